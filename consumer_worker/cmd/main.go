@@ -6,16 +6,23 @@ import (
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/config"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/connect"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/limiters"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/publishers"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/receivers"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/senders"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/stores"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/service"
 	"github.com/wb-go/wbf/rabbitmq"
+	"github.com/wb-go/wbf/redis"
 	"github.com/wb-go/wbf/retry"
 	"github.com/wb-go/wbf/zlog"
 	"log"
+	"maps"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"time"
 )
@@ -54,8 +61,10 @@ func main() {
 		VHost:     cfg.RabbitMQConfig.VHost,
 		QueueName: cfg.RabbitMQConfig.UniversalQueue,
 		Consumer:  cfg.RabbitMQConfig.Consumer,
-		AutoAck:   cfg.RabbitMQConfig.AutoAck,
 		NoWait:    cfg.RabbitMQConfig.NoWait,
+
+		QuarantineQueue: cfg.RabbitMQConfig.QuarantineQueue,
+		Prefetch:        cfg.RabbitMQConfig.Prefetch,
 	}
 
 	rabbitmqRetryStrategy := retry.Strategy{
@@ -64,20 +73,72 @@ func main() {
 		Backoff:  cfg.RabbitMQRetryConfig.Backoff,
 	}
 
-	var rabbitConsumer *rabbitmq.Consumer
-	var rabbitmqChannelToClose *rabbitmq.Channel
-	rabbitConsumer, rabbitmqChannelToClose, err = connect.GetRabbitMQConsumer(
-		rabbitConnectCfg,
-		rabbitmqRetryStrategy,
-	)
+	// 1 consumer per queue of served channels, so a slow channel doesn't block the rest
+	channelQueues, err := connect.ChannelQueues(cfg.RabbitMQConfig)
 	if err != nil {
-		zlog.Logger.Fatal().Err(err).Msg("error creating rabbitmq consumer")
+		zlog.Logger.Fatal().Err(err).Msg("error choosing rabbitmq queues to consume")
+	}
+
+	rabbitmqReceivers := make([]ports.NotificationReceiver, 0, len(channelQueues))
+	for queueName, channelStrings := range channelQueues {
+		queueConnectCfg := rabbitConnectCfg
+		queueConnectCfg.QueueName = queueName
+		queueConnectCfg.RoutingKeys = channelStrings
+
+		rabbitConsumerConfig, rabbitmqChannelToClose, errConsumer := connect.GetRabbitMQConsumer(
+			queueConnectCfg,
+			rabbitmqRetryStrategy,
+		)
+		if errConsumer != nil {
+			zlog.Logger.Fatal().Err(errConsumer).Str("queue", queueName).Msg("error creating rabbitmq consumer")
+		}
+		rabbitmqReceivers = append(rabbitmqReceivers,
+			receivers.NewRabbitMQReceiver(rabbitConsumerConfig, rabbitmqChannelToClose, cfg.RabbitMQConfig.QuarantineQueue, rabbitmqRetryStrategy))
+		zlog.Logger.Info().Str("queue", queueName).Strs("channels", channelStrings).Msg("rabbit connected")
+	}
+
+	// delivery results are optional
+	var resultPublisher ports.DeliveryResultPublisher
+	if cfg.RabbitMQConfig.ResultQueue != "" {
+		var rabbitResultPublisher *rabbitmq.Publisher
+		var rabbitmqResultChannelToClose *rabbitmq.Channel
+		rabbitResultPublisher, rabbitmqResultChannelToClose, err = connect.GetRabbitMQResultPublisher(
+			rabbitConnectCfg,
+			cfg.RabbitMQConfig.ResultQueue,
+			rabbitmqRetryStrategy,
+		)
+		if err != nil {
+			zlog.Logger.Fatal().Err(err).Msg("error creating rabbitmq result publisher")
+		}
+
+		defer func(rabbitmqResultChannelToClose *rabbitmq.Channel) {
+			closeErr := rabbitmqResultChannelToClose.Close()
+			if closeErr != nil {
+				zlog.Logger.Error().Err(closeErr).Msg("error closing rabbitmq result channel")
+			}
+		}(rabbitmqResultChannelToClose)
+
+		resultPublisher = publishers.NewRabbitMQResultPublisher(rabbitResultPublisher, cfg.RabbitMQConfig.ResultQueue, rabbitmqRetryStrategy)
+		zlog.Logger.Info().Str("queue", cfg.RabbitMQConfig.ResultQueue).Msg("rabbit result publisher connected")
 	}
-	zlog.Logger.Info().Msg("rabbit connected")
 	//endregion
 
 	//region service
-	rabbitmqReceiver := receivers.NewRabbitMQReceiver(rabbitConsumer, rabbitmqChannelToClose, rabbitmqRetryStrategy)
+	rabbitmqReceiver := receivers.NewMergedReceiver(rabbitmqReceivers...)
+
+	telegramSender, err := senders.NewTelegramSender(
+		cfg.TelegramConfig.BotToken, cfg.TelegramConfig.APIURL, cfg.TelegramConfig.ParseMode,
+		time.Duration(cfg.TelegramConfig.TimeoutMilliseconds)*time.Millisecond,
+		time.Duration(cfg.TelegramConfig.MaxRetryAfterSeconds)*time.Second,
+		retry.Strategy{
+			Attempts: cfg.TelegramRetryConfig.Attempts,
+			Delay:    time.Duration(cfg.TelegramRetryConfig.DelayMilliseconds) * time.Millisecond,
+			Backoff:  cfg.TelegramRetryConfig.Backoff,
+		},
+	)
+	if err != nil {
+		zlog.Logger.Fatal().Err(err).Msg("error creating telegram sender")
+	}
 
 	channelToSender := map[internaltypes.NotificationChannel]ports.NotificationSender{
 		internaltypes.ChannelConsole: senders.NewConsoleSender(),
@@ -89,10 +150,69 @@ func main() {
 				Backoff:  cfg.EmailRetryConfig.Backoff,
 			},
 		),
-		internaltypes.ChannelTelegram: senders.NewConsoleSender(), // TODO: change
+		internaltypes.ChannelTelegram: telegramSender,
+	}
+	// only served channels are sent, e.g. SMTP credentials aren't needed by a telegram worker
+	if len(cfg.RabbitMQConfig.Channels) > 0 {
+		maps.DeleteFunc(channelToSender, func(channel internaltypes.NotificationChannel, _ ports.NotificationSender) bool {
+			return !slices.Contains(cfg.RabbitMQConfig.Channels, channel.String())
+		})
 	}
 
-	notificationService := service.NewNotificationService(rabbitmqReceiver, channelToSender, time.Duration(50)*time.Millisecond)
+	// received notifications are stored optionally
+	var notificationStore ports.NotificationStore
+	if cfg.StoreConfig.Dir != "" {
+		var walStore *stores.WALStore
+		walStore, err = stores.NewWALStore(cfg.StoreConfig.Dir, cfg.StoreConfig.SnapshotEvery)
+		if err != nil {
+			zlog.Logger.Fatal().Err(err).Str("dir", cfg.StoreConfig.Dir).Msg("error opening notification store")
+		}
+
+		defer func(walStore *stores.WALStore) {
+			closeErr := walStore.Close()
+			if closeErr != nil {
+				zlog.Logger.Error().Err(closeErr).Msg("error closing notification store")
+			}
+		}(walStore)
+
+		notificationStore = walStore
+		zlog.Logger.Info().Str("dir", cfg.StoreConfig.Dir).Msg("notification store opened")
+	}
+
+	sendRetryPolicy := service.RetryPolicy{
+		MaxAttempts: cfg.SendRetryConfig.Attempts,
+		Delay:       time.Duration(cfg.SendRetryConfig.DelayMilliseconds) * time.Millisecond,
+		Backoff:     cfg.SendRetryConfig.Backoff,
+	}
+	channelConfigs := map[internaltypes.NotificationChannel]service.ChannelConfig{
+		internaltypes.ChannelConsole:  channelConfig(cfg.ConcurrencyConfig.Console, cfg.RateLimitConfig.Console, sendRetryPolicy),
+		internaltypes.ChannelEmail:    channelConfig(cfg.ConcurrencyConfig.Email, cfg.RateLimitConfig.Email, sendRetryPolicy),
+		internaltypes.ChannelTelegram: channelConfig(cfg.ConcurrencyConfig.Telegram, cfg.RateLimitConfig.Telegram, sendRetryPolicy),
+	}
+
+	// token buckets are shared by replicas only in redis
+	var rateLimiter ports.RateLimiter = limiters.NewMemoryRateLimiter()
+	if cfg.RateLimitConfig.Backend == config.RateLimitBackendRedis {
+		redisClient := redis.New(cfg.RedisConfig.Addr, cfg.RedisConfig.Password, cfg.RedisConfig.DB)
+		defer func(redisClient *redis.Client) {
+			closeErr := redisClient.Close()
+			if closeErr != nil {
+				zlog.Logger.Error().Err(closeErr).Msg("error closing redis client")
+			}
+		}(redisClient)
+
+		rateLimiter = limiters.NewRedisRateLimiter(redisClient,
+			retry.Strategy{
+				Attempts: cfg.RedisRetryConfig.Attempts,
+				Delay:    time.Duration(cfg.RedisRetryConfig.DelayMilliseconds) * time.Millisecond,
+				Backoff:  cfg.RedisRetryConfig.Backoff,
+			},
+			cfg.RateLimitConfig.RedisKeyPrefix,
+		)
+		zlog.Logger.Info().Str("addr", cfg.RedisConfig.Addr).Msg("redis rate limiter created")
+	}
+
+	notificationService := service.NewNotificationService(rabbitmqReceiver, channelToSender, channelConfigs, rateLimiter, resultPublisher, notificationStore, time.Duration(50)*time.Millisecond)
 
 	wg := &sync.WaitGroup{}
 	wg.Add(1)
@@ -110,8 +230,18 @@ func main() {
 
 	<-ctx.Done()
 
-	// notificationService stops with ctx
+	// notificationService stops with ctx, after in-flight sends
 
 	wg.Wait()
 	zlog.Logger.Info().Msg("shutdown complete")
 }
+
+// channelConfig builds service.ChannelConfig of 1 channel from config sections
+func channelConfig(concurrency int, rateLimit config.ChannelRateLimitConfig, retryPolicy service.RetryPolicy) service.ChannelConfig {
+	return service.ChannelConfig{
+		Concurrency:    concurrency,
+		Limit:          models.RateLimit{Rate: rateLimit.Rate, Burst: rateLimit.Burst},
+		RecipientLimit: models.RateLimit{Rate: rateLimit.RecipientRate, Burst: rateLimit.RecipientBurst},
+		Retry:          retryPolicy,
+	}
+}
@@ -3,6 +3,7 @@ package config
 import (
 	"fmt"
 	"github.com/wb-go/wbf/config"
+	"strings"
 )
 
 // AppConfig is THE whole config struct
@@ -10,8 +11,17 @@ type AppConfig struct {
 	LogConfig           LogConfig           `env-prefix:"LOG_"`
 	RabbitMQConfig      RabbitMQConfig      `env-prefix:"RABBITMQ_"`
 	EmailConfig         EmailConfig         `env-prefix:"EMAIL_"`
+	TelegramConfig      TelegramConfig      `env-prefix:"TELEGRAM_"`
+	StoreConfig         StoreConfig         `env-prefix:"STORE_"`
+	ConcurrencyConfig   ConcurrencyConfig   `env-prefix:"CONCURRENCY_"`
+	RateLimitConfig     RateLimitConfig     `env-prefix:"RATE_LIMIT_"`
+	RedisConfig         RedisConfig         `env-prefix:"REDIS_"`
+	RedisRetryConfig    RetryStrategyConfig `env-prefix:"RETRY_REDIS_"`
 	RabbitMQRetryConfig RetryStrategyConfig `env-prefix:"RETRY_RABBITMQ_"`
 	EmailRetryConfig    RetryStrategyConfig `env-prefix:"RETRY_RABBITMQ_"`
+	TelegramRetryConfig RetryStrategyConfig `env-prefix:"RETRY_TELEGRAM_"`
+	// SendRetryConfig is how transient send failures are requeued after sender's own retries, Attempts include the first one
+	SendRetryConfig RetryStrategyConfig `env-prefix:"RETRY_SEND_"`
 }
 
 // NewAppConfig creates a new struct of "THE config"
@@ -30,6 +40,44 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	cfg.SetDefault("consumer_worker.retry_email.attempts", 3)
 	cfg.SetDefault("consumer_worker.retry_email.delay_milliseconds", 300)
 	cfg.SetDefault("consumer_worker.retry_email.backoff", 1.5)
+
+	cfg.SetDefault("consumer_worker.retry_telegram.attempts", 3)
+	cfg.SetDefault("consumer_worker.retry_telegram.delay_milliseconds", 300)
+	cfg.SetDefault("consumer_worker.retry_telegram.backoff", 1.5)
+
+	cfg.SetDefault("consumer_worker.retry_send.attempts", 5)
+	cfg.SetDefault("consumer_worker.retry_send.delay_milliseconds", 1000)
+	cfg.SetDefault("consumer_worker.retry_send.backoff", 2)
+
+	cfg.SetDefault("consumer_worker.rabbitmq.prefetch", 50)
+
+	cfg.SetDefault("consumer_worker.telegram.api_url", "https://api.telegram.org")
+	cfg.SetDefault("consumer_worker.telegram.timeout_milliseconds", 10000)
+	cfg.SetDefault("consumer_worker.telegram.max_retry_after_seconds", 30)
+
+	cfg.SetDefault("consumer_worker.store.snapshot_every", 1000)
+
+	cfg.SetDefault("consumer_worker.concurrency.email", 4)
+	cfg.SetDefault("consumer_worker.concurrency.telegram", 4)
+	cfg.SetDefault("consumer_worker.concurrency.console", 1)
+
+	cfg.SetDefault("consumer_worker.rate_limit.backend", RateLimitBackendMemory)
+	cfg.SetDefault("consumer_worker.rate_limit.redis_key_prefix", "consumer_worker:rate_limit")
+	for _, channel := range []string{"email", "telegram", "console"} {
+		cfg.SetDefault("consumer_worker.rate_limit."+channel+".burst", 1)
+		cfg.SetDefault("consumer_worker.rate_limit."+channel+".recipient_burst", 1)
+	}
+	// Bot API allows ~30 messages per second overall and ~1 per second to 1 chat
+	cfg.SetDefault("consumer_worker.rate_limit.telegram.rate", 30)
+	cfg.SetDefault("consumer_worker.rate_limit.telegram.burst", 30)
+	cfg.SetDefault("consumer_worker.rate_limit.telegram.recipient_rate", 1)
+
+	cfg.SetDefault("consumer_worker.redis.addr", "localhost:6379")
+	cfg.SetDefault("consumer_worker.redis.db", 0)
+
+	cfg.SetDefault("consumer_worker.retry_redis.attempts", 3)
+	cfg.SetDefault("consumer_worker.retry_redis.delay_milliseconds", 100)
+	cfg.SetDefault("consumer_worker.retry_redis.backoff", 1.5)
 	//endregion
 
 	// region flags
@@ -54,8 +102,13 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	appConfig.RabbitMQConfig.Port = cfg.GetInt("consumer_worker.rabbitmq.port")
 	appConfig.RabbitMQConfig.VHost = cfg.GetString("consumer_worker.rabbitmq.vhost")
 	appConfig.RabbitMQConfig.UniversalQueue = cfg.GetString("consumer_worker.rabbitmq.queue")
-	// appConfig.RabbitMQConfig.QueueForChannel.Telegram = cfg.GetString("consumer_worker.rabbitmq.queue_read.telegram")
-	// appConfig.RabbitMQConfig.QueueForChannel.Console = cfg.GetString("consumer_worker.rabbitmq.queue_read.console")
+	appConfig.RabbitMQConfig.ResultQueue = cfg.GetString("consumer_worker.rabbitmq.result_queue")
+	appConfig.RabbitMQConfig.QuarantineQueue = cfg.GetString("consumer_worker.rabbitmq.quarantine_queue")
+	appConfig.RabbitMQConfig.Prefetch = cfg.GetInt("consumer_worker.rabbitmq.prefetch")
+	appConfig.RabbitMQConfig.QueueForChannel.Email = cfg.GetString("consumer_worker.rabbitmq.queue_read.email")
+	appConfig.RabbitMQConfig.QueueForChannel.Telegram = cfg.GetString("consumer_worker.rabbitmq.queue_read.telegram")
+	appConfig.RabbitMQConfig.QueueForChannel.Console = cfg.GetString("consumer_worker.rabbitmq.queue_read.console")
+	appConfig.RabbitMQConfig.Channels = splitNotEmpty(cfg.GetString("consumer_worker.rabbitmq.channels"), ",")
 
 	// EmailConfig
 	appConfig.EmailConfig.From = cfg.GetString("consumer_worker.email.from")
@@ -63,14 +116,80 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	appConfig.EmailConfig.Port = cfg.GetInt("consumer_worker.email.port")
 	appConfig.EmailConfig.Password = cfg.GetString("consumer_worker.email.password")
 
+	// TelegramConfig
+	appConfig.TelegramConfig.BotToken = cfg.GetString("consumer_worker.telegram.bot_token")
+	appConfig.TelegramConfig.APIURL = cfg.GetString("consumer_worker.telegram.api_url")
+	appConfig.TelegramConfig.ParseMode = cfg.GetString("consumer_worker.telegram.parse_mode")
+	appConfig.TelegramConfig.TimeoutMilliseconds = cfg.GetInt("consumer_worker.telegram.timeout_milliseconds")
+	appConfig.TelegramConfig.MaxRetryAfterSeconds = cfg.GetInt("consumer_worker.telegram.max_retry_after_seconds")
+
+	// StoreConfig
+	appConfig.StoreConfig.Dir = cfg.GetString("consumer_worker.store.dir")
+	appConfig.StoreConfig.SnapshotEvery = cfg.GetInt("consumer_worker.store.snapshot_every")
+
+	// ConcurrencyConfig
+	appConfig.ConcurrencyConfig.Email = cfg.GetInt("consumer_worker.concurrency.email")
+	appConfig.ConcurrencyConfig.Telegram = cfg.GetInt("consumer_worker.concurrency.telegram")
+	appConfig.ConcurrencyConfig.Console = cfg.GetInt("consumer_worker.concurrency.console")
+
+	// RateLimitConfig
+	appConfig.RateLimitConfig.Backend = cfg.GetString("consumer_worker.rate_limit.backend")
+	appConfig.RateLimitConfig.RedisKeyPrefix = cfg.GetString("consumer_worker.rate_limit.redis_key_prefix")
+	appConfig.RateLimitConfig.Email = channelRateLimitConfig(cfg, "consumer_worker.rate_limit.email")
+	appConfig.RateLimitConfig.Telegram = channelRateLimitConfig(cfg, "consumer_worker.rate_limit.telegram")
+	appConfig.RateLimitConfig.Console = channelRateLimitConfig(cfg, "consumer_worker.rate_limit.console")
+
+	// RedisConfig
+	appConfig.RedisConfig.Addr = cfg.GetString("consumer_worker.redis.addr")
+	appConfig.RedisConfig.Password = cfg.GetString("consumer_worker.redis.password")
+	appConfig.RedisConfig.DB = cfg.GetInt("consumer_worker.redis.db")
+
 	// Retries
 	appConfig.RabbitMQRetryConfig.Attempts = cfg.GetInt("consumer_worker.retry_rabbitmq.attempts")
 	appConfig.RabbitMQRetryConfig.DelayMilliseconds = cfg.GetInt("consumer_worker.retry_rabbitmq.delay_milliseconds")
 	appConfig.RabbitMQRetryConfig.Backoff = cfg.GetFloat64("consumer_worker.retry_rabbitmq.backoff")
 
+	appConfig.RedisRetryConfig.Attempts = cfg.GetInt("consumer_worker.retry_redis.attempts")
+	appConfig.RedisRetryConfig.DelayMilliseconds = cfg.GetInt("consumer_worker.retry_redis.delay_milliseconds")
+	appConfig.RedisRetryConfig.Backoff = cfg.GetFloat64("consumer_worker.retry_redis.backoff")
+
 	appConfig.EmailRetryConfig.Attempts = cfg.GetInt("consumer_worker.retry_email.attempts")
 	appConfig.EmailRetryConfig.DelayMilliseconds = cfg.GetInt("consumer_worker.retry_email.delay_milliseconds")
 	appConfig.RabbitMQRetryConfig.Backoff = cfg.GetFloat64("consumer_worker.retry_email.backoff")
 
+	appConfig.TelegramRetryConfig.Attempts = cfg.GetInt("consumer_worker.retry_telegram.attempts")
+	appConfig.TelegramRetryConfig.DelayMilliseconds = cfg.GetInt("consumer_worker.retry_telegram.delay_milliseconds")
+	appConfig.TelegramRetryConfig.Backoff = cfg.GetFloat64("consumer_worker.retry_telegram.backoff")
+
+	appConfig.SendRetryConfig.Attempts = cfg.GetInt("consumer_worker.retry_send.attempts")
+	appConfig.SendRetryConfig.DelayMilliseconds = cfg.GetInt("consumer_worker.retry_send.delay_milliseconds")
+	appConfig.SendRetryConfig.Backoff = cfg.GetFloat64("consumer_worker.retry_send.backoff")
+
+	if backend := appConfig.RateLimitConfig.Backend; backend != RateLimitBackendMemory && backend != RateLimitBackendRedis {
+		return appConfig, fmt.Errorf("invalid rate limit backend '%s': possible ones are: '%s', '%s'",
+			backend, RateLimitBackendMemory, RateLimitBackendRedis)
+	}
+
 	return appConfig, nil
 }
+
+// channelRateLimitConfig reads ChannelRateLimitConfig under given key
+func channelRateLimitConfig(cfg *config.Config, key string) ChannelRateLimitConfig {
+	return ChannelRateLimitConfig{
+		Rate:           cfg.GetFloat64(key + ".rate"),
+		Burst:          cfg.GetInt(key + ".burst"),
+		RecipientRate:  cfg.GetFloat64(key + ".recipient_rate"),
+		RecipientBurst: cfg.GetInt(key + ".recipient_burst"),
+	}
+}
+
+// splitNotEmpty splits s by sep and drops empty parts, so empty s is an empty slice
+func splitNotEmpty(s, sep string) []string {
+	parts := make([]string, 0)
+	for _, part := range strings.Split(s, sep) {
+		if part = strings.TrimSpace(part); part != "" {
+			parts = append(parts, part)
+		}
+	}
+	return parts
+}
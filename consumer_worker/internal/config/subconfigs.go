@@ -23,10 +23,22 @@ type RabbitMQConfig struct {
 	Port     int    `env:"PORT"`
 	VHost    string `env:"VHOST"`
 
+	// UniversalQueue is the queue of channels that don't have their own one in QueueForChannel
 	UniversalQueue string `env:"QUEUE"`
-	// QueueForChannel QueueRead `env:"QUEUE_"`
+	// QueueForChannel are queues of channels, empty ones are UniversalQueue. Must be the same as producer's ones
+	QueueForChannel QueueRead `env-prefix:"QUEUE_READ_"`
+	// Channels are the ones this worker sends, empty = all. Queues of others aren't consumed
+	Channels []string `env:"CHANNELS" envSeparator:","`
+	// ResultQueue is where delivery results are reported, empty = don't report
+	ResultQueue string `env:"RESULT_QUEUE"`
+	// QuarantineQueue is where malformed messages and the ones out of send attempts are moved to, empty = they're dropped
+	QuarantineQueue string `env:"QUARANTINE_QUEUE"`
+	// Prefetch is the max amount of unsettled messages of 1 queue given to this worker, < 1 = unlimited
+	Prefetch int `env:"PREFETCH" envDefault:"50"`
+
+	// messages are always acknowledged manually after the send, so there's no AUTO_ACK
+
 	Consumer string `env:"CONSUMER"`
-	AutoAck  bool   `env:"AUTO_ACK" envDefault:"false"`
 	NoWait   bool   `env:"NO_WAIT" envDefault:"false"`
 }
 
@@ -37,6 +49,52 @@ type QueueRead struct {
 	Console  string `env:"CONSOLE"`
 }
 
+// ConcurrencyConfig is the amount of notifications of every channel sent at once
+//
+// channels are sent by separate pools, so a slow one doesn't delay the others
+type ConcurrencyConfig struct {
+	Email    int `env:"EMAIL" envDefault:"4"`
+	Telegram int `env:"TELEGRAM" envDefault:"4"`
+	Console  int `env:"CONSOLE" envDefault:"1"`
+}
+
+// RateLimitConfig is the config of send rate limits of every channel (token buckets)
+type RateLimitConfig struct {
+	// Backend keeps token buckets: RateLimitBackendMemory (per replica) or RateLimitBackendRedis (shared by replicas)
+	Backend string `env:"BACKEND" envDefault:"memory"`
+	// RedisKeyPrefix prefixes buckets of RateLimitBackendRedis
+	RedisKeyPrefix string `env:"REDIS_KEY_PREFIX" envDefault:"consumer_worker:rate_limit"`
+
+	Email    ChannelRateLimitConfig `env-prefix:"EMAIL_"`
+	Telegram ChannelRateLimitConfig `env-prefix:"TELEGRAM_"`
+	Console  ChannelRateLimitConfig `env-prefix:"CONSOLE_"`
+}
+
+const (
+	// RateLimitBackendMemory keeps token buckets in memory, every replica has its own ones
+	RateLimitBackendMemory = "memory"
+	// RateLimitBackendRedis keeps token buckets in redis, replicas share them
+	RateLimitBackendRedis = "redis"
+)
+
+// ChannelRateLimitConfig is the rate limit of 1 channel and of every its recipient, rate 0 = unlimited
+type ChannelRateLimitConfig struct {
+	// Rate is sends per second of the whole channel
+	Rate  float64 `env:"RATE" envDefault:"0"`
+	Burst int     `env:"BURST" envDefault:"1"`
+
+	// RecipientRate is sends per second to 1 recipient (SendTo)
+	RecipientRate  float64 `env:"RECIPIENT_RATE" envDefault:"0"`
+	RecipientBurst int     `env:"RECIPIENT_BURST" envDefault:"1"`
+}
+
+// RedisConfig is the redis connection config struct
+type RedisConfig struct {
+	Addr     string `env:"ADDR" envDefault:"localhost:6379"`
+	Password string `env:"PASSWORD" envDefault:""`
+	DB       int    `env:"DB" envDefault:"0"`
+}
+
 // RetryStrategyConfig is the retry strategy config struct
 //
 // specifies how retry operations will be handled
@@ -55,3 +113,24 @@ type EmailConfig struct {
 	Port     int    `env:"PORT"`
 	Password string `env:"PASSWORD"`
 }
+
+// TelegramConfig is the config for Telegram Bot API
+type TelegramConfig struct {
+	BotToken string `env:"BOT_TOKEN"`
+	// APIURL is the Bot API base URL, e.g. a local Bot API server
+	APIURL string `env:"API_URL" envDefault:"https://api.telegram.org"`
+	// ParseMode is "", "HTML", "MarkdownV2" or "Markdown"
+	ParseMode           string `env:"PARSE_MODE" envDefault:""`
+	TimeoutMilliseconds int    `env:"TIMEOUT_MILLISECONDS" envDefault:"10000"`
+	// MaxRetryAfterSeconds is the longest 429 retry_after waited before resend, longer ones fail the send
+	// and the retry waits for retry_after
+	MaxRetryAfterSeconds int `env:"MAX_RETRY_AFTER_SECONDS" envDefault:"30"`
+}
+
+// StoreConfig is the config for durable storage of received notifications
+type StoreConfig struct {
+	// Dir is the local directory of WAL and snapshot, empty = notifications are kept in memory only
+	Dir string `env:"DIR"`
+	// SnapshotEvery is the amount of WAL records after which the snapshot is written
+	SnapshotEvery int `env:"SNAPSHOT_EVERY" envDefault:"1000"`
+}
@@ -2,10 +2,12 @@ package connect
 
 import (
 	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/config"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
 	"github.com/rabbitmq/amqp091-go"
 	"github.com/wb-go/wbf/rabbitmq"
 	"github.com/wb-go/wbf/retry"
+	"slices"
 )
 
 // RabbitMQConsumerConfig is the options struct for GetRabbitMQConsumer
@@ -20,19 +22,26 @@ type RabbitMQConsumerConfig struct {
 	VHost    string
 
 	QueueName string
-	Consumer  string
-	AutoAck   bool
-	NoWait    bool
+	// RoutingKeys are channels bound to QueueName, empty = all
+	RoutingKeys []string
+	// QuarantineQueue receives malformed messages of QueueName, empty = they're dropped
+	QuarantineQueue string
+	// Prefetch is the max amount of unsettled messages given to the consumer, < 1 = unlimited
+	Prefetch int
+	Consumer string
+	NoWait   bool
 }
 
 // GetRabbitMQConsumer simplifies complex rabbitMQ connection process!
 //
+// messages are acknowledged manually, so consumer config never has AutoAck
+//
 // returns:
 //
-//	consumer
-//	channel to close
+//	consumer config
+//	channel to consume from and close
 //	error
-func GetRabbitMQConsumer(rabbitCfg RabbitMQConsumerConfig, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.Consumer, *rabbitmq.Channel, error) {
+func GetRabbitMQConsumer(rabbitCfg RabbitMQConsumerConfig, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.ConsumerConfig, *rabbitmq.Channel, error) {
 	// step 1. init connect
 	rabbitMQConn, err := rabbitmq.Connect(
 		fmt.Sprintf("amqp://%s:%s@%s:%d/%s",
@@ -53,6 +62,14 @@ func GetRabbitMQConsumer(rabbitCfg RabbitMQConsumerConfig, rabbitmqRetryStrategy
 		return nil, nil, fmt.Errorf("error connecting to rabbitmq (conn.Channel()): %w", err)
 	}
 
+	// step 2.1. limit unsettled messages, they're held until sent
+	if rabbitCfg.Prefetch > 0 {
+		err = rabbitMQChannel.Qos(rabbitCfg.Prefetch, 0, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error setting rabbitmq prefetch to %d: %w", rabbitCfg.Prefetch, err)
+		}
+	}
+
 	// step 3. bind channel to exchange with type direct
 	rabbitMQExchange := rabbitmq.NewExchange(rabbitCfg.Exchange, "direct")
 	err = rabbitMQExchange.BindToChannel(rabbitMQChannel)
@@ -65,11 +82,16 @@ func GetRabbitMQConsumer(rabbitCfg RabbitMQConsumerConfig, rabbitmqRetryStrategy
 	rabbitMQQueueManager := rabbitmq.NewQueueManager(rabbitMQChannel)
 
 	// bind to the queue by using channel names as routing keys!
+	routingKeys := rabbitCfg.RoutingKeys
+	if len(routingKeys) == 0 {
+		routingKeys = internaltypes.ChannelAllStrings
+	}
+
 	err = retry.Do(
 		func() error {
 			q, errQueue := rabbitMQQueueManager.DeclareQueue(rabbitCfg.QueueName)
 			if errQueue == nil {
-				for _, channelString := range internaltypes.ChannelAllStrings {
+				for _, channelString := range routingKeys {
 					errQueue = rabbitMQChannel.QueueBind(q.Name, channelString, rabbitMQExchange.Name(), rabbitCfg.NoWait, make(amqp091.Table))
 					if errQueue != nil {
 						break
@@ -85,9 +107,127 @@ func GetRabbitMQConsumer(rabbitCfg RabbitMQConsumerConfig, rabbitmqRetryStrategy
 		return nil, nil, fmt.Errorf("error declaring queue '%s': %w", rabbitCfg.QueueName, err)
 	}
 
-	// final step. create consumer
-	rabbitmqPublisher := rabbitmq.NewConsumer(
-		rabbitMQChannel,
-		rabbitmq.NewConsumerConfig(rabbitCfg.QueueName))
+	// step 5. declare quarantine queue, it's filled through the default exchange
+	if rabbitCfg.QuarantineQueue != "" {
+		err = retry.Do(
+			func() error {
+				_, errQueue := rabbitMQQueueManager.DeclareQueue(rabbitCfg.QuarantineQueue)
+				return errQueue
+			},
+			rabbitmqRetryStrategy,
+		)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error declaring quarantine queue '%s': %w", rabbitCfg.QuarantineQueue, err)
+		}
+	}
+
+	// final step. create consumer config
+	consumerConfig := rabbitmq.NewConsumerConfig(rabbitCfg.QueueName)
+	consumerConfig.Consumer = rabbitCfg.Consumer
+	consumerConfig.NoWait = rabbitCfg.NoWait
+	return consumerConfig, rabbitMQChannel, nil
+}
+
+// ChannelQueues returns channels to bind to every queue this worker consumes: own queues of served channels
+// or UniversalQueue
+//
+// a queue shared with a channel that isn't served is an error: its messages would be consumed and dropped
+func ChannelQueues(rabbitCfg config.RabbitMQConfig) (map[string][]string, error) {
+	served := rabbitCfg.Channels
+	if len(served) == 0 {
+		served = internaltypes.ChannelAllStrings
+	}
+	for _, channelString := range served {
+		if !slices.Contains(internaltypes.ChannelAllStrings, channelString) {
+			return nil, fmt.Errorf("%w: '%s'", internaltypes.ErrInvalidNotificationChannelValue, channelString)
+		}
+	}
+
+	queues := make(map[string][]string)
+	for _, channelString := range internaltypes.ChannelAllStrings {
+		queueName := queueOf(rabbitCfg, channelString)
+		queues[queueName] = append(queues[queueName], channelString)
+	}
+
+	result := make(map[string][]string)
+	for _, channelString := range served {
+		queueName := queueOf(rabbitCfg, channelString)
+		if _, found := result[queueName]; found {
+			continue
+		}
+		for _, sharedWith := range queues[queueName] {
+			if !slices.Contains(served, sharedWith) {
+				return nil, fmt.Errorf("queue '%s' of channel '%s' is shared with channel '%s' that isn't served, give them own queues",
+					queueName, channelString, sharedWith)
+			}
+		}
+		result[queueName] = queues[queueName]
+	}
+	return result, nil
+}
+
+// queueOf returns the queue of channelString, UniversalQueue if it doesn't have its own one
+func queueOf(rabbitCfg config.RabbitMQConfig, channelString string) string {
+	var queueName string
+	switch channelString {
+	case internaltypes.EMAIL:
+		queueName = rabbitCfg.QueueForChannel.Email
+	case internaltypes.TELEGRAM:
+		queueName = rabbitCfg.QueueForChannel.Telegram
+	case internaltypes.CONSOLE:
+		queueName = rabbitCfg.QueueForChannel.Console
+	}
+	if queueName == "" {
+		return rabbitCfg.UniversalQueue
+	}
+	return queueName
+}
+
+// GetRabbitMQResultPublisher connects to rabbitMQ and declares the result queue
+//
+// publisher uses the default exchange, so routing key = queue name
+//
+// returns:
+//
+//	publisher
+//	channel to close
+//	error
+func GetRabbitMQResultPublisher(rabbitCfg RabbitMQConsumerConfig, resultQueue string, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.Publisher, *rabbitmq.Channel, error) {
+	// step 1. init connect
+	rabbitMQConn, err := rabbitmq.Connect(
+		fmt.Sprintf("amqp://%s:%s@%s:%d/%s",
+			rabbitCfg.User,
+			rabbitCfg.Password,
+			rabbitCfg.Host,
+			rabbitCfg.Port,
+			rabbitCfg.VHost,
+		), rabbitmqRetryStrategy.Attempts, rabbitmqRetryStrategy.Delay)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to rabbitmq: %w", err)
+	}
+
+	// step 2. get channel to publish
+	var rabbitMQChannel *rabbitmq.Channel
+	rabbitMQChannel, err = rabbitMQConn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to rabbitmq (conn.Channel()): %w", err)
+	}
+
+	// step 3. declare result queue (at least try)
+	rabbitMQQueueManager := rabbitmq.NewQueueManager(rabbitMQChannel)
+
+	err = retry.Do(
+		func() error {
+			_, errQueue := rabbitMQQueueManager.DeclareQueue(resultQueue)
+			return errQueue
+		},
+		rabbitmqRetryStrategy,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error declaring queue '%s': %w", resultQueue, err)
+	}
+
+	// final step. create publisher with default exchange
+	rabbitmqPublisher := rabbitmq.NewPublisher(rabbitMQChannel, "")
 	return rabbitmqPublisher, rabbitMQChannel, nil
 }
@@ -0,0 +1,36 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"time"
+)
+
+// DeliveryResultBody is the DTO for reporting delivery result to MQ
+type DeliveryResultBody struct {
+	ID        string `json:"id"`
+	Channel   string `json:"channel"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+	Attempt   int    `json:"attempt"`
+	Timestamp string `json:"timestamp"`
+}
+
+// DeliveryResultBodyFromEntity creates a ready-to-send []byte body from given object
+//
+// timestamp is RFC 3339 with nanoseconds so that producer can order results
+func DeliveryResultBodyFromEntity(object *models.DeliveryResult) ([]byte, error) {
+	result, err := json.Marshal(&DeliveryResultBody{
+		ID:        object.ID.String(),
+		Channel:   object.Channel.String(),
+		Outcome:   object.Outcome,
+		Error:     object.Error.String(),
+		Attempt:   object.Attempt,
+		Timestamp: object.Timestamp.Value().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("could not marshal DeliveryResultBody: %w", err)
+	}
+	return result, nil
+}
@@ -5,6 +5,7 @@ import (
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
 )
 
 // NotificationSendBody is the DTO for sending to MQ
@@ -14,6 +15,16 @@ type NotificationSendBody struct {
 	PublicationAt string                  `json:"publication_at"`
 	Channel       string                  `json:"channel"`
 	SendTo        string                  `json:"send_to,omitempty"`
+
+	// Template is rendered here, content is empty then
+	Template *notificationSendTemplate `json:"template,omitempty"`
+}
+
+type notificationSendTemplate struct {
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Message   string         `json:"message"`
+	Variables map[string]any `json:"variables"`
 }
 
 type notificationBodyContent struct {
@@ -43,6 +54,15 @@ func NotificationModelFromSendDTO(dto *NotificationSendBody) (*models.Notificati
 		return nil, fmt.Errorf("invalid send_to: %w", err)
 	}
 
+	var template *models.NotificationTemplate
+	if dto.Template != nil {
+		template = &models.NotificationTemplate{
+			Title:     types.NewAnyText(dto.Template.Title),
+			Message:   types.NewAnyText(dto.Template.Message),
+			Variables: dto.Template.Variables,
+		}
+	}
+
 	return &models.Notification{
 		PublicationAt: publicationAt,
 		ID:            &id,
@@ -51,7 +71,34 @@ func NotificationModelFromSendDTO(dto *NotificationSendBody) (*models.Notificati
 			Title:   types.NewAnyText(dto.Content.Title),
 			Message: types.NewAnyText(dto.Content.Message),
 		},
-		Sent:   true,
-		SendTo: sendTo,
+		Sent:     true,
+		SendTo:   sendTo,
+		Template: template,
 	}, nil
 }
+
+// NotificationSendBodyFromEntity serializes *models.Notification back into the DTO, reverse of NotificationModelFromSendDTO
+//
+// used to store received notifications, so rendered content isn't kept: it's rendered again from Template
+func NotificationSendBodyFromEntity(model *models.Notification) *NotificationSendBody {
+	var template *notificationSendTemplate
+	if model.Template != nil {
+		template = &notificationSendTemplate{
+			Title:     model.Template.Title.String(),
+			Message:   model.Template.Message.String(),
+			Variables: model.Template.Variables,
+		}
+	}
+
+	return &NotificationSendBody{
+		Content: notificationBodyContent{
+			Title:   model.Content.Title.String(),
+			Message: model.Content.Message.String(),
+		},
+		ID:            model.ID.String(),
+		PublicationAt: model.PublicationAt.Value().UTC().Format(time.RFC3339Nano),
+		Channel:       model.Channel.String(),
+		SendTo:        model.SendTo.String(),
+		Template:      template,
+	}
+}
@@ -2,6 +2,7 @@ package internaltypes
 
 import (
 	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/templating"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"net/mail"
 	"strconv"
@@ -56,6 +57,14 @@ func (c *NotificationChannel) String() string {
 	return c.val.String()
 }
 
+// TemplateKind tells which engine renders template messages for this channel: emails are HTML, the rest is plain text
+func (c *NotificationChannel) TemplateKind() templating.Kind {
+	if c.val == EMAIL {
+		return templating.KindHTML
+	}
+	return templating.KindText
+}
+
 // SendTo is a value type that stores an address of user according to notification channel
 //
 //	email	-> some@email.com
@@ -0,0 +1,43 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTerminal marks send errors that won't go away on retry, e.g. unknown channel or broken template
+//
+// wrap it: fmt.Errorf("%w: ...", models.ErrTerminal), other errors are considered transient
+var ErrTerminal = errors.New("terminal send failure")
+
+// RetryAfter is a transient send error that tells how long to wait before the retry, e.g. the rate limit of a channel
+//
+// the retry isn't made before Wait even if the retry delay is shorter
+type RetryAfter struct {
+	Wait time.Duration
+	Err  error
+}
+
+func (e *RetryAfter) Error() string {
+	return fmt.Sprintf("retry after %s: %v", e.Wait, e.Err)
+}
+
+func (e *RetryAfter) Unwrap() error {
+	return e.Err
+}
+
+// ErrAttemptsExhausted occurs when message is delivered again after its last send attempt, e.g. it crashed every worker
+var ErrAttemptsExhausted = errors.New("send attempts are exhausted")
+
+// Delivery is the broker handle of a received Notification, it's settled after the send outcome is known
+type Delivery interface {
+	// Ack removes message from broker for good: it's sent or can't be sent ever
+	Ack() error
+	// Nack returns message into its queue after a transient failure, broker delivers it again
+	Nack() error
+	// Quarantine moves message aside for good, e.g. into a quarantine queue: its send attempts are exhausted
+	Quarantine(reason error) error
+	// Attempt is the number of this delivery of message, starting from 1
+	Attempt() int
+}
@@ -0,0 +1,28 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+const (
+	// OutcomeDelivered is the outcome of a successful send
+	OutcomeDelivered = "delivered"
+	// OutcomeFailed is the outcome of a failed send
+	OutcomeFailed = "failed"
+)
+
+// DeliveryResult is what worker reports back to producer after trying to send a notification
+type DeliveryResult struct {
+	ID      *types.UUID
+	Channel internaltypes.NotificationChannel
+
+	// Outcome is either OutcomeDelivered or OutcomeFailed
+	Outcome string
+	// Error is empty on success
+	Error types.AnyText
+	// Attempt is the number of this send attempt, starting from 1
+	Attempt int
+
+	Timestamp types.DateTime
+}
@@ -1,8 +1,11 @@
 package models
 
 import (
+	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/templating"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
 )
 
 // Notification is the main model - it's saved in DB, cached and DTOs are converted to it
@@ -15,10 +18,83 @@ type Notification struct {
 
 	// is an email, telegram user id or empty
 	SendTo internaltypes.SendTo
+
+	// Template is set if Content must be rendered before sending, see Render
+	Template *NotificationTemplate
+
+	// Delivery is set by receivers that must be told the send outcome, nil = nothing to settle
+	Delivery Delivery
+
+	// DeferredUntil is set when send is postponed after PublicationAt, e.g. by a rate limit. Zero = not deferred
+	DeferredUntil types.DateTime
+
+	// Requeues is the amount of attempts made before message was nacked and delivered again, 0 = none.
+	// It counts attempts when Delivery can't, e.g. classic queues only tell if message is redelivered
+	Requeues int
+
+	// SentParts is the amount of parts sent before a failure by senders that split notification into several messages,
+	// the retry resumes from the next one
+	SentParts int
+}
+
+// DueAt returns when notification must be sent: PublicationAt or DeferredUntil if it's later
+func (n *Notification) DueAt() time.Time {
+	if deferredUntil := n.DeferredUntil.Value(); deferredUntil.After(n.PublicationAt.Value()) {
+		return deferredUntil
+	}
+	return n.PublicationAt.Value()
+}
+
+// Attempt returns the number of current send attempt, starting from 1: the one told by Delivery or after Requeues
+func (n *Notification) Attempt() int {
+	attempt := 1
+	if n.Delivery != nil {
+		attempt = max(n.Delivery.Attempt(), 1)
+	}
+	return max(attempt, n.Requeues+1)
 }
 
 // NotificationContent is the universal struct for content: notification has a title and a message
 type NotificationContent struct {
 	Title   types.AnyText
 	Message types.AnyText
+
+	// HTML tells if Message is HTML (rendered with html/template)
+	HTML bool
+}
+
+// NotificationTemplate is the template source and variables to render Content with
+type NotificationTemplate struct {
+	Title     types.AnyText
+	Message   types.AnyText
+	Variables map[string]any
+}
+
+// Render fills Content from Template, does nothing if there's no template
+//
+// title is always plain text, message engine depends on channel
+func (n *Notification) Render() error {
+	if n.Template == nil {
+		return nil
+	}
+
+	title, err := templating.Render(templating.KindText, n.Template.Title.String(), n.Template.Variables)
+	if err != nil {
+		return fmt.Errorf("title: %w", err)
+	}
+
+	kind := n.Channel.TemplateKind()
+
+	var message string
+	message, err = templating.Render(kind, n.Template.Message.String(), n.Template.Variables)
+	if err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+
+	n.Content = NotificationContent{
+		Title:   types.NewAnyText(title),
+		Message: types.NewAnyText(message),
+		HTML:    kind == templating.KindHTML,
+	}
+	return nil
 }
@@ -0,0 +1,25 @@
+package models
+
+// RateLimit is a token bucket: Rate tokens per second are added up to Burst, 1 send takes 1 token
+//
+// Rate <= 0 means unlimited, Burst < 1 means 1
+type RateLimit struct {
+	Rate  float64
+	Burst int
+}
+
+// Unlimited tells if there's no limit at all
+func (l RateLimit) Unlimited() bool {
+	return l.Rate <= 0
+}
+
+// Capacity returns Burst, at least 1
+func (l RateLimit) Capacity() int {
+	return max(l.Burst, 1)
+}
+
+// RateLimitBucket is 1 named token bucket, e.g. of a channel or of a recipient
+type RateLimitBucket struct {
+	Key   string
+	Limit RateLimit
+}
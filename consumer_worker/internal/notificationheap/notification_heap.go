@@ -2,14 +2,11 @@ package notificationheap
 
 import (
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
-	"time"
 )
 
 // NotificationHeap is a slice for sorting incoming notifications
 //
-// Sorts by PublicationAt (Desc)
-//
-// { late, ...,  early }
+// Sorts by DueAt (Asc): the earliest one is the root
 //
 // Implements heap.Interface
 type NotificationHeap []*models.Notification
@@ -19,13 +16,11 @@ type NotificationHeap []*models.Notification
 // required by heap.Interface
 func (h *NotificationHeap) Len() int { return len(*h) }
 
-// Less returns if i < j
+// Less returns if i must be published before j
 //
 // required by heap.Interface
 func (h *NotificationHeap) Less(i, j int) bool {
-	timeI, _ := time.Parse(time.RFC3339, (*h)[i].PublicationAt.String())
-	timeJ, _ := time.Parse(time.RFC3339, (*h)[j].PublicationAt.String())
-	return timeI.After(timeJ)
+	return (*h)[i].DueAt().Before((*h)[j].DueAt())
 }
 
 // Swap 2 elements by indices
@@ -40,7 +35,7 @@ func (h *NotificationHeap) Push(x interface{}) {
 	*h = append(*h, x.(*models.Notification))
 }
 
-// Pop removes the element with earliest PublicationAt and returns it
+// Pop removes the last element and returns it, heap.Pop moves the root there before calling it
 //
 // Simple slices the slice without allocating a new one
 // because space been once occupied is supposed to be filled and freed regularly
@@ -54,13 +49,12 @@ func (h *NotificationHeap) Pop() any {
 	return x
 }
 
-// Peek returns (not pops) the element to be popped
+// Peek returns (not pops) the element to be popped by heap.Pop: the root
 //
 // returns nil if Len = 0
 func (h *NotificationHeap) Peek() *models.Notification {
 	if h.Len() == 0 {
 		return nil
 	}
-	n := len(*h)
-	return (*h)[n-1]
+	return (*h)[0]
 }
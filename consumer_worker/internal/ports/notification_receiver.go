@@ -3,6 +3,8 @@ package ports
 import (
 	"context"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
 )
 
 // NotificationReceiver is the port for Notification receiver
@@ -26,3 +28,35 @@ type NotificationSender interface {
 	// Send sends a message to whatever the Implementation is created for
 	Send(ctx context.Context, notification *models.Notification) error
 }
+
+// DeliveryResultPublisher is the port for reporting delivery results back to producer
+//
+// Used in the service after every send attempt
+type DeliveryResultPublisher interface {
+	// Publish sends 1 result
+	Publish(ctx context.Context, result *models.DeliveryResult) error
+}
+
+// NotificationStore is the port for durable storage of received notifications that aren't sent yet
+//
+// Used in the service to survive restarts: saved on receive, removed once settled, loaded on start
+type NotificationStore interface {
+	// Save stores 1 notification, saving the same ID again overwrites it
+	Save(ctx context.Context, notification *models.Notification) error
+
+	// Remove deletes notification by ID, missing ones are ignored
+	Remove(ctx context.Context, id types.UUID) error
+
+	// Load returns every stored notification
+	Load(ctx context.Context) ([]*models.Notification, error)
+}
+
+// RateLimiter is the port for token buckets of sends, see models.RateLimit
+//
+// Used in the service before every send
+type RateLimiter interface {
+	// Take takes 1 token from every bucket or from none of them
+	//
+	// returns 0 if tokens are taken, otherwise how long to wait until every bucket has one
+	Take(ctx context.Context, buckets ...models.RateLimitBucket) (time.Duration, error)
+}
@@ -0,0 +1,108 @@
+package limiters
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"math"
+	"sync"
+	"time"
+)
+
+// pruneEvery is the amount of Take calls after which full (idle) buckets are forgotten
+const pruneEvery = 1000
+
+// MemoryRateLimiter is the ports.RateLimiter Repository that keeps token buckets in memory of 1 replica
+type MemoryRateLimiter struct {
+	mu      sync.Mutex
+	buckets map[string]*tokenBucket
+	takes   int
+
+	// now is time.Now, replaced in tests
+	now func() time.Time
+}
+
+// tokenBucket is the state of 1 bucket, tokens are added lazily since updatedAt
+type tokenBucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     models.RateLimit
+}
+
+// NewMemoryRateLimiter creates a new MemoryRateLimiter, every bucket starts full
+func NewMemoryRateLimiter() *MemoryRateLimiter {
+	return NewMemoryRateLimiterWithClock(time.Now)
+}
+
+// NewMemoryRateLimiterWithClock creates a new MemoryRateLimiter with given clock instead of time.Now
+func NewMemoryRateLimiterWithClock(now func() time.Time) *MemoryRateLimiter {
+	return &MemoryRateLimiter{
+		buckets: make(map[string]*tokenBucket),
+		now:     now,
+	}
+}
+
+// Take takes 1 token from every limited bucket or from none of them
+func (l *MemoryRateLimiter) Take(_ context.Context, buckets ...models.RateLimitBucket) (time.Duration, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.prune(now)
+
+	// step 1. refill and find out the longest wait
+	var wait time.Duration
+	refilled := make([]*tokenBucket, 0, len(buckets))
+	for _, bucket := range buckets {
+		if bucket.Limit.Unlimited() {
+			continue
+		}
+
+		state, found := l.buckets[bucket.Key]
+		if !found {
+			state = &tokenBucket{tokens: float64(bucket.Limit.Capacity()), updatedAt: now}
+			l.buckets[bucket.Key] = state
+		}
+		state.refill(now, bucket.Limit)
+		refilled = append(refilled, state)
+
+		if state.tokens < 1 {
+			wait = max(wait, time.Duration(math.Ceil((1-state.tokens)/bucket.Limit.Rate*float64(time.Second))))
+		}
+	}
+
+	if wait > 0 {
+		return wait, nil
+	}
+
+	// step 2. every bucket has a token, take them
+	for _, state := range refilled {
+		state.tokens--
+	}
+	return 0, nil
+}
+
+// refill adds tokens for the time passed since updatedAt
+func (b *tokenBucket) refill(now time.Time, limit models.RateLimit) {
+	if elapsed := now.Sub(b.updatedAt); elapsed > 0 {
+		b.tokens += elapsed.Seconds() * limit.Rate
+	}
+	b.tokens = min(b.tokens, float64(limit.Capacity()))
+	b.updatedAt = now
+	b.limit = limit
+}
+
+// prune forgets buckets that would be full by now every pruneEvery calls, so that recipients don't pile up
+func (l *MemoryRateLimiter) prune(now time.Time) {
+	l.takes++
+	if l.takes < pruneEvery {
+		return
+	}
+	l.takes = 0
+
+	for key, state := range l.buckets {
+		missing := float64(state.limit.Capacity()) - state.tokens
+		if now.Sub(state.updatedAt).Seconds()*state.limit.Rate >= missing {
+			delete(l.buckets, key)
+		}
+	}
+}
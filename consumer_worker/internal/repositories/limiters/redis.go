@@ -0,0 +1,99 @@
+package limiters
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/retry"
+	"strconv"
+	"time"
+)
+
+// takeScript takes 1 token from every bucket or from none of them, so that replicas share the buckets
+//
+// redis clock is used, replicas' ones may differ. Missing bucket is full, idle ones expire once they'd be full
+//
+//	KEYS: buckets
+//	ARGV: rate (tokens per second) and burst of every bucket, in KEYS order
+//
+// returns 0 if tokens are taken, otherwise milliseconds to wait
+var takeScript = goredis.NewScript(`
+local time = redis.call('TIME')
+local now = tonumber(time[1]) * 1000 + math.floor(tonumber(time[2]) / 1000)
+
+local wait = 0
+local tokens = {}
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	local state = redis.call('HMGET', key, 'tokens', 'updated_at')
+	local left = tonumber(state[1]) or burst
+	local updatedAt = tonumber(state[2]) or now
+	left = math.min(burst, left + math.max(0, now - updatedAt) * rate / 1000)
+	if left < 1 then
+		wait = math.max(wait, math.ceil((1 - left) * 1000 / rate))
+	end
+	tokens[i] = left
+end
+
+if wait > 0 then
+	return wait
+end
+
+for i, key in ipairs(KEYS) do
+	local rate = tonumber(ARGV[2 * i - 1])
+	local burst = tonumber(ARGV[2 * i])
+	redis.call('HSET', key, 'tokens', tostring(tokens[i] - 1), 'updated_at', tostring(now))
+	redis.call('PEXPIRE', key, math.ceil(burst * 1000 / rate) + 1000)
+end
+return 0
+`)
+
+// RedisRateLimiter is the ports.RateLimiter Repository that keeps token buckets in redis, shared by every replica
+//
+// every bucket is a hash "<keyPrefix>:<bucket key>"
+type RedisRateLimiter struct {
+	redisClient   *redis.Client
+	retryStrategy retry.Strategy
+	keyPrefix     string
+}
+
+// NewRedisRateLimiter creates a new RedisRateLimiter
+func NewRedisRateLimiter(redisClient *redis.Client, retryStrategy retry.Strategy, keyPrefix string) *RedisRateLimiter {
+	return &RedisRateLimiter{
+		redisClient:   redisClient,
+		retryStrategy: retryStrategy,
+		keyPrefix:     keyPrefix,
+	}
+}
+
+// Take takes 1 token from every limited bucket or from none of them in 1 script call
+func (l *RedisRateLimiter) Take(ctx context.Context, buckets ...models.RateLimitBucket) (time.Duration, error) {
+	keys := make([]string, 0, len(buckets))
+	args := make([]interface{}, 0, 2*len(buckets))
+	for _, bucket := range buckets {
+		if bucket.Limit.Unlimited() {
+			continue
+		}
+		keys = append(keys, l.keyPrefix+":"+bucket.Key)
+		args = append(args, strconv.FormatFloat(bucket.Limit.Rate, 'f', -1, 64), bucket.Limit.Capacity())
+	}
+
+	if len(keys) == 0 {
+		return 0, nil
+	}
+
+	var waitMilliseconds int64
+	err := retry.Do(func() error {
+		var errScript error
+		waitMilliseconds, errScript = takeScript.Run(ctx, l.redisClient, keys, args...).Int64()
+		return errScript
+	}, l.retryStrategy)
+	if err != nil {
+		return 0, fmt.Errorf("couldn't take rate limit tokens in redis: %w", err)
+	}
+
+	return time.Duration(waitMilliseconds) * time.Millisecond, nil
+}
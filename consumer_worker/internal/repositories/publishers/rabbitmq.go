@@ -0,0 +1,45 @@
+package publishers
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/wb-go/wbf/rabbitmq"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// RabbitMQResultPublisher is the ports.DeliveryResultPublisher Repository for RabbitMQ
+//
+// results are published through the default exchange straight into the result queue
+type RabbitMQResultPublisher struct {
+	publisher     *rabbitmq.Publisher
+	queue         string
+	retryStrategy retry.Strategy
+}
+
+// NewRabbitMQResultPublisher creates a new RabbitMQResultPublisher
+func NewRabbitMQResultPublisher(publisher *rabbitmq.Publisher, queue string, retryStrategy retry.Strategy) *RabbitMQResultPublisher {
+	return &RabbitMQResultPublisher{
+		publisher:     publisher,
+		queue:         queue,
+		retryStrategy: retryStrategy,
+	}
+}
+
+// Publish sends 1 result
+func (p *RabbitMQResultPublisher) Publish(ctx context.Context, result *models.DeliveryResult) error {
+	body, err := dto.DeliveryResultBodyFromEntity(result)
+	if err != nil {
+		return fmt.Errorf("couldn't create body to send result: %w", err)
+	}
+
+	err = p.publisher.PublishWithRetry(body, p.queue, "application/json", p.retryStrategy)
+	if err != nil {
+		return fmt.Errorf("couldn't send result to rabbitMQ: %w", err)
+	}
+
+	zlog.Logger.Debug().Str("notification_id", result.ID.String()).Str("outcome", result.Outcome).Msg("sent delivery result to rabbitMQ")
+	return nil
+}
@@ -0,0 +1,103 @@
+package receivers
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"sync"
+)
+
+// MergedReceiver is the ports.NotificationReceiver that reads from many receivers at once, e.g. 1 per queue
+//
+// objects channel is closed as soon as any receiver's one is: a queue that isn't consumed anymore
+// (e.g. broker closed its channel) mustn't go unnoticed while the others are fine
+type MergedReceiver struct {
+	receivers []ports.NotificationReceiver
+
+	objectsChan chan *models.Notification
+
+	// stop is closed by StopReceiving, transfer doesn't wait for a reader after that
+	stop     chan struct{}
+	stopOnce sync.Once
+}
+
+// NewMergedReceiver creates a new MergedReceiver of given receivers
+func NewMergedReceiver(receivers ...ports.NotificationReceiver) *MergedReceiver {
+	return &MergedReceiver{
+		receivers:   receivers,
+		objectsChan: make(chan *models.Notification),
+		stop:        make(chan struct{}),
+	}
+}
+
+// StartReceiving starts every receiver, in background
+//
+// Must be called
+func (r *MergedReceiver) StartReceiving() <-chan *models.Notification {
+	// closed by the first receiver that ends, the rest stop transferring then
+	ended := make(chan struct{})
+	endOnce := &sync.Once{}
+
+	wg := &sync.WaitGroup{}
+	for _, receiver := range r.receivers {
+		objects := receiver.StartReceiving()
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			defer endOnce.Do(func() {
+				close(ended)
+			})
+			r.transfer(objects, ended)
+		}()
+	}
+
+	go func() {
+		wg.Wait()
+		close(r.objectsChan)
+	}()
+
+	return r.objectsChan
+}
+
+// transfer moves objects into merged channel until they're closed, ended or StopReceiving is called
+//
+// an object that isn't transferred is left unsettled, broker delivers it again
+func (r *MergedReceiver) transfer(objects <-chan *models.Notification, ended <-chan struct{}) {
+	for {
+		select {
+		case <-ended:
+			return
+		case <-r.stop:
+			return
+		case object, ok := <-objects:
+			if !ok {
+				return
+			}
+
+			select {
+			case r.objectsChan <- object:
+			case <-ended:
+				return
+			case <-r.stop:
+				return
+			}
+		}
+	}
+}
+
+// StopReceiving stops every receiver, their errors are joined
+//
+// Must be called
+func (r *MergedReceiver) StopReceiving() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+
+	errs := make([]error, 0)
+	for _, receiver := range r.receivers {
+		if err := receiver.StopReceiving(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
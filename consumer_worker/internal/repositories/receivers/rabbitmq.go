@@ -4,45 +4,63 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/dto"
-	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
-	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/rabbitmq/amqp091-go"
 	"github.com/wb-go/wbf/rabbitmq"
 	"github.com/wb-go/wbf/retry"
 	"github.com/wb-go/wbf/zlog"
+	"sync"
 )
 
+// ConsumeChannel is the part of *rabbitmq.Channel used by RabbitMQReceiver
+type ConsumeChannel interface {
+	Consume(queue, consumer string, autoAck, exclusive, noLocal, noWait bool, args amqp091.Table) (<-chan amqp091.Delivery, error)
+	Publish(exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) error
+	Close() error
+}
+
 // RabbitMQReceiver is the ports.NotificationReceiver Repository for RabbitMQ
 //
-//	defer channel.Close() // or whatever
+// messages are acknowledged manually: every received Notification has Delivery to settle after the send.
+// Transient failures are nacked with requeue while there are send attempts left.
+// Malformed messages are moved into quarantine queue right away, the ones out of send attempts - after the last one
+//
 //	defer r.StopReceiving()
 //
-//	err = r.StartReceiving()
-//	// handle err
+//	objects := r.StartReceiving()
 //
 //	//...
 //
-//	obj, err = r.Receive(ctx)
+//	obj := <-objects
+//	// send obj
+//	err = obj.Delivery.Ack()
 type RabbitMQReceiver struct {
-	consumer      *rabbitmq.Consumer
-	channel       *rabbitmq.Channel
-	retryStrategy retry.Strategy
+	consumerConfig *rabbitmq.ConsumerConfig
+	channel        ConsumeChannel
+	retryStrategy  retry.Strategy
 
-	// close messages - objects close too
-	// StartReceiving launches transfer from 1 to 2 channel
+	// quarantineQueue is filled through the default exchange, empty = malformed messages are dropped
+	quarantineQueue string
 
-	messages    chan []byte
+	// closed after channel is, StartReceiving launches transfer from deliveries into it
 	objectsChan chan *models.Notification
+
+	// stop is closed by StopReceiving, transfer doesn't wait for a reader after that
+	stop     chan struct{}
+	stopOnce sync.Once
 }
 
-// NewRabbitMQReceiver creates a new RabbitMQReceiver for given consumer
-func NewRabbitMQReceiver(consumer *rabbitmq.Consumer, channel *rabbitmq.Channel, retryStrategy retry.Strategy) *RabbitMQReceiver {
+// NewRabbitMQReceiver creates a new RabbitMQReceiver for given consumer config and its channel
+//
+// quarantineQueue may be empty
+func NewRabbitMQReceiver(consumerConfig *rabbitmq.ConsumerConfig, channel ConsumeChannel, quarantineQueue string, retryStrategy retry.Strategy) *RabbitMQReceiver {
 	return &RabbitMQReceiver{
-		consumer:      consumer,
-		channel:       channel,
-		messages:      make(chan []byte),
-		objectsChan:   make(chan *models.Notification),
-		retryStrategy: retryStrategy,
+		consumerConfig:  consumerConfig,
+		channel:         channel,
+		quarantineQueue: quarantineQueue,
+		objectsChan:     make(chan *models.Notification),
+		stop:            make(chan struct{}),
+		retryStrategy:   retryStrategy,
 	}
 }
 
@@ -51,22 +69,51 @@ func NewRabbitMQReceiver(consumer *rabbitmq.Consumer, channel *rabbitmq.Channel,
 // Must be called
 func (r *RabbitMQReceiver) StartReceiving() <-chan *models.Notification {
 	go func() {
-		err := r.consumer.ConsumeWithRetry(r.messages, r.retryStrategy)
+		defer close(r.objectsChan)
+
+		var deliveries <-chan amqp091.Delivery
+		err := retry.Do(func() error {
+			var errConsume error
+			deliveries, errConsume = r.channel.Consume(
+				r.consumerConfig.Queue,
+				r.consumerConfig.Consumer,
+				false, // ack after the send, see rabbitMQDelivery
+				r.consumerConfig.Exclusive,
+				r.consumerConfig.NoLocal,
+				r.consumerConfig.NoWait,
+				r.consumerConfig.Args,
+			)
+			return errConsume
+		}, r.retryStrategy)
 		if err != nil {
-			zlog.Logger.Error().Err(err).Msg("error occurred while consuming messages")
+			zlog.Logger.Error().Err(err).Str("queue", r.consumerConfig.Queue).Msg("error occurred while consuming messages")
+			return
 		}
-	}()
 
-	go func() {
-		defer close(r.objectsChan)
-		for delivery := range r.messages {
-			object, err := r.processMessage(delivery)
-			if err != nil {
-				zlog.Logger.Info().Err(err).Msg("error while processing message")
+		// deliveries are closed with channel
+		for delivery := range deliveries {
+			object, errProcess := r.processMessage(delivery.Body)
+			if errProcess != nil {
+				zlog.Logger.Info().Err(errProcess).Msg("error while processing message")
+				if errQuarantine := r.quarantine(delivery, errProcess); errQuarantine != nil {
+					zlog.Logger.Error().Err(errQuarantine).Msg("error settling malformed message")
+				}
 				continue
 			}
 
-			r.objectsChan <- object
+			object.Delivery = &rabbitMQDelivery{receiver: r, delivery: delivery}
+			select {
+			case r.objectsChan <- object:
+			case <-r.stop:
+				// left unsettled, broker delivers it again
+				return
+			}
+		}
+
+		select {
+		case <-r.stop:
+		default:
+			zlog.Logger.Error().Str("queue", r.consumerConfig.Queue).Msg("deliveries are closed, e.g. broker closed the channel")
 		}
 	}()
 
@@ -75,17 +122,46 @@ func (r *RabbitMQReceiver) StartReceiving() <-chan *models.Notification {
 
 // StopReceiving stops the processing of messages.
 //
+// unsettled messages are delivered again by broker
+//
 // Must be called
 func (r *RabbitMQReceiver) StopReceiving() error {
+	r.stopOnce.Do(func() {
+		close(r.stop)
+	})
+
 	err := r.channel.Close()
 	if err != nil {
 		zlog.Logger.Error().Err(err).Msg("error closing rabbitmq channel")
 	}
-	close(r.messages)
 
 	return err
 }
 
+// quarantine moves message into quarantineQueue and acks it, or just rejects it if there's no such queue
+//
+// failed move is a reject too: a message that can't be read or sent will never be, so redelivery is pointless
+func (r *RabbitMQReceiver) quarantine(delivery amqp091.Delivery, reason error) error {
+	if r.quarantineQueue != "" {
+		err := retry.Do(func() error {
+			return r.channel.Publish("", r.quarantineQueue, false, false, amqp091.Publishing{
+				Headers: amqp091.Table{
+					"x-quarantine-reason": reason.Error(),
+					"x-original-queue":    r.consumerConfig.Queue,
+				},
+				ContentType: delivery.ContentType,
+				Body:        delivery.Body,
+			})
+		}, r.retryStrategy)
+		if err == nil {
+			return delivery.Ack(false)
+		}
+		zlog.Logger.Error().Err(err).Str("queue", r.quarantineQueue).Msg("error moving message into quarantine, dropping it")
+	}
+
+	return delivery.Reject(false)
+}
+
 // processMessage reads 1 message from RabbitMQ and converts it to Notification model
 func (r *RabbitMQReceiver) processMessage(delivery []byte) (*models.Notification, error) {
 	// step 1. read (passed)
@@ -93,7 +169,7 @@ func (r *RabbitMQReceiver) processMessage(delivery []byte) (*models.Notification
 	// step 2. parse
 	var messageData dto.NotificationSendBody
 
-	// step 2.1: no ack if bad content! but wbf limits me
+	// step 2.1: bad content is quarantined by caller
 	if err := json.Unmarshal(delivery, &messageData); err != nil {
 		return nil, fmt.Errorf("bad message (bad json): %w", err)
 	}
@@ -112,40 +188,40 @@ func (r *RabbitMQReceiver) processMessage(delivery []byte) (*models.Notification
 	return notification, nil
 }
 
-func (r *RabbitMQReceiver) convertToNotification(data struct {
-	Content struct {
-		Title   string `json:"title"`
-		Message string `json:"message"`
-	} `json:"content"`
-	ID            string `json:"id"`
-	PublicationAt string `json:"publication_at"`
-	Channel       string `json:"channel"`
-}) (*models.Notification, error) {
-	uuid, err := types.NewUUID(data.ID)
-	if err != nil {
-		return nil, fmt.Errorf("invalid UUID: %w", err)
-	}
+// rabbitMQDelivery is the models.Delivery of 1 RabbitMQ message
+type rabbitMQDelivery struct {
+	receiver *RabbitMQReceiver
+	delivery amqp091.Delivery
+}
 
-	channel, err := internaltypes.NotificationChannelFromString(data.Channel)
-	if err != nil {
-		return nil, fmt.Errorf("invalid channel: %w", err)
-	}
+// Ack acknowledges this message only
+func (d *rabbitMQDelivery) Ack() error {
+	return d.delivery.Ack(false)
+}
 
-	publicationAt, err := types.NewDateTimeFromString(data.PublicationAt)
-	if err != nil {
-		return nil, fmt.Errorf("invalid publication date: %w", err)
-	}
+// Nack returns this message into its queue
+func (d *rabbitMQDelivery) Nack() error {
+	return d.delivery.Nack(false, true)
+}
+
+// Quarantine moves this message into quarantine queue of its receiver, see RabbitMQReceiver.quarantine
+func (d *rabbitMQDelivery) Quarantine(reason error) error {
+	return d.receiver.quarantine(d.delivery, reason)
+}
 
-	content := models.NotificationContent{
-		Title:   types.NewAnyText(data.Content.Title),
-		Message: types.NewAnyText(data.Content.Message),
+// Attempt is "x-delivery-count" + 1 of quorum queues, classic ones only tell if message is redelivered
+func (d *rabbitMQDelivery) Attempt() int {
+	switch count := d.delivery.Headers["x-delivery-count"].(type) {
+	case int64:
+		return int(count) + 1
+	case int32:
+		return int(count) + 1
+	case int:
+		return count + 1
 	}
 
-	return &models.Notification{
-		ID:            &uuid,
-		Channel:       channel,
-		PublicationAt: publicationAt,
-		Content:       content,
-		Sent:          false,
-	}, nil
+	if d.delivery.Redelivered {
+		return 2
+	}
+	return 1
 }
@@ -2,12 +2,19 @@ package senders
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
 	"github.com/wb-go/wbf/retry"
+	"mime"
 	"net/smtp"
+	"net/textproto"
+	"strings"
 )
 
+// headerBreaks are replaced in header values, so that a title can't add headers of its own
+var headerBreaks = strings.NewReplacer("\r\n", " ", "\r", " ", "\n", " ")
+
 // EmailSender is a sender that sends an email with retries
 type EmailSender struct {
 	from     string
@@ -20,11 +27,17 @@ type EmailSender struct {
 }
 
 // Send of EmailSender simply logs out a message with net/smtp
+//
+// permanent SMTP replies (5xx, e.g. unknown mailbox) are models.ErrTerminal
 func (s *EmailSender) Send(ctx context.Context, notification *models.Notification) error {
 	err := retry.Do(
 		func() error { return s.sendMail(ctx, notification) },
 		s.retryStrategy)
 	if err != nil {
+		var smtpErr *textproto.Error
+		if errors.As(err, &smtpErr) && smtpErr.Code >= 500 {
+			return fmt.Errorf("%w: error send email: %w", models.ErrTerminal, err)
+		}
 		return fmt.Errorf("error send email: %w", err)
 	}
 	return nil
@@ -34,7 +47,15 @@ func (s *EmailSender) sendMail(ctx context.Context, notification *models.Notific
 	to := []string{notification.SendTo.String()}
 	from := s.from
 
-	msg := fmt.Sprintf("%s\n\n%s", notification.Content.Title, notification.Content.Message)
+	// title is user (or template) input, it's kept on 1 line
+	title := headerBreaks.Replace(notification.Content.Title.String())
+
+	msg := fmt.Sprintf("%s\n\n%s", title, notification.Content.Message)
+	if notification.Content.HTML {
+		// rendered from a template: title is the subject, message is the HTML body
+		msg = fmt.Sprintf("Subject: %s\r\nMIME-Version: 1.0\r\nContent-Type: text/html; charset=\"UTF-8\"\r\n\r\n%s",
+			mime.QEncoding.Encode("utf-8", title), notification.Content.Message)
+	}
 
 	return smtp.SendMail(
 		s.addr,
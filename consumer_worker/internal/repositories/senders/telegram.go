@@ -0,0 +1,274 @@
+package senders
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/wb-go/wbf/retry"
+	"html"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+	"unicode/utf16"
+)
+
+// TelegramMessageLimit is the max length of 1 Bot API message in UTF-16 code units, longer ones are split
+const TelegramMessageLimit = 4096
+
+const (
+	// TelegramParseModePlain sends text as is, without formatting
+	TelegramParseModePlain = ""
+	// TelegramParseModeHTML formats text with HTML tags
+	TelegramParseModeHTML = "HTML"
+	// TelegramParseModeMarkdownV2 formats text with MarkdownV2
+	TelegramParseModeMarkdownV2 = "MarkdownV2"
+	// TelegramParseModeMarkdown formats text with legacy Markdown
+	TelegramParseModeMarkdown = "Markdown"
+)
+
+// TelegramSender is a sender that sends a message to a chat with Bot API sendMessage
+//
+// title is bold (escaped for parse mode), message is sent as is, so it may have markup of parse mode
+type TelegramSender struct {
+	botToken  string
+	apiURL    string
+	parseMode string
+
+	httpClient    *http.Client
+	retryStrategy retry.Strategy
+	// maxRetryAfter is the longest 429 retry_after that's waited in place, longer ones fail the send with models.RetryAfter
+	maxRetryAfter time.Duration
+}
+
+// telegramSendMessageRequest is the body of sendMessage
+type telegramSendMessageRequest struct {
+	ChatID    string `json:"chat_id"`
+	Text      string `json:"text"`
+	ParseMode string `json:"parse_mode,omitempty"`
+}
+
+// telegramResponse is the Bot API response, result is ignored
+type telegramResponse struct {
+	OK          bool   `json:"ok"`
+	ErrorCode   int    `json:"error_code"`
+	Description string `json:"description"`
+	Parameters  struct {
+		RetryAfter int `json:"retry_after"`
+	} `json:"parameters"`
+}
+
+// Send of TelegramSender sends notification to chat SendTo, split into several messages if it's too long
+//
+// 400 and 403 responses (e.g. chat not found, bot blocked, bad markup) are models.ErrTerminal.
+// Parts are sent in order starting from notification.SentParts, which counts the sent ones,
+// so a retried notification resumes from the part that failed
+func (s *TelegramSender) Send(ctx context.Context, notification *models.Notification) error {
+	chatID := notification.SendTo.String()
+	if chatID == "" {
+		return fmt.Errorf("%w: error send telegram message: no chat id", models.ErrTerminal)
+	}
+
+	parts := splitMessage(s.text(notification), TelegramMessageLimit)
+	for i := notification.SentParts; i < len(parts); i++ {
+		err := s.sendPart(ctx, telegramSendMessageRequest{ChatID: chatID, Text: parts[i], ParseMode: s.parseMode})
+		if err != nil {
+			return fmt.Errorf("error send telegram message part %d of %d: %w", i+1, len(parts), err)
+		}
+		notification.SentParts = i + 1
+	}
+	return nil
+}
+
+// sendPart sends 1 message with retries, waits for retry_after on 429 if it's not longer than maxRetryAfter
+//
+// terminal errors aren't retried, 429 that isn't waited is returned as models.RetryAfter
+func (s *TelegramSender) sendPart(ctx context.Context, request telegramSendMessageRequest) error {
+	for waits := 0; ; waits++ {
+		// retry.Do doesn't stop early, so errors that mustn't be retried are passed around it
+		var stopErr error
+		err := retry.Do(func() error {
+			errCall := s.sendMessage(ctx, request)
+			var retryAfterErr *models.RetryAfter
+			if errors.Is(errCall, models.ErrTerminal) || errors.As(errCall, &retryAfterErr) || ctx.Err() != nil {
+				stopErr = errCall
+				return nil
+			}
+			return errCall
+		}, s.retryStrategy)
+		if stopErr != nil {
+			err = stopErr
+		}
+
+		var retryAfterErr *models.RetryAfter
+		if !errors.As(err, &retryAfterErr) || retryAfterErr.Wait > s.maxRetryAfter || waits >= s.retryStrategy.Attempts {
+			return err
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("%w: %w", ctx.Err(), err)
+		case <-time.After(retryAfterErr.Wait):
+		}
+	}
+}
+
+// sendMessage makes 1 sendMessage call
+func (s *TelegramSender) sendMessage(ctx context.Context, request telegramSendMessageRequest) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return fmt.Errorf("%w: couldn't marshal request: %w", models.ErrTerminal, err)
+	}
+
+	httpRequest, err := http.NewRequestWithContext(ctx, http.MethodPost, s.apiURL+"/bot"+s.botToken+"/sendMessage", bytes.NewReader(body))
+	if err != nil {
+		return fmt.Errorf("couldn't create request: %w", err)
+	}
+	httpRequest.Header.Set("Content-Type", "application/json")
+
+	httpResponse, err := s.httpClient.Do(httpRequest)
+	if err != nil {
+		// url.Error has the URL with bot token in it
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			err = urlErr.Err
+		}
+		return fmt.Errorf("couldn't call sendMessage: %w", err)
+	}
+	defer func() { _ = httpResponse.Body.Close() }()
+
+	response := telegramResponse{}
+	if err = json.NewDecoder(httpResponse.Body).Decode(&response); err != nil {
+		return fmt.Errorf("couldn't decode response with status %d: %w", httpResponse.StatusCode, err)
+	}
+	if response.OK {
+		return nil
+	}
+
+	code := response.ErrorCode
+	if code == 0 {
+		code = httpResponse.StatusCode
+	}
+
+	switch {
+	case code == http.StatusTooManyRequests:
+		return &models.RetryAfter{
+			Wait: time.Duration(max(response.Parameters.RetryAfter, 1)) * time.Second,
+			Err:  fmt.Errorf("%d %s", code, response.Description),
+		}
+	case code == http.StatusBadRequest || code == http.StatusForbidden:
+		return fmt.Errorf("%w: %d %s", models.ErrTerminal, code, response.Description)
+	default:
+		return fmt.Errorf("%d %s", code, response.Description)
+	}
+}
+
+// text joins title and message of notification, title is bold in parse modes with formatting
+func (s *TelegramSender) text(notification *models.Notification) string {
+	title := notification.Content.Title.String()
+	message := notification.Content.Message.String()
+	if title == "" {
+		return message
+	}
+
+	switch s.parseMode {
+	case TelegramParseModeHTML:
+		title = "<b>" + html.EscapeString(title) + "</b>"
+	case TelegramParseModeMarkdownV2:
+		title = "*" + escapeMarkdown(title, "_*[]()~`>#+-=|{}.!\\") + "*"
+	case TelegramParseModeMarkdown:
+		title = "*" + escapeMarkdown(title, "_*`[") + "*"
+	}
+
+	if message == "" {
+		return title
+	}
+	return title + "\n\n" + message
+}
+
+// escapeMarkdown prepends '\' to every char of special
+func escapeMarkdown(s, special string) string {
+	builder := strings.Builder{}
+	for _, r := range s {
+		if strings.ContainsRune(special, r) {
+			builder.WriteRune('\\')
+		}
+		builder.WriteRune(r)
+	}
+	return builder.String()
+}
+
+// splitMessage splits text into parts of at most limit UTF-16 code units
+//
+// parts end at the last line break, or space if there's none, so markup shouldn't span several lines of long messages
+func splitMessage(text string, limit int) []string {
+	parts := make([]string, 0, 1)
+	for {
+		runes := []rune(text)
+
+		// step 1. find the longest prefix that fits
+		length, end := 0, 0
+		for end < len(runes) {
+			runeLength := utf16.RuneLen(runes[end])
+			if runeLength < 0 {
+				runeLength = 1
+			}
+			if length+runeLength > limit {
+				break
+			}
+			length += runeLength
+			end++
+		}
+		if end == len(runes) {
+			return append(parts, text)
+		}
+
+		// step 2. cut it at a line break or a space, the separator is dropped
+		cut, next := end, end
+		if i := lastIndexRune(runes[:end], '\n'); i > 0 {
+			cut, next = i, i+1
+		} else if i = lastIndexRune(runes[:end], ' '); i > 0 {
+			cut, next = i, i+1
+		}
+
+		parts = append(parts, string(runes[:cut]))
+		text = string(runes[next:])
+	}
+}
+
+// lastIndexRune returns the index of the last r in runes, -1 if there's none
+func lastIndexRune(runes []rune, r rune) int {
+	for i := len(runes) - 1; i >= 0; i-- {
+		if runes[i] == r {
+			return i
+		}
+	}
+	return -1
+}
+
+// NewTelegramSender creates a new TelegramSender
+//
+// apiURL is the Bot API base URL, e.g. https://api.telegram.org, parseMode is 1 of TelegramParseMode*
+func NewTelegramSender(botToken, apiURL, parseMode string, timeout, maxRetryAfter time.Duration, retryStrategy retry.Strategy) (*TelegramSender, error) {
+	switch parseMode {
+	case TelegramParseModePlain, TelegramParseModeHTML, TelegramParseModeMarkdownV2, TelegramParseModeMarkdown:
+	default:
+		return nil, fmt.Errorf("invalid telegram parse mode '%s': possible ones are: '%s', '%s', '%s', '%s'",
+			parseMode, TelegramParseModePlain, TelegramParseModeHTML, TelegramParseModeMarkdownV2, TelegramParseModeMarkdown)
+	}
+
+	// retry.Do with no attempts doesn't call anything
+	retryStrategy.Attempts = max(retryStrategy.Attempts, 1)
+
+	return &TelegramSender{
+		botToken:      botToken,
+		apiURL:        strings.TrimRight(apiURL, "/"),
+		parseMode:     parseMode,
+		httpClient:    &http.Client{Timeout: timeout},
+		retryStrategy: retryStrategy,
+		maxRetryAfter: maxRetryAfter,
+	}, nil
+}
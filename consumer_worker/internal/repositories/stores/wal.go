@@ -0,0 +1,309 @@
+package stores
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+	"io"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+const (
+	// walFileName is the append-only log of changes made after the snapshot
+	walFileName = "notifications.wal"
+	// snapshotFileName is the whole state at some moment, replaced atomically
+	snapshotFileName = "notifications.snapshot"
+
+	walOpSave   = "save"
+	walOpRemove = "remove"
+)
+
+// walRecord is 1 line of WAL file
+type walRecord struct {
+	Op           string                    `json:"op"`
+	ID           string                    `json:"id"`
+	Notification *dto.NotificationSendBody `json:"notification,omitempty"`
+}
+
+// WALStore is the ports.NotificationStore Repository that keeps notifications in a local directory
+//
+// every change is appended to WAL file and fsync'ed before returning, WAL is folded into snapshot every
+// snapshotEvery records. A torn last WAL line (crash mid-write) is ignored on open
+//
+//	store, err := NewWALStore(dir, 1000)
+//	// handle err
+//	defer store.Close()
+type WALStore struct {
+	mu sync.Mutex
+
+	dir string
+	wal *os.File
+
+	// state is snapshot + WAL, by ID
+	state map[string]*dto.NotificationSendBody
+
+	// records is amount of lines in WAL, snapshot is written once it reaches snapshotEvery
+	records       int
+	snapshotEvery int
+}
+
+// NewWALStore opens (or creates) store in dir and restores its state
+//
+// snapshotEvery <= 0 means that snapshot is written only on open and Close
+func NewWALStore(dir string, snapshotEvery int) (*WALStore, error) {
+	if err := os.MkdirAll(dir, 0o750); err != nil {
+		return nil, fmt.Errorf("couldn't create store dir '%s': %w", dir, err)
+	}
+
+	s := &WALStore{
+		dir:           dir,
+		state:         make(map[string]*dto.NotificationSendBody),
+		snapshotEvery: snapshotEvery,
+	}
+
+	if err := s.readSnapshot(); err != nil {
+		return nil, err
+	}
+	if err := s.replayWAL(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	s.wal, err = os.OpenFile(filepath.Join(dir, walFileName), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o640)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't open wal file: %w", err)
+	}
+
+	// start with an empty WAL, a torn tail mustn't be followed by new records
+	if err = s.snapshot(); err != nil {
+		return nil, errors.Join(err, s.wal.Close())
+	}
+	return s, nil
+}
+
+// Save appends notification to WAL
+func (s *WALStore) Save(_ context.Context, notification *models.Notification) error {
+	body := dto.NotificationSendBodyFromEntity(notification)
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.append(walRecord{Op: walOpSave, ID: body.ID, Notification: body}); err != nil {
+		return err
+	}
+	s.state[body.ID] = body
+	return s.snapshotIfNeeded()
+}
+
+// Remove appends removal to WAL, does nothing if there's no such notification
+func (s *WALStore) Remove(_ context.Context, id types.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, found := s.state[id.String()]; !found {
+		return nil
+	}
+
+	if err := s.append(walRecord{Op: walOpRemove, ID: id.String()}); err != nil {
+		return err
+	}
+	delete(s.state, id.String())
+	return s.snapshotIfNeeded()
+}
+
+// Load returns every stored notification, ones that can't be converted to model anymore are logged and skipped
+func (s *WALStore) Load(_ context.Context) ([]*models.Notification, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make([]*models.Notification, 0, len(s.state))
+	for id, body := range s.state {
+		notification, err := dto.NotificationModelFromSendDTO(body)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Str("notification_id", id).Msg("skipping invalid stored notification")
+			continue
+		}
+		result = append(result, notification)
+	}
+	return result, nil
+}
+
+// Close writes the snapshot and closes WAL file
+func (s *WALStore) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return errors.Join(s.snapshot(), s.wal.Close())
+}
+
+// append writes 1 record as a JSON line and waits for it to reach the disk
+func (s *WALStore) append(record walRecord) error {
+	line, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal wal record: %w", err)
+	}
+
+	if _, err = s.wal.Write(append(line, '\n')); err != nil {
+		return fmt.Errorf("couldn't write wal record: %w", err)
+	}
+	if err = s.wal.Sync(); err != nil {
+		return fmt.Errorf("couldn't sync wal file: %w", err)
+	}
+
+	s.records++
+	return nil
+}
+
+// snapshotIfNeeded calls snapshot once WAL is long enough
+func (s *WALStore) snapshotIfNeeded() error {
+	if s.snapshotEvery <= 0 || s.records < s.snapshotEvery {
+		return nil
+	}
+	return s.snapshot()
+}
+
+// snapshot replaces snapshot file with state and truncates WAL
+//
+// crash between these steps is harmless: WAL records are idempotent on top of the new snapshot
+func (s *WALStore) snapshot() error {
+	bodies := make([]*dto.NotificationSendBody, 0, len(s.state))
+	for _, body := range s.state {
+		bodies = append(bodies, body)
+	}
+
+	data, err := json.Marshal(bodies)
+	if err != nil {
+		return fmt.Errorf("couldn't marshal snapshot: %w", err)
+	}
+
+	// step 1. write temp file next to the snapshot
+	tmpPath := filepath.Join(s.dir, snapshotFileName+".tmp")
+	if err = writeFileSync(tmpPath, data); err != nil {
+		return fmt.Errorf("couldn't write snapshot: %w", err)
+	}
+
+	// step 2. swap them atomically
+	if err = os.Rename(tmpPath, filepath.Join(s.dir, snapshotFileName)); err != nil {
+		return fmt.Errorf("couldn't replace snapshot: %w", err)
+	}
+	if err = syncDir(s.dir); err != nil {
+		return fmt.Errorf("couldn't sync store dir: %w", err)
+	}
+
+	// step 3. everything in WAL is in the snapshot now
+	if err = s.wal.Truncate(0); err != nil {
+		return fmt.Errorf("couldn't truncate wal file: %w", err)
+	}
+	if err = s.wal.Sync(); err != nil {
+		return fmt.Errorf("couldn't sync wal file: %w", err)
+	}
+
+	s.records = 0
+	return nil
+}
+
+// readSnapshot fills state from snapshot file, missing file = empty state
+func (s *WALStore) readSnapshot() error {
+	data, err := os.ReadFile(filepath.Join(s.dir, snapshotFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't read snapshot: %w", err)
+	}
+
+	var bodies []*dto.NotificationSendBody
+	if err = json.Unmarshal(data, &bodies); err != nil {
+		return fmt.Errorf("couldn't parse snapshot: %w", err)
+	}
+
+	for _, body := range bodies {
+		s.state[body.ID] = body
+	}
+	return nil
+}
+
+// replayWAL applies WAL records on top of state, missing file = nothing to apply
+//
+// the last line without '\n' is a torn write and is skipped, any other broken line is an error
+func (s *WALStore) replayWAL() error {
+	file, err := os.Open(filepath.Join(s.dir, walFileName))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("couldn't open wal file: %w", err)
+	}
+	defer func(file *os.File) {
+		if closeErr := file.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close wal file after replay")
+		}
+	}(file)
+
+	reader := bufio.NewReader(file)
+	for lineNumber := 1; ; lineNumber++ {
+		line, errRead := reader.ReadBytes('\n')
+		if errors.Is(errRead, io.EOF) {
+			if len(bytes.TrimSpace(line)) > 0 {
+				zlog.Logger.Warn().Int("line", lineNumber).Msg("skipping torn wal record")
+			}
+			return nil
+		}
+		if errRead != nil {
+			return fmt.Errorf("couldn't read wal file: %w", errRead)
+		}
+
+		var record walRecord
+		if err = json.Unmarshal(line, &record); err != nil {
+			return fmt.Errorf("broken wal record at line %d: %w", lineNumber, err)
+		}
+
+		switch record.Op {
+		case walOpSave:
+			if record.Notification == nil {
+				return fmt.Errorf("broken wal record at line %d: no notification to save", lineNumber)
+			}
+			s.state[record.ID] = record.Notification
+		case walOpRemove:
+			delete(s.state, record.ID)
+		default:
+			return fmt.Errorf("broken wal record at line %d: unknown op '%s'", lineNumber, record.Op)
+		}
+	}
+}
+
+// writeFileSync writes data into a new file at path and waits for it to reach the disk
+func writeFileSync(path string, data []byte) error {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o640)
+	if err != nil {
+		return err
+	}
+	if _, err = file.Write(data); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	if err = file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	return file.Close()
+}
+
+// syncDir makes a rename in dir durable
+func syncDir(dir string) error {
+	file, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	if err = file.Sync(); err != nil {
+		return errors.Join(err, file.Close())
+	}
+	return file.Close()
+}
@@ -0,0 +1,296 @@
+package service
+
+import (
+	"container/heap"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/notificationheap"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"sync"
+	"time"
+)
+
+// ChannelConfig is how notifications of 1 channel are sent
+type ChannelConfig struct {
+	// Concurrency is the amount of workers sending at once, < 1 means 1
+	Concurrency int
+
+	// Limit is shared by every notification of the channel
+	Limit models.RateLimit
+	// RecipientLimit is shared by notifications of 1 SendTo, ones without SendTo aren't limited by it
+	RecipientLimit models.RateLimit
+
+	// Retry is how transient send failures are retried
+	Retry RetryPolicy
+}
+
+// RetryPolicy is how transient send failures of 1 channel are retried: message is nacked with requeue,
+// its redelivered copy waits in lane for the delay, see channelLane.requeue
+//
+// attempts are told by Delivery, so a message redelivered after a crash doesn't get extra ones
+type RetryPolicy struct {
+	// MaxAttempts < 1 means 1: the first failure is final
+	MaxAttempts int
+	// Delay is the delay before the first retry, the next ones are Backoff times longer
+	Delay time.Duration
+	// Backoff < 1 means 1
+	Backoff float64
+}
+
+// attempts returns MaxAttempts, at least 1
+func (p RetryPolicy) attempts() int {
+	return max(p.MaxAttempts, 1)
+}
+
+// delay returns how long to wait before the retry after given amount of failed attempts - 1
+func (p RetryPolicy) delay(retries int) time.Duration {
+	delay := float64(p.Delay)
+	for i := 0; i < retries; i++ {
+		delay *= max(p.Backoff, 1)
+	}
+	return time.Duration(delay)
+}
+
+// delayAfter returns delay, or the wait told by sendErr if it's longer, see models.RetryAfter
+func (p RetryPolicy) delayAfter(retries int, sendErr error) time.Duration {
+	delay := p.delay(retries)
+	var retryAfter *models.RetryAfter
+	if errors.As(sendErr, &retryAfter) {
+		return max(delay, retryAfter.Wait)
+	}
+	return delay
+}
+
+// requeuedTTL is how long nacked notification is remembered, its redelivered copy may go to another worker
+const requeuedTTL = time.Hour
+
+// channelLane is the heap of 1 channel and the bounded pool of its senders
+//
+// every channel has its own lane, so a slow one never delays the others
+type channelLane struct {
+	channel internaltypes.NotificationChannel
+
+	limit          models.RateLimit
+	recipientLimit models.RateLimit
+	retry          RetryPolicy
+
+	notificationHeap *notificationheap.NotificationHeap
+	// pending are notifications in heap by ID, so that a restored one gets Delivery of its redelivery, see handOver
+	pending map[string]*models.Notification
+	// restored are notifications restored from store without Delivery by ID, until broker redelivers them
+	restored map[string]*restoredNotification
+	// requeued are notifications nacked after transient failures by ID, until broker redelivers them
+	requeued map[string]requeuedNotification
+	mutex    sync.Mutex
+
+	// jobs are due notifications, taken by concurrency workers. Closed by the dispatcher on exit
+	jobs        chan *models.Notification
+	concurrency int
+}
+
+// newChannelLane creates a new empty channelLane
+func newChannelLane(channel internaltypes.NotificationChannel, config ChannelConfig) *channelLane {
+	// make container/heap handle our sorting
+	notificationHeap := &notificationheap.NotificationHeap{}
+	heap.Init(notificationHeap)
+
+	return &channelLane{
+		channel:          channel,
+		limit:            config.Limit,
+		recipientLimit:   config.RecipientLimit,
+		retry:            config.Retry,
+		notificationHeap: notificationHeap,
+		pending:          make(map[string]*models.Notification),
+		restored:         make(map[string]*restoredNotification),
+		requeued:         make(map[string]requeuedNotification),
+		jobs:             make(chan *models.Notification),
+		concurrency:      max(config.Concurrency, 1),
+	}
+}
+
+// restoredNotification is the state of 1 notification restored without Delivery, broker may still hold it
+type restoredNotification struct {
+	// inFlight is set while it's being sent
+	inFlight bool
+	// done is set once it's sent or failed for good, its redelivery must be acked then
+	done bool
+	// redelivery is Delivery of the redelivered one received while it was in flight
+	redelivery models.Delivery
+}
+
+// requeuedNotification is what nacked notification passes on to its redelivered copy
+type requeuedNotification struct {
+	// requeues is the amount of attempts made so far, see models.Notification.Requeues
+	requeues int
+	// retryAt is when the redelivered copy may be sent
+	retryAt time.Time
+	// sentParts is where the redelivered copy resumes, see models.Notification.SentParts
+	sentParts int
+}
+
+// requeue remembers notification that is going to be nacked, its redelivered copy waits until retryAt, see takeRequeued
+//
+// the ones whose copy didn't come back in requeuedTTL are forgotten
+func (l *channelLane) requeue(notification *models.Notification, requeues int, retryAt time.Time) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	staleBefore := time.Now().Add(-requeuedTTL)
+	for id, requeued := range l.requeued {
+		if requeued.retryAt.Before(staleBefore) {
+			delete(l.requeued, id)
+		}
+	}
+
+	l.requeued[notification.ID.String()] = requeuedNotification{
+		requeues:  requeues,
+		retryAt:   retryAt,
+		sentParts: notification.SentParts,
+	}
+}
+
+// takeRequeued defers redelivered copy of nacked notification until its retry and gives it the attempts made
+// and the parts sent so far
+//
+// does nothing to the ones that weren't nacked by this lane
+func (l *channelLane) takeRequeued(notification *models.Notification) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	id := notification.ID.String()
+	requeued, found := l.requeued[id]
+	if !found {
+		return
+	}
+	delete(l.requeued, id)
+
+	notification.Requeues = max(notification.Requeues, requeued.requeues)
+	notification.DeferredUntil = types.NewDateTime(requeued.retryAt)
+	notification.SentParts = max(notification.SentParts, requeued.sentParts)
+}
+
+// restore schedules notification restored from store without Delivery, see handOver
+func (l *channelLane) restore(notification *models.Notification) {
+	l.mutex.Lock()
+	l.restored[notification.ID.String()] = &restoredNotification{}
+	l.mutex.Unlock()
+
+	l.push(notification)
+}
+
+// handOver gives Delivery of redelivered notification to the same one restored without it
+//
+// returns false if there's no such notification, it must be pushed then.
+// Returns done if the restored one is sent or failed for good already, redelivered one must be acked then
+func (l *channelLane) handOver(notification *models.Notification) (found bool, done bool) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	id := notification.ID.String()
+	restored, found := l.restored[id]
+	if !found {
+		return false, false
+	}
+
+	switch {
+	case restored.done:
+		delete(l.restored, id)
+		return true, true
+	case restored.inFlight:
+		// it's given over when the send is retried, or settled with the outcome, see finishRestored
+		restored.redelivery = notification.Delivery
+	default:
+		if pending, inHeap := l.pending[id]; inHeap {
+			pending.Delivery = notification.Delivery
+		}
+		delete(l.restored, id)
+	}
+	return true, false
+}
+
+// finishRestored tells if notification is restored without Delivery and sets its outcome: final or not
+//
+// not final one is forgotten, its redelivery is sent with its own attempts.
+// Returns Delivery of the redelivered one received while it was in flight, nil if there's none
+func (l *channelLane) finishRestored(notification *models.Notification, final bool) (isRestored bool, redelivery models.Delivery) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	id := notification.ID.String()
+	restored, found := l.restored[id]
+	if !found {
+		return false, nil
+	}
+
+	redelivery = restored.redelivery
+	if final && redelivery == nil {
+		// it stays until the redelivery, which may never come if the message was settled before the restart
+		restored.inFlight, restored.done = false, true
+		return true, nil
+	}
+	delete(l.restored, id)
+	return true, redelivery
+}
+
+// push schedules notification
+//
+// restored one that's pushed back gets Delivery redelivered while it was in flight, if any
+func (l *channelLane) push(notification *models.Notification) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	id := notification.ID.String()
+	if restored, found := l.restored[id]; found && restored.inFlight {
+		restored.inFlight = false
+		if restored.redelivery != nil {
+			notification.Delivery = restored.redelivery
+			delete(l.restored, id)
+		}
+	}
+
+	l.pending[id] = notification
+	heap.Push(l.notificationHeap, notification)
+}
+
+// buckets returns rate limit buckets of notification, unlimited ones are skipped
+func (l *channelLane) buckets(notification *models.Notification) []models.RateLimitBucket {
+	buckets := make([]models.RateLimitBucket, 0, 2)
+	if !l.limit.Unlimited() {
+		buckets = append(buckets, models.RateLimitBucket{Key: "channel:" + l.channel.String(), Limit: l.limit})
+	}
+	if sendTo := notification.SendTo.String(); sendTo != "" && !l.recipientLimit.Unlimited() {
+		buckets = append(buckets, models.RateLimitBucket{Key: "recipient:" + l.channel.String() + ":" + sendTo, Limit: l.recipientLimit})
+	}
+	return buckets
+}
+
+// popDue pops the earliest notification if it has been due for checkPeriod already, nil otherwise
+//
+// so it's never sent before DueAt, but up to 2 checkPeriods after it
+func (l *channelLane) popDue(now time.Time, checkPeriod time.Duration) *models.Notification {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	// step 1. Peek notification for some validation
+	notificationToPublish := l.notificationHeap.Peek()
+	if notificationToPublish == nil {
+		return nil
+	}
+
+	// step 1.1. If it isn't overdue by checkPeriod yet, we leave
+	if notificationToPublish.DueAt().Add(checkPeriod).After(now) {
+		return nil
+	}
+
+	// step 2. Pop
+	notification := heap.Pop(l.notificationHeap).(*models.Notification)
+	id := notification.ID.String()
+	if l.pending[id] == notification {
+		delete(l.pending, id)
+	}
+	if restored, found := l.restored[id]; found {
+		restored.inFlight = true
+	}
+	return notification
+}
@@ -1,89 +1,237 @@
 package service
 
 import (
-	"container/heap"
 	"context"
 	"errors"
+	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
-	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/notificationheap"
 	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"github.com/wb-go/wbf/zlog"
 	"sync"
 	"time"
 )
 
 // ErrUnknownChannel occurs when channel given by producer in the message doesn't have corresponding sender here
-var ErrUnknownChannel = errors.New("unknown channel: no sender for it")
+//
+// it's terminal: redelivery into the same worker won't help
+var ErrUnknownChannel = fmt.Errorf("%w: unknown channel: no sender for it", models.ErrTerminal)
 
 // NotificationService is the main service that reads, sorts and sends 100 MLN notifications per 1 MS
 //
-//	s.StartReceiving(ctx)
-//	<-ctx.Done()
-//	// service already stopped
+// every channel is sorted and sent separately by its own bounded pool, see channelLane
+//
+//	err := s.Run(ctx) // until ctx.Done()
+//	// service already stopped, in-flight sends are finished
 type NotificationService struct {
 	// no writes -> no mutex
 	channelToSender map[internaltypes.NotificationChannel]ports.NotificationSender
 
 	receiver ports.NotificationReceiver
 
-	notificationHeap *notificationheap.NotificationHeap
-	heapMutex        sync.RWMutex
+	// resultPublisher reports every send outcome back to producer, nil = don't report
+	resultPublisher ports.DeliveryResultPublisher
+
+	// store keeps heap across restarts, nil = heap is lost on exit
+	store ports.NotificationStore
+
+	// limiter defers notifications over ChannelConfig limits, nil = no limits
+	limiter ports.RateLimiter
+
+	// lanes has 1 lane per channelToSender key, no writes -> no mutex
+	lanes map[internaltypes.NotificationChannel]*channelLane
 
 	checkPeriod time.Duration
 }
 
 // NewNotificationService creates a new NotificationService
-func NewNotificationService(receiver ports.NotificationReceiver, channelToSender map[internaltypes.NotificationChannel]ports.NotificationSender, checkPeriod time.Duration) *NotificationService {
-	// make container/heap handle our sorting
-	notificationHeap := &notificationheap.NotificationHeap{}
-	heap.Init(notificationHeap)
+//
+// channelConfigs tell how every channel is sent, missing = 1 worker without limits.
+// limiter, resultPublisher and store may be nil
+func NewNotificationService(receiver ports.NotificationReceiver, channelToSender map[internaltypes.NotificationChannel]ports.NotificationSender, channelConfigs map[internaltypes.NotificationChannel]ChannelConfig, limiter ports.RateLimiter, resultPublisher ports.DeliveryResultPublisher, store ports.NotificationStore, checkPeriod time.Duration) *NotificationService {
+	lanes := make(map[internaltypes.NotificationChannel]*channelLane, len(channelToSender))
+	for channel := range channelToSender {
+		lanes[channel] = newChannelLane(channel, channelConfigs[channel])
+	}
 
 	return &NotificationService{
-		channelToSender:  channelToSender,
-		receiver:         receiver,
-		heapMutex:        sync.RWMutex{},
-		notificationHeap: notificationHeap,
-		checkPeriod:      checkPeriod,
+		channelToSender: channelToSender,
+		receiver:        receiver,
+		resultPublisher: resultPublisher,
+		store:           store,
+		limiter:         limiter,
+		lanes:           lanes,
+		checkPeriod:     checkPeriod,
 	}
 }
 
 // Run is the life cycle function
 //
-// blocking, stops automatically with ctx.Done()
+// blocking, stops automatically with ctx.Done() or when receiver is gone.
+// Waits for in-flight sends to finish before stopping the receiver, so that they're still settled
+//
+// notifications left in store by previous run are scheduled before receiving new ones
 func (s *NotificationService) Run(ctx context.Context) error {
+	if err := s.restore(ctx); err != nil {
+		return err
+	}
+
+	lanesCtx, stopLanes := context.WithCancel(ctx)
+	defer stopLanes()
+
+	wg := &sync.WaitGroup{}
+	for _, lane := range s.lanes {
+		s.startLane(lanesCtx, lane, wg)
+	}
+
 	objects := s.receiver.StartReceiving()
 	var object *models.Notification
-
-	go s.serveHeap(ctx)
+	var ok bool
 
 out:
 	for {
 		select {
 		case <-ctx.Done():
 			break out
-		case object = <-objects:
+		case object, ok = <-objects:
+			if !ok {
+				// receiver is gone, e.g. broker closed the channel
+				zlog.Logger.Error().Msg("receiver stopped sending notifications")
+				break out
+			}
+
 			// check if we'll be able to even send this notification
-			if _, ok := s.channelToSender[object.Channel]; !ok {
+			if _, found := s.lanes[object.Channel]; !found {
 				zlog.Logger.Error().Stringer("channel", &object.Channel).Msg("unable to find sender for given channel")
+				s.settle(ctx, object, ErrUnknownChannel)
 				continue
 			}
 
-			s.heapMutex.Lock()
-			heap.Push(s.notificationHeap, object)
-			s.heapMutex.Unlock()
+			s.schedule(ctx, object)
 		}
 	}
 
+	stopLanes()
+	wg.Wait()
+	zlog.Logger.Info().Msg("in-flight sends finished")
+
 	return s.receiver.StopReceiving()
 }
 
-// serveHeap simply reads everything from heap every 50ms and sends it
-func (s *NotificationService) serveHeap(ctx context.Context) {
-	// step 1. Peek
-	// step 2. Pop
-	// step 3. Send
+// restore pushes every stored notification into heap, they have no Delivery until broker redelivers them
+//
+// they're sent in time anyway, broker's redelivery of a sent one is only acked, see channelLane.handOver
+func (s *NotificationService) restore(ctx context.Context) error {
+	if s.store == nil {
+		return nil
+	}
+
+	restored, err := s.store.Load(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to restore notifications from store: %w", err)
+	}
+
+	for _, notification := range restored {
+		lane, found := s.lanes[notification.Channel]
+		if !found {
+			// this worker doesn't serve it anymore, but broker still has it unless it's settled
+			zlog.Logger.Warn().
+				Str("notification_id", notification.ID.String()).
+				Str("channel", notification.Channel.String()).
+				Msg("dropping restored notification of channel without sender")
+			s.forget(ctx, notification)
+			continue
+		}
+		lane.restore(notification)
+	}
+
+	zlog.Logger.Info().Int("count", len(restored)).Msg("restored notifications from store")
+	return nil
+}
+
+// schedule saves notification into store and pushes it into heap
+//
+// redelivered notification that is restored already only hands its Delivery over to the restored one,
+// or is acked if the restored one is sent. Redelivered copy of a nacked one waits for its retry.
+// The one delivered again after its last attempt is quarantined
+//
+// notification must have a lane
+func (s *NotificationService) schedule(ctx context.Context, notification *models.Notification) {
+	lane := s.lanes[notification.Channel]
+	if found, done := lane.handOver(notification); found {
+		if done {
+			s.ackRedelivery(notification, notification.Delivery)
+		}
+		return
+	}
+	lane.takeRequeued(notification)
+
+	// e.g. every previous delivery crashed the worker
+	if notification.Attempt() > lane.retry.attempts() {
+		zlog.Logger.Error().
+			Str("notification_id", notification.ID.String()).
+			Int("attempt", notification.Attempt()).
+			Msg("notification is delivered again after its last attempt")
+		s.settle(ctx, notification, models.ErrAttemptsExhausted)
+		return
+	}
 
+	if s.store != nil {
+		if err := s.store.Save(ctx, notification); err != nil {
+			// still unacked, so broker has it if we crash
+			zlog.Logger.Error().
+				Err(err).
+				Str("notification_id", notification.ID.String()).
+				Msg("failed to save notification into store")
+		}
+	}
+
+	lane.push(notification)
+}
+
+// forget removes settled notification from store, logs on error
+func (s *NotificationService) forget(ctx context.Context, notification *models.Notification) {
+	if s.store == nil {
+		return
+	}
+
+	if err := s.store.Remove(ctx, *notification.ID); err != nil {
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Msg("failed to remove notification from store, it's going to be sent again after restart")
+	}
+}
+
+// startLane launches dispatcher and workers of lane, they're done in wg after ctx.Done()
+func (s *NotificationService) startLane(ctx context.Context, lane *channelLane, wg *sync.WaitGroup) {
+	// in-flight sends aren't interrupted on shutdown, they're waited for
+	sendCtx := context.WithoutCancel(ctx)
+
+	wg.Add(lane.concurrency)
+	for i := 0; i < lane.concurrency; i++ {
+		go func() {
+			defer wg.Done()
+			for notification := range lane.jobs {
+				s.process(sendCtx, lane, notification)
+			}
+		}()
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		defer close(lane.jobs)
+		s.serveHeap(ctx, lane)
+	}()
+}
+
+// serveHeap simply reads everything due from lane heap every checkPeriod and hands it to lane workers
+//
+// notifications over rate limits are deferred back into heap.
+// Waits for a free worker, so only this lane is slowed down by its slow sends
+func (s *NotificationService) serveHeap(ctx context.Context, lane *channelLane) {
 	ticker := time.NewTicker(s.checkPeriod)
 	defer ticker.Stop()
 
@@ -94,54 +242,185 @@ func (s *NotificationService) serveHeap(ctx context.Context) {
 		case <-ticker.C:
 			now := time.Now()
 
-			s.heapMutex.Lock()
-
-			// read everything from heap
-			for s.notificationHeap.Len() > 0 {
-				// step 1. Peek notification for some validation
-				notificationToPublish := s.notificationHeap.Peek()
-				if notificationToPublish == nil {
-					break
+			// read everything due from heap
+			for notification := lane.popDue(now, s.checkPeriod); notification != nil; notification = lane.popDue(now, s.checkPeriod) {
+				if wait := s.throttle(ctx, lane, notification); wait > 0 {
+					// not earlier than the next check, so that it isn't popped again right away
+					notification.DeferredUntil = types.NewDateTime(now.Add(max(wait, s.checkPeriod)))
+					lane.push(notification)
+					continue
 				}
 
-				// step 1.1. If time isn't even soon, we leave
-				if publicationTime := notificationToPublish.PublicationAt.Value(); publicationTime.Add(s.checkPeriod).After(now) {
-					break
+				select {
+				case lane.jobs <- notification:
+				case <-ctx.Done():
+					// it's still in store and unacked in broker
+					return
 				}
+			}
+		}
+	}
+}
 
-				// step 2. Pop
-				notification := heap.Pop(s.notificationHeap).(*models.Notification)
-
-				s.heapMutex.Unlock()
-
-				// step 3. Send
-				if err := s.sendNotification(ctx, notification); err != nil {
-					zlog.Logger.Error().
-						Err(err).
-						Str("notification_id", notification.ID.String()).
-						Str("channel", notification.Channel.String()).
-						Msg("failed to send notification")
-				} else {
-					zlog.Logger.Info().
-						Str("notification_id", notification.ID.String()).
-						Str("channel", notification.Channel.String()).
-						Msg("notification sent successfully")
-				}
+// throttle takes rate limit tokens of notification, returns how long to defer it, 0 = send now
+//
+// limiter errors are logged and notification is sent: limits mustn't stop delivery
+func (s *NotificationService) throttle(ctx context.Context, lane *channelLane, notification *models.Notification) time.Duration {
+	if s.limiter == nil {
+		return 0
+	}
 
-				s.heapMutex.Lock()
-			}
+	buckets := lane.buckets(notification)
+	if len(buckets) == 0 {
+		return 0
+	}
+
+	wait, err := s.limiter.Take(ctx, buckets...)
+	if err != nil {
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Str("channel", notification.Channel.String()).
+			Msg("failed to check rate limits, sending anyway")
+		return 0
+	}
+
+	if wait > 0 {
+		zlog.Logger.Debug().
+			Str("notification_id", notification.ID.String()).
+			Str("channel", notification.Channel.String()).
+			Dur("wait", wait).
+			Msg("notification is over rate limit, deferred")
+	}
+	return wait
+}
+
+// process sends 1 notification and settles it, unless it's retried later
+func (s *NotificationService) process(ctx context.Context, lane *channelLane, notification *models.Notification) {
+	// step 1. Send
+	err := s.sendNotification(ctx, notification)
+	if err != nil {
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Str("channel", notification.Channel.String()).
+			Int("attempt", notification.Attempt()).
+			Msg("failed to send notification")
+	} else {
+		zlog.Logger.Info().
+			Str("notification_id", notification.ID.String()).
+			Str("channel", notification.Channel.String()).
+			Msg("notification sent successfully")
+	}
+
+	// step 2. Transient failure is requeued while there are attempts left
+	if s.requeue(ctx, lane, notification, err) {
+		return
+	}
+
+	// step 3. Restored one without Delivery is still held by broker
+	if notification.Delivery == nil {
+		final := err == nil || errors.Is(err, models.ErrTerminal)
+		if restored, redelivery := lane.finishRestored(notification, final); restored {
+			s.settleRestored(ctx, lane, notification, err, final, redelivery)
+			return
+		}
+	}
+
+	// step 4. Tell broker and producer how it went
+	s.settle(ctx, notification, err)
+
+	// step 5. It's either sent or given up on
+	s.forget(ctx, notification)
+}
+
+// settleRestored settles notification restored without Delivery, redelivery is the Delivery of its redelivered copy, may be nil
+//
+// final outcome is reported and settles the redelivery. Transient failure can't be nacked, broker holds the message:
+// it isn't reported and the redelivered copy is sent with its own attempts after the retry delay
+func (s *NotificationService) settleRestored(ctx context.Context, lane *channelLane, notification *models.Notification, sendErr error, final bool, redelivery models.Delivery) {
+	s.forget(ctx, notification)
 
-			s.heapMutex.Unlock()
+	if final {
+		if redelivery != nil {
+			s.ackRedelivery(notification, redelivery)
 		}
+		s.reportResult(ctx, notification, sendErr)
+		return
+	}
+
+	zlog.Logger.Warn().
+		Str("notification_id", notification.ID.String()).
+		Msg("restored notification failed, it's sent again when broker redelivers it")
+	lane.requeue(notification, notification.Requeues, time.Now().Add(lane.retry.delayAfter(0, sendErr)))
+	if redelivery != nil {
+		redelivered := *notification
+		redelivered.Delivery = redelivery
+		redelivered.DeferredUntil = types.DateTime{}
+		s.schedule(ctx, &redelivered)
+	}
+}
+
+// ackRedelivery acks delivery of notification that is sent or failed for good already, logs on error
+func (s *NotificationService) ackRedelivery(notification *models.Notification, delivery models.Delivery) {
+	zlog.Logger.Info().
+		Str("notification_id", notification.ID.String()).
+		Msg("redelivered notification is settled already, acking it")
+	if err := delivery.Ack(); err != nil {
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Msg("failed to ack redelivered notification")
 	}
 }
 
+// requeue nacks notification after transient sendErr, returns false if its outcome is final
+//
+// broker delivers it again and the redelivered copy waits in lane for the retry delay, see channelLane.requeue.
+// Restored one without Delivery can't be nacked, see settleRestored
+func (s *NotificationService) requeue(ctx context.Context, lane *channelLane, notification *models.Notification, sendErr error) bool {
+	if sendErr == nil || errors.Is(sendErr, models.ErrTerminal) || notification.Delivery == nil ||
+		notification.Attempt() >= lane.retry.attempts() {
+		return false
+	}
+
+	attempt := notification.Attempt()
+	delay := lane.retry.delayAfter(attempt-1, sendErr)
+	lane.requeue(notification, attempt, time.Now().Add(delay))
+
+	// before the nack, so that the redelivered copy isn't removed from store
+	s.forget(ctx, notification)
+
+	if err := notification.Delivery.Nack(); err != nil {
+		// it's unsettled, so broker delivers it again after the channel is closed
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Msg("failed to nack notification")
+	}
+
+	zlog.Logger.Info().
+		Str("notification_id", notification.ID.String()).
+		Str("channel", notification.Channel.String()).
+		Dur("delay", delay).
+		Int("next_attempt", attempt+1).
+		Msg("notification is requeued, it's sent again later")
+	return true
+}
+
 func (s *NotificationService) sendNotification(ctx context.Context, notification *models.Notification) error {
 	sender, ok := s.channelToSender[notification.Channel]
 	if !ok {
 		return ErrUnknownChannel
 	}
-	err := sender.Send(ctx, notification)
+
+	// templates are rendered right before sending
+	err := notification.Render()
+	if err != nil {
+		return fmt.Errorf("%w: failed to render template: %w", models.ErrTerminal, err)
+	}
+
+	err = sender.Send(ctx, notification)
 	if err != nil {
 		zlog.Logger.Error().
 			Err(err).
@@ -152,3 +431,57 @@ func (s *NotificationService) sendNotification(ctx context.Context, notification
 	}
 	return err
 }
+
+// settle tells broker and producer the final outcome of notification
+//
+// sent notification and terminal failure (see models.ErrTerminal) are acked,
+// transient failure is final after the last attempt only (the previous ones are requeued), so it's quarantined.
+// Notification without Delivery came from a receiver that isn't settled, restored ones go to settleRestored
+func (s *NotificationService) settle(ctx context.Context, notification *models.Notification, sendErr error) {
+	if notification.Delivery != nil {
+		var err error
+		if sendErr != nil && !errors.Is(sendErr, models.ErrTerminal) {
+			err = notification.Delivery.Quarantine(sendErr)
+		} else {
+			err = notification.Delivery.Ack()
+		}
+		if err != nil {
+			// it's going to be redelivered and sent twice, nothing to do about it
+			zlog.Logger.Error().
+				Err(err).
+				Str("notification_id", notification.ID.String()).
+				Msg("failed to settle notification")
+		}
+	}
+
+	s.reportResult(ctx, notification, sendErr)
+}
+
+// reportResult publishes delivery result of notification, sendErr = nil means success
+//
+// only logs on error: the notification is already sent (or not) anyway
+func (s *NotificationService) reportResult(ctx context.Context, notification *models.Notification, sendErr error) {
+	if s.resultPublisher == nil {
+		return
+	}
+
+	result := &models.DeliveryResult{
+		ID:        notification.ID,
+		Channel:   notification.Channel,
+		Outcome:   models.OutcomeDelivered,
+		Attempt:   notification.Attempt(),
+		Timestamp: types.NewDateTime(time.Now()),
+	}
+	if sendErr != nil {
+		result.Outcome = models.OutcomeFailed
+		result.Error = types.NewAnyText(sendErr.Error())
+	}
+
+	if err := s.resultPublisher.Publish(ctx, result); err != nil {
+		zlog.Logger.Error().
+			Err(err).
+			Str("notification_id", notification.ID.String()).
+			Str("outcome", result.Outcome).
+			Msg("failed to report delivery result")
+	}
+}
@@ -0,0 +1,54 @@
+package templating
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// ErrRenderFailed occurs when template can't be parsed or rendered with given variables, e.g. some are missing
+var ErrRenderFailed = errors.New("couldn't render template")
+
+// Kind tells which engine renders a template: plain text or HTML with escaping
+type Kind int
+
+const (
+	// KindText uses text/template
+	KindText Kind = iota
+	// KindHTML uses html/template, variables are escaped
+	KindHTML
+)
+
+// Render renders source with variables, every variable used must be given
+//
+// same rules as delayed_notifier uses to validate notifications on creation
+func Render(kind Kind, source string, variables map[string]any) (string, error) {
+	if variables == nil {
+		variables = map[string]any{}
+	}
+
+	var buffer bytes.Buffer
+
+	switch kind {
+	case KindHTML:
+		parsed, err := htmltemplate.New("").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+		if err = parsed.Execute(&buffer, variables); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+	default:
+		parsed, err := texttemplate.New("").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+		if err = parsed.Execute(&buffer, variables); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+	}
+
+	return buffer.String(), nil
+}
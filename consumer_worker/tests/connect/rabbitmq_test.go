@@ -0,0 +1,99 @@
+package tests
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/config"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/connect"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestChannelQueues(t *testing.T) {
+	testCases := []struct {
+		name            string
+		queueForChannel config.QueueRead
+		channels        []string
+		expected        map[string][]string
+	}{
+		{
+			name:            "shared queue",
+			queueForChannel: config.QueueRead{},
+			expected: map[string][]string{
+				"notifications": {internaltypes.EMAIL, internaltypes.TELEGRAM, internaltypes.CONSOLE},
+			},
+		},
+		{
+			name:            "some own queues",
+			queueForChannel: config.QueueRead{Email: "notifications.email"},
+			expected: map[string][]string{
+				"notifications.email": {internaltypes.EMAIL},
+				"notifications":       {internaltypes.TELEGRAM, internaltypes.CONSOLE},
+			},
+		},
+		{
+			name:            "only served own queue",
+			queueForChannel: config.QueueRead{Email: "notifications.email"},
+			channels:        []string{internaltypes.EMAIL},
+			expected: map[string][]string{
+				"notifications.email": {internaltypes.EMAIL},
+			},
+		},
+		{
+			name:            "served queue of 2 channels",
+			queueForChannel: config.QueueRead{Email: "slow", Telegram: "slow", Console: "console"},
+			channels:        []string{internaltypes.TELEGRAM, internaltypes.EMAIL},
+			expected: map[string][]string{
+				"slow": {internaltypes.EMAIL, internaltypes.TELEGRAM},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queues, err := connect.ChannelQueues(config.RabbitMQConfig{UniversalQueue: "notifications",
+				QueueForChannel: tc.queueForChannel, Channels: tc.channels})
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !maps.EqualFunc(queues, tc.expected, slices.Equal) {
+				t.Errorf("Expected '%v', got '%v'", tc.expected, queues)
+			}
+		})
+	}
+}
+
+func TestChannelQueuesErrors(t *testing.T) {
+	testCases := []struct {
+		name            string
+		queueForChannel config.QueueRead
+		channels        []string
+	}{
+		{
+			name:     "unknown channel",
+			channels: []string{"pigeon"},
+		},
+		{
+			// console messages of the shared queue would be consumed and dropped
+			name:            "queue shared with not served channel",
+			queueForChannel: config.QueueRead{Email: "notifications.email"},
+			channels:        []string{internaltypes.TELEGRAM},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queues, err := connect.ChannelQueues(config.RabbitMQConfig{UniversalQueue: "notifications",
+				QueueForChannel: tc.queueForChannel, Channels: tc.channels})
+			if err == nil {
+				t.Errorf("Expected error, got '%v'", queues)
+			}
+		})
+	}
+
+	_, err := connect.ChannelQueues(config.RabbitMQConfig{UniversalQueue: "notifications", Channels: []string{"pigeon"}})
+	if !errors.Is(err, internaltypes.ErrInvalidNotificationChannelValue) {
+		t.Errorf("Expected '%v', got '%v'", internaltypes.ErrInvalidNotificationChannelValue, err)
+	}
+}
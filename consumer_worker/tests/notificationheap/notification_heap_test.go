@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"container/heap"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/notificationheap"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"slices"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestPopReturnsEarliestFirst(t *testing.T) {
+	notificationHeap := &notificationheap.NotificationHeap{}
+	heap.Init(notificationHeap)
+
+	if peeked := notificationHeap.Peek(); peeked != nil {
+		t.Errorf("Expected nil, got '%v'", peeked)
+	}
+
+	titles := map[string]time.Duration{"c": 3 * time.Second, "a": time.Second, "d": 4 * time.Second, "b": 2 * time.Second}
+	for title, after := range titles {
+		heap.Push(notificationHeap, &models.Notification{
+			PublicationAt: types.NewDateTime(base.Add(after)),
+			Content:       models.NotificationContent{Title: types.NewAnyText(title)},
+		})
+	}
+
+	popped := make([]string, 0, len(titles))
+	for notificationHeap.Len() > 0 {
+		peeked := notificationHeap.Peek()
+		notification := heap.Pop(notificationHeap).(*models.Notification)
+		if peeked != notification {
+			t.Errorf("Expected peeked '%s' to be popped, got '%s'", peeked.Content.Title, notification.Content.Title)
+		}
+		popped = append(popped, notification.Content.Title.String())
+	}
+
+	expected := []string{"a", "b", "c", "d"}
+	if !slices.Equal(popped, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, popped)
+	}
+}
@@ -0,0 +1,143 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/receivers"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryReceiver is the ports.NotificationReceiver that gives away objects sent into it by test
+//
+// objects are closed on StopReceiving or end, like deliveries of a closed channel
+type memoryReceiver struct {
+	objects   chan *models.Notification
+	closeOnce sync.Once
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func newMemoryReceiver() *memoryReceiver {
+	return &memoryReceiver{objects: make(chan *models.Notification, 10)}
+}
+
+func (r *memoryReceiver) StartReceiving() <-chan *models.Notification {
+	return r.objects
+}
+
+func (r *memoryReceiver) StopReceiving() error {
+	r.mu.Lock()
+	r.stopped = true
+	r.mu.Unlock()
+
+	r.end()
+	return nil
+}
+
+func (r *memoryReceiver) end() {
+	r.closeOnce.Do(func() {
+		close(r.objects)
+	})
+}
+
+func (r *memoryReceiver) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+func notification() *models.Notification {
+	id := types.GenerateUUID()
+	return &models.Notification{ID: &id, Channel: internaltypes.ChannelConsole}
+}
+
+// receiveClosed reads objects until they're closed, fails if it takes too long
+func receiveClosed(t *testing.T, objects <-chan *models.Notification) []*models.Notification {
+	received := make([]*models.Notification, 0)
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case object, ok := <-objects:
+			if !ok {
+				return received
+			}
+			received = append(received, object)
+		case <-deadline:
+			t.Fatalf("Expected objects to be closed")
+		}
+	}
+}
+
+func TestMergedReceiverMergesReceivers(t *testing.T) {
+	email, telegram := newMemoryReceiver(), newMemoryReceiver()
+	merged := receivers.NewMergedReceiver(email, telegram)
+	objects := merged.StartReceiving()
+
+	expected := map[types.UUID]bool{}
+	for _, receiver := range []*memoryReceiver{email, telegram, email} {
+		object := notification()
+		expected[*object.ID] = true
+		receiver.objects <- object
+	}
+
+	for range expected {
+		select {
+		case object := <-objects:
+			if !expected[*object.ID] {
+				t.Errorf("Unexpected notification '%s'", object.ID.String())
+			}
+			delete(expected, *object.ID)
+		case <-time.After(time.Second):
+			t.Fatalf("Expected '%d' more notifications", len(expected))
+		}
+	}
+
+	if err := merged.StopReceiving(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	receiveClosed(t, objects)
+
+	for _, receiver := range []*memoryReceiver{email, telegram} {
+		if !receiver.isStopped() {
+			t.Errorf("Expected receiver to be stopped")
+		}
+	}
+}
+
+func TestMergedReceiverEndsWithFirstReceiver(t *testing.T) {
+	email, telegram := newMemoryReceiver(), newMemoryReceiver()
+	merged := receivers.NewMergedReceiver(email, telegram)
+	objects := merged.StartReceiving()
+
+	// e.g. broker closed the channel of email queue, telegram one is still open
+	email.end()
+
+	receiveClosed(t, objects)
+	if err := merged.StopReceiving(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestMergedReceiverStopsWithoutReader(t *testing.T) {
+	email, telegram := newMemoryReceiver(), newMemoryReceiver()
+	merged := receivers.NewMergedReceiver(email, telegram)
+	objects := merged.StartReceiving()
+
+	// nobody reads them, e.g. service is shutting down
+	email.objects <- notification()
+	telegram.objects <- notification()
+	time.Sleep(20 * time.Millisecond)
+
+	if err := merged.StopReceiving(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	time.Sleep(20 * time.Millisecond)
+
+	if object, ok := <-objects; ok {
+		t.Errorf("Expected objects to be closed, got '%s'", object.ID.String())
+	}
+}
@@ -0,0 +1,295 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/receivers"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wb-go/wbf/rabbitmq"
+	"github.com/wb-go/wbf/retry"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	queue           = "notifications"
+	quarantineQueue = "notifications.quarantine"
+)
+
+// publishing is 1 message published by memoryChannel
+type publishing struct {
+	key string
+	msg amqp091.Publishing
+}
+
+// memoryChannel is the receivers.ConsumeChannel that gives away deliveries and remembers publishings
+type memoryChannel struct {
+	deliveries chan amqp091.Delivery
+
+	mu          sync.Mutex
+	publishings []publishing
+}
+
+func newMemoryChannel() *memoryChannel {
+	return &memoryChannel{deliveries: make(chan amqp091.Delivery, 10)}
+}
+
+func (c *memoryChannel) Consume(_, _ string, _, _, _, _ bool, _ amqp091.Table) (<-chan amqp091.Delivery, error) {
+	return c.deliveries, nil
+}
+
+func (c *memoryChannel) Publish(_, key string, _, _ bool, msg amqp091.Publishing) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.publishings = append(c.publishings, publishing{key: key, msg: msg})
+	return nil
+}
+
+func (c *memoryChannel) Close() error {
+	close(c.deliveries)
+	return nil
+}
+
+func (c *memoryChannel) published() []publishing {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return append([]publishing(nil), c.publishings...)
+}
+
+// acknowledger is the amqp091.Acknowledger that remembers how delivery was settled
+type acknowledger struct {
+	mu       sync.Mutex
+	acks     int
+	rejects  int
+	requeues int
+}
+
+func (a *acknowledger) Ack(_ uint64, _ bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.acks++
+	return nil
+}
+
+func (a *acknowledger) Nack(_ uint64, _ bool, requeue bool) error {
+	if !requeue {
+		return errors.New("nack without requeue isn't expected")
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.requeues++
+	return nil
+}
+
+func (a *acknowledger) Reject(_ uint64, _ bool) error {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.rejects++
+	return nil
+}
+
+func (a *acknowledger) counts() (acks, rejects int) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return a.acks, a.rejects
+}
+
+func newReceiver(channel *memoryChannel, quarantine string) *receivers.RabbitMQReceiver {
+	return receivers.NewRabbitMQReceiver(rabbitmq.NewConsumerConfig(queue), channel, quarantine,
+		retry.Strategy{Attempts: 1, Delay: time.Millisecond, Backoff: 1})
+}
+
+func notificationBody(t *testing.T) []byte {
+	id := types.GenerateUUID()
+	body, err := json.Marshal(dto.NotificationSendBodyFromEntity(&models.Notification{
+		PublicationAt: types.NewDateTime(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)),
+		ID:            &id,
+		Channel:       internaltypes.ChannelConsole,
+		Content: models.NotificationContent{
+			Title:   types.NewAnyText("title"),
+			Message: types.NewAnyText("message"),
+		},
+	}))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return body
+}
+
+func TestRabbitMQReceiverQuarantinesMalformedMessage(t *testing.T) {
+	tests := []struct {
+		name            string
+		quarantineQueue string
+		expectedMoved   int
+		expectedAcks    int
+		expectedRejects int
+	}{
+		{name: "moved into quarantine", quarantineQueue: quarantineQueue, expectedMoved: 1, expectedAcks: 1},
+		{name: "dropped without quarantine", expectedRejects: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			channel := newMemoryChannel()
+			receiver := newReceiver(channel, tt.quarantineQueue)
+			objects := receiver.StartReceiving()
+
+			ack := &acknowledger{}
+			channel.deliveries <- amqp091.Delivery{Acknowledger: ack, Body: []byte("{not json")}
+			_ = receiver.StopReceiving()
+
+			for object := range objects {
+				t.Errorf("Expected no notifications, got '%s'", object.ID.String())
+			}
+
+			published := channel.published()
+			if len(published) != tt.expectedMoved {
+				t.Fatalf("Expected '%d', got '%d'", tt.expectedMoved, len(published))
+			}
+			if tt.expectedMoved > 0 {
+				if published[0].key != quarantineQueue {
+					t.Errorf("Expected '%s', got '%s'", quarantineQueue, published[0].key)
+				}
+				if string(published[0].msg.Body) != "{not json" {
+					t.Errorf("Expected '%s', got '%s'", "{not json", string(published[0].msg.Body))
+				}
+				if published[0].msg.Headers["x-original-queue"] != queue {
+					t.Errorf("Expected '%s', got '%v'", queue, published[0].msg.Headers["x-original-queue"])
+				}
+			}
+
+			acks, rejects := ack.counts()
+			if acks != tt.expectedAcks || rejects != tt.expectedRejects {
+				t.Errorf("Expected '%d' acks and '%d' rejects, got '%d' and '%d'", tt.expectedAcks, tt.expectedRejects, acks, rejects)
+			}
+		})
+	}
+}
+
+func TestRabbitMQReceiverDelivery(t *testing.T) {
+	channel := newMemoryChannel()
+	receiver := newReceiver(channel, quarantineQueue)
+	objects := receiver.StartReceiving()
+
+	sent, quarantined := &acknowledger{}, &acknowledger{}
+	channel.deliveries <- amqp091.Delivery{Acknowledger: sent, Body: notificationBody(t)}
+	channel.deliveries <- amqp091.Delivery{Acknowledger: quarantined, Body: notificationBody(t),
+		Headers: amqp091.Table{"x-delivery-count": int64(4)}}
+
+	notifications := []*models.Notification{<-objects, <-objects}
+	_ = receiver.StopReceiving()
+
+	// first one is sent
+	if attempt := notifications[0].Attempt(); attempt != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, attempt)
+	}
+	if err := notifications[0].Delivery.Ack(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if acks, rejects := sent.counts(); acks != 1 || rejects != 0 {
+		t.Errorf("Expected '%d' acks and '%d' rejects, got '%d' and '%d'", 1, 0, acks, rejects)
+	}
+
+	// second one is out of attempts
+	if attempt := notifications[1].Attempt(); attempt != 5 {
+		t.Errorf("Expected '%d', got '%d'", 5, attempt)
+	}
+	if err := notifications[1].Delivery.Quarantine(errors.New("smtp is down")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if acks, rejects := quarantined.counts(); acks != 1 || rejects != 0 {
+		t.Errorf("Expected '%d' acks and '%d' rejects, got '%d' and '%d'", 1, 0, acks, rejects)
+	}
+
+	published := channel.published()
+	if len(published) != 1 {
+		t.Fatalf("Expected '%d', got '%d'", 1, len(published))
+	}
+	if reason := published[0].msg.Headers["x-quarantine-reason"]; reason != "smtp is down" {
+		t.Errorf("Expected '%s', got '%v'", "smtp is down", reason)
+	}
+}
+
+func TestRabbitMQReceiverDeliveryNackRequeues(t *testing.T) {
+	channel := newMemoryChannel()
+	receiver := newReceiver(channel, quarantineQueue)
+	objects := receiver.StartReceiving()
+
+	ack := &acknowledger{}
+	channel.deliveries <- amqp091.Delivery{Acknowledger: ack, Body: notificationBody(t)}
+
+	object := <-objects
+	_ = receiver.StopReceiving()
+
+	if err := object.Delivery.Nack(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ack.mu.Lock()
+	defer ack.mu.Unlock()
+	if ack.requeues != 1 || ack.acks != 0 || ack.rejects != 0 {
+		t.Errorf("Expected '%d' requeues, got '%d' (and '%d' acks, '%d' rejects)", 1, ack.requeues, ack.acks, ack.rejects)
+	}
+	if published := channel.published(); len(published) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(published))
+	}
+}
+
+func TestRabbitMQReceiverAttemptOfClassicQueue(t *testing.T) {
+	channel := newMemoryChannel()
+	receiver := newReceiver(channel, quarantineQueue)
+	objects := receiver.StartReceiving()
+
+	channel.deliveries <- amqp091.Delivery{Acknowledger: &acknowledger{}, Body: notificationBody(t), Redelivered: true}
+
+	object := <-objects
+	_ = receiver.StopReceiving()
+	if attempt := object.Attempt(); attempt != 2 {
+		t.Errorf("Expected '%d', got '%d'", 2, attempt)
+	}
+}
+
+func TestRabbitMQReceiverStopsWithoutReader(t *testing.T) {
+	channel := newMemoryChannel()
+	receiver := newReceiver(channel, quarantineQueue)
+	objects := receiver.StartReceiving()
+
+	// nobody reads it, e.g. service is shutting down
+	ack := &acknowledger{}
+	channel.deliveries <- amqp091.Delivery{Acknowledger: ack, Body: notificationBody(t)}
+	time.Sleep(20 * time.Millisecond)
+	_ = receiver.StopReceiving()
+	time.Sleep(20 * time.Millisecond)
+
+	if object, ok := <-objects; ok {
+		t.Errorf("Expected objects to be closed, got '%s'", object.ID.String())
+	}
+
+	// left unsettled, broker delivers it again
+	if acks, rejects := ack.counts(); acks != 0 || rejects != 0 {
+		t.Errorf("Expected '%d' acks and '%d' rejects, got '%d' and '%d'", 0, 0, acks, rejects)
+	}
+}
+
+func TestRabbitMQReceiverKeepsPublicationAtNanoseconds(t *testing.T) {
+	channel := newMemoryChannel()
+	receiver := newReceiver(channel, quarantineQueue)
+	objects := receiver.StartReceiving()
+
+	body := `{"id":"` + types.GenerateUUID().String() + `","channel":"console","publication_at":"2025-01-01T12:00:00.123456789Z",` +
+		`"content":{"title":"title","message":"message"}}`
+	channel.deliveries <- amqp091.Delivery{Acknowledger: &acknowledger{}, Body: []byte(body)}
+
+	object := <-objects
+	_ = receiver.StopReceiving()
+
+	expected := time.Date(2025, 1, 1, 12, 0, 0, 123456789, time.UTC)
+	if !object.PublicationAt.Value().Equal(expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, object.PublicationAt.Value())
+	}
+}
@@ -0,0 +1,150 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/limiters"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/retry"
+	"os"
+	"testing"
+	"time"
+)
+
+func takeOrFail(t *testing.T, limiter ports.RateLimiter, buckets ...models.RateLimitBucket) time.Duration {
+	wait, err := limiter.Take(context.Background(), buckets...)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return wait
+}
+
+func TestMemoryRateLimiterRefillsBucket(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := limiters.NewMemoryRateLimiterWithClock(func() time.Time { return now })
+
+	bucket := models.RateLimitBucket{Key: "channel:email", Limit: models.RateLimit{Rate: 2, Burst: 3}}
+
+	// starts full
+	for i := 0; i < 3; i++ {
+		if wait := takeOrFail(t, limiter, bucket); wait != 0 {
+			t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+		}
+	}
+	if wait := takeOrFail(t, limiter, bucket); wait != 500*time.Millisecond {
+		t.Errorf("Expected '%v', got '%v'", 500*time.Millisecond, wait)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if wait := takeOrFail(t, limiter, bucket); wait != 250*time.Millisecond {
+		t.Errorf("Expected '%v', got '%v'", 250*time.Millisecond, wait)
+	}
+
+	now = now.Add(250 * time.Millisecond)
+	if wait := takeOrFail(t, limiter, bucket); wait != 0 {
+		t.Errorf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+
+	// never more than burst
+	now = now.Add(time.Hour)
+	for i := 0; i < 3; i++ {
+		if wait := takeOrFail(t, limiter, bucket); wait != 0 {
+			t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+		}
+	}
+	if wait := takeOrFail(t, limiter, bucket); wait == 0 {
+		t.Errorf("Expected a wait, got '%v'", wait)
+	}
+}
+
+func TestMemoryRateLimiterTakesAllOrNothing(t *testing.T) {
+	now := time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+	limiter := limiters.NewMemoryRateLimiterWithClock(func() time.Time { return now })
+
+	channel := models.RateLimitBucket{Key: "channel:telegram", Limit: models.RateLimit{Rate: 1, Burst: 2}}
+	alice := models.RateLimitBucket{Key: "recipient:telegram:1", Limit: models.RateLimit{Rate: 1, Burst: 1}}
+	bob := models.RateLimitBucket{Key: "recipient:telegram:2", Limit: models.RateLimit{Rate: 1, Burst: 1}}
+	unlimited := models.RateLimitBucket{Key: "channel:console"}
+
+	if wait := takeOrFail(t, limiter, channel, alice); wait != 0 {
+		t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+
+	// alice is over her limit: channel token isn't taken
+	if wait := takeOrFail(t, limiter, channel, alice); wait != time.Second {
+		t.Errorf("Expected '%v', got '%v'", time.Second, wait)
+	}
+
+	// so bob gets the last one
+	if wait := takeOrFail(t, limiter, channel, bob); wait != 0 {
+		t.Errorf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+
+	for i := 0; i < 10; i++ {
+		if wait := takeOrFail(t, limiter, unlimited); wait != 0 {
+			t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+		}
+	}
+}
+
+// redisLimiter connects to redis at CONSUMER_WORKER_TEST_REDIS_ADDR, test is skipped without it. Keys are unique per test
+func redisLimiter(t *testing.T) *limiters.RedisRateLimiter {
+	addr := os.Getenv("CONSUMER_WORKER_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("CONSUMER_WORKER_TEST_REDIS_ADDR isn't set")
+	}
+
+	client := redis.New(addr, os.Getenv("CONSUMER_WORKER_TEST_REDIS_PASSWORD"), 0)
+	t.Cleanup(func() { _ = client.Close() })
+
+	prefix := "consumer_worker_test:" + types.GenerateUUID().String()
+	t.Cleanup(func() {
+		keys, _ := client.Keys(context.Background(), prefix+":*").Result()
+		if len(keys) > 0 {
+			_ = client.Client.Del(context.Background(), keys...).Err()
+		}
+	})
+
+	return limiters.NewRedisRateLimiter(client, retry.Strategy{Attempts: 1}, prefix)
+}
+
+func TestRedisRateLimiterIsSharedByReplicas(t *testing.T) {
+	first := redisLimiter(t)
+	// same redis and prefix = another replica
+	second := *first
+
+	bucket := models.RateLimitBucket{Key: "channel:email", Limit: models.RateLimit{Rate: 1, Burst: 2}}
+
+	if wait := takeOrFail(t, first, bucket); wait != 0 {
+		t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+	if wait := takeOrFail(t, &second, bucket); wait != 0 {
+		t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+	if wait := takeOrFail(t, first, bucket); wait <= 0 || wait > time.Second {
+		t.Errorf("Expected a wait in (0; %v], got '%v'", time.Second, wait)
+	}
+}
+
+func TestRedisRateLimiterTakesAllOrNothing(t *testing.T) {
+	limiter := redisLimiter(t)
+
+	channel := models.RateLimitBucket{Key: "channel:telegram", Limit: models.RateLimit{Rate: 0.001, Burst: 2}}
+	alice := models.RateLimitBucket{Key: "recipient:telegram:1", Limit: models.RateLimit{Rate: 0.001, Burst: 1}}
+	bob := models.RateLimitBucket{Key: "recipient:telegram:2", Limit: models.RateLimit{Rate: 0.001, Burst: 1}}
+
+	if wait := takeOrFail(t, limiter, channel, alice); wait != 0 {
+		t.Fatalf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+	if wait := takeOrFail(t, limiter, channel, alice); wait == 0 {
+		t.Errorf("Expected a wait, got '%v'", wait)
+	}
+	if wait := takeOrFail(t, limiter, channel, bob); wait != 0 {
+		t.Errorf("Expected '%v', got '%v'", time.Duration(0), wait)
+	}
+	if wait := takeOrFail(t, limiter, channel); wait == 0 {
+		t.Errorf("Expected a wait, got '%v'", wait)
+	}
+}
@@ -0,0 +1,172 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/stores"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"time"
+)
+
+func newNotification(title string) *models.Notification {
+	id := types.GenerateUUID()
+	return &models.Notification{
+		PublicationAt: types.NewDateTime(time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)),
+		ID:            &id,
+		Channel:       internaltypes.ChannelConsole,
+		Content: models.NotificationContent{
+			Title:   types.NewAnyText(title),
+			Message: types.NewAnyText("message of " + title),
+		},
+	}
+}
+
+// loadedTitles reopens store in dir and returns sorted titles of what's in it
+func loadedTitles(t *testing.T, dir string) []string {
+	store, err := stores.NewWALStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		if closeErr := store.Close(); closeErr != nil {
+			t.Errorf("Unexpected error: %v", closeErr)
+		}
+	}()
+
+	loaded, err := store.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	titles := make([]string, 0, len(loaded))
+	for _, notification := range loaded {
+		titles = append(titles, notification.Content.Title.String())
+	}
+	slices.Sort(titles)
+	return titles
+}
+
+func TestWALStoreSurvivesReopen(t *testing.T) {
+	testCases := []struct {
+		name          string
+		snapshotEvery int
+	}{
+		{name: "wal only", snapshotEvery: 0},
+		{name: "snapshot every record", snapshotEvery: 1},
+		{name: "snapshot in the middle", snapshotEvery: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			ctx := context.Background()
+
+			store, err := stores.NewWALStore(dir, tc.snapshotEvery)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			a, b, c := newNotification("a"), newNotification("b"), newNotification("c")
+			for _, notification := range []*models.Notification{a, b, c} {
+				if err = store.Save(ctx, notification); err != nil {
+					t.Fatalf("Unexpected error: %v", err)
+				}
+			}
+			if err = store.Remove(ctx, *b.ID); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			// missing ones are ignored
+			if err = store.Remove(ctx, *b.ID); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// no Close: the process is killed
+			expected := []string{"a", "c"}
+			if titles := loadedTitles(t, dir); !slices.Equal(titles, expected) {
+				t.Errorf("Expected '%v', got '%v'", expected, titles)
+			}
+		})
+	}
+}
+
+func TestWALStoreSkipsTornRecord(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := stores.NewWALStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = store.Save(ctx, newNotification("a")); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// crash in the middle of the next write
+	wal, err := os.OpenFile(filepath.Join(dir, "notifications.wal"), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err = wal.WriteString(`{"op":"save","id":"2c1a`); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = wal.Close(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	expected := []string{"a"}
+	if titles := loadedTitles(t, dir); !slices.Equal(titles, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, titles)
+	}
+
+	// torn tail is gone after reopen, so new records are readable
+	if titles := loadedTitles(t, dir); !slices.Equal(titles, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, titles)
+	}
+}
+
+func TestWALStoreKeepsTemplate(t *testing.T) {
+	dir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := stores.NewWALStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	notification := newNotification("")
+	notification.Template = &models.NotificationTemplate{
+		Title:     types.NewAnyText("Hi {{.name}}"),
+		Message:   types.NewAnyText("Bye {{.name}}"),
+		Variables: map[string]any{"name": "Bob"},
+	}
+	if err = store.Save(ctx, notification); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	reopened, err := stores.NewWALStore(dir, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	loaded, err := reopened.Load(ctx)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(loaded) != 1 {
+		t.Fatalf("Expected '%d', got '%d'", 1, len(loaded))
+	}
+
+	if err = loaded[0].Render(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if loaded[0].Content.Message.String() != "Bye Bob" {
+		t.Errorf("Expected '%s', got '%s'", "Bye Bob", loaded[0].Content.Message)
+	}
+	if loaded[0].ID.String() != notification.ID.String() {
+		t.Errorf("Expected '%s', got '%s'", notification.ID, loaded[0].ID)
+	}
+}
@@ -0,0 +1,152 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/senders"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/retry"
+	"mime"
+	"net"
+	"net/mail"
+	"strings"
+	"testing"
+	"time"
+)
+
+// smtpServer is the stand-in of SMTP server that accepts any auth and remembers the DATA of 1 message
+type smtpServer struct {
+	listener net.Listener
+	data     chan string
+}
+
+func newSMTPServer(t *testing.T) *smtpServer {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	server := &smtpServer{listener: listener, data: make(chan string, 1)}
+	t.Cleanup(func() { _ = listener.Close() })
+
+	go server.serve()
+	return server
+}
+
+func (s *smtpServer) port() int {
+	return s.listener.Addr().(*net.TCPAddr).Port
+}
+
+func (s *smtpServer) serve() {
+	conn, err := s.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer func() { _ = conn.Close() }()
+
+	reader := bufio.NewReader(conn)
+	reply := func(line string) { _, _ = conn.Write([]byte(line + "\r\n")) }
+
+	reply("220 localhost ESMTP")
+	for {
+		line, errRead := reader.ReadString('\n')
+		if errRead != nil {
+			return
+		}
+
+		switch command := strings.ToUpper(strings.TrimSpace(line)); {
+		case strings.HasPrefix(command, "EHLO"):
+			reply("250-localhost")
+			reply("250 AUTH PLAIN")
+		case strings.HasPrefix(command, "AUTH"):
+			reply("235 2.7.0 Authentication successful")
+		case strings.HasPrefix(command, "DATA"):
+			reply("354 End data with <CR><LF>.<CR><LF>")
+			var data strings.Builder
+			for {
+				dataLine, errData := reader.ReadString('\n')
+				if errData != nil {
+					return
+				}
+				if dataLine == ".\r\n" {
+					break
+				}
+				data.WriteString(dataLine)
+			}
+			s.data <- data.String()
+			reply("250 OK")
+		case strings.HasPrefix(command, "QUIT"):
+			reply("221 Bye")
+			return
+		default:
+			reply("250 OK")
+		}
+	}
+}
+
+func TestEmailSenderKeepsTitleOnOneLine(t *testing.T) {
+	tests := []struct {
+		name string
+		html bool
+	}{
+		{name: "plain text", html: false},
+		{name: "html with subject", html: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := newSMTPServer(t)
+			sender := senders.NewEmailSender("from@example.com", "password", "127.0.0.1", server.port(),
+				retry.Strategy{Attempts: 1, Delay: time.Millisecond, Backoff: 1})
+
+			// sender doesn't validate the address, so it isn't validated here either
+			sendTo, err := internaltypes.NewSendTo(types.NewAnyText("to@example.com"), internaltypes.ChannelConsole)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			id := types.GenerateUUID()
+			notification := &models.Notification{
+				ID:      &id,
+				Channel: internaltypes.ChannelEmail,
+				Content: models.NotificationContent{
+					Title:   types.NewAnyText("Скидка 50%\r\nBcc: victim@example.com"),
+					Message: types.NewAnyText("<p>hello</p>"),
+					HTML:    tt.html,
+				},
+				SendTo: sendTo,
+			}
+
+			if err = sender.Send(context.Background(), notification); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			var data string
+			select {
+			case data = <-server.data:
+			case <-time.After(time.Second):
+				t.Fatalf("Expected message to be sent")
+			}
+
+			if strings.Contains(data, "\nBcc:") {
+				t.Errorf("Expected no Bcc header, got '%s'", data)
+			}
+			if !tt.html {
+				return
+			}
+
+			message, err := mail.ReadMessage(strings.NewReader(data))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			subject, err := new(mime.WordDecoder).DecodeHeader(message.Header.Get("Subject"))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if expected := "Скидка 50% Bcc: victim@example.com"; subject != expected {
+				t.Errorf("Expected '%s', got '%s'", expected, subject)
+			}
+		})
+	}
+}
@@ -0,0 +1,336 @@
+package tests
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/senders"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/retry"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+	"unicode/utf16"
+)
+
+const botToken = "123:secret"
+
+// sendMessageCall is a sendMessage request received by botAPI
+type sendMessageCall struct {
+	path      string
+	chatID    string
+	text      string
+	parseMode string
+	at        time.Time
+}
+
+// botAPI is the httptest stand-in of Bot API, it answers with responses in order and then with ok
+type botAPI struct {
+	server *httptest.Server
+
+	mu        sync.Mutex
+	calls     []sendMessageCall
+	responses []func(w http.ResponseWriter)
+}
+
+func newBotAPI(t *testing.T, responses ...func(w http.ResponseWriter)) *botAPI {
+	api := &botAPI{responses: responses}
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body := struct {
+			ChatID    string `json:"chat_id"`
+			Text      string `json:"text"`
+			ParseMode string `json:"parse_mode"`
+		}{}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			t.Errorf("Unexpected error: %v", err)
+		}
+
+		api.mu.Lock()
+		api.calls = append(api.calls, sendMessageCall{
+			path: r.URL.Path, chatID: body.ChatID, text: body.Text, parseMode: body.ParseMode, at: time.Now(),
+		})
+		var response func(w http.ResponseWriter)
+		if len(api.responses) > 0 {
+			response, api.responses = api.responses[0], api.responses[1:]
+		}
+		api.mu.Unlock()
+
+		if response == nil {
+			response = botAPIResponse(http.StatusOK, `{"ok":true,"result":{"message_id":1}}`)
+		}
+		response(w)
+	}))
+	t.Cleanup(api.server.Close)
+	return api
+}
+
+func (a *botAPI) sent() []sendMessageCall {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]sendMessageCall(nil), a.calls...)
+}
+
+func botAPIResponse(status int, body string) func(w http.ResponseWriter) {
+	return func(w http.ResponseWriter) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(body))
+	}
+}
+
+func newTelegramSender(t *testing.T, api *botAPI, parseMode string) *senders.TelegramSender {
+	sender, err := senders.NewTelegramSender(botToken, api.server.URL+"/", parseMode,
+		time.Second, 2*time.Second, retry.Strategy{Attempts: 3, Delay: 10 * time.Millisecond, Backoff: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return sender
+}
+
+func telegramNotification(t *testing.T, title, message string) *models.Notification {
+	sendTo, err := internaltypes.NewSendTo(types.NewAnyText("42"), internaltypes.ChannelTelegram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id := types.GenerateUUID()
+	return &models.Notification{
+		ID:      &id,
+		Channel: internaltypes.ChannelTelegram,
+		Content: models.NotificationContent{Title: types.NewAnyText(title), Message: types.NewAnyText(message)},
+		SendTo:  sendTo,
+	}
+}
+
+func TestTelegramSenderSendsMessage(t *testing.T) {
+	testCases := []struct {
+		parseMode string
+		expected  string
+	}{
+		{parseMode: senders.TelegramParseModePlain, expected: "Sale <50%>!\n\nhello"},
+		{parseMode: senders.TelegramParseModeHTML, expected: "<b>Sale &lt;50%&gt;!</b>\n\nhello"},
+		{parseMode: senders.TelegramParseModeMarkdownV2, expected: "*Sale <50%\\>\\!*\n\nhello"},
+	}
+
+	for _, tc := range testCases {
+		t.Run("parse mode "+tc.parseMode, func(t *testing.T) {
+			api := newBotAPI(t)
+
+			err := newTelegramSender(t, api, tc.parseMode).Send(context.Background(), telegramNotification(t, "Sale <50%>!", "hello"))
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			calls := api.sent()
+			if len(calls) != 1 {
+				t.Fatalf("Expected '%d', got '%d'", 1, len(calls))
+			}
+			if calls[0].path != "/bot"+botToken+"/sendMessage" {
+				t.Errorf("Expected '%s', got '%s'", "/bot"+botToken+"/sendMessage", calls[0].path)
+			}
+			if calls[0].chatID != "42" {
+				t.Errorf("Expected '%s', got '%s'", "42", calls[0].chatID)
+			}
+			if calls[0].parseMode != tc.parseMode {
+				t.Errorf("Expected '%s', got '%s'", tc.parseMode, calls[0].parseMode)
+			}
+			if calls[0].text != tc.expected {
+				t.Errorf("Expected '%s', got '%s'", tc.expected, calls[0].text)
+			}
+		})
+	}
+}
+
+func TestTelegramSenderSplitsLongMessages(t *testing.T) {
+	api := newBotAPI(t)
+
+	// 3 lines of 3000 units: 2 of them never fit 1 message. Emoji are 2 UTF-16 units each
+	lines := []string{strings.Repeat("a", 3000), strings.Repeat("😀", 1500), strings.Repeat("b", 3000)}
+	message := strings.Join(lines, "\n")
+
+	err := newTelegramSender(t, api, senders.TelegramParseModePlain).Send(context.Background(), telegramNotification(t, "", message))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := api.sent()
+	if len(calls) != len(lines) {
+		t.Fatalf("Expected '%d', got '%d'", len(lines), len(calls))
+	}
+	for i, call := range calls {
+		if length := len(utf16.Encode([]rune(call.text))); length > senders.TelegramMessageLimit {
+			t.Errorf("Expected at most '%d', got '%d'", senders.TelegramMessageLimit, length)
+		}
+		if call.text != lines[i] {
+			t.Errorf("part %d isn't the line %d", i, i)
+		}
+	}
+}
+
+func TestTelegramSenderResumesFromFailedPart(t *testing.T) {
+	serverError := botAPIResponse(http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`)
+	// the 1st part is sent, the 2nd one fails all 3 attempts
+	api := newBotAPI(t, nil, serverError, serverError, serverError)
+	sender := newTelegramSender(t, api, senders.TelegramParseModePlain)
+
+	lines := []string{strings.Repeat("a", 3000), strings.Repeat("b", 3000), strings.Repeat("c", 3000)}
+	notification := telegramNotification(t, "", strings.Join(lines, "\n"))
+
+	if err := sender.Send(context.Background(), notification); err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if notification.SentParts != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, notification.SentParts)
+	}
+
+	if err := sender.Send(context.Background(), notification); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if notification.SentParts != len(lines) {
+		t.Errorf("Expected '%d', got '%d'", len(lines), notification.SentParts)
+	}
+
+	// 1 sent, 3 failed, then the rest
+	calls := api.sent()
+	if len(calls) != 6 {
+		t.Fatalf("Expected '%d', got '%d'", 6, len(calls))
+	}
+	texts := []string{calls[0].text, calls[4].text, calls[5].text}
+	for i, text := range texts {
+		if text != lines[i] {
+			t.Errorf("part %d isn't the line %d", i, i)
+		}
+	}
+}
+
+func TestTelegramSenderSplitsMessageWithoutLineBreaks(t *testing.T) {
+	api := newBotAPI(t)
+
+	message := strings.Repeat("x", 2*senders.TelegramMessageLimit+10)
+	err := newTelegramSender(t, api, senders.TelegramParseModePlain).Send(context.Background(), telegramNotification(t, "", message))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := api.sent()
+	if len(calls) != 3 {
+		t.Fatalf("Expected '%d', got '%d'", 3, len(calls))
+	}
+	joined := ""
+	for _, call := range calls {
+		joined += call.text
+	}
+	if joined != message {
+		t.Errorf("Expected parts to make up the message")
+	}
+}
+
+func TestTelegramSenderHonoursRetryAfter(t *testing.T) {
+	api := newBotAPI(t, botAPIResponse(http.StatusTooManyRequests,
+		`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 1","parameters":{"retry_after":1}}`))
+
+	err := newTelegramSender(t, api, senders.TelegramParseModePlain).Send(context.Background(), telegramNotification(t, "title", "message"))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	calls := api.sent()
+	if len(calls) != 2 {
+		t.Fatalf("Expected '%d', got '%d'", 2, len(calls))
+	}
+	if waited := calls[1].at.Sub(calls[0].at); waited < time.Second {
+		t.Errorf("Expected at least '%v', got '%v'", time.Second, waited)
+	}
+}
+
+func TestTelegramSenderFailsOnLongRetryAfter(t *testing.T) {
+	api := newBotAPI(t, botAPIResponse(http.StatusTooManyRequests,
+		`{"ok":false,"error_code":429,"description":"Too Many Requests: retry after 60","parameters":{"retry_after":60}}`))
+
+	started := time.Now()
+	err := newTelegramSender(t, api, senders.TelegramParseModePlain).Send(context.Background(), telegramNotification(t, "title", "message"))
+	if err == nil {
+		t.Fatalf("Expected an error")
+	}
+	if errors.Is(err, models.ErrTerminal) {
+		t.Errorf("Expected a transient error, got '%v'", err)
+	}
+	var retryAfter *models.RetryAfter
+	if !errors.As(err, &retryAfter) {
+		t.Fatalf("Expected models.RetryAfter, got '%v'", err)
+	}
+	if retryAfter.Wait != time.Minute {
+		t.Errorf("Expected '%v', got '%v'", time.Minute, retryAfter.Wait)
+	}
+	if elapsed := time.Since(started); elapsed > time.Second {
+		t.Errorf("Expected no wait, got '%v'", elapsed)
+	}
+	if len(api.sent()) != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, len(api.sent()))
+	}
+}
+
+func TestTelegramSenderErrors(t *testing.T) {
+	testCases := []struct {
+		name          string
+		response      func(w http.ResponseWriter)
+		terminal      bool
+		expectedCalls int
+	}{
+		{
+			name:          "chat not found",
+			response:      botAPIResponse(http.StatusBadRequest, `{"ok":false,"error_code":400,"description":"Bad Request: chat not found"}`),
+			terminal:      true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "bot blocked",
+			response:      botAPIResponse(http.StatusForbidden, `{"ok":false,"error_code":403,"description":"Forbidden: bot was blocked by the user"}`),
+			terminal:      true,
+			expectedCalls: 1,
+		},
+		{
+			name:          "server error",
+			response:      botAPIResponse(http.StatusBadGateway, `{"ok":false,"error_code":502,"description":"Bad Gateway"}`),
+			terminal:      false,
+			expectedCalls: 3,
+		},
+		{
+			name:          "not a Bot API response",
+			response:      botAPIResponse(http.StatusBadGateway, `<html>bad gateway</html>`),
+			terminal:      false,
+			expectedCalls: 3,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			api := newBotAPI(t, tc.response, tc.response, tc.response)
+
+			err := newTelegramSender(t, api, senders.TelegramParseModePlain).Send(context.Background(), telegramNotification(t, "title", "message"))
+			if err == nil {
+				t.Fatalf("Expected an error")
+			}
+			if errors.Is(err, models.ErrTerminal) != tc.terminal {
+				t.Errorf("Expected terminal '%t', got '%v'", tc.terminal, err)
+			}
+			if strings.Contains(err.Error(), botToken) {
+				t.Errorf("bot token leaked into error '%v'", err)
+			}
+			if len(api.sent()) != tc.expectedCalls {
+				t.Errorf("Expected '%d', got '%d'", tc.expectedCalls, len(api.sent()))
+			}
+		})
+	}
+}
+
+func TestTelegramSenderRejectsUnknownParseMode(t *testing.T) {
+	_, err := senders.NewTelegramSender(botToken, "https://api.telegram.org", "BBCode", time.Second, time.Second, retry.Strategy{})
+	if err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,196 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/service"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// blockingSender is the ports.NotificationSender that waits for release before returning
+type blockingSender struct {
+	entered chan struct{}
+	release chan struct{}
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+	sent        int
+}
+
+func newBlockingSender() *blockingSender {
+	return &blockingSender{entered: make(chan struct{}, 100), release: make(chan struct{})}
+}
+
+func (s *blockingSender) Send(_ context.Context, _ *models.Notification) error {
+	s.mu.Lock()
+	s.inFlight++
+	s.maxInFlight = max(s.maxInFlight, s.inFlight)
+	s.mu.Unlock()
+
+	s.entered <- struct{}{}
+	<-s.release
+
+	s.mu.Lock()
+	s.inFlight--
+	s.sent++
+	s.mu.Unlock()
+	return nil
+}
+
+func (s *blockingSender) stats() (maxInFlight, sent int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.maxInFlight, s.sent
+}
+
+func emailNotification(title string) *models.Notification {
+	notification := consoleNotification(title, time.Now().Add(-time.Minute))
+	notification.Channel = internaltypes.ChannelEmail
+	return notification
+}
+
+func TestSlowChannelDoesNotDelayOthers(t *testing.T) {
+	emailSender := newBlockingSender()
+	defer close(emailSender.release)
+
+	consoleSent := make(chan struct{})
+	consoleSender := &memorySender{onSend: func() { close(consoleSent) }}
+
+	notificationService := service.NewNotificationService(
+		newMemoryReceiver(emailNotification("a"), emailNotification("b"), consoleNotification("c", time.Now().Add(-time.Minute))),
+		map[internaltypes.NotificationChannel]ports.NotificationSender{
+			internaltypes.ChannelEmail:   emailSender,
+			internaltypes.ChannelConsole: consoleSender,
+		},
+		nil,
+		nil,
+		nil,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = notificationService.Run(ctx) }()
+
+	// email is stuck in the middle of the send
+	select {
+	case <-emailSender.entered:
+	case <-time.After(time.Second):
+		t.Fatalf("email wasn't sent in time")
+	}
+
+	select {
+	case <-consoleSent:
+	case <-time.After(time.Second):
+		t.Fatalf("console notification was delayed by email one")
+	}
+}
+
+func TestRunWaitsForInFlightSends(t *testing.T) {
+	sender := newBlockingSender()
+
+	notificationService := service.NewNotificationService(
+		newMemoryReceiver(consoleNotification("a", time.Now().Add(-time.Minute))),
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		nil,
+		nil,
+		nil,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	stopped := make(chan error, 1)
+	go func() { stopped <- notificationService.Run(ctx) }()
+
+	select {
+	case <-sender.entered:
+	case <-time.After(time.Second):
+		t.Fatalf("notification wasn't sent in time")
+	}
+
+	cancel()
+	select {
+	case <-stopped:
+		t.Fatalf("Run returned before in-flight send finished")
+	case <-time.After(100 * time.Millisecond):
+	}
+
+	close(sender.release)
+	select {
+	case err := <-stopped:
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatalf("Run didn't return after in-flight send finished")
+	}
+
+	if _, sent := sender.stats(); sent != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, sent)
+	}
+}
+
+func TestConcurrencyIsBounded(t *testing.T) {
+	testCases := []struct {
+		name        string
+		concurrency int
+		expected    int
+	}{
+		{name: "not set", concurrency: 0, expected: 1},
+		{name: "1", concurrency: 1, expected: 1},
+		{name: "3", concurrency: 3, expected: 3},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			sender := newBlockingSender()
+
+			notifications := make([]*models.Notification, 0, 6)
+			for i := 0; i < cap(notifications); i++ {
+				notifications = append(notifications, consoleNotification(strconv.Itoa(i), time.Now().Add(-time.Minute)))
+			}
+
+			notificationService := service.NewNotificationService(
+				newMemoryReceiver(notifications...),
+				map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+				map[internaltypes.NotificationChannel]service.ChannelConfig{internaltypes.ChannelConsole: {Concurrency: tc.concurrency}},
+				nil,
+				nil,
+				nil,
+				checkPeriod,
+			)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			stopped := make(chan error, 1)
+			go func() { stopped <- notificationService.Run(ctx) }()
+
+			// let every worker take a notification, the rest must wait
+			for i := 0; i < tc.expected; i++ {
+				select {
+				case <-sender.entered:
+				case <-time.After(time.Second):
+					t.Fatalf("notification wasn't sent in time")
+				}
+			}
+			time.Sleep(10 * checkPeriod)
+
+			if maxInFlight, _ := sender.stats(); maxInFlight != tc.expected {
+				t.Errorf("Expected '%d', got '%d'", tc.expected, maxInFlight)
+			}
+
+			cancel()
+			close(sender.release)
+			if err := <-stopped; err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,478 @@
+package tests
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/stores"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/service"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"os"
+	"os/exec"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+const (
+	// crashDirEnv tells test binary to run as the worker that gets killed, see TestCrashHelper
+	crashDirEnv = "CONSUMER_WORKER_TEST_CRASH_DIR"
+
+	dueNow   = 5
+	dueLater = 7
+	// laterIn is how soon later ones are due: worker is killed long before that, restarted one sends them
+	laterIn = 2 * time.Second
+
+	checkPeriod = 10 * time.Millisecond
+)
+
+// memoryReceiver is the ports.NotificationReceiver that gives away given notifications
+type memoryReceiver struct {
+	objects chan *models.Notification
+}
+
+func newMemoryReceiver(notifications ...*models.Notification) *memoryReceiver {
+	r := &memoryReceiver{objects: make(chan *models.Notification)}
+	go func() {
+		for _, notification := range notifications {
+			r.objects <- notification
+		}
+	}()
+	return r
+}
+
+func (r *memoryReceiver) StartReceiving() <-chan *models.Notification { return r.objects }
+
+func (r *memoryReceiver) StopReceiving() error { return nil }
+
+// memorySender is the ports.NotificationSender that remembers titles of sent notifications
+type memorySender struct {
+	mu     sync.Mutex
+	titles map[string]int
+
+	// onSend is called after every send, may be nil
+	onSend func()
+}
+
+func (s *memorySender) Send(_ context.Context, notification *models.Notification) error {
+	s.mu.Lock()
+	if s.titles == nil {
+		s.titles = make(map[string]int)
+	}
+	s.titles[notification.Content.Title.String()]++
+	s.mu.Unlock()
+
+	if s.onSend != nil {
+		s.onSend()
+	}
+	return nil
+}
+
+func (s *memorySender) sent() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	result := make(map[string]int, len(s.titles))
+	for title, count := range s.titles {
+		result[title] = count
+	}
+	return result
+}
+
+// countingStore is the ports.NotificationStore that counts successful changes of wrapped one
+type countingStore struct {
+	*stores.WALStore
+
+	mu      sync.Mutex
+	saved   int
+	removed int
+
+	// onChange is called after every change with the counters, may be nil
+	onChange func(saved, removed int)
+}
+
+func (s *countingStore) Save(ctx context.Context, notification *models.Notification) error {
+	err := s.WALStore.Save(ctx, notification)
+	if err == nil {
+		s.changed(1, 0)
+	}
+	return err
+}
+
+func (s *countingStore) Remove(ctx context.Context, id types.UUID) error {
+	err := s.WALStore.Remove(ctx, id)
+	if err == nil {
+		s.changed(0, 1)
+	}
+	return err
+}
+
+func (s *countingStore) changed(saved, removed int) {
+	s.mu.Lock()
+	s.saved += saved
+	s.removed += removed
+	saved, removed = s.saved, s.removed
+	s.mu.Unlock()
+
+	if s.onChange != nil {
+		s.onChange(saved, removed)
+	}
+}
+
+func consoleNotification(title string, publicationAt time.Time) *models.Notification {
+	id := types.GenerateUUID()
+	return &models.Notification{
+		PublicationAt: types.NewDateTime(publicationAt.UTC()),
+		ID:            &id,
+		Channel:       internaltypes.ChannelConsole,
+		Content: models.NotificationContent{
+			Title:   types.NewAnyText(title),
+			Message: types.NewAnyText(title),
+		},
+	}
+}
+
+func newService(receiver ports.NotificationReceiver, sender ports.NotificationSender, store ports.NotificationStore) *service.NotificationService {
+	return service.NewNotificationService(
+		receiver,
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		nil,
+		nil,
+		nil,
+		store,
+		checkPeriod,
+	)
+}
+
+// TestCrashHelper is the worker process of TestServiceRestoresNotificationsAfterKill, does nothing in normal runs
+//
+// receives dueNow notifications to send right away and dueLater ones due in laterIn,
+// prints "ready" once due ones are sent and removed from store and waits to be killed
+func TestCrashHelper(t *testing.T) {
+	dir := os.Getenv(crashDirEnv)
+	if dir == "" {
+		t.Skip("run by TestServiceRestoresNotificationsAfterKill only")
+	}
+
+	walStore, err := stores.NewWALStore(dir, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	ready := make(chan struct{})
+	readyOnce := sync.Once{}
+	store := &countingStore{WALStore: walStore, onChange: func(saved, removed int) {
+		if saved == dueNow+dueLater && removed == dueNow {
+			readyOnce.Do(func() { close(ready) })
+		}
+	}}
+
+	notifications := make([]*models.Notification, 0, dueNow+dueLater)
+	for i := 0; i < dueNow; i++ {
+		notifications = append(notifications, consoleNotification("now "+strconv.Itoa(i), time.Now().Add(-time.Minute)))
+	}
+	for i := 0; i < dueLater; i++ {
+		notifications = append(notifications, consoleNotification("later "+strconv.Itoa(i), time.Now().Add(laterIn)))
+	}
+
+	go func() {
+		_ = newService(newMemoryReceiver(notifications...), &memorySender{}, store).Run(context.Background())
+	}()
+
+	<-ready
+	fmt.Println("ready")
+
+	// killed here
+	select {}
+}
+
+func TestServiceRestoresNotificationsAfterKill(t *testing.T) {
+	if os.Getenv(crashDirEnv) != "" {
+		t.Skip("this is the worker process")
+	}
+
+	dir := t.TempDir()
+
+	// step 1. run worker in another process and kill it mid-run
+	worker := exec.Command(os.Args[0], "-test.run=^TestCrashHelper$", "-test.v")
+	worker.Env = append(os.Environ(), crashDirEnv+"="+dir)
+	stdout, err := worker.StdoutPipe()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err = worker.Start(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	readyLine := make(chan bool, 1)
+	go func() {
+		scanner := bufio.NewScanner(stdout)
+		for scanner.Scan() {
+			if scanner.Text() == "ready" {
+				readyLine <- true
+				break
+			}
+		}
+		close(readyLine)
+	}()
+
+	select {
+	case ok := <-readyLine:
+		if !ok {
+			_ = worker.Wait()
+			t.Fatalf("worker exited before it was ready")
+		}
+	case <-time.After(10 * time.Second):
+		_ = worker.Process.Kill()
+		t.Fatalf("worker wasn't ready in time")
+	}
+
+	if err = worker.Process.Kill(); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	_ = worker.Wait()
+
+	// step 2. restart with nothing to receive
+	walStore, err := stores.NewWALStore(dir, 4)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		if closeErr := walStore.Close(); closeErr != nil {
+			t.Errorf("Unexpected error: %v", closeErr)
+		}
+	}()
+
+	done := make(chan struct{})
+	doneOnce := sync.Once{}
+	sender := &memorySender{}
+	store := &countingStore{WALStore: walStore, onChange: func(_, removed int) {
+		if removed == dueLater {
+			doneOnce.Do(func() { close(done) })
+		}
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	serviceErr := make(chan error, 1)
+	go func() {
+		serviceErr <- newService(newMemoryReceiver(), sender, store).Run(ctx)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(laterIn + 5*time.Second):
+		t.Fatalf("restored notifications weren't sent in time, sent: %v", sender.sent())
+	}
+	cancel()
+	if err = <-serviceErr; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// step 3. every later one is sent exactly once, no due one is sent again
+	sent := sender.sent()
+	if len(sent) != dueLater {
+		t.Errorf("Expected '%d', got '%d': %v", dueLater, len(sent), sent)
+	}
+	for i := 0; i < dueLater; i++ {
+		title := "later " + strconv.Itoa(i)
+		if sent[title] != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, sent[title], title)
+		}
+	}
+
+	leftovers, err := walStore.Load(context.Background())
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(leftovers) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(leftovers))
+	}
+}
+
+func TestServiceDoesNotScheduleRedeliveredNotificationTwice(t *testing.T) {
+	const (
+		// redeliveredPending comes while the restored one waits in heap
+		redeliveredPending = iota
+		// redeliveredInFlight comes while the restored one is being sent
+		redeliveredInFlight
+		// redeliveredSent comes after the restored one is sent
+		redeliveredSent
+	)
+
+	tests := []struct {
+		name          string
+		publicationAt time.Time
+		redelivered   int
+	}{
+		{name: "due later", publicationAt: time.Now().Add(200 * time.Millisecond), redelivered: redeliveredPending},
+		{name: "already due, redelivered while sending", publicationAt: time.Now().Add(-time.Minute), redelivered: redeliveredInFlight},
+		{name: "already due, redelivered after send", publicationAt: time.Now().Add(-time.Minute), redelivered: redeliveredSent},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+
+			walStore, err := stores.NewWALStore(t.TempDir(), 0)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			defer func() {
+				if closeErr := walStore.Close(); closeErr != nil {
+					t.Errorf("Unexpected error: %v", closeErr)
+				}
+			}()
+
+			stored := consoleNotification("restored", tt.publicationAt)
+			if err = walStore.Save(ctx, stored); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			// broker redelivers the same unacked message
+			redelivered := *stored
+			delivery := newMemoryDelivery(2)
+			redelivered.Delivery = delivery
+
+			receiver := &memoryReceiver{objects: make(chan *models.Notification)}
+			sender := &memorySender{}
+			switch tt.redelivered {
+			case redeliveredPending:
+				go func() { receiver.objects <- &redelivered }()
+			case redeliveredInFlight:
+				sender.onSend = func() {
+					receiver.objects <- &redelivered
+					// handed over before the send is finished
+					time.Sleep(100 * time.Millisecond)
+				}
+			case redeliveredSent:
+				sender.onSend = func() {
+					go func() {
+						time.Sleep(100 * time.Millisecond)
+						receiver.objects <- &redelivered
+					}()
+				}
+			}
+
+			publisher := &memoryResultPublisher{}
+			notificationService := service.NewNotificationService(
+				receiver,
+				map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+				nil,
+				nil,
+				publisher,
+				walStore,
+				checkPeriod,
+			)
+
+			runCtx, cancel := context.WithCancel(ctx)
+			done := make(chan error)
+			go func() {
+				done <- notificationService.Run(runCtx)
+			}()
+
+			select {
+			case <-delivery.closed:
+			case <-time.After(2 * time.Second):
+				t.Errorf("Expected redelivered notification to be settled")
+			}
+			cancel()
+			if err = <-done; err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if sent := sender.sent(); sent["restored"] != 1 {
+				t.Errorf("Expected '%d', got '%d'", 1, sent["restored"])
+			}
+			if acks, quarantined := delivery.counts(); acks != 1 || quarantined != 0 {
+				t.Errorf("Expected '%d' acks and '%d' quarantines, got '%d' and '%d'", 1, 0, acks, quarantined)
+			}
+			if results := publisher.published(); len(results) != 1 || results[0].Outcome != models.OutcomeDelivered {
+				t.Errorf("Expected 1 '%s' result, got %d", models.OutcomeDelivered, len(results))
+			}
+
+			leftovers, err := walStore.Load(ctx)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if len(leftovers) != 0 {
+				t.Errorf("Expected '%d', got '%d'", 0, len(leftovers))
+			}
+		})
+	}
+}
+
+func TestServiceDoesNotReportRestoredNotificationOutOfAttempts(t *testing.T) {
+	ctx := context.Background()
+
+	walStore, err := stores.NewWALStore(t.TempDir(), 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	defer func() {
+		if closeErr := walStore.Close(); closeErr != nil {
+			t.Errorf("Unexpected error: %v", closeErr)
+		}
+	}()
+
+	stored := consoleNotification("restored", time.Now().Add(-time.Minute))
+	if err = walStore.Save(ctx, stored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	redelivered := *stored
+	delivery := newMemoryDelivery(1)
+	redelivered.Delivery = delivery
+
+	// 1 attempt only: restored one fails and broker's copy is sent after it
+	receiver := &memoryReceiver{objects: make(chan *models.Notification)}
+	sender := &failingSender{errs: []error{errors.New("smtp is down")}}
+	publisher := &memoryResultPublisher{}
+	notificationService := service.NewNotificationService(
+		receiver,
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		nil,
+		nil,
+		publisher,
+		walStore,
+		checkPeriod,
+	)
+
+	runCtx, cancel := context.WithCancel(ctx)
+	done := make(chan error)
+	go func() {
+		done <- notificationService.Run(runCtx)
+	}()
+
+	time.Sleep(100 * time.Millisecond)
+	if results := publisher.published(); len(results) != 0 {
+		t.Errorf("Expected no results while broker holds the message, got '%d'", len(results))
+	}
+	receiver.objects <- &redelivered
+
+	select {
+	case <-delivery.closed:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected redelivered notification to be settled")
+	}
+	cancel()
+	if err = <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sends := len(sender.sends()); sends != 2 {
+		t.Errorf("Expected '%d', got '%d'", 2, sends)
+	}
+	if acks, quarantined := delivery.counts(); acks != 1 || quarantined != 0 {
+		t.Errorf("Expected '%d' acks and '%d' quarantines, got '%d' and '%d'", 1, 0, acks, quarantined)
+	}
+	if results := publisher.published(); len(results) != 1 || results[0].Outcome != models.OutcomeDelivered {
+		t.Errorf("Expected 1 '%s' result, got %d", models.OutcomeDelivered, len(results))
+	}
+}
@@ -0,0 +1,110 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/repositories/limiters"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/service"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestOverLimitNotificationsAreDeferredNotDropped(t *testing.T) {
+	const count = 4
+	const rate = 20
+
+	sentAt := make([]time.Time, 0, count)
+	mu := sync.Mutex{}
+	done := make(chan struct{})
+	sender := &memorySender{onSend: func() {
+		mu.Lock()
+		defer mu.Unlock()
+		sentAt = append(sentAt, time.Now())
+		if len(sentAt) == count {
+			close(done)
+		}
+	}}
+
+	notifications := make([]*models.Notification, 0, count)
+	for i := 0; i < count; i++ {
+		notifications = append(notifications, consoleNotification(strconv.Itoa(i), time.Now().Add(-time.Minute)))
+	}
+
+	notificationService := service.NewNotificationService(
+		newMemoryReceiver(notifications...),
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		map[internaltypes.NotificationChannel]service.ChannelConfig{
+			internaltypes.ChannelConsole: {Concurrency: count, Limit: models.RateLimit{Rate: rate, Burst: 1}},
+		},
+		limiters.NewMemoryRateLimiter(),
+		nil,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	started := time.Now()
+	go func() { _ = notificationService.Run(ctx) }()
+
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("over limit notifications weren't sent in time, sent: %v", sender.sent())
+	}
+
+	if len(sender.sent()) != count {
+		t.Errorf("Expected '%d', got '%d'", count, len(sender.sent()))
+	}
+
+	// 1 token at start, then 1 per 1/rate
+	minimum := (count - 1) * time.Second / rate
+	if elapsed := sentAt[count-1].Sub(started); elapsed < minimum {
+		t.Errorf("Expected at least '%v', got '%v'", minimum, elapsed)
+	}
+}
+
+func TestRecipientLimitDoesNotDelayOtherRecipients(t *testing.T) {
+	sender := &memorySender{}
+	telegramNotification := func(title, chatID string) *models.Notification {
+		notification := consoleNotification(title, time.Now().Add(-time.Minute))
+		notification.Channel = internaltypes.ChannelTelegram
+		sendTo, err := internaltypes.NewSendTo(types.NewAnyText(chatID), internaltypes.ChannelTelegram)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		notification.SendTo = sendTo
+		return notification
+	}
+
+	notificationService := service.NewNotificationService(
+		newMemoryReceiver(telegramNotification("alice 1", "1"), telegramNotification("alice 2", "1"), telegramNotification("bob", "2")),
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelTelegram: sender},
+		map[internaltypes.NotificationChannel]service.ChannelConfig{
+			internaltypes.ChannelTelegram: {RecipientLimit: models.RateLimit{Rate: 0.01, Burst: 1}},
+		},
+		limiters.NewMemoryRateLimiter(),
+		nil,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	if err := notificationService.Run(ctx); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	sent := sender.sent()
+	if sent["bob"] != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, sent["bob"])
+	}
+	if sent["alice 1"]+sent["alice 2"] != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, sent["alice 1"]+sent["alice 2"])
+	}
+}
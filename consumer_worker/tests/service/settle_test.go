@@ -0,0 +1,423 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/consumer_worker/internal/service"
+	"sync"
+	"testing"
+	"time"
+)
+
+// retryPolicy retries fast, so that tests don't wait
+var retryPolicy = service.RetryPolicy{MaxAttempts: 3, Delay: 50 * time.Millisecond, Backoff: 2}
+
+// memoryDelivery is the models.Delivery that remembers how it was settled
+type memoryDelivery struct {
+	attempt int
+	// onNack is called on every nack, may be nil
+	onNack func()
+
+	mu          sync.Mutex
+	acks        int
+	nacks       int
+	quarantined []error
+	closed      chan struct{}
+}
+
+func newMemoryDelivery(attempt int) *memoryDelivery {
+	return &memoryDelivery{attempt: attempt, closed: make(chan struct{})}
+}
+
+func (d *memoryDelivery) Ack() error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.acks++
+	d.settled()
+	return nil
+}
+
+func (d *memoryDelivery) Nack() error {
+	d.mu.Lock()
+	d.nacks++
+	d.mu.Unlock()
+
+	if d.onNack != nil {
+		d.onNack()
+	}
+	return nil
+}
+
+func (d *memoryDelivery) Quarantine(reason error) error {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.quarantined = append(d.quarantined, reason)
+	d.settled()
+	return nil
+}
+
+func (d *memoryDelivery) Attempt() int { return d.attempt }
+
+// settled closes closed once, d.mu must be held
+func (d *memoryDelivery) settled() {
+	select {
+	case <-d.closed:
+	default:
+		close(d.closed)
+	}
+}
+
+func (d *memoryDelivery) counts() (acks, quarantined int) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.acks, len(d.quarantined)
+}
+
+func (d *memoryDelivery) nacked() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return d.nacks
+}
+
+// memoryBroker is the ports.NotificationReceiver of 1 message, it's delivered again whenever it's nacked
+type memoryBroker struct {
+	message models.Notification
+	// classic queues only tell if message is redelivered, quorum ones count deliveries
+	classic bool
+
+	objects chan *models.Notification
+	stop    chan struct{}
+
+	mu         sync.Mutex
+	deliveries []*memoryDelivery
+	// settled is closed once message is acked or quarantined
+	settled    chan struct{}
+	settleOnce sync.Once
+}
+
+func newMemoryBroker(message *models.Notification, attempt int, classic bool) *memoryBroker {
+	b := &memoryBroker{
+		message: *message,
+		classic: classic,
+		objects: make(chan *models.Notification),
+		stop:    make(chan struct{}),
+		settled: make(chan struct{}),
+	}
+	b.deliver(attempt)
+	return b
+}
+
+// deliver gives away a copy of message with a new delivery, as if it's read from the queue
+func (b *memoryBroker) deliver(attempt int) {
+	delivery := newMemoryDelivery(attempt)
+	delivery.onNack = func() {
+		next := attempt + 1
+		if b.classic {
+			next = 2
+		}
+		b.deliver(next)
+	}
+
+	b.mu.Lock()
+	b.deliveries = append(b.deliveries, delivery)
+	b.mu.Unlock()
+
+	copied := b.message
+	copied.Delivery = delivery
+	go func() {
+		select {
+		case b.objects <- &copied:
+		case <-b.stop:
+		}
+	}()
+	go func() {
+		<-delivery.closed
+		b.settleOnce.Do(func() {
+			close(b.settled)
+		})
+	}()
+}
+
+func (b *memoryBroker) StartReceiving() <-chan *models.Notification { return b.objects }
+
+func (b *memoryBroker) StopReceiving() error {
+	close(b.stop)
+	return nil
+}
+
+// counts sums up how every delivery of message was settled
+func (b *memoryBroker) counts() (acks, nacks, quarantined int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	for _, delivery := range b.deliveries {
+		deliveryAcks, deliveryQuarantined := delivery.counts()
+		acks += deliveryAcks
+		quarantined += deliveryQuarantined
+		nacks += delivery.nacked()
+	}
+	return acks, nacks, quarantined
+}
+
+// memoryResultPublisher is the ports.DeliveryResultPublisher that remembers published results
+type memoryResultPublisher struct {
+	mu      sync.Mutex
+	results []*models.DeliveryResult
+}
+
+func (p *memoryResultPublisher) Publish(_ context.Context, result *models.DeliveryResult) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.results = append(p.results, result)
+	return nil
+}
+
+func (p *memoryResultPublisher) published() []*models.DeliveryResult {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]*models.DeliveryResult(nil), p.results...)
+}
+
+// failingSender is the ports.NotificationSender that fails with errs in order, then sends
+type failingSender struct {
+	errs []error
+
+	mu      sync.Mutex
+	sendsAt []time.Time
+}
+
+func (s *failingSender) Send(_ context.Context, _ *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sendsAt = append(s.sendsAt, time.Now())
+	if len(s.sendsAt) <= len(s.errs) {
+		return s.errs[len(s.sendsAt)-1]
+	}
+	return nil
+}
+
+func (s *failingSender) sends() []time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]time.Time(nil), s.sendsAt...)
+}
+
+// runUntilSettled runs service over broker until its message is settled, then stops it
+func runUntilSettled(t *testing.T, broker *memoryBroker, sender ports.NotificationSender, publisher ports.DeliveryResultPublisher) {
+	notificationService := service.NewNotificationService(
+		broker,
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		map[internaltypes.NotificationChannel]service.ChannelConfig{internaltypes.ChannelConsole: {Retry: retryPolicy}},
+		nil,
+		publisher,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- notificationService.Run(ctx)
+	}()
+
+	select {
+	case <-broker.settled:
+	case <-time.After(2 * time.Second):
+		t.Errorf("Expected message to be settled")
+	}
+
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+}
+
+func TestServiceReportsAttemptOfDelivery(t *testing.T) {
+	publisher := &memoryResultPublisher{}
+	broker := newMemoryBroker(consoleNotification("redelivered", time.Now()), 2, false)
+
+	runUntilSettled(t, broker, &memorySender{}, publisher)
+
+	results := publisher.published()
+	if len(results) != 1 {
+		t.Fatalf("Expected '%d', got '%d'", 1, len(results))
+	}
+	if results[0].Outcome != models.OutcomeDelivered {
+		t.Errorf("Expected '%s', got '%s'", models.OutcomeDelivered, results[0].Outcome)
+	}
+	if results[0].Attempt != 2 {
+		t.Errorf("Expected '%d', got '%d'", 2, results[0].Attempt)
+	}
+}
+
+func TestServiceSettlesDelivery(t *testing.T) {
+	transient := errors.New("smtp is down")
+	terminal := fmt.Errorf("%w: unknown mailbox", models.ErrTerminal)
+
+	tests := []struct {
+		name                string
+		attempt             int
+		classic             bool
+		errs                []error
+		expectedSends       int
+		expectedAcks        int
+		expectedNacks       int
+		expectedQuarantined int
+		expectedOutcome     string
+		expectedAttempt     int
+	}{
+		{name: "sent", attempt: 1,
+			expectedSends: 1, expectedAcks: 1, expectedOutcome: models.OutcomeDelivered, expectedAttempt: 1},
+		{name: "terminal failure", attempt: 1, errs: []error{terminal},
+			expectedSends: 1, expectedAcks: 1, expectedOutcome: models.OutcomeFailed, expectedAttempt: 1},
+		{name: "transient failure, sent on retry", attempt: 1, errs: []error{transient},
+			expectedSends: 2, expectedAcks: 1, expectedNacks: 1, expectedOutcome: models.OutcomeDelivered, expectedAttempt: 2},
+		{name: "transient failure every attempt", attempt: 1, errs: []error{transient, transient, transient},
+			expectedSends: 3, expectedNacks: 2, expectedQuarantined: 1, expectedOutcome: models.OutcomeFailed, expectedAttempt: 3},
+		{name: "transient failure every attempt, classic queue", attempt: 1, classic: true, errs: []error{transient, transient, transient},
+			expectedSends: 3, expectedNacks: 2, expectedQuarantined: 1, expectedOutcome: models.OutcomeFailed, expectedAttempt: 3},
+		{name: "redelivered with 1 attempt left", attempt: 3, errs: []error{transient},
+			expectedSends: 1, expectedQuarantined: 1, expectedOutcome: models.OutcomeFailed, expectedAttempt: 3},
+		{name: "redelivered after the last attempt", attempt: 4,
+			expectedSends: 0, expectedQuarantined: 1, expectedOutcome: models.OutcomeFailed, expectedAttempt: 4},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			publisher := &memoryResultPublisher{}
+			sender := &failingSender{errs: tt.errs}
+			broker := newMemoryBroker(consoleNotification(tt.name, time.Now()), tt.attempt, tt.classic)
+
+			runUntilSettled(t, broker, sender, publisher)
+
+			sends := sender.sends()
+			if len(sends) != tt.expectedSends {
+				t.Errorf("Expected '%d', got '%d'", tt.expectedSends, len(sends))
+			}
+			// requeued ones wait for their delay
+			for i := 1; i < len(sends); i++ {
+				if wait := sends[i].Sub(sends[i-1]); wait < retryPolicy.Delay {
+					t.Errorf("Expected retry after '%s' at least, got '%s'", retryPolicy.Delay, wait)
+				}
+			}
+
+			acks, nacks, quarantined := broker.counts()
+			if acks != tt.expectedAcks || nacks != tt.expectedNacks || quarantined != tt.expectedQuarantined {
+				t.Errorf("Expected '%d' acks, '%d' nacks and '%d' quarantines, got '%d', '%d' and '%d'",
+					tt.expectedAcks, tt.expectedNacks, tt.expectedQuarantined, acks, nacks, quarantined)
+			}
+
+			// only the final outcome is reported
+			results := publisher.published()
+			if len(results) != 1 {
+				t.Fatalf("Expected '%d', got '%d'", 1, len(results))
+			}
+			if results[0].Outcome != tt.expectedOutcome {
+				t.Errorf("Expected '%s', got '%s'", tt.expectedOutcome, results[0].Outcome)
+			}
+			if results[0].Attempt != tt.expectedAttempt {
+				t.Errorf("Expected '%d', got '%d'", tt.expectedAttempt, results[0].Attempt)
+			}
+		})
+	}
+}
+
+func TestServiceDoesNotReportTransientFailureBeforeRetry(t *testing.T) {
+	publisher := &memoryResultPublisher{}
+	// the retry is due in 1 second, long after the check below
+	sender := &failingSender{errs: []error{errors.New("smtp is down")}}
+	broker := newMemoryBroker(consoleNotification("retried", time.Now()), 1, false)
+
+	notificationService := service.NewNotificationService(
+		broker,
+		map[internaltypes.NotificationChannel]ports.NotificationSender{internaltypes.ChannelConsole: sender},
+		map[internaltypes.NotificationChannel]service.ChannelConfig{
+			internaltypes.ChannelConsole: {Retry: service.RetryPolicy{MaxAttempts: 3, Delay: time.Second}},
+		},
+		nil,
+		publisher,
+		nil,
+		checkPeriod,
+	)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- notificationService.Run(ctx)
+	}()
+
+	time.Sleep(300 * time.Millisecond)
+	cancel()
+	if err := <-done; err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if sends := len(sender.sends()); sends != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, sends)
+	}
+	// requeued, its redelivered copy waits for the retry unsettled
+	if acks, nacks, quarantined := broker.counts(); acks != 0 || nacks != 1 || quarantined != 0 {
+		t.Errorf("Expected '%d' acks, '%d' nacks and '%d' quarantines, got '%d', '%d' and '%d'", 0, 1, 0, acks, nacks, quarantined)
+	}
+	if results := publisher.published(); len(results) != 0 {
+		t.Errorf("Expected no results, got '%d'", len(results))
+	}
+}
+
+func TestServiceWaitsForRetryAfter(t *testing.T) {
+	retryAfter := 300 * time.Millisecond
+	sender := &failingSender{errs: []error{&models.RetryAfter{Wait: retryAfter, Err: errors.New("429 too many requests")}}}
+	broker := newMemoryBroker(consoleNotification("rate limited", time.Now()), 1, false)
+
+	runUntilSettled(t, broker, sender, &memoryResultPublisher{})
+
+	sends := sender.sends()
+	if len(sends) != 2 {
+		t.Fatalf("Expected '%d', got '%d'", 2, len(sends))
+	}
+	// it's longer than retryPolicy.Delay
+	if wait := sends[1].Sub(sends[0]); wait < retryAfter {
+		t.Errorf("Expected retry after '%s' at least, got '%s'", retryAfter, wait)
+	}
+}
+
+// partialSender is the ports.NotificationSender of 2 parts, the 2nd one fails the first time
+type partialSender struct {
+	mu sync.Mutex
+	// startParts are SentParts of notification at every send
+	startParts []int
+}
+
+func (s *partialSender) Send(_ context.Context, notification *models.Notification) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.startParts = append(s.startParts, notification.SentParts)
+	notification.SentParts = 1
+	if len(s.startParts) == 1 {
+		return errors.New("part 2 isn't sent")
+	}
+	notification.SentParts = 2
+	return nil
+}
+
+func TestServiceResumesRequeuedFromFailedPart(t *testing.T) {
+	sender := &partialSender{}
+	broker := newMemoryBroker(consoleNotification("long", time.Now()), 1, false)
+
+	runUntilSettled(t, broker, sender, &memoryResultPublisher{})
+
+	sender.mu.Lock()
+	defer sender.mu.Unlock()
+	if len(sender.startParts) != 2 {
+		t.Fatalf("Expected '%d', got '%d'", 2, len(sender.startParts))
+	}
+	// redelivered copy doesn't send the 1st part again
+	if sender.startParts[1] != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, sender.startParts[1])
+	}
+}
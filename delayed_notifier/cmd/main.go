@@ -5,11 +5,14 @@ import (
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/config"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/connect"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/transport"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/httpserver"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/postgres"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"github.com/wb-go/wbf/dbpg"
 	"github.com/wb-go/wbf/rabbitmq"
 	"github.com/wb-go/wbf/redis"
@@ -18,6 +21,9 @@ import (
 	"log"
 	"sync"
 	"time"
+
+	// IANA zones of publication_at, final image has no tzdata
+	_ "time/tzdata"
 )
 
 func main() {
@@ -61,9 +67,8 @@ func main() {
 	//endregion
 
 	//region rabbitMQ
-	var rabbitmqPublisher *rabbitmq.Publisher
 	var rabbitmqChannelToClose *rabbitmq.Channel
-	rabbitmqPublisher, rabbitmqChannelToClose, err = connect.GetRabbitMQPublisher(cfg.RabbitMQConfig, rabbitmqRetryStrategy)
+	rabbitmqChannelToClose, err = connect.GetRabbitMQPublisher(cfg.RabbitMQConfig, rabbitmqRetryStrategy)
 	if err != nil {
 		zlog.Logger.Fatal().Err(err).Msg("error creating rabbitmq publisher")
 	}
@@ -134,16 +139,77 @@ func main() {
 	//endregion
 
 	//region services
-	postgresRepo := repositories.NewNotificationPostgres(postgresDB, postgresRetryStrategy)
+	postgresRepo := repositories.NewNotificationPostgres(postgresDB, postgresRetryStrategy, cfg.PostgresConfig.NotifyChannel)
 	redisRepo := repositories.NewNotificationRedis(redisClient, redisRetryStrategy, redisExpiration)
-	rabbitmqRepo := repositories.NewNotificationRabbitMQ(rabbitmqPublisher, rabbitmqRetryStrategy)
+	delayLayout := connect.DelayLayout(cfg.RabbitMQConfig)
+	rabbitmqRepo := repositories.NewNotificationRabbitMQ(rabbitmqChannelToClose, cfg.RabbitMQConfig.Exchange, delayLayout, rabbitmqRetryStrategy,
+		time.Duration(cfg.RabbitMQConfig.ConfirmTimeoutSeconds)*time.Second)
+	templateRepo := repositories.NewTemplatePostgres(postgresDB, postgresRetryStrategy)
+	idempotencyRepo := repositories.NewIdempotencyPostgres(postgresDB, postgresRetryStrategy)
+
+	// due notifications are looked up in postgres itself or indexed in redis
+	var fetcherRepo ports.NotificationFetcherRepository
+	switch cfg.FetcherConfig.Backend {
+	case config.FetcherBackendPostgres:
+		fetcherRepo = postgresRepo
+	case config.FetcherBackendRedis:
+		redisFetcherRepo := repositories.NewNotificationFetcherRedis(redisClient, redisRetryStrategy, postgresRepo, cfg.FetcherConfig.RedisKeyPrefix)
+		err = redisFetcherRepo.Reconcile(context.Background(),
+			types.NewDateTime(time.Now().Add(time.Duration(cfg.FetcherConfig.FetchMaxDiapasonSeconds)*time.Second+delayLayout.Max())),
+			cfg.FetcherConfig.MaxScheduled)
+		if err != nil {
+			zlog.Logger.Fatal().Err(err).Msg("couldn't reconcile redis fetcher index with postgres")
+		}
+		fetcherRepo = redisFetcherRepo
+	default:
+		zlog.Logger.Fatal().Str("backend", cfg.FetcherConfig.Backend).Msg("unknown fetcher backend")
+	}
+	zlog.Logger.Info().Str("backend", cfg.FetcherConfig.Backend).Msg("fetcher created")
+
+	// wake-ups of notifications created by other replicas
+	var wakeUpListener ports.NotificationWakeUpListener
+	if cfg.PostgresConfig.NotifyChannel != "" {
+		wakeUpListener = repositories.NewNotificationWakeUpPostgres(cfg.PostgresConfig.MasterDSN, cfg.PostgresConfig.NotifyChannel, time.Second, time.Minute)
+	}
 
 	senderService := service.NewSenderService(
 		time.Duration(cfg.FetcherConfig.FetchPeriodSeconds)*time.Second,
 		time.Duration(cfg.FetcherConfig.FetchMaxDiapasonSeconds)*time.Second,
-		rabbitmqRepo, postgresRepo,
+		time.Duration(cfg.FetcherConfig.ExpireAfterSeconds)*time.Second,
+		delayLayout.Max(),
+		cfg.FetcherConfig.InstanceID, time.Duration(cfg.FetcherConfig.LeaseSeconds)*time.Second,
+		models.PublishBackoff{
+			Base:        time.Duration(cfg.FetcherConfig.PublishBackoffSeconds) * time.Second,
+			Max:         time.Duration(cfg.FetcherConfig.PublishBackoffMaxSeconds) * time.Second,
+			MaxAttempts: cfg.FetcherConfig.PublishMaxAttempts,
+		},
+		service.FetchPaging{
+			BatchSize:          cfg.FetcherConfig.BatchSize,
+			MaxConcurrentPages: cfg.FetcherConfig.MaxConcurrentPages,
+			MaxInFlight:        cfg.FetcherConfig.MaxInFlight,
+			MaxScheduled:       cfg.FetcherConfig.MaxScheduled,
+		},
+		rabbitmqRepo, fetcherRepo, postgresRepo, templateRepo, wakeUpListener,
 	)
-	crudService := service.NewNotificationCRUDService(postgresRepo, redisRepo, senderService.QuickSendIfNeeded)
+	crudService := service.NewNotificationCRUDService(postgresRepo, redisRepo, templateRepo, senderService.Schedule, senderService.Schedule,
+		service.Signals(senderService.Unschedule, senderService.MaterialiseNext))
+	seriesService := service.NewSeriesService(postgresRepo, redisRepo, templateRepo, senderService.Schedule)
+	fanOutService := service.NewFanOutService(postgresRepo, redisRepo, templateRepo, senderService.Schedule)
+	templateService := service.NewTemplateService(templateRepo)
+	deadLetterService := service.NewDeadLetterService(postgresRepo, redisRepo, senderService.Schedule)
+	idempotencyService := service.NewIdempotencyService(idempotencyRepo, time.Duration(cfg.IdempotencyConfig.TTLSeconds)*time.Second)
+
+	// delivery results are optional: workers may not report them
+	var deliveryResultService *service.DeliveryResultService
+	if cfg.RabbitMQConfig.ResultQueue != "" {
+		resultConsumerConfig, resultChannel, resultErr := connect.GetRabbitMQResultConsumer(cfg.RabbitMQConfig, rabbitmqRetryStrategy)
+		if resultErr != nil {
+			zlog.Logger.Fatal().Err(resultErr).Msg("error creating rabbitmq result consumer")
+		}
+		deliveryResultReceiver := repositories.NewDeliveryResultRabbitMQ(resultConsumerConfig, resultChannel, rabbitmqRetryStrategy)
+		deliveryResultService = service.NewDeliveryResultService(deliveryResultReceiver, postgresRepo, redisRepo, postgresRetryStrategy)
+		zlog.Logger.Info().Str("queue", cfg.RabbitMQConfig.ResultQueue).Msg("rabbitMQ result consumer created")
+	}
 	//endregion
 
 	ctx, stopCtx := context.WithCancel(context.Background())
@@ -155,11 +221,27 @@ func main() {
 		defer wg.Done()
 		senderService.Run(ctx)
 	}(wg, ctx)
+
+	wg.Add(1)
+	go func(wg *sync.WaitGroup, ctx2 context.Context) {
+		defer wg.Done()
+		idempotencyService.Run(ctx)
+	}(wg, ctx)
+
+	if deliveryResultService != nil {
+		wg.Add(1)
+		go func(wg *sync.WaitGroup, ctx2 context.Context) {
+			defer wg.Done()
+			deliveryResultService.Run(ctx)
+		}(wg, ctx)
+	}
 	//endregion
 
 	//region Start HTTP
-	notifyHTTPHandler := transport.NewNotifyHandler(crudService)
-	appRouter := transport.AssembleRouter(notifyHTTPHandler)
+	notifyHTTPHandler := transport.NewNotifyHandler(crudService, seriesService, fanOutService, idempotencyService)
+	templateHTTPHandler := transport.NewTemplateHandler(templateService)
+	deadLetterHTTPHandler := transport.NewDeadLetterHandler(deadLetterService)
+	appRouter := transport.AssembleRouter(notifyHTTPHandler, templateHTTPHandler, deadLetterHTTPHandler)
 	appServer := httpserver.NewHTTPServer(appRouter)
 
 	zlog.Logger.Info().Int("http_port", cfg.ServerConfig.HTTPPort).Msg("server starting :http_port")
@@ -0,0 +1 @@
+DROP INDEX IF EXISTS delayed_notifier.notifications_publication_at_id_idx;
\ No newline at end of file
@@ -0,0 +1 @@
+CREATE INDEX IF NOT EXISTS notifications_publication_at_id_idx ON delayed_notifier.notifications (publication_at, id);
\ No newline at end of file
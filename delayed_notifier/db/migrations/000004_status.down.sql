@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS delayed_notifier.notifications_status_publication_at_idx;
+
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS sent_to_worker BOOLEAN NOT NULL DEFAULT FALSE;
+
+UPDATE delayed_notifier.notifications SET sent_to_worker = true WHERE status <> 'scheduled';
+
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS status;
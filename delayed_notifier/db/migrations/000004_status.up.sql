@@ -0,0 +1,7 @@
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS status VARCHAR(20) NOT NULL DEFAULT 'scheduled';
+
+UPDATE delayed_notifier.notifications SET status = 'queued' WHERE sent_to_worker = true;
+
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS sent_to_worker;
+
+CREATE INDEX IF NOT EXISTS notifications_status_publication_at_idx ON delayed_notifier.notifications (status, publication_at);
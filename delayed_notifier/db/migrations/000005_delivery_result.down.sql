@@ -0,0 +1,3 @@
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS delivery_last_attempt_at;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS delivery_error;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS delivery_attempts;
@@ -0,0 +1,3 @@
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS delivery_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS delivery_error TEXT;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS delivery_last_attempt_at TIMESTAMP WITH TIME ZONE;
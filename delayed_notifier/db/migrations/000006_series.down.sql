@@ -0,0 +1,6 @@
+DROP INDEX IF EXISTS delayed_notifier.notifications_series_occurrence_idx;
+
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS occurrence;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS series_id;
+
+DROP TABLE IF EXISTS delayed_notifier.notification_series;
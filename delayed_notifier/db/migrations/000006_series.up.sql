@@ -0,0 +1,17 @@
+CREATE TABLE IF NOT EXISTS delayed_notifier.notification_series
+(
+    id         UUID PRIMARY KEY,
+    rule       TEXT                     NOT NULL,
+    starts_at  TIMESTAMP WITH TIME ZONE NOT NULL,
+    until      TIMESTAMP WITH TIME ZONE,
+    max_count  INTEGER                  NOT NULL DEFAULT 0,
+    stopped_at TIMESTAMP WITH TIME ZONE,
+    created_at TIMESTAMP WITH TIME ZONE          DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE          DEFAULT now()
+);
+
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS series_id UUID REFERENCES delayed_notifier.notification_series (id);
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS occurrence INTEGER NOT NULL DEFAULT 0;
+
+-- every occurrence is materialised once, NULL series_id are distinct
+CREATE UNIQUE INDEX IF NOT EXISTS notifications_series_occurrence_idx ON delayed_notifier.notifications (series_id, occurrence);
@@ -0,0 +1,4 @@
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS template_vars;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS template_id;
+
+DROP TABLE IF EXISTS delayed_notifier.notification_templates;
@@ -0,0 +1,13 @@
+CREATE TABLE IF NOT EXISTS delayed_notifier.notification_templates
+(
+    id         UUID PRIMARY KEY,
+    name       VARCHAR(255)             NOT NULL UNIQUE,
+    title      TEXT                     NOT NULL,
+    message    TEXT                     NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE          DEFAULT now(),
+    updated_at TIMESTAMP WITH TIME ZONE          DEFAULT now()
+);
+
+-- templates in use can't be deleted
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS template_id UUID REFERENCES delayed_notifier.notification_templates (id) ON DELETE RESTRICT;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS template_vars JSONB;
@@ -0,0 +1,5 @@
+DROP INDEX IF EXISTS delayed_notifier.notifications_parent_id_idx;
+
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS parent_id;
+
+DROP TABLE IF EXISTS delayed_notifier.notification_parents;
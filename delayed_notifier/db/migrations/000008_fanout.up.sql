@@ -0,0 +1,14 @@
+CREATE TABLE IF NOT EXISTS delayed_notifier.notification_parents
+(
+    id             UUID PRIMARY KEY,
+    publication_at TIMESTAMP WITH TIME ZONE NOT NULL,
+    title          TEXT                     NOT NULL,
+    message        TEXT                     NOT NULL,
+    template_id    UUID REFERENCES delayed_notifier.notification_templates (id) ON DELETE RESTRICT,
+    template_vars  JSONB,
+    created_at     TIMESTAMP WITH TIME ZONE          DEFAULT now()
+);
+
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS parent_id UUID REFERENCES delayed_notifier.notification_parents (id);
+
+CREATE INDEX IF NOT EXISTS notifications_parent_id_idx ON delayed_notifier.notifications (parent_id);
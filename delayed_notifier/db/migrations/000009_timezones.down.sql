@@ -0,0 +1,3 @@
+ALTER TABLE delayed_notifier.notification_series DROP COLUMN IF EXISTS starts_at_tz;
+ALTER TABLE delayed_notifier.notification_parents DROP COLUMN IF EXISTS publication_tz;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS publication_tz;
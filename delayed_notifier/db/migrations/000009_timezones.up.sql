@@ -0,0 +1,6 @@
+-- original zones of datetimes: IANA name, offset like '+03:00' or '' for UTC
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS publication_tz TEXT NOT NULL DEFAULT '';
+ALTER TABLE delayed_notifier.notification_parents ADD COLUMN IF NOT EXISTS publication_tz TEXT NOT NULL DEFAULT '';
+
+-- recurrence rules are evaluated in this zone
+ALTER TABLE delayed_notifier.notification_series ADD COLUMN IF NOT EXISTS starts_at_tz TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,12 @@
+CREATE TABLE IF NOT EXISTS delayed_notifier.idempotency_keys
+(
+    key          VARCHAR(255) PRIMARY KEY,
+    request_hash CHAR(64)                 NOT NULL,
+    -- response is NULL while the first request is in progress
+    status_code  INTEGER,
+    response     BYTEA,
+    created_at   TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now(),
+    expires_at   TIMESTAMP WITH TIME ZONE NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_expires_at_idx ON delayed_notifier.idempotency_keys (expires_at);
@@ -0,0 +1,2 @@
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS lease_expires_at;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS lease_owner;
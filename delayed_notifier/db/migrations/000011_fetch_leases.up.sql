@@ -0,0 +1,3 @@
+-- a scheduled notification is claimed by one instance until lease_expires_at, then anyone may reclaim it
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS lease_owner TEXT;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS lease_expires_at TIMESTAMP WITH TIME ZONE;
@@ -0,0 +1,3 @@
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS next_attempt_at;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS publish_error;
+ALTER TABLE delayed_notifier.notifications DROP COLUMN IF EXISTS publish_attempts;
@@ -0,0 +1,5 @@
+-- notifications table is the outbox: a scheduled row becomes queued only after its publish is confirmed,
+-- failed publishes are retried after next_attempt_at
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS publish_attempts INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS publish_error TEXT;
+ALTER TABLE delayed_notifier.notifications ADD COLUMN IF NOT EXISTS next_attempt_at TIMESTAMP WITH TIME ZONE;
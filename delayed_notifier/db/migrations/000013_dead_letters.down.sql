@@ -0,0 +1 @@
+DROP TABLE IF EXISTS delayed_notifier.dead_letters;
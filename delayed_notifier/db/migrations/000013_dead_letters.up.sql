@@ -0,0 +1,16 @@
+-- notifications that failed for good: publish attempts are exhausted or worker couldn't deliver them.
+-- payload is the notification row as it was at the failure, replay removes the dead letter and reschedules it
+CREATE TABLE IF NOT EXISTS delayed_notifier.dead_letters
+(
+    id              UUID PRIMARY KEY                  DEFAULT gen_random_uuid(),
+    notification_id UUID                     NOT NULL REFERENCES delayed_notifier.notifications (id) ON DELETE CASCADE,
+    channel         VARCHAR(50)              NOT NULL,
+    source          VARCHAR(20)              NOT NULL,
+    error           TEXT                     NOT NULL,
+    attempts        INTEGER                  NOT NULL,
+    payload         JSONB                    NOT NULL,
+    failed_at       TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_failed_at_idx ON delayed_notifier.dead_letters (failed_at, id);
+CREATE INDEX IF NOT EXISTS dead_letters_notification_id_idx ON delayed_notifier.dead_letters (notification_id);
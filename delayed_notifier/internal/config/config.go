@@ -3,6 +3,8 @@ package config
 import (
 	"fmt"
 	"github.com/wb-go/wbf/config"
+	"os"
+	"strconv"
 	"strings"
 )
 
@@ -21,6 +23,8 @@ type AppConfig struct {
 	RedisRetryConfig    RetryStrategyConfig `env-prefix:"RETRY_REDIS_"`
 
 	FetcherConfig FetcherConfig `env-prefix:"FETCHER_"`
+
+	IdempotencyConfig IdempotencyConfig `env-prefix:"IDEMPOTENCY_"`
 }
 
 // NewAppConfig creates a new struct of "THE config"
@@ -35,9 +39,14 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	cfg.SetDefault("delayed_notifier.server.http.port", 8080)
 	cfg.SetDefault("delayed_notifier.log.level", "info")
 
+	cfg.SetDefault("delayed_notifier.rabbitmq.confirm_timeout_seconds", 10)
+	cfg.SetDefault("delayed_notifier.rabbitmq.delay_step_milliseconds", 1000)
+	cfg.SetDefault("delayed_notifier.rabbitmq.delay_buckets", 300)
+
 	cfg.SetDefault("delayed_notifier.postgres.max_open_connections", 2)
 	cfg.SetDefault("delayed_notifier.postgres.max_idle_connections", 2)
 	cfg.SetDefault("delayed_notifier.postgres.connection_max_lifetime_seconds", 0)
+	cfg.SetDefault("delayed_notifier.postgres.notify_channel", "notification_wake_ups")
 
 	cfg.SetDefault("delayed_notifier.redis.db", 0)
 	cfg.SetDefault("delayed_notifier.redis.ttl_seconds", 20)
@@ -53,6 +62,22 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	cfg.SetDefault("delayed_notifier.retry_redis.backoff", 1.5)
 	cfg.SetDefault("delayed_notifier.retry_postgres.backoff", 1.5)
 	cfg.SetDefault("delayed_notifier.retry_rabbitmq.backoff", 1.5)
+
+	cfg.SetDefault("delayed_notifier.fetcher.fetch_period_seconds", 60)
+	cfg.SetDefault("delayed_notifier.fetcher.fetch_max_diapason_seconds", 100)
+	cfg.SetDefault("delayed_notifier.fetcher.expire_after_seconds", 0)
+	cfg.SetDefault("delayed_notifier.fetcher.lease_seconds", 300)
+	cfg.SetDefault("delayed_notifier.fetcher.publish_backoff_seconds", 5)
+	cfg.SetDefault("delayed_notifier.fetcher.publish_backoff_max_seconds", 300)
+	cfg.SetDefault("delayed_notifier.fetcher.publish_max_attempts", 10)
+	cfg.SetDefault("delayed_notifier.fetcher.batch_size", 1000)
+	cfg.SetDefault("delayed_notifier.fetcher.max_concurrent_pages", 4)
+	cfg.SetDefault("delayed_notifier.fetcher.max_in_flight", 10000)
+	cfg.SetDefault("delayed_notifier.fetcher.max_scheduled", 100000)
+	cfg.SetDefault("delayed_notifier.fetcher.backend", "postgres")
+	cfg.SetDefault("delayed_notifier.fetcher.redis_key_prefix", "delayed_notifier:fetcher")
+
+	cfg.SetDefault("delayed_notifier.idempotency.ttl_seconds", 86400)
 	//endregion
 
 	// region flags
@@ -89,6 +114,14 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	appConfig.RabbitMQConfig.Port = cfg.GetInt("delayed_notifier.rabbitmq.port")
 	appConfig.RabbitMQConfig.VHost = cfg.GetString("delayed_notifier.rabbitmq.vhost")
 	appConfig.RabbitMQConfig.QueueSend = cfg.GetString("delayed_notifier.rabbitmq.queue")
+	appConfig.RabbitMQConfig.QueueForChannel.Email = cfg.GetString("delayed_notifier.rabbitmq.queue_send.email")
+	appConfig.RabbitMQConfig.QueueForChannel.Telegram = cfg.GetString("delayed_notifier.rabbitmq.queue_send.telegram")
+	appConfig.RabbitMQConfig.QueueForChannel.Console = cfg.GetString("delayed_notifier.rabbitmq.queue_send.console")
+	appConfig.RabbitMQConfig.ResultQueue = cfg.GetString("delayed_notifier.rabbitmq.result_queue")
+	appConfig.RabbitMQConfig.ConfirmTimeoutSeconds = cfg.GetInt("delayed_notifier.rabbitmq.confirm_timeout_seconds")
+	appConfig.RabbitMQConfig.DelayExchange = cfg.GetString("delayed_notifier.rabbitmq.delay_exchange")
+	appConfig.RabbitMQConfig.DelayStepMilliseconds = cfg.GetInt("delayed_notifier.rabbitmq.delay_step_milliseconds")
+	appConfig.RabbitMQConfig.DelayBuckets = cfg.GetInt("delayed_notifier.rabbitmq.delay_buckets")
 
 	// 4. PostgresConfig
 	appConfig.PostgresConfig.MasterDSN = cfg.GetString("delayed_notifier.postgres.master_dsn")
@@ -96,6 +129,7 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 	appConfig.PostgresConfig.MaxOpenConnections = cfg.GetInt("delayed_notifier.postgres.max_open_connections")
 	appConfig.PostgresConfig.MaxIdleConnections = cfg.GetInt("delayed_notifier.postgres.max_idle_connections")
 	appConfig.PostgresConfig.ConnectionMaxLifetimeSeconds = cfg.GetInt("delayed_notifier.postgres.connection_max_lifetime_seconds")
+	appConfig.PostgresConfig.NotifyChannel = cfg.GetString("delayed_notifier.postgres.notify_channel")
 
 	// 5. RedisConfig
 	appConfig.RedisConfig.Addr = cfg.GetString("delayed_notifier.redis.addr")
@@ -119,6 +153,34 @@ func NewAppConfig(configFilePath, envFilePath string) (*AppConfig, error) {
 
 	//9. FetcherConfig
 	appConfig.FetcherConfig.FetchPeriodSeconds = cfg.GetInt("delayed_notifier.fetcher.fetch_period_seconds")
+	appConfig.FetcherConfig.FetchMaxDiapasonSeconds = cfg.GetInt("delayed_notifier.fetcher.fetch_max_diapason_seconds")
+	appConfig.FetcherConfig.ExpireAfterSeconds = cfg.GetInt("delayed_notifier.fetcher.expire_after_seconds")
+	appConfig.FetcherConfig.InstanceID = cfg.GetString("delayed_notifier.fetcher.instance_id")
+	appConfig.FetcherConfig.LeaseSeconds = cfg.GetInt("delayed_notifier.fetcher.lease_seconds")
+	appConfig.FetcherConfig.PublishBackoffSeconds = cfg.GetInt("delayed_notifier.fetcher.publish_backoff_seconds")
+	appConfig.FetcherConfig.PublishBackoffMaxSeconds = cfg.GetInt("delayed_notifier.fetcher.publish_backoff_max_seconds")
+	appConfig.FetcherConfig.PublishMaxAttempts = cfg.GetInt("delayed_notifier.fetcher.publish_max_attempts")
+	appConfig.FetcherConfig.BatchSize = cfg.GetInt("delayed_notifier.fetcher.batch_size")
+	appConfig.FetcherConfig.MaxConcurrentPages = cfg.GetInt("delayed_notifier.fetcher.max_concurrent_pages")
+	appConfig.FetcherConfig.MaxInFlight = cfg.GetInt("delayed_notifier.fetcher.max_in_flight")
+	appConfig.FetcherConfig.MaxScheduled = cfg.GetInt("delayed_notifier.fetcher.max_scheduled")
+	appConfig.FetcherConfig.Backend = cfg.GetString("delayed_notifier.fetcher.backend")
+	appConfig.FetcherConfig.RedisKeyPrefix = cfg.GetString("delayed_notifier.fetcher.redis_key_prefix")
+	if appConfig.FetcherConfig.InstanceID == "" {
+		appConfig.FetcherConfig.InstanceID = defaultInstanceID()
+	}
+
+	//10. IdempotencyConfig
+	appConfig.IdempotencyConfig.TTLSeconds = cfg.GetInt("delayed_notifier.idempotency.ttl_seconds")
 
 	return appConfig, nil
 }
+
+// defaultInstanceID returns "hostname-pid", it's unique for both pods and processes on 1 machine
+func defaultInstanceID() string {
+	hostname, err := os.Hostname()
+	if err != nil || hostname == "" {
+		hostname = "delayed_notifier"
+	}
+	return hostname + "-" + strconv.Itoa(os.Getpid())
+}
@@ -23,11 +23,24 @@ type RabbitMQConfig struct {
 	Port     int    `env:"PORT"`
 	VHost    string `env:"VHOST"`
 
+	// QueueSend is the queue of channels that don't have their own one in QueueForChannel
 	QueueSend string `env:"QUEUE"`
-}
+	// QueueForChannel are queues of channels, so a slow channel doesn't block the rest. Empty ones are QueueSend
+	QueueForChannel QueueSend `env-prefix:"QUEUE_SEND_"`
+
+	// ResultQueue is where workers report delivery results, empty = don't consume them
+	ResultQueue string `env:"RESULT_QUEUE"`
 
-/*
- Nah, dude!!! Too much complexity!
+	// ConfirmTimeoutSeconds is how long to wait for broker to confirm a message, then it's retried later
+	ConfirmTimeoutSeconds int `env:"CONFIRM_TIMEOUT_SECONDS" envDefault:"10"`
+
+	// DelayExchange is where notifications wait for their publication_at in broker (TTL queues), empty = don't wait
+	DelayExchange string `env:"DELAY_EXCHANGE"`
+	// DelayStepMilliseconds is the TTL difference between wait queues, the rest of delay is waited by worker
+	DelayStepMilliseconds int `env:"DELAY_STEP_MILLISECONDS" envDefault:"1000"`
+	// DelayBuckets is the amount of wait queues, the longest one holds DelayBuckets*DelayStepMilliseconds
+	DelayBuckets int `env:"DELAY_BUCKETS" envDefault:"300"`
+}
 
 // QueueSend is the config that lists MQ queues to send notifications into (by channel)
 type QueueSend struct {
@@ -36,8 +49,6 @@ type QueueSend struct {
 	Console  string `env:"CONSOLE"`
 }
 
-*/
-
 // RetryStrategyConfig is the retry strategy config struct
 //
 // specifies how retry operations will be handled
@@ -56,6 +67,9 @@ type PostgresConfig struct {
 	MaxOpenConnections           int      `env:"MAX_OPEN_CONNECTIONS" envDefault:"3"`
 	MaxIdleConnections           int      `env:"MAX_IDLE_CONNECTIONS" envDefault:"5"`
 	ConnectionMaxLifetimeSeconds int      `env:"CONNECTION_MAX_LIFETIME_SECONDS" envDefault:"0"`
+
+	// NotifyChannel is where created and updated notifications are announced to all replicas, empty = don't
+	NotifyChannel string `env:"NOTIFY_CHANNEL" envDefault:"notification_wake_ups"`
 }
 
 // RedisConfig is the redis connection config struct
@@ -70,4 +84,47 @@ type RedisConfig struct {
 type FetcherConfig struct {
 	FetchPeriodSeconds      int `env:"FETCH_PERIOD_SECONDS" envDefault:"60"`
 	FetchMaxDiapasonSeconds int `env:"FETCH_MAX_DIAPASON_SECONDS" envDefault:"100"`
+
+	// ExpireAfterSeconds is how late a notification may be sent, 0 = never expire
+	ExpireAfterSeconds int `env:"EXPIRE_AFTER_SECONDS" envDefault:"0"`
+
+	// InstanceID owns fetched notifications, must be unique among replicas. Default is "hostname-pid"
+	InstanceID string `env:"INSTANCE_ID"`
+	// LeaseSeconds is how long fetched notifications belong to the instance, then others may reclaim them
+	LeaseSeconds int `env:"LEASE_SECONDS" envDefault:"300"`
+
+	// PublishBackoffSeconds is the delay before 1st retry of a failed publish, it doubles on every attempt
+	PublishBackoffSeconds int `env:"PUBLISH_BACKOFF_SECONDS" envDefault:"5"`
+	// PublishBackoffMaxSeconds caps PublishBackoffSeconds doubling
+	PublishBackoffMaxSeconds int `env:"PUBLISH_BACKOFF_MAX_SECONDS" envDefault:"300"`
+	// PublishMaxAttempts is the amount of failed publishes after which notification is failed and dead-lettered, 0 = retry forever
+	PublishMaxAttempts int `env:"PUBLISH_MAX_ATTEMPTS" envDefault:"10"`
+
+	// BatchSize is the amount of notifications in 1 fetched page, pages are fetched until there's none
+	BatchSize int `env:"BATCH_SIZE" envDefault:"1000"`
+	// MaxConcurrentPages is the amount of pages sent at a time
+	MaxConcurrentPages int `env:"MAX_CONCURRENT_PAGES" envDefault:"4"`
+	// MaxInFlight is the amount of fetched but not sent notifications, it's at least BatchSize
+	MaxInFlight int `env:"MAX_IN_FLIGHT" envDefault:"10000"`
+
+	// MaxScheduled is the amount of wake-ups of the near-term window kept in memory
+	MaxScheduled int `env:"MAX_SCHEDULED" envDefault:"100000"`
+
+	// Backend is where due notifications are looked up: FetcherBackendPostgres or FetcherBackendRedis
+	Backend string `env:"BACKEND" envDefault:"postgres"`
+	// RedisKeyPrefix prefixes sorted sets of FetcherBackendRedis
+	RedisKeyPrefix string `env:"REDIS_KEY_PREFIX" envDefault:"delayed_notifier:fetcher"`
+}
+
+const (
+	// FetcherBackendPostgres fetches due notifications from postgres by publication_at
+	FetcherBackendPostgres = "postgres"
+	// FetcherBackendRedis indexes due notifications in redis sorted sets, postgres is still the source of truth
+	FetcherBackendRedis = "redis"
+)
+
+// IdempotencyConfig is the config struct for Idempotency-Key of POST /notify
+type IdempotencyConfig struct {
+	// TTLSeconds is how long a key and its response are kept
+	TTLSeconds int `env:"TTL_SECONDS" envDefault:"86400"`
 }
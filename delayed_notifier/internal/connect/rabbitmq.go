@@ -3,18 +3,37 @@ package connect
 import (
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/config"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/delaybuckets"
+	"github.com/rabbitmq/amqp091-go"
 	"github.com/wb-go/wbf/rabbitmq"
 	"github.com/wb-go/wbf/retry"
+	"slices"
+	"time"
 )
 
+// DelayLayout returns wait queues of rabbitCfg, it's disabled if DelayExchange is empty
+func DelayLayout(rabbitCfg config.RabbitMQConfig) delaybuckets.Layout {
+	return delaybuckets.Layout{
+		Exchange: rabbitCfg.DelayExchange,
+		Step:     time.Duration(rabbitCfg.DelayStepMilliseconds) * time.Millisecond,
+		Amount:   rabbitCfg.DelayBuckets,
+	}
+}
+
 // GetRabbitMQPublisher simplifies complex rabbitMQ connection process!
 //
+// the channel is in confirm mode, the queue is bound to the exchange with channel names as routing keys,
+// so mandatory messages aren't returned while workers are down. Every channel goes into its queue of ChannelQueues
+//
+// if DelayLayout is enabled, wait queues are declared too: they're bound to the headers delay exchange by bucket
+// and dead-letter expired messages into the exchange with their original routing keys
+//
 // returns:
 //
-//	publisher
-//	channel to close
+//	channel to publish into and to close
 //	error
-func GetRabbitMQPublisher(rabbitCfg config.RabbitMQConfig, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.Publisher, *rabbitmq.Channel, error) {
+func GetRabbitMQPublisher(rabbitCfg config.RabbitMQConfig, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.Channel, error) {
 	// step 1. init connect
 	rabbitMQConn, err := rabbitmq.Connect(
 		fmt.Sprintf("amqp://%s:%s@%s:%d/%s",
@@ -25,42 +44,184 @@ func GetRabbitMQPublisher(rabbitCfg config.RabbitMQConfig, rabbitmqRetryStrategy
 			rabbitCfg.VHost,
 		), rabbitmqRetryStrategy.Attempts, rabbitmqRetryStrategy.Delay)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error connecting to rabbitmq: %w", err)
+		return nil, fmt.Errorf("error connecting to rabbitmq: %w", err)
 	}
 
 	// step 2. get channel to bind
 	var rabbitMQChannel *rabbitmq.Channel
 	rabbitMQChannel, err = rabbitMQConn.Channel()
 	if err != nil {
-		return nil, nil, fmt.Errorf("error connecting to rabbitmq (conn.Channel()): %w", err)
+		return nil, fmt.Errorf("error connecting to rabbitmq (conn.Channel()): %w", err)
 	}
 
 	// step 3. bind channel to exchange with type direct
 	rabbitMQExchange := rabbitmq.NewExchange(rabbitCfg.Exchange, "direct")
 	err = rabbitMQExchange.BindToChannel(rabbitMQChannel)
 	if err != nil {
-		return nil, nil, fmt.Errorf("error binding rabbitmq channel to exchange '%s': %w",
+		return nil, fmt.Errorf("error binding rabbitmq channel to exchange '%s': %w",
 			rabbitCfg.Exchange, err)
 	}
 
-	// step 4. declare queues (at least try)
+	// step 4. declare queues (at least try), bind them by using channel names as routing keys.
+	// Channels that have moved into their own queues are unbound, otherwise they'd be delivered twice
+	rabbitMQQueueManager := rabbitmq.NewQueueManager(rabbitMQChannel)
+
+	channelQueues := ChannelQueues(rabbitCfg)
+	if _, found := channelQueues[rabbitCfg.QueueSend]; !found {
+		channelQueues[rabbitCfg.QueueSend] = nil
+	}
+
+	for queueName, channelStrings := range channelQueues {
+		err = retry.Do(
+			func() error {
+				q, errQueue := rabbitMQQueueManager.DeclareQueue(queueName)
+				if errQueue != nil {
+					return errQueue
+				}
+				for _, channelString := range internaltypes.ChannelAllStrings {
+					if slices.Contains(channelStrings, channelString) {
+						errQueue = rabbitMQChannel.QueueBind(q.Name, channelString, rabbitMQExchange.Name(), false, nil)
+					} else {
+						errQueue = rabbitMQChannel.QueueUnbind(q.Name, channelString, rabbitMQExchange.Name(), nil)
+					}
+					if errQueue != nil {
+						return errQueue
+					}
+				}
+				return nil
+			},
+			rabbitmqRetryStrategy,
+		)
+
+		if err != nil {
+			return nil, fmt.Errorf("error declaring queue '%s': %w", queueName, err)
+		}
+	}
+
+	// step 5. declare wait queues, if any
+	err = declareDelayTopology(rabbitMQChannel, DelayLayout(rabbitCfg), rabbitCfg.Exchange, rabbitmqRetryStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	// final step. confirm mode: broker acks or nacks every published message
+	err = rabbitMQChannel.Confirm(false)
+	if err != nil {
+		return nil, fmt.Errorf("error putting rabbitmq channel into confirm mode: %w", err)
+	}
+	return rabbitMQChannel, nil
+}
+
+// ChannelQueues returns channels routed into every queue: the own queue of channel or QueueSend
+func ChannelQueues(rabbitCfg config.RabbitMQConfig) map[string][]string {
+	queues := make(map[string][]string)
+	for _, channelString := range internaltypes.ChannelAllStrings {
+		queueName := queueOf(rabbitCfg, channelString)
+		queues[queueName] = append(queues[queueName], channelString)
+	}
+	return queues
+}
+
+// queueOf returns the queue of channelString, QueueSend if it doesn't have its own one
+func queueOf(rabbitCfg config.RabbitMQConfig, channelString string) string {
+	var queueName string
+	switch channelString {
+	case internaltypes.EMAIL:
+		queueName = rabbitCfg.QueueForChannel.Email
+	case internaltypes.TELEGRAM:
+		queueName = rabbitCfg.QueueForChannel.Telegram
+	case internaltypes.CONSOLE:
+		queueName = rabbitCfg.QueueForChannel.Console
+	}
+	if queueName == "" {
+		return rabbitCfg.QueueSend
+	}
+	return queueName
+}
+
+// declareDelayTopology declares the delay exchange of layout and its wait queues, nothing is declared if it's disabled
+func declareDelayTopology(rabbitMQChannel *rabbitmq.Channel, layout delaybuckets.Layout, deadLetterExchange string, rabbitmqRetryStrategy retry.Strategy) error {
+	if !layout.Enabled() {
+		return nil
+	}
+
+	delayExchange := rabbitmq.NewExchange(layout.Exchange, "headers")
+	err := delayExchange.BindToChannel(rabbitMQChannel)
+	if err != nil {
+		return fmt.Errorf("error binding rabbitmq channel to delay exchange '%s': %w", layout.Exchange, err)
+	}
+
+	rabbitMQQueueManager := rabbitmq.NewQueueManager(rabbitMQChannel)
+	for _, bucket := range layout.Buckets() {
+		name := layout.QueueName(bucket)
+		err = retry.Do(
+			func() error {
+				// no x-dead-letter-routing-key: expired messages keep their channel routing keys
+				q, errQueue := rabbitMQQueueManager.DeclareQueue(name, rabbitmq.QueueConfig{
+					Args: amqp091.Table{
+						"x-message-ttl":          layout.TTL(bucket).Milliseconds(),
+						"x-dead-letter-exchange": deadLetterExchange,
+					},
+				})
+				if errQueue != nil {
+					return errQueue
+				}
+				return rabbitMQChannel.QueueBind(q.Name, "", layout.Exchange, false, amqp091.Table{
+					"x-match":           "all",
+					delaybuckets.Header: layout.Key(bucket),
+				})
+			},
+			rabbitmqRetryStrategy,
+		)
+		if err != nil {
+			return fmt.Errorf("error declaring wait queue '%s': %w", name, err)
+		}
+	}
+	return nil
+}
+
+// GetRabbitMQResultConsumer connects to rabbitMQ and declares the queue workers report delivery results into
+//
+// returns:
+//
+//	consumer config
+//	channel to close
+//	error
+func GetRabbitMQResultConsumer(rabbitCfg config.RabbitMQConfig, rabbitmqRetryStrategy retry.Strategy) (*rabbitmq.ConsumerConfig, *rabbitmq.Channel, error) {
+	// step 1. init connect
+	rabbitMQConn, err := rabbitmq.Connect(
+		fmt.Sprintf("amqp://%s:%s@%s:%d/%s",
+			rabbitCfg.User,
+			rabbitCfg.Password,
+			rabbitCfg.Host,
+			rabbitCfg.Port,
+			rabbitCfg.VHost,
+		), rabbitmqRetryStrategy.Attempts, rabbitmqRetryStrategy.Delay)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to rabbitmq: %w", err)
+	}
+
+	// step 2. get channel to consume
+	var rabbitMQChannel *rabbitmq.Channel
+	rabbitMQChannel, err = rabbitMQConn.Channel()
+	if err != nil {
+		return nil, nil, fmt.Errorf("error connecting to rabbitmq (conn.Channel()): %w", err)
+	}
+
+	// step 3. declare result queue (at least try), workers publish into it with default exchange
 	rabbitMQQueueManager := rabbitmq.NewQueueManager(rabbitMQChannel)
 
 	err = retry.Do(
 		func() error {
-			_, errQueue := rabbitMQQueueManager.DeclareQueue(rabbitCfg.QueueSend)
+			_, errQueue := rabbitMQQueueManager.DeclareQueue(rabbitCfg.ResultQueue)
 			return errQueue
 		},
 		rabbitmqRetryStrategy,
 	)
-
 	if err != nil {
-		return nil, nil, fmt.Errorf("error declaring queue '%s': %w", rabbitCfg.QueueSend, err)
+		return nil, nil, fmt.Errorf("error declaring queue '%s': %w", rabbitCfg.ResultQueue, err)
 	}
 
-	// final step. create publisher
-	rabbitmqPublisher := rabbitmq.NewPublisher(
-		rabbitMQChannel,
-		rabbitCfg.Exchange)
-	return rabbitmqPublisher, rabbitMQChannel, nil
+	// final step. create consumer config, receiver consumes with it
+	return rabbitmq.NewConsumerConfig(rabbitCfg.ResultQueue), rabbitMQChannel, nil
 }
@@ -4,7 +4,9 @@ import (
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
 )
 
 // CreateNotificationBody is a DTO for create endpoint
@@ -13,6 +15,34 @@ type CreateNotificationBody struct {
 	Channel       string                  `json:"channel"`
 	Content       notificationBodyContent `json:"content"`
 	SendTo        string                  `json:"send_to,omitempty"`
+
+	// Template replaces content: it's rendered with variables at send time
+	Template *notificationBodyTemplate `json:"template,omitempty"`
+
+	// Recurrence makes notification a series, publication_at is its start then
+	Recurrence *notificationBodyRecurrence `json:"recurrence,omitempty"`
+
+	// Recipients replace channel and send_to: notification is sent to each of them, see ToParent
+	Recipients []notificationBodyRecipient `json:"recipients,omitempty"`
+}
+
+// MaxRecipients is the max amount of recipients of 1 fan-out notification
+const MaxRecipients = 10000
+
+type notificationBodyRecipient struct {
+	Channel string `json:"channel"`
+	SendTo  string `json:"send_to"`
+}
+
+type notificationBodyTemplate struct {
+	ID        string         `json:"id"`
+	Variables map[string]any `json:"variables,omitempty"`
+}
+
+type notificationBodyRecurrence struct {
+	Rule  string `json:"rule"`
+	Until string `json:"until,omitempty"`
+	Count int    `json:"count,omitempty"`
 }
 
 // ToEntity is a method that converts DTO into create-able model (without ID)
@@ -33,9 +63,13 @@ func (b CreateNotificationBody) ToEntity() (*models.Notification, error) {
 		return nil, fmt.Errorf("incorrect 'channel' '%s': %w", b.Channel, err)
 	}
 
-	// content body
-	title := types.NewAnyText(b.Content.Title)
-	message := types.NewAnyText(b.Content.Message)
+	// content body or template
+	var content models.NotificationContent
+	var template *models.NotificationTemplate
+	content, template, err = b.toContent()
+	if err != nil {
+		return nil, err
+	}
 
 	// send to
 	var sendTo internaltypes.SendTo
@@ -48,10 +82,126 @@ func (b CreateNotificationBody) ToEntity() (*models.Notification, error) {
 	return &models.Notification{
 		PublicationAt: publicationAt,
 		Channel:       channel,
-		Content: models.NotificationContent{
-			Title:   title,
-			Message: message,
-		},
-		SendTo: sendTo,
+		Content:       content,
+		Status:        internaltypes.StatusScheduled,
+		SendTo:        sendTo,
+		Template:      template,
+	}, nil
+}
+
+// ToParent is a method that converts DTO with recipients into create-able fan-out model (without ID)
+//
+// returns nil if there are no recipients. Top-level channel, send_to and recurrence mustn't be given then
+func (b CreateNotificationBody) ToParent() (*models.NotificationParent, error) {
+	if len(b.Recipients) == 0 {
+		return nil, nil
+	}
+
+	if b.Channel != "" || b.SendTo != "" {
+		return nil, fmt.Errorf("either 'channel' with 'send_to' or 'recipients' must be given, not both")
+	}
+	if b.Recurrence != nil {
+		return nil, fmt.Errorf("'recurrence' can't be combined with 'recipients'")
+	}
+	if len(b.Recipients) > MaxRecipients {
+		return nil, fmt.Errorf("too many 'recipients': %d, max is %d", len(b.Recipients), MaxRecipients)
+	}
+
+	publicationAt, err := types.NewDateTimeFromString(b.PublicationAt)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'publication_at' '%s': %w", b.PublicationAt, err)
+	}
+
+	var content models.NotificationContent
+	var template *models.NotificationTemplate
+	content, template, err = b.toContent()
+	if err != nil {
+		return nil, err
+	}
+
+	recipients := make([]models.Recipient, len(b.Recipients))
+	seen := make(map[models.Recipient]int, len(b.Recipients))
+
+	for i, recipient := range b.Recipients {
+		var channel internaltypes.NotificationChannel
+		channel, err = internaltypes.NotificationChannelFromString(recipient.Channel)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect 'recipients[%d].channel' '%s': %w", i, recipient.Channel, err)
+		}
+
+		var sendTo internaltypes.SendTo
+		sendTo, err = internaltypes.NewSendTo(types.NewAnyText(recipient.SendTo), channel)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect 'recipients[%d].send_to' '%s': %w", i, recipient.SendTo, err)
+		}
+
+		recipients[i] = models.Recipient{Channel: channel, SendTo: sendTo}
+
+		// the same address twice would get the same notification twice
+		if previous, found := seen[recipients[i]]; found {
+			return nil, fmt.Errorf("'recipients[%d]' duplicates 'recipients[%d]'", i, previous)
+		}
+		seen[recipients[i]] = i
+	}
+
+	return &models.NotificationParent{
+		PublicationAt: publicationAt,
+		Content:       content,
+		Template:      template,
+		Recipients:    recipients,
 	}, nil
 }
+
+// toContent validates content body or template, variables are checked later against the template itself
+func (b CreateNotificationBody) toContent() (models.NotificationContent, *models.NotificationTemplate, error) {
+	content := models.NotificationContent{
+		Title:   types.NewAnyText(b.Content.Title),
+		Message: types.NewAnyText(b.Content.Message),
+	}
+
+	if b.Template == nil {
+		return content, nil, nil
+	}
+
+	if b.Content.Title != "" || b.Content.Message != "" {
+		return content, nil, fmt.Errorf("either 'content' or 'template' must be given, not both")
+	}
+
+	templateID, err := types.NewUUID(b.Template.ID)
+	if err != nil {
+		return content, nil, fmt.Errorf("incorrect 'template.id' '%s': %w", b.Template.ID, err)
+	}
+	return content, &models.NotificationTemplate{ID: templateID, Variables: b.Template.Variables}, nil
+}
+
+// ToSeries is a method that converts recurrence into create-able series model (without ID)
+//
+// returns nil if there's no recurrence
+func (b CreateNotificationBody) ToSeries() (*models.NotificationSeries, error) {
+	if b.Recurrence == nil {
+		return nil, nil
+	}
+
+	start, err := types.NewDateTimeFromString(b.PublicationAt)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'publication_at' '%s': %w", b.PublicationAt, err)
+	}
+
+	var until time.Time
+	if b.Recurrence.Until != "" {
+		var untilParsed types.DateTime
+		untilParsed, err = types.NewDateTimeFromString(b.Recurrence.Until)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect 'recurrence.until' '%s': %w", b.Recurrence.Until, err)
+		}
+		until = untilParsed.Value()
+	}
+
+	var rule recurrence.Rule
+	rule, err = recurrence.NewRule(b.Recurrence.Rule, start.Value(), until, b.Recurrence.Count)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'recurrence' '%s': %w", b.Recurrence.Rule, err)
+	}
+
+	return &models.NotificationSeries{Rule: rule}, nil
+}
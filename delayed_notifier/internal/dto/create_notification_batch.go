@@ -0,0 +1,129 @@
+package dto
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"io"
+	"mime"
+)
+
+const (
+	// MaxBatchItems is the max amount of notifications in 1 batch
+	MaxBatchItems = 10000
+	// MaxBatchLineBytes is the max length of 1 NDJSON line
+	MaxBatchLineBytes = 1 << 20
+)
+
+// ErrBatchTooLarge occurs when batch has more than MaxBatchItems items
+var ErrBatchTooLarge = fmt.Errorf("batch mustn't have more than %d items", MaxBatchItems)
+
+// CreateNotificationBatchItem is 1 item of batch create endpoint, ParseErr is set if it couldn't be parsed
+type CreateNotificationBatchItem struct {
+	Body     CreateNotificationBody
+	ParseErr error
+}
+
+// ParseCreateNotificationBatch reads batch of CreateNotificationBody
+//
+// body is NDJSON (1 object per line) if content type is “application/x-ndjson“ or “application/jsonl“,
+// JSON array otherwise. Items that can't be parsed get ParseErr, malformed JSON array or stream fails entirely
+func ParseCreateNotificationBatch(contentType string, body io.Reader) ([]CreateNotificationBatchItem, error) {
+	mediaType, _, _ := mime.ParseMediaType(contentType)
+
+	var raws []json.RawMessage
+	switch mediaType {
+	case "application/x-ndjson", "application/jsonl":
+		scanner := bufio.NewScanner(body)
+		scanner.Buffer(make([]byte, 0, 64*1024), MaxBatchLineBytes)
+		for scanner.Scan() {
+			line := bytes.TrimSpace(scanner.Bytes())
+			if len(line) == 0 {
+				continue
+			}
+			if len(raws) == MaxBatchItems {
+				return nil, ErrBatchTooLarge
+			}
+			raws = append(raws, bytes.Clone(line))
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, fmt.Errorf("invalid NDJSON: %w", err)
+		}
+	default:
+		// streamed item by item so that a too large batch isn't read until its end
+		decoder := json.NewDecoder(body)
+		token, err := decoder.Token()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+		if token != json.Delim('[') {
+			return nil, fmt.Errorf("invalid JSON array: expected '[', got '%v'", token)
+		}
+		for decoder.More() {
+			if len(raws) == MaxBatchItems {
+				return nil, ErrBatchTooLarge
+			}
+			var raw json.RawMessage
+			if err := decoder.Decode(&raw); err != nil {
+				return nil, fmt.Errorf("invalid JSON array: %w", err)
+			}
+			raws = append(raws, raw)
+		}
+		if _, err := decoder.Token(); err != nil {
+			return nil, fmt.Errorf("invalid JSON array: %w", err)
+		}
+	}
+
+	if len(raws) == 0 {
+		return nil, errors.New("batch is empty")
+	}
+
+	items := make([]CreateNotificationBatchItem, len(raws))
+	for i, raw := range raws {
+		items[i].ParseErr = json.Unmarshal(raw, &items[i].Body)
+	}
+	return items, nil
+}
+
+// ToBatchEntity is ToEntity for batch items: recurrence and recipients aren't supported there
+func (b CreateNotificationBody) ToBatchEntity() (*models.Notification, error) {
+	if b.Recurrence != nil {
+		return nil, errors.New("'recurrence' isn't supported in batch")
+	}
+	if len(b.Recipients) > 0 {
+		return nil, errors.New("'recipients' isn't supported in batch")
+	}
+	return b.ToEntity()
+}
+
+// CreateNotificationBatchResponse is a DTO for batch create endpoint response
+//
+// items are in the same order as in request
+type CreateNotificationBatchResponse struct {
+	Created int                                  `json:"created"`
+	Failed  int                                  `json:"failed"`
+	Items   []*CreateNotificationBatchItemResult `json:"items"`
+}
+
+// CreateNotificationBatchItemResult is the result of 1 batch item: either id or error
+type CreateNotificationBatchItemResult struct {
+	Index int    `json:"index"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// NewCreateNotificationBatchResponse creates a response from results, counters are computed
+func NewCreateNotificationBatchResponse(items []*CreateNotificationBatchItemResult) *CreateNotificationBatchResponse {
+	result := &CreateNotificationBatchResponse{Items: items}
+	for _, item := range items {
+		if item.Error != "" {
+			result.Failed++
+		} else {
+			result.Created++
+		}
+	}
+	return result
+}
@@ -0,0 +1,182 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+// DeadLetterFilterRequest is a DTO for dead letter filters in query, used by list, replay and purge endpoints
+//
+// every filter is optional
+type DeadLetterFilterRequest struct {
+	Channel        string `form:"channel"`
+	Source         string `form:"source"`
+	NotificationID string `form:"notification_id"`
+	FailedAtFrom   string `form:"failed_at_from"`
+	FailedAtTo     string `form:"failed_at_to"`
+}
+
+// ListDeadLettersRequest is a DTO for dead letters list endpoint query parameters
+type ListDeadLettersRequest struct {
+	DeadLetterFilterRequest
+
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+}
+
+// DeadLetterBody is a DTO for fully-serialized DeadLetter model
+type DeadLetterBody struct {
+	ID             string `json:"id"`
+	NotificationID string `json:"notification_id"`
+	Channel        string `json:"channel"`
+	Source         string `json:"source"`
+	Error          string `json:"error"`
+	Attempts       int    `json:"attempts"`
+	FailedAt       string `json:"failed_at"`
+
+	// Payload is the notification row as it was at the failure
+	Payload json.RawMessage `json:"payload"`
+}
+
+// ListDeadLettersResponse is a DTO for dead letters list endpoint response
+//
+// next_cursor is omitted on the last page
+type ListDeadLettersResponse struct {
+	Items      []*DeadLetterBody `json:"items"`
+	NextCursor string            `json:"next_cursor,omitempty"`
+}
+
+// BindDeadLetterFilterRequest binds replay/purge request query
+func BindDeadLetterFilterRequest(c *gin.Context) (*DeadLetterFilterRequest, error) {
+	var req DeadLetterFilterRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// BindListDeadLettersRequest binds list request query
+func BindListDeadLettersRequest(c *gin.Context) (*ListDeadLettersRequest, error) {
+	var req ListDeadLettersRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ToFilter validates query parameters and converts them to models.DeadLetterFilter
+func (r *DeadLetterFilterRequest) ToFilter() (models.DeadLetterFilter, error) {
+	var filter models.DeadLetterFilter
+
+	if r.Channel != "" {
+		channel, err := internaltypes.NotificationChannelFromString(r.Channel)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'channel' '%s': %w", r.Channel, err)
+		}
+		filter.Channel = &channel
+	}
+
+	if r.Source != "" {
+		if r.Source != models.DeadLetterSourcePublish && r.Source != models.DeadLetterSourceDelivery {
+			return filter, fmt.Errorf("incorrect 'source' '%s': possible ones are: '%s', '%s'", r.Source,
+				models.DeadLetterSourcePublish, models.DeadLetterSourceDelivery)
+		}
+		source := r.Source
+		filter.Source = &source
+	}
+
+	if r.NotificationID != "" {
+		notificationID, err := types.NewUUID(r.NotificationID)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'notification_id' '%s': %w", r.NotificationID, err)
+		}
+		filter.NotificationID = &notificationID
+	}
+
+	if r.FailedAtFrom != "" {
+		from, err := types.NewDateTimeFromString(r.FailedAtFrom)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'failed_at_from' '%s': %w", r.FailedAtFrom, err)
+		}
+		filter.FailedAtFrom = &from
+	}
+
+	if r.FailedAtTo != "" {
+		to, err := types.NewDateTimeFromString(r.FailedAtTo)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'failed_at_to' '%s': %w", r.FailedAtTo, err)
+		}
+		filter.FailedAtTo = &to
+	}
+
+	return filter, nil
+}
+
+// ToCursor decodes cursor, nil if not given
+func (r *ListDeadLettersRequest) ToCursor() (*models.DeadLetterCursor, error) {
+	if r.Cursor == "" {
+		return nil, nil
+	}
+	return DecodeDeadLetterCursor(r.Cursor)
+}
+
+// ToLimit returns page size, DefaultListLimit if not given
+func (r *ListDeadLettersRequest) ToLimit() (int, error) {
+	if r.Limit == 0 {
+		return DefaultListLimit, nil
+	}
+	if r.Limit < 0 || r.Limit > MaxListLimit {
+		return 0, fmt.Errorf("incorrect 'limit' '%d': must be in [1; %d]", r.Limit, MaxListLimit)
+	}
+	return r.Limit, nil
+}
+
+// DeadLetterBodyFromEntity converts model to DTO
+func DeadLetterBodyFromEntity(model *models.DeadLetter) *DeadLetterBody {
+	return &DeadLetterBody{
+		ID:             model.ID.String(),
+		NotificationID: model.NotificationID.String(),
+		Channel:        model.Channel.String(),
+		Source:         model.Source,
+		Error:          model.Error.String(),
+		Attempts:       model.Attempts,
+		FailedAt:       model.FailedAt.String(),
+		Payload:        model.Payload,
+	}
+}
+
+// ListDeadLettersResponseFromEntities creates a response from a page of models and next cursor (may be nil)
+func ListDeadLettersResponseFromEntities(page []*models.DeadLetter, nextCursor *models.DeadLetterCursor) *ListDeadLettersResponse {
+	items := make([]*DeadLetterBody, len(page))
+	for i, model := range page {
+		items[i] = DeadLetterBodyFromEntity(model)
+	}
+
+	result := &ListDeadLettersResponse{Items: items}
+	if nextCursor != nil {
+		result.NextCursor = EncodeDeadLetterCursor(nextCursor)
+	}
+	return result
+}
+
+// EncodeDeadLetterCursor turns cursor into an opaque url-safe string
+func EncodeDeadLetterCursor(cursor *models.DeadLetterCursor) string {
+	return encodeKeyset(cursor.FailedAt, cursor.ID)
+}
+
+// DecodeDeadLetterCursor is the reverse of EncodeDeadLetterCursor
+func DecodeDeadLetterCursor(value string) (*models.DeadLetterCursor, error) {
+	failedAt, id, err := decodeKeyset(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DeadLetterCursor{
+		FailedAt: failedAt,
+		ID:       id,
+	}, nil
+}
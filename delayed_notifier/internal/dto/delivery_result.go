@@ -0,0 +1,60 @@
+package dto
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
+)
+
+// DeliveryResultBody is the DTO for delivery results received from MQ
+type DeliveryResultBody struct {
+	ID        string `json:"id"`
+	Channel   string `json:"channel"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+	Attempt   int    `json:"attempt"`
+	Timestamp string `json:"timestamp"`
+}
+
+// ToEntity is a method that converts DTO into models.DeliveryResult
+//
+// outcome must be either "delivered" or "failed"
+func (b DeliveryResultBody) ToEntity() (*models.DeliveryResult, error) {
+	id, err := types.NewUUID(b.ID)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'id' '%s': %w", b.ID, err)
+	}
+
+	var channel internaltypes.NotificationChannel
+	channel, err = internaltypes.NotificationChannelFromString(b.Channel)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'channel' '%s': %w", b.Channel, err)
+	}
+
+	var status internaltypes.NotificationStatus
+	switch b.Outcome {
+	case internaltypes.DELIVERED:
+		status = internaltypes.StatusDelivered
+	case internaltypes.FAILED:
+		status = internaltypes.StatusFailed
+	default:
+		return nil, fmt.Errorf("incorrect 'outcome' '%s': must be '%s' or '%s'", b.Outcome, internaltypes.DELIVERED, internaltypes.FAILED)
+	}
+
+	var timestamp time.Time
+	timestamp, err = time.Parse(time.RFC3339Nano, b.Timestamp)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'timestamp' '%s': %w", b.Timestamp, err)
+	}
+
+	return &models.DeliveryResult{
+		ID:        id,
+		Channel:   channel,
+		Status:    status,
+		Error:     types.NewAnyText(b.Error),
+		Attempt:   b.Attempt,
+		Timestamp: types.NewDateTime(timestamp),
+	}, nil
+}
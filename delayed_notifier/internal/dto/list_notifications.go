@@ -0,0 +1,191 @@
+package dto
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/gin-gonic/gin"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultListLimit is the page size used when “limit“ isn't given
+	DefaultListLimit = 50
+	// MaxListLimit is the max page size
+	MaxListLimit = 500
+)
+
+// ErrInvalidCursor occurs when given cursor couldn't be decoded
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// ListNotificationsRequest is a DTO for list endpoint query parameters
+//
+// every filter is optional
+type ListNotificationsRequest struct {
+	Channel           string `form:"channel"`
+	SendTo            string `form:"send_to"`
+	Status            string `form:"status"`
+	ParentID          string `form:"parent_id"`
+	PublicationAtFrom string `form:"publication_at_from"`
+	PublicationAtTo   string `form:"publication_at_to"`
+
+	Cursor string `form:"cursor"`
+	Limit  int    `form:"limit"`
+}
+
+// ListNotificationsResponse is a DTO for list endpoint response
+//
+// next_cursor is omitted on the last page
+type ListNotificationsResponse struct {
+	Items      []*FullNotificationBody `json:"items"`
+	NextCursor string                  `json:"next_cursor,omitempty"`
+}
+
+// BindListNotificationsRequest binds list request query
+func BindListNotificationsRequest(c *gin.Context) (*ListNotificationsRequest, error) {
+	var req ListNotificationsRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ToFilter validates query parameters and converts them to models.NotificationFilter
+func (r *ListNotificationsRequest) ToFilter() (models.NotificationFilter, error) {
+	var filter models.NotificationFilter
+
+	if r.Channel != "" {
+		channel, err := internaltypes.NotificationChannelFromString(r.Channel)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'channel' '%s': %w", r.Channel, err)
+		}
+		filter.Channel = &channel
+	}
+
+	if r.SendTo != "" {
+		sendTo := types.NewAnyText(r.SendTo)
+		filter.SendTo = &sendTo
+	}
+
+	if r.Status != "" {
+		status, err := internaltypes.NotificationStatusFromString(r.Status)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'status' '%s': %w", r.Status, err)
+		}
+		filter.Status = &status
+	}
+
+	if r.ParentID != "" {
+		parentID, err := types.NewUUID(r.ParentID)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'parent_id' '%s': %w", r.ParentID, err)
+		}
+		filter.ParentID = &parentID
+	}
+
+	if r.PublicationAtFrom != "" {
+		from, err := types.NewDateTimeFromString(r.PublicationAtFrom)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'publication_at_from' '%s': %w", r.PublicationAtFrom, err)
+		}
+		filter.PublicationAtFrom = &from
+	}
+
+	if r.PublicationAtTo != "" {
+		to, err := types.NewDateTimeFromString(r.PublicationAtTo)
+		if err != nil {
+			return filter, fmt.Errorf("incorrect 'publication_at_to' '%s': %w", r.PublicationAtTo, err)
+		}
+		filter.PublicationAtTo = &to
+	}
+
+	return filter, nil
+}
+
+// ToCursor decodes cursor, nil if not given
+func (r *ListNotificationsRequest) ToCursor() (*models.NotificationCursor, error) {
+	if r.Cursor == "" {
+		return nil, nil
+	}
+	return DecodeNotificationCursor(r.Cursor)
+}
+
+// ToLimit returns page size, DefaultListLimit if not given
+func (r *ListNotificationsRequest) ToLimit() (int, error) {
+	if r.Limit == 0 {
+		return DefaultListLimit, nil
+	}
+	if r.Limit < 0 || r.Limit > MaxListLimit {
+		return 0, fmt.Errorf("incorrect 'limit' '%d': must be in [1; %d]", r.Limit, MaxListLimit)
+	}
+	return r.Limit, nil
+}
+
+// ListNotificationsResponseFromEntities creates a response from a page of models and next cursor (may be nil)
+func ListNotificationsResponseFromEntities(page []*models.Notification, nextCursor *models.NotificationCursor) *ListNotificationsResponse {
+	items := make([]*FullNotificationBody, len(page))
+	for i, model := range page {
+		items[i] = FullNotificationBodyFromEntity(model)
+	}
+
+	result := &ListNotificationsResponse{Items: items}
+	if nextCursor != nil {
+		result.NextCursor = EncodeNotificationCursor(nextCursor)
+	}
+	return result
+}
+
+// EncodeNotificationCursor turns cursor into an opaque url-safe string
+//
+// publication_at is encoded with nanoseconds so that the keyset stays exact
+func EncodeNotificationCursor(cursor *models.NotificationCursor) string {
+	return encodeKeyset(cursor.PublicationAt, cursor.ID)
+}
+
+// DecodeNotificationCursor is the reverse of EncodeNotificationCursor
+func DecodeNotificationCursor(value string) (*models.NotificationCursor, error) {
+	publicationAt, id, err := decodeKeyset(value)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.NotificationCursor{
+		PublicationAt: publicationAt,
+		ID:            id,
+	}, nil
+}
+
+// encodeKeyset turns (datetime, id) keyset into an opaque url-safe string, datetime keeps nanoseconds
+func encodeKeyset(at types.DateTime, id types.UUID) string {
+	raw := at.Value().Format(time.RFC3339Nano) + "|" + id.String()
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeKeyset is the reverse of encodeKeyset
+func decodeKeyset(value string) (types.DateTime, types.UUID, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(value)
+	if err != nil {
+		return types.DateTime{}, types.UUID{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	atString, idString, found := strings.Cut(string(raw), "|")
+	if !found {
+		return types.DateTime{}, types.UUID{}, ErrInvalidCursor
+	}
+
+	at, err := time.Parse(time.RFC3339Nano, atString)
+	if err != nil {
+		return types.DateTime{}, types.UUID{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	id, err := types.NewUUID(idString)
+	if err != nil {
+		return types.DateTime{}, types.UUID{}, fmt.Errorf("%w: %w", ErrInvalidCursor, err)
+	}
+
+	return types.NewDateTime(at), id, nil
+}
@@ -10,8 +10,20 @@ type FullNotificationBody struct {
 	ID            string                  `json:"id"`
 	PublicationAt string                  `json:"publication_at"`
 	Channel       string                  `json:"channel"`
-	Sent          bool                    `json:"sent"`
+	Status        string                  `json:"status"`
 	SendTo        string                  `json:"send_to"`
+
+	// Delivery is omitted until worker reports anything
+	Delivery *notificationBodyDelivery `json:"delivery,omitempty"`
+
+	// Series is omitted if notification isn't recurring
+	Series *notificationBodySeries `json:"series,omitempty"`
+
+	// Template is omitted if content isn't rendered from a template
+	Template *notificationBodyTemplate `json:"template,omitempty"`
+
+	// ParentID is omitted if notification isn't a delivery of fan-out notification
+	ParentID string `json:"parent_id,omitempty"`
 }
 
 type notificationBodyContent struct {
@@ -19,8 +31,49 @@ type notificationBodyContent struct {
 	Message string `json:"message"`
 }
 
+type notificationBodyDelivery struct {
+	Attempts      int    `json:"attempts"`
+	LastError     string `json:"last_error,omitempty"`
+	LastAttemptAt string `json:"last_attempt_at"`
+}
+
+type notificationBodySeries struct {
+	ID         string `json:"id"`
+	Occurrence int    `json:"occurrence"`
+}
+
 // FullNotificationBodyFromEntity is a method that model to DTO, used for “return “
 func FullNotificationBodyFromEntity(model *models.Notification) *FullNotificationBody {
+	var delivery *notificationBodyDelivery
+	if model.Delivery != nil {
+		delivery = &notificationBodyDelivery{
+			Attempts:      model.Delivery.Attempts,
+			LastError:     model.Delivery.LastError.String(),
+			LastAttemptAt: model.Delivery.LastAttemptAt.String(),
+		}
+	}
+
+	var series *notificationBodySeries
+	if model.SeriesID != nil {
+		series = &notificationBodySeries{
+			ID:         model.SeriesID.String(),
+			Occurrence: model.Occurrence,
+		}
+	}
+
+	var template *notificationBodyTemplate
+	if model.Template != nil {
+		template = &notificationBodyTemplate{
+			ID:        model.Template.ID.String(),
+			Variables: model.Template.Variables,
+		}
+	}
+
+	var parentID string
+	if model.ParentID != nil {
+		parentID = model.ParentID.String()
+	}
+
 	return &FullNotificationBody{
 		ID:            model.ID.String(),
 		PublicationAt: model.PublicationAt.String(),
@@ -29,7 +82,11 @@ func FullNotificationBodyFromEntity(model *models.Notification) *FullNotificatio
 			Title:   model.Content.Title.String(),
 			Message: model.Content.Message.String(),
 		},
-		Sent:   model.Sent,
-		SendTo: model.SendTo.String(),
+		Status:   model.Status.String(),
+		SendTo:   model.SendTo.String(),
+		Delivery: delivery,
+		Series:   series,
+		Template: template,
+		ParentID: parentID,
 	}
 }
@@ -0,0 +1,50 @@
+package dto
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+)
+
+// ParentBody is a DTO for fully-serialized NotificationParent model
+//
+// status is the aggregate one, statuses are amounts of deliveries per status.
+// Deliveries themselves are listed with “GET /notify?parent_id=“
+type ParentBody struct {
+	Content       notificationBodyContent `json:"content"`
+	ID            string                  `json:"id"`
+	PublicationAt string                  `json:"publication_at"`
+	Status        string                  `json:"status"`
+	Total         int                     `json:"total"`
+	Statuses      map[string]int          `json:"statuses"`
+
+	// Template is omitted if content isn't rendered from a template
+	Template *notificationBodyTemplate `json:"template,omitempty"`
+}
+
+// ParentBodyFromEntity is a method that converts model to DTO, used for “return “
+func ParentBodyFromEntity(model *models.NotificationParent) *ParentBody {
+	statuses := make(map[string]int, len(model.StatusCounts))
+	for status, count := range model.StatusCounts {
+		statuses[status.String()] = count
+	}
+
+	var template *notificationBodyTemplate
+	if model.Template != nil {
+		template = &notificationBodyTemplate{
+			ID:        model.Template.ID.String(),
+			Variables: model.Template.Variables,
+		}
+	}
+
+	return &ParentBody{
+		ID:            model.ID.String(),
+		PublicationAt: model.PublicationAt.String(),
+		Content: notificationBodyContent{
+			Title:   model.Content.Title.String(),
+			Message: model.Content.Message.String(),
+		},
+		Status:   model.AggregateStatus(),
+		Total:    model.Total(),
+		Statuses: statuses,
+		Template: template,
+	}
+}
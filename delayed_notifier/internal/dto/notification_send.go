@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"time"
 )
 
 // NotificationSendBody is the DTO for sending to MQ
@@ -13,21 +14,43 @@ type NotificationSendBody struct {
 	PublicationAt string                  `json:"publication_at"`
 	Channel       string                  `json:"channel"`
 	SendTo        string                  `json:"send_to"`
+
+	// Template is rendered by worker, content is empty then
+	Template *notificationSendTemplate `json:"template,omitempty"`
+}
+
+type notificationSendTemplate struct {
+	ID        string         `json:"id"`
+	Title     string         `json:"title"`
+	Message   string         `json:"message"`
+	Variables map[string]any `json:"variables"`
 }
 
 // NotificationSendBodyFromEntity creates a new *NotificationSendBody from given object
 //
-// Use it to send to MQ
+// Use it to send to MQ, template source must be attached to object beforehand
 func NotificationSendBodyFromEntity(object *models.Notification) *NotificationSendBody {
+	var template *notificationSendTemplate
+	if object.Template != nil && object.Template.Source != nil {
+		template = &notificationSendTemplate{
+			ID:        object.Template.ID.String(),
+			Title:     object.Template.Source.Content.Title.String(),
+			Message:   object.Template.Source.Content.Message.String(),
+			Variables: object.Template.Variables,
+		}
+	}
+
 	return &NotificationSendBody{
 		Content: notificationBodyContent{
 			Title:   object.Content.Title.String(),
 			Message: object.Content.Message.String(),
 		},
-		ID:            object.ID.String(),
-		PublicationAt: object.PublicationAt.String(),
+		ID: object.ID.String(),
+		// nanoseconds are kept so that workers don't send before the exact time
+		PublicationAt: object.PublicationAt.Value().UTC().Format(time.RFC3339Nano),
 		Channel:       object.Channel.String(),
 		SendTo:        object.SendTo.String(),
+		Template:      template,
 	}
 }
 
@@ -0,0 +1,80 @@
+package dto
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// DefaultUpcomingLimit is the amount of upcoming occurrences returned when “limit“ isn't given
+	DefaultUpcomingLimit = 10
+	// MaxUpcomingLimit is the max amount of upcoming occurrences
+	MaxUpcomingLimit = 100
+)
+
+// GetSeriesRequest is a DTO for get series endpoint query parameters, ID is bound with BindGetNotificationRequest
+type GetSeriesRequest struct {
+	Limit int `form:"limit"`
+}
+
+// BindGetSeriesRequest binds get series request query
+func BindGetSeriesRequest(c *gin.Context) (*GetSeriesRequest, error) {
+	var req GetSeriesRequest
+	if err := c.ShouldBindQuery(&req); err != nil {
+		return nil, err
+	}
+	return &req, nil
+}
+
+// ToLimit returns amount of upcoming occurrences, DefaultUpcomingLimit if not given
+func (r *GetSeriesRequest) ToLimit() (int, error) {
+	if r.Limit == 0 {
+		return DefaultUpcomingLimit, nil
+	}
+	if r.Limit < 0 || r.Limit > MaxUpcomingLimit {
+		return 0, fmt.Errorf("incorrect 'limit' '%d': must be in [1; %d]", r.Limit, MaxUpcomingLimit)
+	}
+	return r.Limit, nil
+}
+
+// SeriesBody is a DTO for fully-serialized NotificationSeries model
+//
+// upcoming are datetimes of occurrences that haven't been sent yet
+type SeriesBody struct {
+	ID          string   `json:"id"`
+	Rule        string   `json:"rule"`
+	StartsAt    string   `json:"starts_at"`
+	Until       string   `json:"until,omitempty"`
+	Count       int      `json:"count,omitempty"`
+	StoppedAt   string   `json:"stopped_at,omitempty"`
+	Occurrences int      `json:"occurrences"`
+	Upcoming    []string `json:"upcoming"`
+}
+
+// SeriesBodyFromEntity is a method that converts model and its upcoming occurrences to DTO, used for “return “
+func SeriesBodyFromEntity(model *models.NotificationSeries, upcoming []types.DateTime) *SeriesBody {
+	result := &SeriesBody{
+		ID:       model.ID.String(),
+		Rule:     model.Rule.String(),
+		StartsAt: types.NewDateTime(model.Rule.Start()).String(),
+		Count:    model.Rule.Count(),
+		Upcoming: make([]string, len(upcoming)),
+	}
+
+	if until := model.Rule.Until(); !until.IsZero() {
+		result.Until = types.NewDateTime(until).String()
+	}
+	if model.StoppedAt != nil {
+		result.StoppedAt = model.StoppedAt.String()
+	}
+	if model.Last != nil {
+		result.Occurrences = model.Last.Occurrence
+	}
+	for i, occurrence := range upcoming {
+		result.Upcoming[i] = occurrence.String()
+	}
+
+	return result
+}
@@ -0,0 +1,65 @@
+package dto
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+var errEmptyTemplateName = errors.New("'name' mustn't be empty")
+
+// TemplateBody is a DTO for create/update template endpoints
+//
+// title and message are Go templates, e.g. “Hello, {{.name}}!“
+type TemplateBody struct {
+	Name    string                  `json:"name"`
+	Content notificationBodyContent `json:"content"`
+}
+
+// ToEntity is a method that converts DTO into create-able model (without ID)
+func (b TemplateBody) ToEntity() (*models.Template, error) {
+	template := &models.Template{
+		Name: types.NewAnyText(b.Name),
+		Content: models.NotificationContent{
+			Title:   types.NewAnyText(b.Content.Title),
+			Message: types.NewAnyText(b.Content.Message),
+		},
+	}
+
+	if b.Name == "" {
+		return nil, errEmptyTemplateName
+	}
+	if err := template.Validate(); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// FullTemplateBody is a DTO for fully-serialized Template model
+type FullTemplateBody struct {
+	ID      string                  `json:"id"`
+	Name    string                  `json:"name"`
+	Content notificationBodyContent `json:"content"`
+}
+
+// FullTemplateBodyFromEntity is a method that converts model to DTO, used for “return “
+func FullTemplateBodyFromEntity(model *models.Template) *FullTemplateBody {
+	return &FullTemplateBody{
+		ID:   model.ID.String(),
+		Name: model.Name.String(),
+		Content: notificationBodyContent{
+			Title:   model.Content.Title.String(),
+			Message: model.Content.Message.String(),
+		},
+	}
+}
+
+// FullTemplateBodiesFromEntities converts a list of models to DTOs
+func FullTemplateBodiesFromEntities(templates []*models.Template) []*FullTemplateBody {
+	result := make([]*FullTemplateBody, len(templates))
+	for i, template := range templates {
+		result[i] = FullTemplateBodyFromEntity(template)
+	}
+	return result
+}
@@ -0,0 +1,57 @@
+package dto
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// UpdateNotificationBody is a DTO for update (PATCH) endpoint
+//
+// every field is optional, omitted ones stay the same
+type UpdateNotificationBody struct {
+	PublicationAt *string                        `json:"publication_at,omitempty"`
+	Content       *updateNotificationBodyContent `json:"content,omitempty"`
+	SendTo        *string                        `json:"send_to,omitempty"`
+}
+
+type updateNotificationBodyContent struct {
+	Title   *string `json:"title,omitempty"`
+	Message *string `json:"message,omitempty"`
+}
+
+// ToPatch is a method that converts DTO into models.NotificationPatch
+//
+// send_to is validated later against notification channel
+func (b UpdateNotificationBody) ToPatch() (models.NotificationPatch, error) {
+	var patch models.NotificationPatch
+
+	// publication_at
+	if b.PublicationAt != nil {
+		publicationAt, err := types.NewDateTimeFromString(*b.PublicationAt)
+		if err != nil {
+			return patch, fmt.Errorf("incorrect 'publication_at' '%s': %w", *b.PublicationAt, err)
+		}
+		patch.PublicationAt = &publicationAt
+	}
+
+	// content body
+	if b.Content != nil {
+		if b.Content.Title != nil {
+			title := types.NewAnyText(*b.Content.Title)
+			patch.Title = &title
+		}
+		if b.Content.Message != nil {
+			message := types.NewAnyText(*b.Content.Message)
+			patch.Message = &message
+		}
+	}
+
+	// send to
+	if b.SendTo != nil {
+		sendTo := types.NewAnyText(*b.SendTo)
+		patch.SendTo = &sendTo
+	}
+
+	return patch, nil
+}
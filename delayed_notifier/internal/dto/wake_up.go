@@ -0,0 +1,59 @@
+package dto
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
+)
+
+// WakeUpNotice is the DTO for wake-ups sent between replicas (postgres NOTIFY payload)
+//
+// empty ID means that many notifications have changed and the near-term window must be reloaded
+type WakeUpNotice struct {
+	ID string `json:"id,omitempty"`
+	At string `json:"at"`
+}
+
+// WakeUpNoticeFromEntityBytes creates a JSON payload of wake-up, ID may be nil
+func WakeUpNoticeFromEntityBytes(wakeUp *models.WakeUp) ([]byte, error) {
+	notice := WakeUpNotice{At: wakeUp.At.UTC().Format(time.RFC3339Nano)}
+	if wakeUp.ID != nil {
+		notice.ID = wakeUp.ID.String()
+	}
+
+	body, err := json.Marshal(notice)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't marshal wake-up notice: %w", err)
+	}
+	return body, nil
+}
+
+// WakeUpNoticeBytesToEntity parses a JSON payload into models.WakeUp
+func WakeUpNoticeBytesToEntity(body []byte) (*models.WakeUp, error) {
+	var notice WakeUpNotice
+	if err := json.Unmarshal(body, &notice); err != nil {
+		return nil, fmt.Errorf("invalid wake-up notice: %w", err)
+	}
+	return notice.ToEntity()
+}
+
+// ToEntity is a method that converts DTO into models.WakeUp
+func (n WakeUpNotice) ToEntity() (*models.WakeUp, error) {
+	at, err := time.Parse(time.RFC3339Nano, n.At)
+	if err != nil {
+		return nil, fmt.Errorf("incorrect 'at' '%s': %w", n.At, err)
+	}
+
+	wakeUp := &models.WakeUp{At: at}
+	if n.ID != "" {
+		var id types.UUID
+		id, err = types.NewUUID(n.ID)
+		if err != nil {
+			return nil, fmt.Errorf("incorrect 'id' '%s': %w", n.ID, err)
+		}
+		wakeUp.ID = &id
+	}
+	return wakeUp, nil
+}
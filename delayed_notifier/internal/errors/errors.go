@@ -6,3 +6,57 @@ import "errors"
 //
 // Used by both service and repo
 var ErrNotificationNotFound = errors.New("notification not found")
+
+// ErrNotificationNotEditable occurs when notification can't be changed because it's not scheduled anymore
+//
+// Used by both service and repo
+var ErrNotificationNotEditable = errors.New("notification can't be changed in its current status")
+
+// ErrInvalidStatusTransition occurs when notification can't be moved from its current status into requested one
+//
+// Used by both service and repo
+var ErrInvalidStatusTransition = errors.New("invalid notification status transition")
+
+// ErrSeriesNotFound occurs when searched notification series couldn't be found
+//
+// Used by both service and repo
+var ErrSeriesNotFound = errors.New("notification series not found")
+
+// ErrSeriesStopped occurs when notification series is already stopped
+//
+// Used by both service and repo
+var ErrSeriesStopped = errors.New("notification series is already stopped")
+
+// ErrTemplateNotFound occurs when searched template couldn't be found
+//
+// Used by both service and repo
+var ErrTemplateNotFound = errors.New("template not found")
+
+// ErrTemplateNameTaken occurs when template with such name already exists
+//
+// Used by both service and repo
+var ErrTemplateNameTaken = errors.New("template name is already taken")
+
+// ErrTemplateInUse occurs when template can't be deleted because notifications refer to it
+//
+// Used by both service and repo
+var ErrTemplateInUse = errors.New("template is used by notifications")
+
+// ErrParentNotFound occurs when searched fan-out notification couldn't be found
+//
+// Used by both service and repo
+var ErrParentNotFound = errors.New("fan-out notification not found")
+
+// ErrPublishNacked occurs when MQ broker refused to take a published message
+var ErrPublishNacked = errors.New("message was nacked by broker")
+
+// ErrPublishReturned occurs when MQ broker couldn't route a mandatory message into any queue
+var ErrPublishReturned = errors.New("message was returned by broker")
+
+// ErrPublishNotConfirmed occurs when MQ broker didn't confirm a message in time or the channel was closed
+var ErrPublishNotConfirmed = errors.New("message wasn't confirmed by broker")
+
+// ErrDeadLetterNotFound occurs when searched dead letter couldn't be found
+//
+// Used by both service and repo
+var ErrDeadLetterNotFound = errors.New("dead letter not found")
@@ -0,0 +1,130 @@
+package internaltypes
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// ErrInvalidNotificationStatusValue describes an error when invalid string was put into NotificationStatus
+var ErrInvalidNotificationStatusValue = fmt.Errorf("invalid notification status value: possible ones are: '%s', '%s', '%s', '%s', '%s', '%s'",
+	SCHEDULED, QUEUED, DELIVERED, FAILED, CANCELLED, EXPIRED)
+
+const (
+	// SCHEDULED is the constant value for "waiting for publication_at" status
+	SCHEDULED = "scheduled"
+	// QUEUED is the constant value for "handed to MQ, worker will send it" status
+	QUEUED = "queued"
+	// DELIVERED is the constant value for "worker reported a successful send" status
+	DELIVERED = "delivered"
+	// FAILED is the constant value for "worker reported a failed send or publish attempts are exhausted" status
+	FAILED = "failed"
+	// CANCELLED is the constant value for "cancelled by user before it was queued" status
+	CANCELLED = "cancelled"
+	// EXPIRED is the constant value for "publication_at passed too long ago to send it" status
+	EXPIRED = "expired"
+)
+
+var (
+	// StatusScheduled is an example status with value SCHEDULED
+	StatusScheduled = NotificationStatus{val: SCHEDULED}
+	// StatusQueued is an example status with value QUEUED
+	StatusQueued = NotificationStatus{val: QUEUED}
+	// StatusDelivered is an example status with value DELIVERED
+	StatusDelivered = NotificationStatus{val: DELIVERED}
+	// StatusFailed is an example status with value FAILED
+	StatusFailed = NotificationStatus{val: FAILED}
+	// StatusCancelled is an example status with value CANCELLED
+	StatusCancelled = NotificationStatus{val: CANCELLED}
+	// StatusExpired is an example status with value EXPIRED
+	StatusExpired = NotificationStatus{val: EXPIRED}
+)
+
+// statusTransitions lists statuses every status may turn into
+//
+//	scheduled -> queued, cancelled, expired, failed (publish attempts are exhausted)
+//	queued    -> delivered, failed, scheduled (publish wasn't confirmed, try again)
+//	failed    -> scheduled (replay)
+//	delivered, cancelled, expired are final
+var statusTransitions = map[NotificationStatus][]NotificationStatus{
+	StatusScheduled: {StatusQueued, StatusCancelled, StatusExpired, StatusFailed},
+	StatusQueued:    {StatusDelivered, StatusFailed, StatusScheduled},
+	StatusFailed:    {StatusScheduled},
+}
+
+// NotificationStatus is enum'd type for notification lifecycle state
+//
+// possible values: “scheduled“, “queued“, “delivered“, “failed“, “cancelled“, “expired“
+type NotificationStatus struct {
+	val types.AnyText
+}
+
+// NotificationStatusFromString creates a new NotificationStatus object if it's valid
+func NotificationStatusFromString(val string) (NotificationStatus, error) {
+	switch val {
+	case SCHEDULED, QUEUED, DELIVERED, FAILED, CANCELLED, EXPIRED:
+		break
+	default:
+		return NotificationStatus{}, ErrInvalidNotificationStatusValue
+	}
+	return NotificationStatus{val: types.NewAnyText(val)}, nil
+}
+
+// String method of NotificationStatus returns its string value
+func (s NotificationStatus) String() string {
+	return s.val.String()
+}
+
+// MarshalText implements encoding.TextMarshaler, so that status survives json (e.g. in cache)
+func (s NotificationStatus) MarshalText() ([]byte, error) {
+	return []byte(s.val.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see NotificationStatusFromString. Empty text is an unset status
+func (s *NotificationStatus) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*s = NotificationStatus{}
+		return nil
+	}
+
+	status, err := NotificationStatusFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*s = status
+	return nil
+}
+
+// CanTransitionTo tells if notification in this status may be moved into next one
+func (s NotificationStatus) CanTransitionTo(next NotificationStatus) bool {
+	for _, allowed := range statusTransitions[s] {
+		if allowed == next {
+			return true
+		}
+	}
+	return false
+}
+
+// AllowedPrevious lists statuses that may be moved into this one
+//
+// use it for conditional updates, e.g. “WHERE status IN (...)“
+func (s NotificationStatus) AllowedPrevious() []NotificationStatus {
+	result := make([]NotificationStatus, 0, 2)
+	for from, allowed := range statusTransitions {
+		for _, to := range allowed {
+			if to == s {
+				result = append(result, from)
+			}
+		}
+	}
+	return result
+}
+
+// IsEditable tells if notification content and schedule can still be changed
+func (s NotificationStatus) IsEditable() bool {
+	return s == StatusScheduled
+}
+
+// IsFinal tells if notification in this status won't ever change
+func (s NotificationStatus) IsFinal() bool {
+	return len(statusTransitions[s]) == 0
+}
@@ -2,6 +2,7 @@ package internaltypes
 
 import (
 	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/templating"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"net/mail"
 	"strconv"
@@ -26,6 +27,8 @@ var (
 	ChannelTelegram = NotificationChannel{val: TELEGRAM}
 	// ChannelConsole is an example channel with value CONSOLE
 	ChannelConsole = NotificationChannel{val: CONSOLE}
+	// ChannelAllStrings is the collection of all channel name constants
+	ChannelAllStrings = []string{EMAIL, TELEGRAM, CONSOLE}
 )
 
 // NotificationChannel is enum'd type for notification channels
@@ -54,6 +57,34 @@ func (c *NotificationChannel) String() string {
 	return c.val.String()
 }
 
+// MarshalText implements encoding.TextMarshaler, so that channel survives json (e.g. in cache)
+func (c NotificationChannel) MarshalText() ([]byte, error) {
+	return []byte(c.val.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see NotificationChannelFromString. Empty text is an unset channel
+func (c *NotificationChannel) UnmarshalText(text []byte) error {
+	if len(text) == 0 {
+		*c = NotificationChannel{}
+		return nil
+	}
+
+	channel, err := NotificationChannelFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*c = channel
+	return nil
+}
+
+// TemplateKind tells which engine renders templates for this channel: emails are HTML, the rest is plain text
+func (c *NotificationChannel) TemplateKind() templating.Kind {
+	if c.val == EMAIL {
+		return templating.KindHTML
+	}
+	return templating.KindText
+}
+
 // SendTo is a value type that stores an address of user according to notification channel
 //
 //	email	-> some@email.com
@@ -68,6 +99,19 @@ func (s SendTo) String() string {
 	return s.val.String()
 }
 
+// MarshalText implements encoding.TextMarshaler, so that address survives json (e.g. in cache)
+func (s SendTo) MarshalText() ([]byte, error) {
+	return []byte(s.val.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler
+//
+// address isn't validated, channel is unknown here: it's validated by NewSendTo before it's saved
+func (s *SendTo) UnmarshalText(text []byte) error {
+	*s = SendTo{val: types.NewAnyText(string(text))}
+	return nil
+}
+
 // NewSendTo creates a new SendTo with a valid address for given channel
 func NewSendTo(val types.AnyText, channel NotificationChannel) (SendTo, error) {
 	switch channel {
@@ -0,0 +1,62 @@
+package models
+
+import (
+	"encoding/json"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+const (
+	// DeadLetterSourcePublish is the source of notifications whose publish attempts are exhausted
+	DeadLetterSourcePublish = "publish"
+	// DeadLetterSourceDelivery is the source of notifications that worker reported as failed
+	DeadLetterSourceDelivery = "delivery"
+)
+
+// DeadLetter is a notification that failed for good, it's kept for inspection until it's replayed or purged
+type DeadLetter struct {
+	ID             types.UUID
+	NotificationID types.UUID
+	Channel        internaltypes.NotificationChannel
+
+	// Source is either DeadLetterSourcePublish or DeadLetterSourceDelivery
+	Source   string
+	Error    types.AnyText
+	Attempts int
+
+	// Payload is the notification row as it was at the failure
+	Payload json.RawMessage
+
+	FailedAt types.DateTime
+}
+
+// DeadLetterFilter is the set of optional filters for listing, replaying and purging dead letters
+//
+// nil field = no filtering by it
+type DeadLetterFilter struct {
+	Channel *internaltypes.NotificationChannel
+	Source  *string
+
+	NotificationID *types.UUID
+
+	// FailedAtFrom is inclusive
+	FailedAtFrom *types.DateTime
+	// FailedAtTo is inclusive
+	FailedAtTo *types.DateTime
+}
+
+// DeadLetterCursor points at the last dead letter of a page
+//
+// Dead letters are listed in (FailedAt, ID) order, so next page starts right after the cursor
+type DeadLetterCursor struct {
+	FailedAt types.DateTime
+	ID       types.UUID
+}
+
+// DeadLetterCursorFromEntity creates a cursor that points at given dead letter
+func DeadLetterCursorFromEntity(deadLetter *DeadLetter) *DeadLetterCursor {
+	return &DeadLetterCursor{
+		FailedAt: deadLetter.FailedAt,
+		ID:       deadLetter.ID,
+	}
+}
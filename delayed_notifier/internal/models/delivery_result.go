@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// DeliveryResult is what worker reports back after trying to send a notification
+type DeliveryResult struct {
+	ID      types.UUID
+	Channel internaltypes.NotificationChannel
+
+	// Status is either internaltypes.StatusDelivered or internaltypes.StatusFailed
+	Status internaltypes.NotificationStatus
+	// Error is empty on success
+	Error types.AnyText
+	// Attempt is the number of worker's send attempt, starting from 1
+	Attempt int
+
+	Timestamp types.DateTime
+
+	// Message is the MQ message result came with, nil if it didn't come from MQ
+	Message ResultMessage
+}
+
+// ResultMessage settles the MQ message of a DeliveryResult
+//
+// Ack when result is recorded or never can be, Requeue when it must be delivered again
+type ResultMessage interface {
+	Ack()
+	Requeue()
+}
+
+// DeliveryInfo is the last known delivery state of a notification
+type DeliveryInfo struct {
+	Attempts      int
+	LastError     types.AnyText
+	LastAttemptAt types.DateTime
+}
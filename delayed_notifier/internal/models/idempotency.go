@@ -0,0 +1,16 @@
+package models
+
+// IdempotentResponse is the response saved for an idempotency key, it's replayed on repeated requests
+type IdempotentResponse struct {
+	StatusCode int
+	Body       []byte
+}
+
+// IdempotencyRecord is a used idempotency key
+type IdempotencyRecord struct {
+	Key         string
+	RequestHash string
+
+	// Response is nil while the first request is in progress
+	Response *IdempotentResponse
+}
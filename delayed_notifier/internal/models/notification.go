@@ -11,9 +11,23 @@ type Notification struct {
 	ID            *types.UUID
 	Channel       internaltypes.NotificationChannel
 	Content       NotificationContent
-	Sent          bool
+	Status        internaltypes.NotificationStatus
 
 	SendTo internaltypes.SendTo
+
+	// Delivery is the last result reported by worker, nil if there's none yet
+	Delivery *DeliveryInfo
+
+	// SeriesID is set if notification is an occurrence of NotificationSeries
+	SeriesID *types.UUID
+	// Occurrence is the number of occurrence in series, starting from 1 (0 if there's no series)
+	Occurrence int
+
+	// ParentID is set if notification is 1 delivery of NotificationParent
+	ParentID *types.UUID
+
+	// Template is set if content is rendered from a stored Template, Content is empty then
+	Template *NotificationTemplate
 }
 
 // NotificationContent is the universal struct for content: notification has a title and a message
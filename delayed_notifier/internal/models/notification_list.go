@@ -0,0 +1,39 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// NotificationFilter is the set of optional filters for listing notifications
+//
+// nil field = no filtering by it
+type NotificationFilter struct {
+	Channel *internaltypes.NotificationChannel
+	SendTo  *types.AnyText
+	Status  *internaltypes.NotificationStatus
+
+	// ParentID filters deliveries of 1 NotificationParent
+	ParentID *types.UUID
+
+	// PublicationAtFrom is inclusive
+	PublicationAtFrom *types.DateTime
+	// PublicationAtTo is inclusive
+	PublicationAtTo *types.DateTime
+}
+
+// NotificationCursor points at the last notification of a page
+//
+// Notifications are listed in (PublicationAt, ID) order, so next page starts right after the cursor
+type NotificationCursor struct {
+	PublicationAt types.DateTime
+	ID            types.UUID
+}
+
+// NotificationCursorFromEntity creates a cursor that points at given notification
+func NotificationCursorFromEntity(notification *Notification) *NotificationCursor {
+	return &NotificationCursor{
+		PublicationAt: notification.PublicationAt,
+		ID:            *notification.ID,
+	}
+}
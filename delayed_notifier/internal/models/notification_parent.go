@@ -0,0 +1,71 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+const (
+	// AggregateInProgress is the parent status when some deliveries are still scheduled or queued
+	AggregateInProgress = "in_progress"
+	// AggregatePartiallyDelivered is the parent status when every delivery is done, but only some are delivered
+	AggregatePartiallyDelivered = "partially_delivered"
+	// AggregateUndelivered is the parent status when every delivery is done and none is delivered
+	AggregateUndelivered = "undelivered"
+)
+
+// Recipient is 1 address of a fan-out notification
+type Recipient struct {
+	Channel internaltypes.NotificationChannel
+	SendTo  internaltypes.SendTo
+}
+
+// NotificationParent is a notification sent to many recipients
+//
+// it's expanded into 1 usual notification (delivery) per recipient, they're tracked individually
+type NotificationParent struct {
+	ID            *types.UUID
+	PublicationAt types.DateTime
+	Content       NotificationContent
+	Template      *NotificationTemplate
+
+	// Recipients are given on creation only
+	Recipients []Recipient
+
+	// StatusCounts is the amount of deliveries in every status, it's filled on read
+	StatusCounts map[internaltypes.NotificationStatus]int
+}
+
+// Total returns the amount of deliveries
+func (p *NotificationParent) Total() int {
+	total := 0
+	for _, count := range p.StatusCounts {
+		total += count
+	}
+	return total
+}
+
+// AggregateStatus sums up statuses of deliveries
+//
+// it's the common status if every delivery has the same one, otherwise:
+// AggregateInProgress, AggregatePartiallyDelivered or AggregateUndelivered
+func (p *NotificationParent) AggregateStatus() string {
+	present := make([]internaltypes.NotificationStatus, 0, len(p.StatusCounts))
+	for status, count := range p.StatusCounts {
+		if count > 0 {
+			present = append(present, status)
+		}
+	}
+
+	if len(present) == 1 {
+		return present[0].String()
+	}
+
+	if p.StatusCounts[internaltypes.StatusScheduled] > 0 || p.StatusCounts[internaltypes.StatusQueued] > 0 {
+		return AggregateInProgress
+	}
+	if p.StatusCounts[internaltypes.StatusDelivered] > 0 {
+		return AggregatePartiallyDelivered
+	}
+	return AggregateUndelivered
+}
@@ -0,0 +1,50 @@
+package models
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// NotificationPatch is the set of optional changes for an existing notification
+//
+// nil field = leave as is
+type NotificationPatch struct {
+	PublicationAt *types.DateTime
+	Title         *types.AnyText
+	Message       *types.AnyText
+
+	// SendTo is validated in Apply because it depends on notification channel
+	SendTo *types.AnyText
+}
+
+// Apply mutates given notification with non-nil fields of patch
+//
+// returns error if new SendTo is invalid for notification channel or content of a templated notification is changed,
+// notification isn't changed then
+func (p NotificationPatch) Apply(notification *Notification) error {
+	if notification.Template != nil && (p.Title != nil || p.Message != nil) {
+		return fmt.Errorf("content of notification with template can't be changed")
+	}
+
+	sendTo := notification.SendTo
+	if p.SendTo != nil {
+		var err error
+		sendTo, err = internaltypes.NewSendTo(*p.SendTo, notification.Channel)
+		if err != nil {
+			return fmt.Errorf("incorrect 'send_to' '%s': %w", p.SendTo.String(), err)
+		}
+	}
+	notification.SendTo = sendTo
+
+	if p.PublicationAt != nil {
+		notification.PublicationAt = *p.PublicationAt
+	}
+	if p.Title != nil {
+		notification.Content.Title = *p.Title
+	}
+	if p.Message != nil {
+		notification.Content.Message = *p.Message
+	}
+	return nil
+}
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// NotificationSeries is a recurring notification
+//
+// its occurrences are usual notifications, they're materialised one by one: next one is created when previous one is sent,
+// or later if that was interrupted
+type NotificationSeries struct {
+	ID   *types.UUID
+	Rule recurrence.Rule
+
+	// StoppedAt is set when series is stopped, nil if it's still active
+	StoppedAt *types.DateTime
+
+	// Last is the latest materialised occurrence, nil if there's none
+	Last *Notification
+}
+
+// IsStopped tells if no more occurrences will be created
+func (s *NotificationSeries) IsStopped() bool {
+	return s.StoppedAt != nil
+}
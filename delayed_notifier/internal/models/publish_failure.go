@@ -0,0 +1,21 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
+)
+
+// PublishFailure is a notification that MQ didn't accept, it returns to pending and is published again later
+type PublishFailure struct {
+	ID    *types.UUID
+	Error error
+}
+
+// PublishBackoff is the delay before next publish attempt: Base * 2^(attempts-1), up to Max
+//
+// after MaxAttempts failed publishes notification is failed and dead-lettered, 0 = retry forever
+type PublishBackoff struct {
+	Base        time.Duration
+	Max         time.Duration
+	MaxAttempts int
+}
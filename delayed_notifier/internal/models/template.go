@@ -0,0 +1,57 @@
+package models
+
+import (
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/templating"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// Template is a stored title/message pair with “{{.variable}}“ placeholders
+//
+// it isn't bound to a channel: email messages are rendered with html/template, the rest with text/template
+type Template struct {
+	ID      *types.UUID
+	Name    types.AnyText
+	Content NotificationContent
+}
+
+// Validate checks that both title and message can be parsed
+func (t *Template) Validate() error {
+	if err := templating.Validate(t.Content.Title.String()); err != nil {
+		return fmt.Errorf("title: %w", err)
+	}
+	if err := templating.Validate(t.Content.Message.String()); err != nil {
+		return fmt.Errorf("message: %w", err)
+	}
+	return nil
+}
+
+// Render renders both title and message for given channel, title is always plain text (e.g. email subject)
+//
+// fails if some variables are missing
+func (t *Template) Render(channel internaltypes.NotificationChannel, variables map[string]any) (NotificationContent, error) {
+	title, err := templating.Render(templating.KindText, t.Content.Title.String(), variables)
+	if err != nil {
+		return NotificationContent{}, fmt.Errorf("title: %w", err)
+	}
+
+	var message string
+	message, err = templating.Render(channel.TemplateKind(), t.Content.Message.String(), variables)
+	if err != nil {
+		return NotificationContent{}, fmt.Errorf("message: %w", err)
+	}
+
+	return NotificationContent{Title: types.NewAnyText(title), Message: types.NewAnyText(message)}, nil
+}
+
+// NotificationTemplate is a reference from notification to a Template with its variables
+//
+// it's rendered at send time by worker
+type NotificationTemplate struct {
+	ID        types.UUID
+	Variables map[string]any
+
+	// Source is the referenced template, it's filled right before publishing, nil otherwise
+	Source *Template
+}
@@ -0,0 +1,12 @@
+package models
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
+)
+
+// WakeUp is when a scheduled notification becomes due: its publication_at, next publish attempt or lease expiration, whichever is later
+type WakeUp struct {
+	ID *types.UUID
+	At time.Time
+}
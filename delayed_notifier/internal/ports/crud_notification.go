@@ -2,6 +2,7 @@ package ports
 
 import (
 	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 )
@@ -13,16 +14,33 @@ type NotificationCRUDStorageRepository interface {
 	// uuid is generated by caller
 	CreateNotification(ctx context.Context, notification *models.Notification) error
 
+	// CreateNotifications saves many notifications at once, atomically
+	//
+	// uuids are generated by caller
+	CreateNotifications(ctx context.Context, notifications []*models.Notification) error
+
 	// UpdateNotification is the Update method of this DB CRUD
 	//
 	// existing object's uuid is received from *models.Notification
 	UpdateNotification(ctx context.Context, newData *models.Notification) error
 
+	// UpdateStatus moves 1 notification into status
+	//
+	// must return errors.ErrInvalidStatusTransition if its current status can't be moved into given one
+	UpdateStatus(ctx context.Context, id types.UUID, status internaltypes.NotificationStatus) error
+
 	// DeleteNotification is the Delete method of this DB CRUD
 	DeleteNotification(ctx context.Context, ID types.UUID) error
 
 	// GetNotification is the Read method of this DB CRUD
 	GetNotification(ctx context.Context, id types.UUID) (*models.Notification, error)
+
+	// ListNotifications is the List method of this DB CRUD
+	//
+	// returns up to limit objects matching filter, ordered by (publication_at, id)
+	//
+	// cursor = nil means "from the start", otherwise objects strictly after cursor are returned
+	ListNotifications(ctx context.Context, filter models.NotificationFilter, cursor *models.NotificationCursor, limit int) ([]*models.Notification, error)
 }
 
 // NotificationCRUDCacheRepository is the CRUD-only Port for notifications 'Cache' e.g. redis or even in-memory map
@@ -0,0 +1,42 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// DeadLetterRepository is the port for notifications that failed for good
+//
+// dead letters are written by storage itself when publish attempts are exhausted (see
+// NotificationFetcherRepository.ReturnToPending) or worker reports a failure (see
+// DeliveryResultStorageRepository.RecordDeliveryResult), together with the failed status
+type DeadLetterRepository interface {
+	// ListDeadLetters returns up to limit dead letters matching filter, ordered by (failed_at, id)
+	//
+	// cursor = nil means "from the start", otherwise dead letters strictly after cursor are returned
+	ListDeadLetters(ctx context.Context, filter models.DeadLetterFilter, cursor *models.DeadLetterCursor, limit int) ([]*models.DeadLetter, error)
+
+	// GetDeadLetter returns 1 dead letter
+	//
+	// must return errors.ErrDeadLetterNotFound if there's no such dead letter
+	GetDeadLetter(ctx context.Context, id types.UUID) (*models.DeadLetter, error)
+
+	// ReplayDeadLetter removes 1 dead letter and moves its notification back into scheduled status with fresh attempts
+	//
+	// must return errors.ErrDeadLetterNotFound or errors.ErrInvalidStatusTransition if notification isn't failed anymore
+	ReplayDeadLetter(ctx context.Context, id types.UUID) (*models.Notification, error)
+
+	// ReplayDeadLetters is ReplayDeadLetter for every dead letter matching filter, atomically
+	//
+	// returns rescheduled notifications
+	ReplayDeadLetters(ctx context.Context, filter models.DeadLetterFilter) ([]*models.Notification, error)
+
+	// DeleteDeadLetter removes 1 dead letter, its notification stays failed
+	//
+	// must return errors.ErrDeadLetterNotFound if there's no such dead letter
+	DeleteDeadLetter(ctx context.Context, id types.UUID) error
+
+	// PurgeDeadLetters removes every dead letter matching filter, returns amount of them
+	PurgeDeadLetters(ctx context.Context, filter models.DeadLetterFilter) (int64, error)
+}
@@ -0,0 +1,29 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+)
+
+// DeliveryResultReceiver is the port for delivery results reported by workers
+//
+// They are supposed to come from a MQ, such as RabbitMQ
+type DeliveryResultReceiver interface {
+	// StartReceiving begins the consuming and returns readonly channel with parsed objects
+	//
+	// the channel is closed by receiver when ctx is done or consuming stops.
+	// every result carries models.ResultMessage, caller must settle it
+	StartReceiving(ctx context.Context) <-chan *models.DeliveryResult
+
+	// StopReceiving stops the consuming, must be called in the end, after ctx is done
+	StopReceiving() error
+}
+
+// DeliveryResultStorageRepository is the port for saving delivery results next to notifications
+type DeliveryResultStorageRepository interface {
+	// RecordDeliveryResult moves notification into result status and saves attempt info
+	//
+	// failed notifications are dead-lettered, worker has already retried them.
+	// must return errors.ErrInvalidStatusTransition if notification can't be moved into result status
+	RecordDeliveryResult(ctx context.Context, result *models.DeliveryResult) error
+}
@@ -0,0 +1,24 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"time"
+)
+
+// IdempotencyRepository is the port for idempotency keys storage
+type IdempotencyRepository interface {
+	// ClaimKey saves a new key with request hash, it expires after ttl. Expired key may be claimed again
+	//
+	// returns false and the existing record if key is taken. Record may be nil if it's released meanwhile
+	ClaimKey(ctx context.Context, key string, requestHash string, ttl time.Duration) (bool, *models.IdempotencyRecord, error)
+
+	// SaveResponse saves response of a claimed key
+	SaveResponse(ctx context.Context, key string, response *models.IdempotentResponse) error
+
+	// ReleaseKey deletes a claimed key, so that request may be retried
+	ReleaseKey(ctx context.Context, key string) error
+
+	// DeleteExpired deletes expired keys, returns amount of deleted ones
+	DeleteExpired(ctx context.Context) (int64, error)
+}
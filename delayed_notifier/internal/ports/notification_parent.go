@@ -0,0 +1,25 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// NotificationParentRepository is the port for fan-out notifications storage
+type NotificationParentRepository interface {
+	// CreateParent saves a new fan-out notification together with its deliveries, atomically
+	//
+	// uuids are generated by caller
+	CreateParent(ctx context.Context, parent *models.NotificationParent, deliveries []*models.Notification) error
+
+	// GetParent returns fan-out notification with StatusCounts of its deliveries
+	//
+	// must return errors.ErrParentNotFound if there's no such parent
+	GetParent(ctx context.Context, id types.UUID) (*models.NotificationParent, error)
+
+	// CancelParent cancels scheduled deliveries of fan-out notification
+	//
+	// returns ids of cancelled deliveries, errors.ErrParentNotFound
+	CancelParent(ctx context.Context, id types.UUID) ([]*types.UUID, error)
+}
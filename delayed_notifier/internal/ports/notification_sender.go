@@ -2,20 +2,48 @@ package ports
 
 import (
 	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/dlq"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"time"
 )
 
 // NotificationFetcherRepository is the port for fetching a batch-to-send from DB & changing status
 type NotificationFetcherRepository interface {
-	// Fetch fetches objects to be sent (only up to maxPublicationAt not to store everything in memory)=
+	// Fetch claims up to limit earliest objects to be sent (only up to maxPublicationAt not to store everything in memory)
 	//
-	// fetches are supposed to be done regularly
-	Fetch(ctx context.Context, maxPublicationAt types.DateTime) ([]*models.Notification, error)
+	// fetches are supposed to be done regularly. Claimed objects are leased by owner for leaseFor:
+	// other owners don't get them until the lease expires, so every object is fetched by 1 instance.
+	// Leased ones aren't fetched again, so repeated calls return next pages
+	Fetch(ctx context.Context, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration, limit int) ([]*models.Notification, error)
 
-	// MarkAsSent should be used to mark fetched notifications as sent
-	MarkAsSent(ctx context.Context, ids []*types.UUID) error
+	// FetchUpcoming returns up to limit earliest wake-ups of scheduled objects that are due up to until
+	//
+	// nothing is claimed: due objects are fetched with Fetch at their wake-up
+	FetchUpcoming(ctx context.Context, until types.DateTime, limit int) ([]*models.WakeUp, error)
+
+	// Index makes objects fetchable at their wake-ups, it's for fetchers that keep their own index of due objects
+	//
+	// objects must be indexed when they're created or updated, FetchUpcoming indexes the returned ones too
+	Index(ctx context.Context, wakeUps []*models.WakeUp) error
+
+	// Claim leases 1 scheduled object by owner for leaseFor, e.g. before QuickSend
+	//
+	// returns false if it's not scheduled, leased by another owner or waits for next publish attempt
+	Claim(ctx context.Context, id types.UUID, owner string, leaseFor time.Duration) (bool, error)
+
+	// ReturnToPending releases leases of owner's failed publishes, they're fetched again after backoff
+	//
+	// their publish attempts are counted, returns amount of returned ones.
+	// The ones that reach backoff.MaxAttempts are moved into failed status and dead-lettered instead
+	ReturnToPending(ctx context.Context, failures []*models.PublishFailure, owner string, backoff models.PublishBackoff) (int64, error)
+
+	// ChangeStatus moves given notifications into status, e.g. fetched ones into internaltypes.StatusQueued
+	//
+	// only notifications whose current status may be moved into it are changed, returns amount of them.
+	// Their leases are released
+	ChangeStatus(ctx context.Context, ids []*types.UUID, status internaltypes.NotificationStatus) (int64, error)
 }
 
 // NotificationPublisherRepository is the port for notification sender
@@ -28,3 +56,29 @@ type NotificationPublisherRepository interface {
 	// SendMany sends batch of notifications at a time, create notifications lists and use it
 	SendMany(ctx context.Context, notifications []*models.Notification) *dlq.DLQ[*models.Notification]
 }
+
+// NotificationClaimRepository is the port of the source of truth for fetchers that keep their own index of due objects
+type NotificationClaimRepository interface {
+	NotificationFetcherRepository
+
+	// ClaimMany leases given objects like Fetch does, only those that are really due up to maxPublicationAt: index may be stale
+	//
+	// returns claimed ones ordered by publication_at
+	ClaimMany(ctx context.Context, ids []*types.UUID, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration) ([]*models.Notification, error)
+
+	// WakeUpsOf returns wake-ups of given objects that are still scheduled, to fix a stale index
+	WakeUpsOf(ctx context.Context, ids []*types.UUID) ([]*models.WakeUp, error)
+}
+
+// NotificationWakeUpListener is the port for wake-ups of objects created or updated by any replica
+//
+// They are supposed to come from DB notifications, such as postgres LISTEN/NOTIFY
+type NotificationWakeUpListener interface {
+	// StartListening begins the listening and returns readonly channel with wake-ups
+	//
+	// wake-up without ID means that the near-term window must be reloaded (many objects are changed or notices are lost)
+	StartListening() <-chan *models.WakeUp
+
+	// StopListening stops the listening, must be called in the end
+	StopListening() error
+}
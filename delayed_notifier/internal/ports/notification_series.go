@@ -0,0 +1,35 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// NotificationSeriesRepository is the port for recurring notifications storage
+type NotificationSeriesRepository interface {
+	// CreateSeries saves a new series together with its first occurrence, atomically
+	//
+	// uuids are generated by caller
+	CreateSeries(ctx context.Context, series *models.NotificationSeries, first *models.Notification) error
+
+	// GetSeries returns series with its latest occurrence
+	//
+	// must return errors.ErrSeriesNotFound if there's no such series
+	GetSeries(ctx context.Context, id types.UUID) (*models.NotificationSeries, error)
+
+	// StopSeries marks series as stopped and cancels its scheduled occurrences
+	//
+	// returns ids of cancelled occurrences, errors.ErrSeriesNotFound or errors.ErrSeriesStopped
+	StopSeries(ctx context.Context, id types.UUID) ([]*types.UUID, error)
+
+	// CreateOccurrence saves next occurrence of a series
+	//
+	// returns false if series is stopped or this occurrence already exists
+	CreateOccurrence(ctx context.Context, occurrence *models.Notification) (bool, error)
+
+	// FetchStalledSeries returns up to limit latest occurrences of active series that have no scheduled occurrence
+	//
+	// series that are over by their count or until aren't returned
+	FetchStalledSeries(ctx context.Context, limit int) ([]*models.Notification, error)
+}
@@ -0,0 +1,33 @@
+package ports
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+)
+
+// TemplateStorageRepository is the CRUD Port for message templates 'DB'
+type TemplateStorageRepository interface {
+	// CreateTemplate is the Create method of this DB CRUD
+	//
+	// uuid is generated by caller, must return errors.ErrTemplateNameTaken if name isn't unique
+	CreateTemplate(ctx context.Context, template *models.Template) error
+
+	// UpdateTemplate replaces name, title and message of existing template
+	//
+	// must return errors.ErrTemplateNotFound or errors.ErrTemplateNameTaken
+	UpdateTemplate(ctx context.Context, template *models.Template) error
+
+	// GetTemplate is the Read method of this DB CRUD
+	//
+	// must return errors.ErrTemplateNotFound if there's no such template
+	GetTemplate(ctx context.Context, id types.UUID) (*models.Template, error)
+
+	// ListTemplates returns all templates ordered by name
+	ListTemplates(ctx context.Context) ([]*models.Template, error)
+
+	// DeleteTemplate is the Delete method of this DB CRUD
+	//
+	// must return errors.ErrTemplateNotFound or errors.ErrTemplateInUse
+	DeleteTemplate(ctx context.Context, id types.UUID) error
+}
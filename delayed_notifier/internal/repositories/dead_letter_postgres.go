@@ -0,0 +1,293 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// deadLetterColumns is the column list read by scanDeadLetter
+const deadLetterColumns = `id, notification_id, channel, source, error, attempts, payload, failed_at`
+
+// deadLettersInsertCTE returns the "dead_letters AS (INSERT ...)" CTE that dead-letters failed rows of CTE rows
+//
+// rows must return whole notification rows, their errorColumn and attemptsColumn are saved next to them
+func deadLettersInsertCTE(rows, source, errorColumn, attemptsColumn string) string {
+	return fmt.Sprintf(`dead_lettered AS (
+		INSERT INTO delayed_notifier.delayed_notifier.dead_letters (notification_id, channel, source, error, attempts, payload)
+		SELECT id, channel, '%[2]s', COALESCE(%[3]s, ''), %[4]s, to_jsonb(%[1]s) FROM %[1]s WHERE status = '%[5]s'
+	)`, rows, source, errorColumn, attemptsColumn, internaltypes.FAILED)
+}
+
+// deadLetterConditions returns WHERE conditions of filter, placeholders start after existing args
+func deadLetterConditions(filter models.DeadLetterFilter, args []any) ([]string, []any) {
+	conditions := make([]string, 0, 5)
+
+	// addArg appends arg and returns its placeholder, e.g. "$3"
+	addArg := func(arg any) string {
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.Channel != nil {
+		conditions = append(conditions, "channel = "+addArg(filter.Channel.String()))
+	}
+	if filter.Source != nil {
+		conditions = append(conditions, "source = "+addArg(*filter.Source))
+	}
+	if filter.NotificationID != nil {
+		conditions = append(conditions, "notification_id = "+addArg(filter.NotificationID.String()))
+	}
+	if filter.FailedAtFrom != nil {
+		conditions = append(conditions, "failed_at >= "+addArg(filter.FailedAtFrom.Value()))
+	}
+	if filter.FailedAtTo != nil {
+		conditions = append(conditions, "failed_at <= "+addArg(filter.FailedAtTo.Value()))
+	}
+
+	return conditions, args
+}
+
+// whereClause joins conditions into "WHERE ...", empty if there's none
+func whereClause(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(conditions, " AND ")
+}
+
+// ListDeadLetters returns up to limit dead letters matching filter, ordered by (failed_at, id)
+//
+// cursor = nil means "from the start", otherwise keyset pagination is used: (failed_at, id) > cursor
+func (r *NotificationPostgres) ListDeadLetters(ctx context.Context, filter models.DeadLetterFilter, cursor *models.DeadLetterCursor, limit int) ([]*models.DeadLetter, error) {
+	conditions, args := deadLetterConditions(filter, make([]any, 0, 8))
+	if cursor != nil {
+		args = append(args, cursor.FailedAt.Value(), cursor.ID.String())
+		conditions = append(conditions, fmt.Sprintf("(failed_at, id) > ($%d, $%d)", len(args)-1, len(args)))
+	}
+	args = append(args, limit)
+
+	query := fmt.Sprintf(`SELECT %s FROM delayed_notifier.delayed_notifier.dead_letters %s ORDER BY failed_at, id LIMIT $%d`,
+		deadLetterColumns, whereClause(conditions), len(args))
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error listing dead letters in postgres: %w", err)
+	}
+
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when listing dead letters")
+		}
+	}(rows)
+
+	deadLetters := make([]*models.DeadLetter, 0, limit)
+	for rows.Next() {
+		var deadLetter *models.DeadLetter
+		deadLetter, err = scanDeadLetter(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row in dead letters list: %w", err)
+		}
+		deadLetters = append(deadLetters, deadLetter)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows in dead letters list: %w", err)
+	}
+
+	return deadLetters, nil
+}
+
+// GetDeadLetter retrieves a dead letter by ID, err on not found
+func (r *NotificationPostgres) GetDeadLetter(ctx context.Context, id types.UUID) (*models.DeadLetter, error) {
+	query := `SELECT ` + deadLetterColumns + ` FROM delayed_notifier.delayed_notifier.dead_letters WHERE id = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select dead letter by id in postgres: %w", err)
+	}
+
+	var deadLetter *models.DeadLetter
+	deadLetter, err = scanDeadLetter(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrDeadLetterNotFound
+		}
+		return nil, err
+	}
+
+	return deadLetter, nil
+}
+
+// ReplayDeadLetter removes 1 dead letter and reschedules its notification, see replay
+//
+// err ErrDeadLetterNotFound or ErrInvalidStatusTransition if notification isn't failed anymore (dead letter stays then)
+func (r *NotificationPostgres) ReplayDeadLetter(ctx context.Context, id types.UUID) (*models.Notification, error) {
+	replayed, err := r.replay(ctx, []string{"id = $1"}, []any{id.String()})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(replayed) == 0 {
+		// either there's no such dead letter or its notification isn't failed
+		if _, err = r.GetDeadLetter(ctx, id); err != nil {
+			return nil, err
+		}
+		return nil, internalerrors.ErrInvalidStatusTransition
+	}
+	return replayed[0], nil
+}
+
+// ReplayDeadLetters removes dead letters matching filter and reschedules their notifications, see replay
+func (r *NotificationPostgres) ReplayDeadLetters(ctx context.Context, filter models.DeadLetterFilter) ([]*models.Notification, error) {
+	conditions, args := deadLetterConditions(filter, make([]any, 0, 7))
+	return r.replay(ctx, conditions, args)
+}
+
+// replay removes dead letters matching conditions and moves their failed notifications into scheduled status in 1 statement
+//
+// publish attempts start over, publication_at in the past becomes now() so that replayed ones aren't expired right away.
+// Dead letters of notifications that aren't failed anymore are kept
+func (r *NotificationPostgres) replay(ctx context.Context, conditions []string, args []any) ([]*models.Notification, error) {
+	args = append(args, internaltypes.SCHEDULED, internaltypes.FAILED)
+	scheduledNum, failedNum := len(args)-1, len(args)
+
+	query := fmt.Sprintf(`WITH rescheduled AS (
+		UPDATE delayed_notifier.delayed_notifier.notifications
+		SET status = $%[3]d, publication_at = GREATEST(publication_at, now()), publish_attempts = 0, publish_error = NULL,
+			next_attempt_at = NULL, lease_owner = NULL, lease_expires_at = NULL, updated_at = now()
+		WHERE status = $%[4]d AND id IN (SELECT notification_id FROM delayed_notifier.delayed_notifier.dead_letters %[2]s)
+		RETURNING %[1]s
+	), replayed AS (
+		DELETE FROM delayed_notifier.delayed_notifier.dead_letters
+		WHERE notification_id IN (SELECT id FROM rescheduled) %[5]s
+	)
+	SELECT %[1]s FROM rescheduled ORDER BY publication_at`,
+		notificationColumns, whereClause(conditions), scheduledNum, failedNum, andConditions(conditions))
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("error replaying dead letters in postgres: %w", err)
+	}
+
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when replaying dead letters")
+		}
+	}(rows)
+
+	replayed := make([]*models.Notification, 0)
+	for rows.Next() {
+		var notification *models.Notification
+		notification, err = scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning replayed notification: %w", err)
+		}
+		replayed = append(replayed, notification)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating replayed notifications: %w", err)
+	}
+
+	r.notifyWakeUps(ctx, replayed...)
+	return replayed, nil
+}
+
+// andConditions joins conditions into "AND ...", empty if there's none
+func andConditions(conditions []string) string {
+	if len(conditions) == 0 {
+		return ""
+	}
+	return "AND " + strings.Join(conditions, " AND ")
+}
+
+// DeleteDeadLetter deletes a dead letter by ID, err on not found
+func (r *NotificationPostgres) DeleteDeadLetter(ctx context.Context, id types.UUID) error {
+	query := `DELETE FROM delayed_notifier.delayed_notifier.dead_letters WHERE id = $1`
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return err
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return internalerrors.ErrDeadLetterNotFound
+	}
+	return nil
+}
+
+// PurgeDeadLetters deletes dead letters matching filter, returns amount of them
+func (r *NotificationPostgres) PurgeDeadLetters(ctx context.Context, filter models.DeadLetterFilter) (int64, error) {
+	conditions, args := deadLetterConditions(filter, make([]any, 0, 5))
+
+	query := `DELETE FROM delayed_notifier.delayed_notifier.dead_letters ` + whereClause(conditions)
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("error purging dead letters in postgres: %w", err)
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	return rowsAffected, nil
+}
+
+// scanDeadLetter reads 1 row of deadLetterColumns into a model
+func scanDeadLetter(row rowScanner) (*models.DeadLetter, error) {
+	var idString, notificationIDString string
+	var channel string
+	var source string
+	var errorText string
+	var attempts int
+	var payload []byte
+	var failedAt time.Time
+
+	if err := row.Scan(&idString, &notificationIDString, &channel, &source, &errorText, &attempts, &payload, &failedAt); err != nil {
+		return nil, err
+	}
+
+	id, err := types.NewUUID(idString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uuid in postgres: %w", err)
+	}
+
+	var notificationID types.UUID
+	notificationID, err = types.NewUUID(notificationIDString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification uuid in postgres: %w", err)
+	}
+
+	var channelValid internaltypes.NotificationChannel
+	channelValid, err = internaltypes.NotificationChannelFromString(channel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel in postgres: %w", err)
+	}
+
+	return &models.DeadLetter{
+		ID:             id,
+		NotificationID: notificationID,
+		Channel:        channelValid,
+		Source:         source,
+		Error:          types.NewAnyText(errorText),
+		Attempts:       attempts,
+		Payload:        payload,
+		FailedAt:       types.NewDateTime(failedAt),
+	}, nil
+}
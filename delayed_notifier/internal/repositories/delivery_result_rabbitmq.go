@@ -0,0 +1,143 @@
+package repositories
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wb-go/wbf/rabbitmq"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// DeliveryResultRabbitMQ is the RabbitMQ implementation of ports.DeliveryResultReceiver
+//
+// a message is settled by the one who records its result (see models.ResultMessage),
+// so results that weren't recorded before shutdown are delivered again
+type DeliveryResultRabbitMQ struct {
+	consumerConfig *rabbitmq.ConsumerConfig
+	channel        *rabbitmq.Channel
+	retryStrategy  retry.Strategy
+
+	// closed by the consuming goroutine only, when deliveries are closed or ctx is done
+	objectsChan chan *models.DeliveryResult
+}
+
+// NewDeliveryResultRabbitMQ creates a new DeliveryResultRabbitMQ for given consumer config and its channel
+func NewDeliveryResultRabbitMQ(consumerConfig *rabbitmq.ConsumerConfig, channel *rabbitmq.Channel, retryStrategy retry.Strategy) *DeliveryResultRabbitMQ {
+	return &DeliveryResultRabbitMQ{
+		consumerConfig: consumerConfig,
+		channel:        channel,
+		retryStrategy:  retryStrategy,
+		objectsChan:    make(chan *models.DeliveryResult),
+	}
+}
+
+// StartReceiving starts the consuming, in background, until ctx is done
+//
+// Must be called
+func (r *DeliveryResultRabbitMQ) StartReceiving(ctx context.Context) <-chan *models.DeliveryResult {
+	go func() {
+		defer close(r.objectsChan)
+
+		var deliveries <-chan amqp091.Delivery
+		err := retry.Do(func() error {
+			var errConsume error
+			deliveries, errConsume = r.channel.Consume(
+				r.consumerConfig.Queue,
+				r.consumerConfig.Consumer,
+				false, // acked after the result is recorded
+				r.consumerConfig.Exclusive,
+				r.consumerConfig.NoLocal,
+				r.consumerConfig.NoWait,
+				r.consumerConfig.Args,
+			)
+			return errConsume
+		}, r.retryStrategy)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Str("queue", r.consumerConfig.Queue).Msg("error occurred while consuming delivery results")
+			return
+		}
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case delivery, ok := <-deliveries:
+				// deliveries are closed with channel
+				if !ok {
+					return
+				}
+
+				object, errProcess := r.processMessage(delivery.Body)
+				if errProcess != nil {
+					// a result that can't be read will never be read
+					zlog.Logger.Info().Err(errProcess).Msg("error while processing delivery result")
+					resultDelivery{delivery: delivery}.Ack()
+					continue
+				}
+				object.Message = resultDelivery{delivery: delivery}
+
+				select {
+				case r.objectsChan <- object:
+				case <-ctx.Done():
+					// left unacked, broker delivers it again
+					return
+				}
+			}
+		}
+	}()
+
+	return r.objectsChan
+}
+
+// StopReceiving closes the channel, unacked results are delivered again by broker
+//
+// Must be called
+func (r *DeliveryResultRabbitMQ) StopReceiving() error {
+	err := r.channel.Close()
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("error closing rabbitmq result channel")
+	}
+
+	return err
+}
+
+// resultDelivery is the models.ResultMessage of 1 delivery
+type resultDelivery struct {
+	delivery amqp091.Delivery
+}
+
+// Ack acknowledges the delivery, logs on error
+func (d resultDelivery) Ack() {
+	if err := d.delivery.Ack(false); err != nil {
+		zlog.Logger.Error().Err(err).Msg("error acking delivery result")
+	}
+}
+
+// Requeue nacks the delivery with requeue, logs on error
+//
+// if channel is already closed, broker requeues it anyway
+func (d resultDelivery) Requeue() {
+	if err := d.delivery.Nack(false, true); err != nil {
+		zlog.Logger.Error().Err(err).Msg("error requeueing delivery result")
+	}
+}
+
+// processMessage converts 1 message from RabbitMQ into DeliveryResult model
+func (r *DeliveryResultRabbitMQ) processMessage(delivery []byte) (*models.DeliveryResult, error) {
+	var messageData dto.DeliveryResultBody
+
+	if err := json.Unmarshal(delivery, &messageData); err != nil {
+		return nil, fmt.Errorf("bad delivery result (bad json): %w", err)
+	}
+
+	result, err := messageData.ToEntity()
+	if err != nil {
+		return nil, fmt.Errorf("bad delivery result (couldn't convert to model): %w", err)
+	}
+
+	return result, nil
+}
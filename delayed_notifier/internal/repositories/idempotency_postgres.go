@@ -0,0 +1,115 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/wb-go/wbf/dbpg"
+	"github.com/wb-go/wbf/retry"
+	"time"
+)
+
+// IdempotencyPostgres implements ports.IdempotencyRepository
+//
+// Postgres implementation with dbpg.DB
+type IdempotencyPostgres struct {
+	db       *dbpg.DB
+	strategy retry.Strategy
+}
+
+// NewIdempotencyPostgres creates a new IdempotencyPostgres
+func NewIdempotencyPostgres(db *dbpg.DB, retryStrategy retry.Strategy) *IdempotencyPostgres {
+	return &IdempotencyPostgres{db: db, strategy: retryStrategy}
+}
+
+// ClaimKey inserts a new key, or takes an expired one over
+//
+// returns false and the existing record if key is taken, record is nil if it's released meanwhile
+func (r *IdempotencyPostgres) ClaimKey(ctx context.Context, key string, requestHash string, ttl time.Duration) (bool, *models.IdempotencyRecord, error) {
+	query := `
+        INSERT INTO delayed_notifier.delayed_notifier.idempotency_keys (key, request_hash, expires_at)
+        VALUES ($1, $2, $3)
+        ON CONFLICT (key) DO UPDATE
+        SET request_hash = EXCLUDED.request_hash, status_code = NULL, response = NULL, created_at = now(), expires_at = EXCLUDED.expires_at
+        WHERE idempotency_keys.expires_at <= now()`
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, key, requestHash, time.Now().Add(ttl))
+	if err != nil {
+		return false, nil, fmt.Errorf("error claiming idempotency key: %w", err)
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return false, nil, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+	if rowsAffected > 0 {
+		return true, nil, nil
+	}
+
+	// taken: read it
+	selectQuery := `SELECT request_hash, status_code, response FROM delayed_notifier.delayed_notifier.idempotency_keys WHERE key = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, selectQuery, key)
+	if err != nil {
+		return false, nil, fmt.Errorf("error select idempotency key in postgres: %w", err)
+	}
+
+	var hash string
+	var statusCode sql.NullInt64
+	var response []byte
+
+	if err = row.Scan(&hash, &statusCode, &response); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false, nil, nil
+		}
+		return false, nil, err
+	}
+
+	record := &models.IdempotencyRecord{Key: key, RequestHash: hash}
+	if statusCode.Valid {
+		record.Response = &models.IdempotentResponse{StatusCode: int(statusCode.Int64), Body: response}
+	}
+	return false, record, nil
+}
+
+// SaveResponse saves response of a claimed key
+func (r *IdempotencyPostgres) SaveResponse(ctx context.Context, key string, response *models.IdempotentResponse) error {
+	query := `UPDATE delayed_notifier.delayed_notifier.idempotency_keys SET status_code = $1, response = $2 WHERE key = $3`
+
+	_, err := r.db.ExecWithRetry(ctx, r.strategy, query, response.StatusCode, response.Body, key)
+	if err != nil {
+		return fmt.Errorf("error saving idempotent response: %w", err)
+	}
+	return nil
+}
+
+// ReleaseKey deletes a key that has no response yet
+func (r *IdempotencyPostgres) ReleaseKey(ctx context.Context, key string) error {
+	query := `DELETE FROM delayed_notifier.delayed_notifier.idempotency_keys WHERE key = $1 AND status_code IS NULL`
+
+	_, err := r.db.ExecWithRetry(ctx, r.strategy, query, key)
+	if err != nil {
+		return fmt.Errorf("error releasing idempotency key: %w", err)
+	}
+	return nil
+}
+
+// DeleteExpired deletes expired keys, returns amount of deleted ones
+func (r *IdempotencyPostgres) DeleteExpired(ctx context.Context) (int64, error) {
+	query := `DELETE FROM delayed_notifier.delayed_notifier.idempotency_keys WHERE expires_at <= now()`
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query)
+	if err != nil {
+		return 0, fmt.Errorf("error deleting expired idempotency keys: %w", err)
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+	return rowsAffected, nil
+}
@@ -0,0 +1,282 @@
+package repositories
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	goredis "github.com/go-redis/redis/v8"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// reconcileChunkSize is the amount of indexed ids checked in the source of truth at a time
+const reconcileChunkSize = 1000
+
+// claimDueScript moves up to limit due ids from pending into leased in 1 step, so every id is claimed by 1 instance
+//
+// ids whose lease has expired (instance died before marking them) are due again
+//
+//	KEYS: pending, leased
+//	ARGV: max score, now, lease expiration, limit (scores are unix milliseconds)
+var claimDueScript = goredis.NewScript(`
+local expired = redis.call('ZRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+for _, id in ipairs(expired) do
+	redis.call('ZADD', KEYS[1], ARGV[2], id)
+end
+redis.call('ZREMRANGEBYSCORE', KEYS[2], '-inf', ARGV[2])
+
+local due = redis.call('ZRANGEBYSCORE', KEYS[1], '-inf', ARGV[1], 'LIMIT', 0, ARGV[4])
+for _, id in ipairs(due) do
+	redis.call('ZREM', KEYS[1], id)
+	redis.call('ZADD', KEYS[2], ARGV[3], id)
+end
+return due
+`)
+
+// indexScript adds ids into pending with given scores, leased ones are skipped: they're being published
+//
+//	KEYS: pending, leased
+//	ARGV: score, id, score, id, ...
+var indexScript = goredis.NewScript(`
+local indexed = 0
+for i = 1, #ARGV, 2 do
+	if not redis.call('ZSCORE', KEYS[2], ARGV[i + 1]) then
+		redis.call('ZADD', KEYS[1], ARGV[i], ARGV[i + 1])
+		indexed = indexed + 1
+	end
+end
+return indexed
+`)
+
+// NotificationFetcherRedis implements ports.NotificationFetcherRepository with redis sorted sets
+//
+// ids of due notifications are indexed in "<prefix>:pending" by wake-up, claimed ones are moved into "<prefix>:leased"
+// by lease expiration with a Lua script. Notifications themselves are claimed in the source of truth (postgres),
+// ids that turn out to be stale are reindexed from it
+type NotificationFetcherRedis struct {
+	redisClient *redis.Client
+	strategy    retry.Strategy
+	source      ports.NotificationClaimRepository
+
+	pendingKey string
+	leasedKey  string
+}
+
+// NewNotificationFetcherRedis creates a new NotificationFetcherRedis, keys are prefixed with keyPrefix
+//
+// the index is empty or stale at first, call Reconcile on startup
+func NewNotificationFetcherRedis(redisClient *redis.Client, retryStrategy retry.Strategy, source ports.NotificationClaimRepository, keyPrefix string) *NotificationFetcherRedis {
+	return &NotificationFetcherRedis{
+		redisClient: redisClient,
+		strategy:    retryStrategy,
+		source:      source,
+		pendingKey:  keyPrefix + ":pending",
+		leasedKey:   keyPrefix + ":leased",
+	}
+}
+
+// Fetch claims up to limit earliest indexed ids that are due up to maxPublicationAt, then claims them in source
+//
+// ids that source doesn't claim (cancelled, moved, leased by QuickSend of another instance) are reindexed
+func (r *NotificationFetcherRedis) Fetch(ctx context.Context, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration, limit int) ([]*models.Notification, error) {
+	now := time.Now()
+
+	// not retried: a lost reply leaves ids leased, they're due again after lease expires
+	members, err := claimDueScript.Run(ctx, r.redisClient, []string{r.pendingKey, r.leasedKey},
+		maxPublicationAt.Value().UnixMilli(), now.UnixMilli(), now.Add(leaseFor).UnixMilli(), limit).StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("error claiming due ids in redis up to datetime '%s': %w", maxPublicationAt.String(), err)
+	}
+
+	ids := r.parseIDs(ctx, members)
+	claimed, err := r.source.ClaimMany(ctx, ids, maxPublicationAt, owner, leaseFor)
+	if err != nil {
+		return nil, fmt.Errorf("error claiming %d indexed notifications: %w", len(ids), err)
+	}
+
+	if len(claimed) < len(ids) {
+		if err = r.reindex(ctx, notClaimed(ids, claimed)); err != nil {
+			zlog.Logger.Warn().Err(err).Msg("couldn't reindex not claimed notifications, they're due again after lease")
+		}
+	}
+	return claimed, nil
+}
+
+// FetchUpcoming returns wake-ups from source and indexes them
+func (r *NotificationFetcherRedis) FetchUpcoming(ctx context.Context, until types.DateTime, limit int) ([]*models.WakeUp, error) {
+	wakeUps, err := r.source.FetchUpcoming(ctx, until, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = r.Index(ctx, wakeUps); err != nil {
+		return nil, err
+	}
+	return wakeUps, nil
+}
+
+// Index adds ids into pending by their wake-ups, those that are being published are skipped
+func (r *NotificationFetcherRedis) Index(ctx context.Context, wakeUps []*models.WakeUp) error {
+	if len(wakeUps) == 0 {
+		return nil
+	}
+
+	args := make([]any, 0, 2*len(wakeUps))
+	for _, wakeUp := range wakeUps {
+		args = append(args, score(wakeUp.At), wakeUp.ID.String())
+	}
+
+	err := retry.Do(func() error {
+		return indexScript.Run(ctx, r.redisClient, []string{r.pendingKey, r.leasedKey}, args...).Err()
+	}, r.strategy)
+	if err != nil {
+		return fmt.Errorf("error indexing %d wake-ups in redis: %w", len(wakeUps), err)
+	}
+	return nil
+}
+
+// Claim leases 1 object in source, index isn't touched: source doesn't let Fetch claim it twice
+func (r *NotificationFetcherRedis) Claim(ctx context.Context, id types.UUID, owner string, leaseFor time.Duration) (bool, error) {
+	return r.source.Claim(ctx, id, owner, leaseFor)
+}
+
+// ReturnToPending returns failed publishes in source, then reindexes them by their next attempt
+func (r *NotificationFetcherRedis) ReturnToPending(ctx context.Context, failures []*models.PublishFailure, owner string, backoff models.PublishBackoff) (int64, error) {
+	returned, err := r.source.ReturnToPending(ctx, failures, owner, backoff)
+	if err != nil {
+		return returned, err
+	}
+
+	ids := make([]*types.UUID, len(failures))
+	for i, failure := range failures {
+		ids[i] = failure.ID
+	}
+	if err = r.reindex(ctx, ids); err != nil {
+		zlog.Logger.Warn().Err(err).Msg("couldn't reindex returned notifications, they're due again after lease")
+	}
+	return returned, nil
+}
+
+// ChangeStatus changes status in source and removes ids from index, they aren't due anymore
+func (r *NotificationFetcherRedis) ChangeStatus(ctx context.Context, ids []*types.UUID, status internaltypes.NotificationStatus) (int64, error) {
+	changed, err := r.source.ChangeStatus(ctx, ids, status)
+	if err != nil {
+		return changed, err
+	}
+
+	if err = r.remove(ctx, ids); err != nil {
+		// stale ids aren't claimed by source, they're dropped on next claim
+		zlog.Logger.Warn().Err(err).Msg("couldn't remove notifications from redis index")
+	}
+	return changed, nil
+}
+
+// Reconcile fixes the index with the source of truth: indexed ids get their actual wake-ups or are removed,
+// wake-ups up to until are indexed. Supposed to be called on startup
+func (r *NotificationFetcherRedis) Reconcile(ctx context.Context, until types.DateTime, limit int) error {
+	for _, key := range []string{r.pendingKey, r.leasedKey} {
+		var members []string
+		err := retry.Do(func() error {
+			var errRange error
+			members, errRange = r.redisClient.ZRange(ctx, key, 0, -1).Result()
+			return errRange
+		}, r.strategy)
+		if err != nil {
+			return fmt.Errorf("error reading redis index '%s': %w", key, err)
+		}
+
+		ids := r.parseIDs(ctx, members)
+		for start := 0; start < len(ids); start += reconcileChunkSize {
+			if err = r.reindex(ctx, ids[start:min(start+reconcileChunkSize, len(ids))]); err != nil {
+				return err
+			}
+		}
+		zlog.Logger.Info().Str("key", key).Int("amount", len(ids)).Msg("reconciled redis index")
+	}
+
+	_, err := r.FetchUpcoming(ctx, until, limit)
+	return err
+}
+
+// reindex sets ids' wake-ups from source, ids that aren't scheduled anymore are removed
+func (r *NotificationFetcherRedis) reindex(ctx context.Context, ids []*types.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	wakeUps, err := r.source.WakeUpsOf(ctx, ids)
+	if err != nil {
+		return err
+	}
+	if err = r.remove(ctx, ids); err != nil {
+		return err
+	}
+	return r.Index(ctx, wakeUps)
+}
+
+// remove deletes ids from both pending and leased
+func (r *NotificationFetcherRedis) remove(ctx context.Context, ids []*types.UUID) error {
+	if len(ids) == 0 {
+		return nil
+	}
+
+	members := make([]any, len(ids))
+	for i, id := range ids {
+		members[i] = id.String()
+	}
+
+	err := retry.Do(func() error {
+		_, errPipe := r.redisClient.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.ZRem(ctx, r.pendingKey, members...)
+			pipe.ZRem(ctx, r.leasedKey, members...)
+			return nil
+		})
+		return errPipe
+	}, r.strategy)
+	if err != nil {
+		return fmt.Errorf("error removing %d ids from redis index: %w", len(ids), err)
+	}
+	return nil
+}
+
+// parseIDs converts members into ids, invalid ones are removed from index
+func (r *NotificationFetcherRedis) parseIDs(ctx context.Context, members []string) []*types.UUID {
+	ids := make([]*types.UUID, 0, len(members))
+	for _, member := range members {
+		id, err := types.NewUUID(member)
+		if err != nil {
+			zlog.Logger.Error().Err(err).Str("member", member).Msg("invalid id in redis index, removing")
+			r.redisClient.ZRem(ctx, r.pendingKey, member)
+			r.redisClient.ZRem(ctx, r.leasedKey, member)
+			continue
+		}
+		ids = append(ids, &id)
+	}
+	return ids
+}
+
+// notClaimed returns ids that aren't in claimed
+func notClaimed(ids []*types.UUID, claimed []*models.Notification) []*types.UUID {
+	claimedIDs := make(map[types.UUID]struct{}, len(claimed))
+	for _, notification := range claimed {
+		claimedIDs[*notification.ID] = struct{}{}
+	}
+
+	result := make([]*types.UUID, 0, len(ids)-len(claimed))
+	for _, id := range ids {
+		if _, found := claimedIDs[*id]; !found {
+			result = append(result, id)
+		}
+	}
+	return result
+}
+
+// score is the sorted set score of wake-up: unix milliseconds, rounded up so it's never claimed too early
+func score(at time.Time) int64 {
+	return at.Add(time.Millisecond - time.Nanosecond).UnixMilli()
+}
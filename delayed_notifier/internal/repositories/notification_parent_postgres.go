@@ -0,0 +1,195 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// CreateParent saves a new fan-out notification together with its deliveries in 1 transaction
+//
+// deliveries are inserted with COPY, uuids are generated by caller
+func (r *NotificationPostgres) CreateParent(ctx context.Context, parent *models.NotificationParent, deliveries []*models.Notification) error {
+	parentQuery := `
+        INSERT INTO delayed_notifier.delayed_notifier.notification_parents (id, publication_at, title, message, template_id, template_vars, publication_tz)
+        VALUES ($1, $2, $3, $4, $5, $6, $7)`
+
+	var templateID, templateVars any
+	if parent.Template != nil {
+		templateID = parent.Template.ID.String()
+
+		variables, err := json.Marshal(parent.Template.Variables)
+		if err != nil {
+			return fmt.Errorf("couldn't marshal template variables: %w", err)
+		}
+		templateVars = string(variables)
+	}
+
+	return r.inTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, parentQuery, parent.ID.String(), parent.PublicationAt.Value(),
+			parent.Content.Title.String(), parent.Content.Message.String(), templateID, templateVars, parent.PublicationAt.Zone())
+		if err != nil {
+			return fmt.Errorf("error inserting fan-out notification: %w", err)
+		}
+
+		if err = copyNotifications(ctx, tx, deliveries); err != nil {
+			return err
+		}
+		return r.notifyWakeUpsInTx(ctx, tx, deliveries...)
+	})
+}
+
+// GetParent returns fan-out notification with StatusCounts of its deliveries, err ErrParentNotFound on not found
+func (r *NotificationPostgres) GetParent(ctx context.Context, id types.UUID) (*models.NotificationParent, error) {
+	query := `SELECT publication_at, title, message, template_id, template_vars, publication_tz FROM delayed_notifier.delayed_notifier.notification_parents WHERE id = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select fan-out notification by id in postgres: %w", err)
+	}
+
+	var publicationAt time.Time
+	var title, message string
+	var templateIDString sql.NullString
+	var templateVars []byte
+	var publicationTZ string
+
+	if err = row.Scan(&publicationAt, &title, &message, &templateIDString, &templateVars, &publicationTZ); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrParentNotFound
+		}
+		return nil, err
+	}
+
+	var publicationAtValid types.DateTime
+	publicationAtValid, err = types.NewDateTimeInZone(publicationAt, publicationTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid publication_tz in postgres: %w", err)
+	}
+
+	parent := &models.NotificationParent{
+		ID:            &id,
+		PublicationAt: publicationAtValid,
+		Content: models.NotificationContent{
+			Title:   types.AnyText(title),
+			Message: types.AnyText(message),
+		},
+		StatusCounts: make(map[internaltypes.NotificationStatus]int),
+	}
+
+	if templateIDString.Valid {
+		var templateID types.UUID
+		templateID, err = types.NewUUID(templateIDString.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template uuid in postgres: %w", err)
+		}
+
+		parent.Template = &models.NotificationTemplate{ID: templateID}
+		if len(templateVars) > 0 {
+			if err = json.Unmarshal(templateVars, &parent.Template.Variables); err != nil {
+				return nil, fmt.Errorf("invalid template variables in postgres: %w", err)
+			}
+		}
+	}
+
+	// aggregate
+	countsQuery := `SELECT status, count(*) FROM delayed_notifier.delayed_notifier.notifications WHERE parent_id = $1 GROUP BY status`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, countsQuery, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error counting deliveries in postgres: %w", err)
+	}
+
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when counting deliveries")
+		}
+	}(rows)
+
+	for rows.Next() {
+		var status string
+		var count int
+		if err = rows.Scan(&status, &count); err != nil {
+			return nil, fmt.Errorf("error scanning deliveries count: %w", err)
+		}
+
+		var statusValid internaltypes.NotificationStatus
+		statusValid, err = internaltypes.NotificationStatusFromString(status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid status in postgres: %w", err)
+		}
+		parent.StatusCounts[statusValid] = count
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating deliveries counts: %w", err)
+	}
+
+	return parent, nil
+}
+
+// CancelParent cancels scheduled deliveries of fan-out notification
+//
+// returns ids of cancelled deliveries, err ErrParentNotFound
+func (r *NotificationPostgres) CancelParent(ctx context.Context, id types.UUID) ([]*types.UUID, error) {
+	existsQuery := `SELECT 1 FROM delayed_notifier.delayed_notifier.notification_parents WHERE id = $1`
+
+	cancelQuery := `
+        UPDATE delayed_notifier.delayed_notifier.notifications
+        SET status = $1, updated_at = now()
+        WHERE parent_id = $2 AND status = $3
+        RETURNING id`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, existsQuery, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select fan-out notification by id in postgres: %w", err)
+	}
+
+	var exists int
+	if err = row.Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrParentNotFound
+		}
+		return nil, err
+	}
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, cancelQuery, internaltypes.CANCELLED, id.String(), internaltypes.SCHEDULED)
+	if err != nil {
+		return nil, fmt.Errorf("error cancelling scheduled deliveries: %w", err)
+	}
+
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when cancelling deliveries")
+		}
+	}(rows)
+
+	cancelled := make([]*types.UUID, 0)
+	for rows.Next() {
+		var idString string
+		if err = rows.Scan(&idString); err != nil {
+			return nil, fmt.Errorf("error scanning cancelled delivery id: %w", err)
+		}
+
+		var cancelledID types.UUID
+		cancelledID, err = types.NewUUID(idString)
+		if err != nil {
+			return nil, fmt.Errorf("invalid uuid in postgres: %w", err)
+		}
+		cancelled = append(cancelled, &cancelledID)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating cancelled deliveries: %w", err)
+	}
+
+	return cancelled, nil
+}
@@ -3,9 +3,13 @@ package repositories
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
 	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/lib/pq"
 	"github.com/wb-go/wbf/zlog"
 	"strconv"
 	"strings"
@@ -18,17 +22,28 @@ import (
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 )
 
-// NotificationPostgres implements ports.NotificationCRUDStorageRepository and ports.NotificationFetcherRepository
+// notificationInsertColumns is the column list written by notificationInsertArgs
+const notificationInsertColumns = `id, channel, publication_at, title, message, status, send_to, series_id, occurrence, template_id, template_vars, parent_id, publication_tz`
+
+// notificationColumns is the column list read by scanNotification
+const notificationColumns = `id, channel, publication_at, title, message, status, send_to, delivery_attempts, delivery_error, delivery_last_attempt_at, series_id, occurrence, template_id, template_vars, parent_id, publication_tz`
+
+// NotificationPostgres implements ports.NotificationCRUDStorageRepository, ports.NotificationFetcherRepository,
+// ports.DeliveryResultStorageRepository, ports.NotificationSeriesRepository, ports.NotificationParentRepository
+// and ports.DeadLetterRepository
 //
-// Postgres implementation with dbpg.DB
+// Postgres implementation with dbpg.DB.
+// Created and updated scheduled notifications are announced with NOTIFY on notifyChannel,
+// see NotificationWakeUpPostgres. Empty notifyChannel turns it off
 type NotificationPostgres struct {
-	db       *dbpg.DB
-	strategy retry.Strategy
+	db            *dbpg.DB
+	strategy      retry.Strategy
+	notifyChannel string
 }
 
 // NewNotificationPostgres creates a new NotificationPostgres
-func NewNotificationPostgres(db *dbpg.DB, retryStrategy retry.Strategy) *NotificationPostgres {
-	return &NotificationPostgres{db: db, strategy: retryStrategy}
+func NewNotificationPostgres(db *dbpg.DB, retryStrategy retry.Strategy, notifyChannel string) *NotificationPostgres {
+	return &NotificationPostgres{db: db, strategy: retryStrategy, notifyChannel: notifyChannel}
 }
 
 // CreateNotification is the Create method of this DB CRUD
@@ -36,27 +51,86 @@ func NewNotificationPostgres(db *dbpg.DB, retryStrategy retry.Strategy) *Notific
 // uuid is generated by caller
 func (r *NotificationPostgres) CreateNotification(ctx context.Context, notification *models.Notification) error {
 	query := `
-        INSERT INTO delayed_notifier.delayed_notifier.notifications (id, channel, publication_at, title, message, sent_to_worker, send_to) 
-        VALUES ($1, $2, $3, $4, $5, $6, $7)`
+        INSERT INTO delayed_notifier.delayed_notifier.notifications (` + notificationInsertColumns + `) 
+        VALUES ` + notificationInsertPlaceholders()
+
+	args, err := notificationInsertArgs(notification)
+	if err != nil {
+		return err
+	}
 
-	_, err := r.db.ExecWithRetry(ctx, r.strategy, query, notification.ID.String(), notification.Channel.String(), notification.PublicationAt.String(), notification.Content.Title.String(), notification.Content.Message.String(), notification.Sent, notification.SendTo.String())
+	_, err = r.db.ExecWithRetry(ctx, r.strategy, query, args...)
 	if err != nil {
 		return err
 	}
 
+	r.notifyWakeUps(ctx, notification)
+	return nil
+}
+
+// CreateNotifications saves many notifications in 1 transaction with COPY
+//
+// uuids are generated by caller
+func (r *NotificationPostgres) CreateNotifications(ctx context.Context, notifications []*models.Notification) error {
+	if len(notifications) == 0 {
+		return nil
+	}
+
+	return r.inTransaction(ctx, func(tx *sql.Tx) error {
+		if err := copyNotifications(ctx, tx, notifications); err != nil {
+			return err
+		}
+		return r.notifyWakeUpsInTx(ctx, tx, notifications...)
+	})
+}
+
+// copyNotifications inserts given notifications with COPY FROM STDIN, it's much faster than INSERT per row
+func copyNotifications(ctx context.Context, tx *sql.Tx, notifications []*models.Notification) error {
+	columns := strings.Split(notificationInsertColumns, ", ")
+
+	stmt, err := tx.PrepareContext(ctx, pq.CopyInSchema("delayed_notifier", "notifications", columns...))
+	if err != nil {
+		return fmt.Errorf("error preparing COPY: %w", err)
+	}
+
+	defer func(stmt *sql.Stmt) {
+		if closeErr := stmt.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close COPY statement")
+		}
+	}(stmt)
+
+	for _, notification := range notifications {
+		var args []any
+		args, err = notificationInsertArgs(notification)
+		if err != nil {
+			return err
+		}
+
+		// rows are buffered by driver, errors usually come on flush
+		if _, err = stmt.ExecContext(ctx, args...); err != nil {
+			return fmt.Errorf("error copying notification '%s': %w", notification.ID, err)
+		}
+	}
+
+	// flush
+	if _, err = stmt.ExecContext(ctx); err != nil {
+		return fmt.Errorf("error copying %d notifications: %w", len(notifications), err)
+	}
 	return nil
 }
 
 // UpdateNotification is the Update method of this DB CRUD
 //
 // existing object's uuid is received from *models.Notification
+//
+// only scheduled rows are updated, err ErrNotificationNotEditable otherwise
 func (r *NotificationPostgres) UpdateNotification(ctx context.Context, newData *models.Notification) error {
 	query := `
         UPDATE delayed_notifier.delayed_notifier.notifications
-        SET channel = $1, publication_at = $2, title = $3, message = $4, sent_to_worker = $5, send_to = $6, updated_at = now()
-        WHERE id = $7`
+        SET channel = $1, publication_at = $2, title = $3, message = $4, status = $5, send_to = $6, publication_tz = $7, updated_at = now()
+        WHERE id = $8 AND status = $9`
 
-	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, newData.Channel.String(), newData.PublicationAt.String(), newData.Content.Title.String(), newData.Content.Message.String(), newData.Sent, newData.SendTo.String(), newData.ID.String())
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, newData.Channel.String(), newData.PublicationAt.Value(), newData.Content.Title.String(), newData.Content.Message.String(), newData.Status.String(), newData.SendTo.String(), newData.PublicationAt.Zone(), newData.ID.String(), internaltypes.SCHEDULED)
 	if err != nil {
 		return err
 	}
@@ -68,7 +142,112 @@ func (r *NotificationPostgres) UpdateNotification(ctx context.Context, newData *
 	}
 
 	if rowsAffected == 0 {
-		return internalerrors.ErrNotificationNotFound
+		// either there's no such row or it isn't scheduled anymore
+		return r.notUpdatedReason(ctx, *newData.ID, internalerrors.ErrNotificationNotEditable)
+	}
+
+	r.notifyWakeUps(ctx, newData)
+	return nil
+}
+
+// notifyWakeUpsQuery sends the payload to listeners of the channel, postgres delivers it on commit
+const notifyWakeUpsQuery = `SELECT pg_notify($1, $2)`
+
+// wakeUpNoticePayload returns the NOTIFY payload about given notifications, false if listeners don't need it
+//
+// 1 scheduled notification is announced as is, several ones only with the earliest datetime: listeners reload their
+// window then, a notice per row would overflow the NOTIFY queue on big batches
+func (r *NotificationPostgres) wakeUpNoticePayload(notifications []*models.Notification) (string, bool, error) {
+	if r.notifyChannel == "" {
+		return "", false, nil
+	}
+
+	scheduled := make([]*models.Notification, 0, len(notifications))
+	for _, notification := range notifications {
+		if notification.Status == internaltypes.StatusScheduled {
+			scheduled = append(scheduled, notification)
+		}
+	}
+	if len(scheduled) == 0 {
+		return "", false, nil
+	}
+
+	wakeUp := &models.WakeUp{ID: scheduled[0].ID, At: scheduled[0].PublicationAt.Value()}
+	if len(scheduled) > 1 {
+		wakeUp.ID = nil
+		for _, notification := range scheduled[1:] {
+			if notification.PublicationAt.Value().Before(wakeUp.At) {
+				wakeUp.At = notification.PublicationAt.Value()
+			}
+		}
+	}
+
+	body, err := dto.WakeUpNoticeFromEntityBytes(wakeUp)
+	if err != nil {
+		return "", false, err
+	}
+	return string(body), true, nil
+}
+
+// notifyWakeUps announces created or updated notifications to all replicas
+//
+// errors are only logged: the row is saved already and the window is reloaded periodically anyway
+func (r *NotificationPostgres) notifyWakeUps(ctx context.Context, notifications ...*models.Notification) {
+	payload, needed, err := r.wakeUpNoticePayload(notifications)
+	if err == nil && needed {
+		_, err = r.db.ExecWithRetry(ctx, r.strategy, notifyWakeUpsQuery, r.notifyChannel, payload)
+	}
+	if err != nil {
+		zlog.Logger.Warn().Err(err).Str("channel", r.notifyChannel).Msg("couldn't notify about wake-up")
+	}
+}
+
+// notifyWakeUpsInTx announces created notifications to all replicas when tx is committed
+func (r *NotificationPostgres) notifyWakeUpsInTx(ctx context.Context, tx *sql.Tx, notifications ...*models.Notification) error {
+	payload, needed, err := r.wakeUpNoticePayload(notifications)
+	if err != nil || !needed {
+		return err
+	}
+
+	if _, err = tx.ExecContext(ctx, notifyWakeUpsQuery, r.notifyChannel, payload); err != nil {
+		return fmt.Errorf("error notifying about wake-up: %w", err)
+	}
+	return nil
+}
+
+// notUpdatedReason tells why a conditional UPDATE didn't affect any row
+//
+// returns ErrNotificationNotFound if there's no such row, errIfExists otherwise
+func (r *NotificationPostgres) notUpdatedReason(ctx context.Context, id types.UUID, errIfExists error) error {
+	query := `SELECT 1 FROM delayed_notifier.delayed_notifier.notifications WHERE id = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return fmt.Errorf("error select by id in postgres: %w", err)
+	}
+
+	var exists int
+	if err = row.Scan(&exists); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return internalerrors.ErrNotificationNotFound
+		}
+		return err
+	}
+
+	return errIfExists
+}
+
+// UpdateStatus moves 1 notification into status
+//
+// err ErrInvalidStatusTransition if its current status can't be moved into given one
+func (r *NotificationPostgres) UpdateStatus(ctx context.Context, id types.UUID, status internaltypes.NotificationStatus) error {
+	rowsAffected, err := r.ChangeStatus(ctx, []*types.UUID{&id}, status)
+	if err != nil {
+		return err
+	}
+
+	if rowsAffected == 0 {
+		return r.notUpdatedReason(ctx, id, internalerrors.ErrInvalidStatusTransition)
 	}
 	return nil
 }
@@ -95,140 +274,588 @@ func (r *NotificationPostgres) DeleteNotification(ctx context.Context, id types.
 
 // GetNotification retrieves an object by ID, err on not found
 func (r *NotificationPostgres) GetNotification(ctx context.Context, id types.UUID) (*models.Notification, error) {
-	query := `SELECT channel, publication_at, title, message, sent_to_worker, send_to FROM delayed_notifier.delayed_notifier.notifications WHERE id = $1`
+	query := `SELECT ` + notificationColumns + ` FROM delayed_notifier.delayed_notifier.notifications WHERE id = $1`
 
 	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
 	if err != nil {
 		return nil, fmt.Errorf("error select by id in postgres: %w", err)
 	}
 
-	var channel string
-	var publishedAt time.Time
-	var title, message string
-	var sent bool
-	var sendTo string
-	if err = row.Scan(&channel, &publishedAt, &title, &message, &sent, &sendTo); err != nil {
+	var notification *models.Notification
+	notification, err = scanNotification(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrNotificationNotFound
+		}
 		return nil, err
 	}
 
-	var channelValid internaltypes.NotificationChannel
-	channelValid, err = internaltypes.NotificationChannelFromString(channel)
+	return notification, nil
+}
+
+// ListNotifications returns up to limit objects matching filter, ordered by (publication_at, id)
+//
+// cursor = nil means "from the start", otherwise keyset pagination is used: (publication_at, id) > cursor
+func (r *NotificationPostgres) ListNotifications(ctx context.Context, filter models.NotificationFilter, cursor *models.NotificationCursor, limit int) ([]*models.Notification, error) {
+	conditions := make([]string, 0, 6)
+	args := make([]any, 0, 8)
+
+	// addArg appends arg and returns its placeholder, e.g. "$3"
+	addArg := func(arg any) string {
+		args = append(args, arg)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	if filter.Channel != nil {
+		conditions = append(conditions, "channel = "+addArg(filter.Channel.String()))
+	}
+	if filter.SendTo != nil {
+		conditions = append(conditions, "send_to = "+addArg(filter.SendTo.String()))
+	}
+	if filter.ParentID != nil {
+		conditions = append(conditions, "parent_id = "+addArg(filter.ParentID.String()))
+	}
+	if filter.Status != nil {
+		conditions = append(conditions, "status = "+addArg(filter.Status.String()))
+	}
+	if filter.PublicationAtFrom != nil {
+		conditions = append(conditions, "publication_at >= "+addArg(filter.PublicationAtFrom.Value()))
+	}
+	if filter.PublicationAtTo != nil {
+		conditions = append(conditions, "publication_at <= "+addArg(filter.PublicationAtTo.Value()))
+	}
+	if cursor != nil {
+		conditions = append(conditions, fmt.Sprintf("(publication_at, id) > (%s, %s)",
+			addArg(cursor.PublicationAt.Value()), addArg(cursor.ID.String())))
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = "WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	query := fmt.Sprintf(`SELECT %s FROM delayed_notifier.delayed_notifier.notifications %s ORDER BY publication_at, id LIMIT %s`,
+		notificationColumns, where, addArg(limit))
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("invalid channel in postgres: %w", err)
+		return nil, fmt.Errorf("error listing notifications in postgres: %w", err)
 	}
 
-	var sendToValid internaltypes.SendTo
-	sendToValid, err = internaltypes.NewSendTo(types.NewAnyText(sendTo), channelValid)
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when listing")
+		}
+	}(rows)
+
+	notifications := make([]*models.Notification, 0, limit)
+
+	for rows.Next() {
+		var notification *models.Notification
+		notification, err = scanNotification(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row in list: %w", err)
+		}
+		notifications = append(notifications, notification)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows in list: %w", err)
+	}
+
+	return notifications, nil
+}
+
+// Fetch claims up to limit earliest objects to be sent (only up to maxPublicationAt not to store everything in memory)
+//
+// rows are locked with FOR UPDATE SKIP LOCKED and leased by owner for leaseFor in one statement,
+// so concurrent instances never get the same row. Rows with an expired lease (owner died mid-batch) are reclaimed,
+// failed publishes are fetched after their next_attempt_at
+func (r *NotificationPostgres) Fetch(ctx context.Context, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration, limit int) ([]*models.Notification, error) {
+	// UPDATE ... RETURNING doesn't keep the order, so it's sorted afterward
+	query := `WITH claimed AS (
+		UPDATE delayed_notifier.delayed_notifier.notifications
+		SET lease_owner = $3, lease_expires_at = now() + make_interval(secs => $4)
+		WHERE id IN (
+			SELECT id FROM delayed_notifier.delayed_notifier.notifications
+			WHERE publication_at <= $1 AND status = $2 AND (lease_expires_at IS NULL OR lease_expires_at <= now())
+				AND (next_attempt_at IS NULL OR next_attempt_at <= now())
+			ORDER BY publication_at
+			LIMIT $5
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + notificationColumns + `
+	)
+	SELECT ` + notificationColumns + ` FROM claimed ORDER BY publication_at`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, maxPublicationAt.Value(), internaltypes.SCHEDULED, owner, leaseFor.Seconds(), limit)
 	if err != nil {
-		return nil, fmt.Errorf("invalid send_to in postgres: %w", err)
+		return nil, fmt.Errorf("error fetching in postgres up to datetime '%s': %w", maxPublicationAt.String(), err)
 	}
 
-	return &models.Notification{
-		PublicationAt: types.NewDateTime(publishedAt),
-		ID:            &id,
-		Channel:       channelValid,
-		Sent:          sent,
-		Content: models.NotificationContent{
-			Title:   types.AnyText(title),
-			Message: types.AnyText(message),
-		},
-		SendTo: sendToValid,
-	}, nil
+	return scanClaimed(rows, limit)
 }
 
-// Fetch fetches objects to be sent (only up to maxPublicationAt not to store everything in memory)
+// ClaimMany leases given objects like Fetch does, for fetchers that keep their own index of due ones
 //
-// fetches are supposed to be done regularly
-func (r *NotificationPostgres) Fetch(ctx context.Context, maxPublicationAt types.DateTime) ([]*models.Notification, error) {
-	query := `SELECT id, channel, publication_at, title, message, sent_to_worker, send_to FROM delayed_notifier.delayed_notifier.notifications WHERE publication_at <= $1 AND sent_to_worker = false ORDER BY publication_at`
+// only scheduled, not leased, not waiting for next attempt ones with publication_at up to maxPublicationAt are claimed:
+// index may be stale. Returns claimed ones ordered by publication_at
+func (r *NotificationPostgres) ClaimMany(ctx context.Context, ids []*types.UUID, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration) ([]*models.Notification, error) {
+	if len(ids) == 0 {
+		return []*models.Notification{}, nil
+	}
 
-	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, maxPublicationAt.String())
+	query := `WITH claimed AS (
+		UPDATE delayed_notifier.delayed_notifier.notifications
+		SET lease_owner = $4, lease_expires_at = now() + make_interval(secs => $5)
+		WHERE id IN (
+			SELECT id FROM delayed_notifier.delayed_notifier.notifications
+			WHERE id = ANY($1::uuid[]) AND publication_at <= $2 AND status = $3
+				AND (lease_expires_at IS NULL OR lease_expires_at <= now())
+				AND (next_attempt_at IS NULL OR next_attempt_at <= now())
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING ` + notificationColumns + `
+	)
+	SELECT ` + notificationColumns + ` FROM claimed ORDER BY publication_at`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, pq.Array(uuidStrings(ids)), maxPublicationAt.Value(),
+		internaltypes.SCHEDULED, owner, leaseFor.Seconds())
 	if err != nil {
-		return nil, fmt.Errorf("error fetching in postgres up to datetime '%s': %w", maxPublicationAt.String(), err)
+		return nil, fmt.Errorf("error claiming %d notifications in postgres: %w", len(ids), err)
 	}
 
+	return scanClaimed(rows, len(ids))
+}
+
+// scanClaimed reads claimed notifications and closes rows, broken ones are skipped
+func scanClaimed(rows *sql.Rows, limit int) ([]*models.Notification, error) {
 	defer func(rows *sql.Rows) {
 		if closeErr := rows.Close(); closeErr != nil {
-			zlog.Logger.Error().Err(err).Msg("couldn't close postgres rows when fetching")
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when fetching")
 		}
 	}(rows)
 
 	// save both notifications and their IDS for status updating
-	notifications := make([]*models.Notification, 0)
+	notifications := make([]*models.Notification, 0, limit)
 
 	for rows.Next() {
+		notification, err := scanNotification(rows)
+		if err != nil {
+			// 1 broken row mustn't block the whole batch
+			zlog.Logger.Error().Err(err).Msg("invalid notification in postgres when fetching, skipping")
+			continue
+		}
+		notifications = append(notifications, notification)
+	}
 
-		var idString string
-		var channel string
-		var publishedAt time.Time
-		var title, message string
-		var sent bool
-		var sendTo string
+	return notifications, rows.Err()
+}
+
+// FetchUpcoming returns up to limit earliest wake-ups of scheduled notifications that are due up to until
+//
+// failed publishes are due at next_attempt_at, leased ones when lease expires: if their owner dies, someone has to reclaim them
+func (r *NotificationPostgres) FetchUpcoming(ctx context.Context, until types.DateTime, limit int) ([]*models.WakeUp, error) {
+	query := `SELECT id, due_at FROM (
+			SELECT id, GREATEST(publication_at, next_attempt_at, lease_expires_at) AS due_at
+			FROM delayed_notifier.delayed_notifier.notifications
+			WHERE status = $1 AND publication_at <= $2
+		) upcoming
+		WHERE due_at <= $2
+		ORDER BY due_at
+		LIMIT $3`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, internaltypes.SCHEDULED, until.Value(), limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching upcoming in postgres up to datetime '%s': %w", until.String(), err)
+	}
+
+	return scanWakeUps(rows, limit)
+}
 
-		if err = rows.Scan(&idString, &channel, &publishedAt, &title, &message, &sent, &sendTo); err != nil {
-			return nil, fmt.Errorf("error scanning row in fetch: %w", err)
+// WakeUpsOf returns wake-ups of given objects that are still scheduled, due like in FetchUpcoming
+//
+// it's used to fix stale indexes of due objects
+func (r *NotificationPostgres) WakeUpsOf(ctx context.Context, ids []*types.UUID) ([]*models.WakeUp, error) {
+	if len(ids) == 0 {
+		return []*models.WakeUp{}, nil
+	}
+
+	query := `SELECT id, GREATEST(publication_at, next_attempt_at, lease_expires_at) AS due_at
+		FROM delayed_notifier.delayed_notifier.notifications
+		WHERE id = ANY($1::uuid[]) AND status = $2`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, pq.Array(uuidStrings(ids)), internaltypes.SCHEDULED)
+	if err != nil {
+		return nil, fmt.Errorf("error getting wake-ups of %d notifications in postgres: %w", len(ids), err)
+	}
+
+	return scanWakeUps(rows, len(ids))
+}
+
+// scanWakeUps reads (id, due_at) rows and closes them
+func scanWakeUps(rows *sql.Rows, limit int) ([]*models.WakeUp, error) {
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when fetching upcoming")
 		}
+	}(rows)
 
-		var channelValid internaltypes.NotificationChannel
-		channelValid, err = internaltypes.NotificationChannelFromString(channel)
-		if err != nil {
-			zlog.Logger.Error().Err(fmt.Errorf("invalid channel in postgres: %w", err))
-			continue
+	wakeUps := make([]*models.WakeUp, 0, limit)
+	for rows.Next() {
+		var id string
+		var dueAt time.Time
+		if err := rows.Scan(&id, &dueAt); err != nil {
+			return nil, fmt.Errorf("error scanning upcoming notification: %w", err)
 		}
 
-		var sendToValid internaltypes.SendTo
-		sendToValid, err = internaltypes.NewSendTo(types.NewAnyText(sendTo), channelValid)
+		uuid, err := types.NewUUID(id)
 		if err != nil {
-			return nil, fmt.Errorf("invalid send_to in postgres: %w", err)
+			return nil, fmt.Errorf("invalid id of upcoming notification: %w", err)
 		}
+		wakeUps = append(wakeUps, &models.WakeUp{ID: &uuid, At: dueAt})
+	}
 
-		var id types.UUID
-		id, err = types.NewUUID(idString)
-		if err != nil {
-			zlog.Logger.Error().Err(fmt.Errorf("invalid uuid in postgres: %w", err))
-			continue
+	return wakeUps, rows.Err()
+}
+
+// Index does nothing: postgres fetches due objects by publication_at itself
+func (r *NotificationPostgres) Index(_ context.Context, _ []*models.WakeUp) error {
+	return nil
+}
+
+// Claim leases 1 scheduled notification by owner for leaseFor
+//
+// owner may extend its own lease, others have to wait until it expires. Failed publishes wait for next_attempt_at
+func (r *NotificationPostgres) Claim(ctx context.Context, id types.UUID, owner string, leaseFor time.Duration) (bool, error) {
+	query := `UPDATE delayed_notifier.delayed_notifier.notifications
+		SET lease_owner = $3, lease_expires_at = now() + make_interval(secs => $4)
+		WHERE id = $1 AND status = $2 AND (lease_expires_at IS NULL OR lease_expires_at <= now() OR lease_owner = $3)
+			AND (next_attempt_at IS NULL OR next_attempt_at <= now())`
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, id.String(), internaltypes.SCHEDULED, owner, leaseFor.Seconds())
+	if err != nil {
+		return false, fmt.Errorf("error claiming notification '%s': %w", id, err)
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	return rowsAffected > 0, nil
+}
+
+// ReturnToPending releases leases of owner's failed publishes, they stay scheduled until next_attempt_at
+//
+// next_attempt_at is now + backoff.Base * 2^publish_attempts, up to backoff.Max.
+// Rows that reach backoff.MaxAttempts are failed and dead-lettered in the same statement.
+// Rows that were reclaimed by another owner (our lease expired) aren't touched
+func (r *NotificationPostgres) ReturnToPending(ctx context.Context, failures []*models.PublishFailure, owner string, backoff models.PublishBackoff) (int64, error) {
+	if len(failures) == 0 {
+		return 0, nil
+	}
+
+	ids := make([]string, len(failures))
+	errs := make([]string, len(failures))
+	for i, failure := range failures {
+		ids[i] = failure.ID.String()
+		if failure.Error != nil {
+			errs[i] = failure.Error.Error()
 		}
+	}
 
-		notifications = append(notifications, &models.Notification{
-			PublicationAt: types.NewDateTime(publishedAt),
-			ID:            &id,
-			Channel:       channelValid,
-			Content: models.NotificationContent{
-				Title:   types.AnyText(title),
-				Message: types.AnyText(message),
-			},
-			Sent:   sent,
-			SendTo: sendToValid,
-		})
+	// power is capped, 2^30 is more than any sane Max anyway
+	query := `WITH returned AS (
+		UPDATE delayed_notifier.delayed_notifier.notifications AS n
+		SET publish_attempts = n.publish_attempts + 1,
+			publish_error = NULLIF(failed.error, ''),
+			status = CASE WHEN $7::int > 0 AND n.publish_attempts + 1 >= $7::int THEN $8 ELSE n.status END,
+			next_attempt_at = CASE WHEN $7::int > 0 AND n.publish_attempts + 1 >= $7::int THEN NULL
+				ELSE now() + make_interval(secs => LEAST($3 * power(2, LEAST(n.publish_attempts, 30)), $4)) END,
+			lease_owner = NULL, lease_expires_at = NULL, updated_at = now()
+		FROM unnest($1::uuid[], $2::text[]) AS failed(id, error)
+		WHERE n.id = failed.id AND n.status = $5 AND n.lease_owner = $6
+		RETURNING n.*
+	), ` + deadLettersInsertCTE("returned", models.DeadLetterSourcePublish, "publish_error", "publish_attempts") + `
+	SELECT count(*) FILTER (WHERE status = $5) FROM returned`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, pq.Array(ids), pq.Array(errs),
+		backoff.Base.Seconds(), backoff.Max.Seconds(), internaltypes.SCHEDULED, owner, backoff.MaxAttempts, internaltypes.FAILED)
+	if err != nil {
+		return 0, fmt.Errorf("error returning %d notifications to pending: %w", len(failures), err)
 	}
 
-	return notifications, nil
+	var returned int64
+	if err = row.Scan(&returned); err != nil {
+		return 0, fmt.Errorf("error returning %d notifications to pending: %w", len(failures), err)
+	}
+
+	return returned, nil
 }
 
-// MarkAsSent should be used to mark fetched notifications as sent
-func (r *NotificationPostgres) MarkAsSent(ctx context.Context, ids []*types.UUID) error {
-	idsNumsList := make([]string, len(ids))
-	for i := range ids {
-		idsNumsList[i] = "$" + strconv.Itoa(i+1)
+// RecordDeliveryResult moves notification into result status and saves attempt info
+//
+// failed ones are dead-lettered in the same statement.
+// err ErrInvalidStatusTransition if notification isn't queued (e.g. result is a duplicate)
+func (r *NotificationPostgres) RecordDeliveryResult(ctx context.Context, result *models.DeliveryResult) error {
+	previous := result.Status.AllowedPrevious()
+
+	args := []any{result.Status.String(), result.Attempt, result.Error.String(), result.Timestamp.Value(), result.ID.String()}
+	previousNumsList := make([]string, len(previous))
+	for i, previousStatus := range previous {
+		args = append(args, previousStatus.String())
+		previousNumsList[i] = "$" + strconv.Itoa(len(args))
+	}
+
+	query := fmt.Sprintf(`WITH recorded AS (
+		UPDATE delayed_notifier.delayed_notifier.notifications
+		SET status = $1, delivery_attempts = GREATEST(delivery_attempts, $2), delivery_error = NULLIF($3, ''), delivery_last_attempt_at = $4, updated_at = now()
+		WHERE id = $5 AND status IN (%s)
+		RETURNING *
+	), %s
+	SELECT count(*) FROM recorded`, strings.Join(previousNumsList, ","),
+		deadLettersInsertCTE("recorded", models.DeadLetterSourceDelivery, "delivery_error", "delivery_attempts"))
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, args...)
+	if err != nil {
+		return fmt.Errorf("error recording delivery result: %w", err)
 	}
-	query := fmt.Sprintf(`UPDATE delayed_notifier.delayed_notifier.notifications SET sent_to_worker = true where id IN (%s)`, strings.Join(idsNumsList, ","))
 
+	var rowsAffected int64
+	if err = row.Scan(&rowsAffected); err != nil {
+		return fmt.Errorf("error recording delivery result: %w", err)
+	}
+
+	if rowsAffected == 0 {
+		return r.notUpdatedReason(ctx, result.ID, internalerrors.ErrInvalidStatusTransition)
+	}
+	return nil
+}
+
+// ChangeStatus moves given notifications into status
+//
+// only rows whose current status may be moved into it are changed (see internaltypes.NotificationStatus.AllowedPrevious)
+//
+// returns amount of changed rows
+func (r *NotificationPostgres) ChangeStatus(ctx context.Context, ids []*types.UUID, status internaltypes.NotificationStatus) (int64, error) {
+	if len(ids) == 0 {
+		return 0, nil
+	}
+
+	previous := status.AllowedPrevious()
+	if len(previous) == 0 {
+		return 0, internalerrors.ErrInvalidStatusTransition
+	}
+
+	// $1 is the new status, then allowed previous ones, then ids
+	//
 	// requires to convert: []types.UUID to []string to ('string1', 'string2', ....)
 	//
 	// allocations and everything... unfortunately
-	idsStrings := make([]any, len(ids))
+	args := make([]any, 0, 1+len(previous)+len(ids))
+	args = append(args, status.String())
+
+	previousNumsList := make([]string, len(previous))
+	for i, previousStatus := range previous {
+		args = append(args, previousStatus.String())
+		previousNumsList[i] = "$" + strconv.Itoa(len(args))
+	}
+
+	idsNumsList := make([]string, len(ids))
 	for i, id := range ids {
-		idsStrings[i] = id.String()
+		args = append(args, id.String())
+		idsNumsList[i] = "$" + strconv.Itoa(len(args))
 	}
 
+	query := fmt.Sprintf(`UPDATE delayed_notifier.delayed_notifier.notifications SET status = $1, updated_at = now(), lease_owner = NULL, lease_expires_at = NULL, next_attempt_at = NULL WHERE status IN (%s) AND id IN (%s)`,
+		strings.Join(previousNumsList, ","), strings.Join(idsNumsList, ","))
+
 	// exec
-	_, err := r.db.ExecWithRetry(ctx, r.strategy, query, idsStrings...)
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, args...)
 	if err != nil {
-		return fmt.Errorf("error marking %d notifications as sent: %w", len(ids), err)
+		return 0, fmt.Errorf("error marking %d notifications as '%s': %w", len(ids), status, err)
 	}
 
-	// we could also check if RowsAffected = len(ids) but that's wrong
-	// what if rows were deleted while sending notifications?
+	// we don't require RowsAffected = len(ids)
+	// what if rows were deleted or cancelled while sending notifications?
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
 
-	return nil
+	return rowsAffected, nil
+}
+
+// notificationInsertColumnsCount is the amount of columns in notificationInsertColumns
+const notificationInsertColumnsCount = 13
+
+// notificationInsertPlaceholders returns "($1, ..., $n)" for INSERT, see notificationInsertColumns
+func notificationInsertPlaceholders() string {
+	placeholders := make([]string, notificationInsertColumnsCount)
+	for i := range placeholders {
+		placeholders[i] = "$" + strconv.Itoa(i+1)
+	}
+	return "(" + strings.Join(placeholders, ", ") + ")"
+}
+
+// notificationInsertArgs returns $1..$13 of INSERT, see notificationInsertColumns
+func notificationInsertArgs(notification *models.Notification) ([]any, error) {
+	var seriesID any
+	if notification.SeriesID != nil {
+		seriesID = notification.SeriesID.String()
+	}
+
+	var parentID any
+	if notification.ParentID != nil {
+		parentID = notification.ParentID.String()
+	}
+
+	var templateID, templateVars any
+	if notification.Template != nil {
+		templateID = notification.Template.ID.String()
+
+		variables, err := json.Marshal(notification.Template.Variables)
+		if err != nil {
+			return nil, fmt.Errorf("couldn't marshal template variables: %w", err)
+		}
+		templateVars = string(variables)
+	}
+
+	return []any{notification.ID.String(), notification.Channel.String(), notification.PublicationAt.Value(),
+		notification.Content.Title.String(), notification.Content.Message.String(), notification.Status.String(),
+		notification.SendTo.String(), seriesID, notification.Occurrence, templateID, templateVars, parentID,
+		notification.PublicationAt.Zone()}, nil
+}
+
+// rowScanner is either *sql.Row or *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+// scanNotification reads 1 row of notificationColumns into a model
+func scanNotification(row rowScanner) (*models.Notification, error) {
+	var idString string
+	var channel string
+	var publishedAt time.Time
+	var title, message string
+	var status string
+	var sendTo string
+	var deliveryAttempts int
+	var deliveryError sql.NullString
+	var deliveryLastAttemptAt sql.NullTime
+	var seriesIDString sql.NullString
+	var occurrence int
+	var templateIDString sql.NullString
+	var templateVars []byte
+	var parentIDString sql.NullString
+	var publicationTZ string
+
+	if err := row.Scan(&idString, &channel, &publishedAt, &title, &message, &status, &sendTo,
+		&deliveryAttempts, &deliveryError, &deliveryLastAttemptAt, &seriesIDString, &occurrence, &templateIDString, &templateVars, &parentIDString, &publicationTZ); err != nil {
+		return nil, err
+	}
+
+	id, err := types.NewUUID(idString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uuid in postgres: %w", err)
+	}
+
+	var publicationAtValid types.DateTime
+	publicationAtValid, err = types.NewDateTimeInZone(publishedAt, publicationTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid publication_tz in postgres: %w", err)
+	}
+
+	var channelValid internaltypes.NotificationChannel
+	channelValid, err = internaltypes.NotificationChannelFromString(channel)
+	if err != nil {
+		return nil, fmt.Errorf("invalid channel in postgres: %w", err)
+	}
+
+	var sendToValid internaltypes.SendTo
+	sendToValid, err = internaltypes.NewSendTo(types.NewAnyText(sendTo), channelValid)
+	if err != nil {
+		return nil, fmt.Errorf("invalid send_to in postgres: %w", err)
+	}
+
+	var statusValid internaltypes.NotificationStatus
+	statusValid, err = internaltypes.NotificationStatusFromString(status)
+	if err != nil {
+		return nil, fmt.Errorf("invalid status in postgres: %w", err)
+	}
+
+	// worker hasn't reported anything yet
+	var delivery *models.DeliveryInfo
+	if deliveryLastAttemptAt.Valid {
+		delivery = &models.DeliveryInfo{
+			Attempts:      deliveryAttempts,
+			LastError:     types.NewAnyText(deliveryError.String),
+			LastAttemptAt: types.NewDateTime(deliveryLastAttemptAt.Time),
+		}
+	}
+
+	var seriesID *types.UUID
+	if seriesIDString.Valid {
+		var seriesIDValid types.UUID
+		seriesIDValid, err = types.NewUUID(seriesIDString.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid series uuid in postgres: %w", err)
+		}
+		seriesID = &seriesIDValid
+	}
+
+	var parentID *types.UUID
+	if parentIDString.Valid {
+		var parentIDValid types.UUID
+		parentIDValid, err = types.NewUUID(parentIDString.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid parent uuid in postgres: %w", err)
+		}
+		parentID = &parentIDValid
+	}
+
+	var template *models.NotificationTemplate
+	if templateIDString.Valid {
+		var templateID types.UUID
+		templateID, err = types.NewUUID(templateIDString.String)
+		if err != nil {
+			return nil, fmt.Errorf("invalid template uuid in postgres: %w", err)
+		}
+
+		template = &models.NotificationTemplate{ID: templateID}
+		if len(templateVars) > 0 {
+			if err = json.Unmarshal(templateVars, &template.Variables); err != nil {
+				return nil, fmt.Errorf("invalid template variables in postgres: %w", err)
+			}
+		}
+	}
+
+	return &models.Notification{
+		PublicationAt: publicationAtValid,
+		ID:            &id,
+		Channel:       channelValid,
+		Content: models.NotificationContent{
+			Title:   types.AnyText(title),
+			Message: types.AnyText(message),
+		},
+		Status:     statusValid,
+		SendTo:     sendToValid,
+		Delivery:   delivery,
+		SeriesID:   seriesID,
+		Occurrence: occurrence,
+		Template:   template,
+		ParentID:   parentID,
+	}, nil
+}
+
+// uuidStrings converts ids for pq.Array
+func uuidStrings(ids []*types.UUID) []string {
+	result := make([]string, len(ids))
+	for i, id := range ids {
+		result[i] = id.String()
+	}
+	return result
 }
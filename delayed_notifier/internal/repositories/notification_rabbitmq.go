@@ -4,37 +4,97 @@ import (
 	"context"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/delaybuckets"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/dlq"
-	"github.com/wb-go/wbf/rabbitmq"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/rabbitmq/amqp091-go"
 	"github.com/wb-go/wbf/retry"
 	"github.com/wb-go/wbf/zlog"
+	"sync"
+	"time"
 )
 
+// ConfirmChannel is the part of *rabbitmq.Channel used by NotificationRabbitMQ
+//
+// the channel must be in confirm mode (see connect.GetRabbitMQPublisher) and used by 1 NotificationRabbitMQ only
+type ConfirmChannel interface {
+	PublishWithDeferredConfirmWithContext(ctx context.Context, exchange, key string, mandatory, immediate bool, msg amqp091.Publishing) (*amqp091.DeferredConfirmation, error)
+	NotifyPublish(confirm chan amqp091.Confirmation) chan amqp091.Confirmation
+	NotifyReturn(c chan amqp091.Return) chan amqp091.Return
+}
+
+// publishing is 1 message waiting for broker's confirmation
+type publishing struct {
+	messageID string
+	done      chan struct{}
+	err       error
+}
+
 // NotificationRabbitMQ is the RabbitMQ implementation on ports.NotificationPublisherRepository
+//
+// messages are published as mandatory and are sent only when broker acks them:
+// nacked, returned (no queue is bound) and not confirmed in time ones are failed
+//
+// with enabled delays, notifications that aren't due yet are published into wait queues and the broker releases
+// them into exchange at their time (rounded down to delays.Step). Only routing into a wait queue is checked then
 type NotificationRabbitMQ struct {
-	publisher     *rabbitmq.Publisher
-	retryStrategy retry.Strategy
+	channel        ConfirmChannel
+	exchange       string
+	delays         delaybuckets.Layout
+	retryStrategy  retry.Strategy
+	confirmTimeout time.Duration
+
+	// mu guards everything below, it's never held while calling channel
+	mu sync.Mutex
+	// waiting are publishings by delivery tag
+	waiting map[uint64]*publishing
+	// confirmedEarly are confirmations that came before their publishing was registered
+	confirmedEarly map[uint64]bool
+	// returned are errors of messages the broker couldn't route, by message ID. Returns come before confirmations
+	returned map[string]error
+	// closed is true after the channel is closed, nothing can be confirmed anymore
+	closed bool
 }
 
-// NewNotificationRabbitMQ creates a new NotificationRabbitMQ
+// NewNotificationRabbitMQ creates a new NotificationRabbitMQ, it listens to confirmations until channel is closed
+//
+// delays may be disabled (zero), then everything is published into exchange right away
 func NewNotificationRabbitMQ(
-	publisher *rabbitmq.Publisher,
+	channel ConfirmChannel,
+	exchange string,
+	delays delaybuckets.Layout,
 	retryStrategy retry.Strategy,
+	confirmTimeout time.Duration,
 ) *NotificationRabbitMQ {
-	return &NotificationRabbitMQ{
-		publisher,
-		retryStrategy,
+	n := &NotificationRabbitMQ{
+		channel:        channel,
+		exchange:       exchange,
+		delays:         delays,
+		retryStrategy:  retryStrategy,
+		confirmTimeout: confirmTimeout,
+		waiting:        make(map[uint64]*publishing),
+		confirmedEarly: make(map[uint64]bool),
+		returned:       make(map[string]error),
 	}
+
+	// both are unbuffered: amqp091 sends a return before the confirmation of the same message
+	// from 1 goroutine, so listen sees them in this order too
+	confirms := channel.NotifyPublish(make(chan amqp091.Confirmation))
+	returns := channel.NotifyReturn(make(chan amqp091.Return))
+	go n.listen(confirms, returns)
+
+	return n
 }
 
-// SendOne sends 1 notification at a time
+// SendOne sends 1 notification at a time and waits for its confirmation
 func (n *NotificationRabbitMQ) SendOne(ctx context.Context, notification *models.Notification) error {
-	body, err := dto.NotificationSendBodyFromEntityBytes(notification)
+	published, err := n.publish(ctx, notification)
 	if err != nil {
-		return fmt.Errorf("couldn't create body to send one: %w", err)
+		return err
 	}
-	err = n.publisher.PublishWithRetry(body, n.routingKey(notification), "application/json", n.retryStrategy)
+	err = n.wait(ctx, published)
 	if err != nil {
 		return fmt.Errorf("couldn't send message to rabbitMQ: %w", err)
 	}
@@ -43,19 +103,28 @@ func (n *NotificationRabbitMQ) SendOne(ctx context.Context, notification *models
 }
 
 // SendMany sends batch of notifications at a time, create notifications lists and use it
+//
+// all messages are published first, then their confirmations are awaited. DLQ is closed after the last one
 func (n *NotificationRabbitMQ) SendMany(ctx context.Context, notifications []*models.Notification) *dlq.DLQ[*models.Notification] {
 	DLQ := dlq.NewDLQ[*models.Notification](len(notifications) / 10)
 
 	go func() {
-		for _, notification := range notifications {
-			body, err := dto.NotificationSendBodyFromEntityBytes(notification)
+		publishings := make([]*publishing, len(notifications))
+		for i, notification := range notifications {
+			published, err := n.publish(ctx, notification)
 			if err != nil {
-				DLQ.Put(notification, fmt.Errorf("couldn't send message to rabbitMQ: %w", err))
+				DLQ.Put(notification, err)
+				continue
 			}
+			publishings[i] = published
+		}
 
-			err = n.publisher.PublishWithRetry(body, n.routingKey(notification), "application/json", n.retryStrategy)
-			if err != nil {
-				DLQ.Put(notification, fmt.Errorf("couldn't send message to rabbitMQ: %w", err))
+		for i, published := range publishings {
+			if published == nil {
+				continue
+			}
+			if err := n.wait(ctx, published); err != nil {
+				DLQ.Put(notifications[i], fmt.Errorf("couldn't send message to rabbitMQ: %w", err))
 			} else {
 				zlog.Logger.Debug().Msg("sent message in batch to rabbitMQ")
 			}
@@ -66,6 +135,141 @@ func (n *NotificationRabbitMQ) SendMany(ctx context.Context, notifications []*mo
 	return DLQ
 }
 
+// publish publishes 1 notification as mandatory and registers it to wait for confirmation
+func (n *NotificationRabbitMQ) publish(ctx context.Context, notification *models.Notification) (*publishing, error) {
+	body, err := dto.NotificationSendBodyFromEntityBytes(notification)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create body to send: %w", err)
+	}
+
+	// message ID is unique per publish, so returns of retried notifications aren't mixed up
+	published := &publishing{messageID: types.GenerateUUID().String(), done: make(chan struct{})}
+
+	exchange, headers := n.route(notification)
+
+	var confirmation *amqp091.DeferredConfirmation
+	err = retry.Do(func() error {
+		var errPublish error
+		confirmation, errPublish = n.channel.PublishWithDeferredConfirmWithContext(ctx, exchange, n.routingKey(notification), true, false,
+			amqp091.Publishing{
+				ContentType: "application/json",
+				MessageId:   published.messageID,
+				Headers:     headers,
+				Body:        body,
+			})
+		return errPublish
+	}, n.retryStrategy)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't send message to rabbitMQ: %w", err)
+	}
+	if confirmation == nil {
+		return nil, fmt.Errorf("couldn't send message to rabbitMQ: %w: channel isn't in confirm mode", internalerrors.ErrPublishNotConfirmed)
+	}
+
+	n.register(confirmation.DeliveryTag, published)
+	return published, nil
+}
+
+// register starts waiting for the confirmation of deliveryTag, it may have already come
+func (n *NotificationRabbitMQ) register(deliveryTag uint64, published *publishing) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if ack, found := n.confirmedEarly[deliveryTag]; found {
+		delete(n.confirmedEarly, deliveryTag)
+		n.finish(published, ack)
+		return
+	}
+
+	if n.closed {
+		published.err = fmt.Errorf("%w: channel is closed", internalerrors.ErrPublishNotConfirmed)
+		close(published.done)
+		return
+	}
+
+	n.waiting[deliveryTag] = published
+}
+
+// finish sets the result of published, must be called with mu held
+func (n *NotificationRabbitMQ) finish(published *publishing, ack bool) {
+	if errReturned, isReturned := n.returned[published.messageID]; isReturned {
+		delete(n.returned, published.messageID)
+		published.err = errReturned
+	} else if !ack {
+		published.err = internalerrors.ErrPublishNacked
+	}
+	close(published.done)
+}
+
+// wait waits for the confirmation of published, for confirmTimeout at most
+func (n *NotificationRabbitMQ) wait(ctx context.Context, published *publishing) error {
+	timer := time.NewTimer(n.confirmTimeout)
+	defer timer.Stop()
+
+	select {
+	case <-published.done:
+		return published.err
+	case <-timer.C:
+		return fmt.Errorf("%w: timeout %s", internalerrors.ErrPublishNotConfirmed, n.confirmTimeout)
+	case <-ctx.Done():
+		return fmt.Errorf("%w: %w", internalerrors.ErrPublishNotConfirmed, ctx.Err())
+	}
+}
+
+// listen matches confirmations and returns with waiting publishings until the channel is closed
+func (n *NotificationRabbitMQ) listen(confirms <-chan amqp091.Confirmation, returns <-chan amqp091.Return) {
+	for confirms != nil {
+		select {
+		case returned, ok := <-returns:
+			if !ok {
+				returns = nil
+				continue
+			}
+			n.mu.Lock()
+			n.returned[returned.MessageId] = fmt.Errorf("%w: %d %s (routing key '%s')",
+				internalerrors.ErrPublishReturned, returned.ReplyCode, returned.ReplyText, returned.RoutingKey)
+			n.mu.Unlock()
+
+		case confirmation, ok := <-confirms:
+			if !ok {
+				confirms = nil
+				continue
+			}
+			n.mu.Lock()
+			if published, found := n.waiting[confirmation.DeliveryTag]; found {
+				delete(n.waiting, confirmation.DeliveryTag)
+				n.finish(published, confirmation.Ack)
+			} else {
+				n.confirmedEarly[confirmation.DeliveryTag] = confirmation.Ack
+			}
+			n.mu.Unlock()
+		}
+	}
+
+	// channel is closed, nothing else will be confirmed
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.closed = true
+	for deliveryTag, published := range n.waiting {
+		published.err = fmt.Errorf("%w: channel is closed", internalerrors.ErrPublishNotConfirmed)
+		close(published.done)
+		delete(n.waiting, deliveryTag)
+	}
+	zlog.Logger.Warn().Msg("rabbitMQ publisher channel is closed")
+}
+
+// route returns the exchange and headers to publish notification with: wait queue of its delay or exchange if it's due
+//
+// routing key is the same in both cases, wait queues dead-letter messages with it
+func (n *NotificationRabbitMQ) route(notification *models.Notification) (string, amqp091.Table) {
+	bucket := n.delays.Of(time.Until(notification.PublicationAt.Value()))
+	if bucket == 0 {
+		return n.exchange, nil
+	}
+	return n.delays.Exchange, amqp091.Table{delaybuckets.Header: n.delays.Key(bucket)}
+}
+
 func (n *NotificationRabbitMQ) routingKey(notification *models.Notification) string {
 	return notification.Channel.String()
 }
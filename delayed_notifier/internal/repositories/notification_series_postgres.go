@@ -0,0 +1,284 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// CreateSeries saves a new series together with its first occurrence in 1 transaction
+//
+// uuids are generated by caller
+func (r *NotificationPostgres) CreateSeries(ctx context.Context, series *models.NotificationSeries, first *models.Notification) error {
+	seriesQuery := `
+        INSERT INTO delayed_notifier.delayed_notifier.notification_series (id, rule, starts_at, until, max_count, starts_at_tz)
+        VALUES ($1, $2, $3, $4, $5, $6)`
+
+	notificationQuery := `
+        INSERT INTO delayed_notifier.delayed_notifier.notifications (` + notificationInsertColumns + `) 
+        VALUES ` + notificationInsertPlaceholders()
+
+	notificationArgs, err := notificationInsertArgs(first)
+	if err != nil {
+		return err
+	}
+
+	var until any
+	if !series.Rule.Until().IsZero() {
+		until = series.Rule.Until()
+	}
+
+	return r.inTransaction(ctx, func(tx *sql.Tx) error {
+		_, err := tx.ExecContext(ctx, seriesQuery, series.ID.String(), series.Rule.String(), series.Rule.Start(), until, series.Rule.Count(),
+			types.NewDateTime(series.Rule.Start()).Zone())
+		if err != nil {
+			return fmt.Errorf("error inserting series: %w", err)
+		}
+
+		_, err = tx.ExecContext(ctx, notificationQuery, notificationArgs...)
+		if err != nil {
+			return fmt.Errorf("error inserting first occurrence: %w", err)
+		}
+		return r.notifyWakeUpsInTx(ctx, tx, first)
+	})
+}
+
+// GetSeries returns series with its latest occurrence, err ErrSeriesNotFound on not found
+func (r *NotificationPostgres) GetSeries(ctx context.Context, id types.UUID) (*models.NotificationSeries, error) {
+	query := `SELECT rule, starts_at, until, max_count, stopped_at, starts_at_tz FROM delayed_notifier.delayed_notifier.notification_series WHERE id = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select series by id in postgres: %w", err)
+	}
+
+	var rule string
+	var startsAt time.Time
+	var until, stoppedAt sql.NullTime
+	var maxCount int
+	var startsAtTZ string
+
+	if err = row.Scan(&rule, &startsAt, &until, &maxCount, &stoppedAt, &startsAtTZ); err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrSeriesNotFound
+		}
+		return nil, err
+	}
+
+	// rule is evaluated in the zone of start
+	var start types.DateTime
+	start, err = types.NewDateTimeInZone(startsAt, startsAtTZ)
+	if err != nil {
+		return nil, fmt.Errorf("invalid starts_at_tz in postgres: %w", err)
+	}
+
+	var ruleValid recurrence.Rule
+	ruleValid, err = recurrence.NewRule(rule, start.Value(), until.Time, maxCount)
+	if err != nil {
+		return nil, fmt.Errorf("invalid rule in postgres: %w", err)
+	}
+
+	series := &models.NotificationSeries{ID: &id, Rule: ruleValid}
+	if stoppedAt.Valid {
+		stoppedAtValue := types.NewDateTime(stoppedAt.Time)
+		series.StoppedAt = &stoppedAtValue
+	}
+
+	// latest occurrence
+	lastQuery := `SELECT ` + notificationColumns + ` FROM delayed_notifier.delayed_notifier.notifications WHERE series_id = $1 ORDER BY occurrence DESC LIMIT 1`
+
+	row, err = r.db.QueryRowWithRetry(ctx, r.strategy, lastQuery, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select last occurrence in postgres: %w", err)
+	}
+
+	series.Last, err = scanNotification(row)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return nil, fmt.Errorf("error scanning last occurrence: %w", err)
+	}
+
+	return series, nil
+}
+
+// StopSeries marks series as stopped and cancels its scheduled occurrences in 1 transaction
+//
+// returns ids of cancelled occurrences, err ErrSeriesNotFound or ErrSeriesStopped
+func (r *NotificationPostgres) StopSeries(ctx context.Context, id types.UUID) ([]*types.UUID, error) {
+	stopQuery := `
+        UPDATE delayed_notifier.delayed_notifier.notification_series
+        SET stopped_at = now(), updated_at = now()
+        WHERE id = $1 AND stopped_at IS NULL`
+
+	cancelQuery := `
+        UPDATE delayed_notifier.delayed_notifier.notifications
+        SET status = $1, updated_at = now()
+        WHERE series_id = $2 AND status = $3
+        RETURNING id`
+
+	var cancelled []*types.UUID
+
+	err := r.inTransaction(ctx, func(tx *sql.Tx) error {
+		cancelled = make([]*types.UUID, 0)
+
+		res, err := tx.ExecContext(ctx, stopQuery, id.String())
+		if err != nil {
+			return fmt.Errorf("error stopping series: %w", err)
+		}
+
+		var rowsAffected int64
+		rowsAffected, err = res.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("couldn't get number of rows affected: %v", err)
+		}
+
+		if rowsAffected == 0 {
+			var exists int
+			err = tx.QueryRowContext(ctx, `SELECT 1 FROM delayed_notifier.delayed_notifier.notification_series WHERE id = $1`, id.String()).Scan(&exists)
+			if errors.Is(err, sql.ErrNoRows) {
+				return internalerrors.ErrSeriesNotFound
+			}
+			if err != nil {
+				return err
+			}
+			return internalerrors.ErrSeriesStopped
+		}
+
+		var rows *sql.Rows
+		rows, err = tx.QueryContext(ctx, cancelQuery, internaltypes.CANCELLED, id.String(), internaltypes.SCHEDULED)
+		if err != nil {
+			return fmt.Errorf("error cancelling scheduled occurrences: %w", err)
+		}
+
+		defer func(rows *sql.Rows) {
+			if closeErr := rows.Close(); closeErr != nil {
+				zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when stopping series")
+			}
+		}(rows)
+
+		for rows.Next() {
+			var idString string
+			if err = rows.Scan(&idString); err != nil {
+				return err
+			}
+
+			var cancelledID types.UUID
+			cancelledID, err = types.NewUUID(idString)
+			if err != nil {
+				return fmt.Errorf("invalid uuid in postgres: %w", err)
+			}
+			cancelled = append(cancelled, &cancelledID)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return cancelled, nil
+}
+
+// CreateOccurrence saves next occurrence of a series
+//
+// series row is locked FOR SHARE, so StopSeries waits for it and cancels it too
+//
+// returns false if series is stopped or this occurrence already exists
+func (r *NotificationPostgres) CreateOccurrence(ctx context.Context, occurrence *models.Notification) (bool, error) {
+	if occurrence.SeriesID == nil {
+		return false, fmt.Errorf("occurrence '%s' has no series", occurrence.ID)
+	}
+
+	query := `
+        INSERT INTO delayed_notifier.delayed_notifier.notifications (` + notificationInsertColumns + `)
+        SELECT $1::uuid, $2, $3::timestamptz, $4, $5, $6, $7, $8::uuid, $9::integer, $10::uuid, $11::jsonb, $12::uuid, $13
+        WHERE EXISTS (
+            SELECT 1 FROM delayed_notifier.delayed_notifier.notification_series WHERE id = $8::uuid AND stopped_at IS NULL FOR SHARE
+        )
+        ON CONFLICT (series_id, occurrence) DO NOTHING`
+
+	args, err := notificationInsertArgs(occurrence)
+	if err != nil {
+		return false, err
+	}
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, args...)
+	if err != nil {
+		return false, fmt.Errorf("error inserting occurrence: %w", err)
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return false, fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	if rowsAffected > 0 {
+		r.notifyWakeUps(ctx, occurrence)
+	}
+	return rowsAffected > 0, nil
+}
+
+// FetchStalledSeries returns up to limit latest occurrences of active series that aren't scheduled anymore
+//
+// a series whose next occurrence wasn't created after the latest one was sent (e.g. service was down) is stalled.
+// Series that are over by their count or until aren't returned
+func (r *NotificationPostgres) FetchStalledSeries(ctx context.Context, limit int) ([]*models.Notification, error) {
+	query := `
+        SELECT ` + notificationColumns + ` FROM (
+            SELECT DISTINCT ON (n.series_id) n.*, s.max_count
+            FROM delayed_notifier.delayed_notifier.notifications n
+            JOIN delayed_notifier.delayed_notifier.notification_series s ON s.id = n.series_id
+            WHERE s.stopped_at IS NULL AND (s.until IS NULL OR s.until > now())
+            ORDER BY n.series_id, n.occurrence DESC
+        ) latest
+        WHERE latest.status <> $1 AND (latest.max_count = 0 OR latest.occurrence < latest.max_count)
+        LIMIT $2`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query, internaltypes.SCHEDULED, limit)
+	if err != nil {
+		return nil, fmt.Errorf("error fetching stalled series in postgres: %w", err)
+	}
+
+	return scanClaimed(rows, limit)
+}
+
+// inTransaction runs fn in a transaction on master, with retry
+//
+// fn's errors ErrSeriesNotFound, ErrSeriesStopped aren't retried
+func (r *NotificationPostgres) inTransaction(ctx context.Context, fn func(tx *sql.Tx) error) error {
+	var finalErr error
+
+	err := retry.Do(func() error {
+		tx, err := r.db.Master.BeginTx(ctx, nil)
+		if err != nil {
+			return fmt.Errorf("error beginning transaction: %w", err)
+		}
+
+		finalErr = fn(tx)
+		if finalErr != nil {
+			if rollbackErr := tx.Rollback(); rollbackErr != nil {
+				zlog.Logger.Error().Err(rollbackErr).Msg("couldn't rollback transaction")
+			}
+			if errors.Is(finalErr, internalerrors.ErrSeriesNotFound) || errors.Is(finalErr, internalerrors.ErrSeriesStopped) {
+				return nil
+			}
+			return finalErr
+		}
+
+		finalErr = tx.Commit()
+		return finalErr
+	}, r.strategy)
+	if err != nil {
+		return err
+	}
+
+	return finalErr
+}
@@ -0,0 +1,111 @@
+package repositories
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// wakeUpListenerPingPeriod is how often the idle connection is checked, lost one is re-established by pq.Listener
+const wakeUpListenerPingPeriod = 90 * time.Second
+
+// NotificationWakeUpPostgres is the Postgres implementation of ports.NotificationWakeUpListener
+//
+// it LISTENs to the channel NotificationPostgres NOTIFYs on, so every replica knows about notifications
+// created or updated by any of them
+type NotificationWakeUpPostgres struct {
+	listener *pq.Listener
+	channel  string
+
+	// close done - objects close too
+	done        chan struct{}
+	objectsChan chan *models.WakeUp
+}
+
+// NewNotificationWakeUpPostgres creates a new NotificationWakeUpPostgres with its own connection to dsn
+//
+// connection is re-established after minReconnect, then up to maxReconnect intervals
+func NewNotificationWakeUpPostgres(dsn string, channel string, minReconnect, maxReconnect time.Duration) *NotificationWakeUpPostgres {
+	listener := pq.NewListener(dsn, minReconnect, maxReconnect, func(event pq.ListenerEventType, err error) {
+		if err != nil {
+			zlog.Logger.Warn().Err(err).Int("event", int(event)).Msg("postgres wake-up listener connection event")
+		}
+	})
+
+	return &NotificationWakeUpPostgres{
+		listener:    listener,
+		channel:     channel,
+		done:        make(chan struct{}),
+		objectsChan: make(chan *models.WakeUp),
+	}
+}
+
+// StartListening starts the listening, in background
+//
+// after reconnect a wake-up without ID is sent: notices could be missed, so the window must be reloaded
+//
+// Must be called
+func (r *NotificationWakeUpPostgres) StartListening() <-chan *models.WakeUp {
+	go func() {
+		defer close(r.objectsChan)
+
+		// blocks until connected
+		if err := r.listener.Listen(r.channel); err != nil {
+			zlog.Logger.Error().Err(err).Str("channel", r.channel).Msg("couldn't listen to postgres wake-ups")
+			return
+		}
+		zlog.Logger.Info().Str("channel", r.channel).Msg("listening to postgres wake-ups")
+
+		ticker := time.NewTicker(wakeUpListenerPingPeriod)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case notification, ok := <-r.listener.Notify:
+				if !ok {
+					return
+				}
+
+				object, err := r.processNotification(notification)
+				if err != nil {
+					zlog.Logger.Info().Err(err).Msg("error while processing wake-up")
+					continue
+				}
+				select {
+				case r.objectsChan <- object:
+				case <-r.done:
+					return
+				}
+
+			case <-ticker.C:
+				if err := r.listener.Ping(); err != nil {
+					zlog.Logger.Warn().Err(err).Msg("postgres wake-up listener ping failed")
+				}
+			}
+		}
+	}()
+
+	return r.objectsChan
+}
+
+// StopListening closes the connection, wake-ups channel is closed after it
+//
+// Must be called
+func (r *NotificationWakeUpPostgres) StopListening() error {
+	close(r.done)
+	err := r.listener.Close()
+	if err != nil {
+		zlog.Logger.Error().Err(err).Msg("error closing postgres wake-up listener")
+	}
+	return err
+}
+
+// processNotification converts 1 notification from postgres into WakeUp model, nil one means reconnect
+func (r *NotificationWakeUpPostgres) processNotification(notification *pq.Notification) (*models.WakeUp, error) {
+	if notification == nil {
+		return &models.WakeUp{At: time.Now()}, nil
+	}
+	return dto.WakeUpNoticeBytesToEntity([]byte(notification.Extra))
+}
@@ -0,0 +1,192 @@
+package repositories
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/lib/pq"
+	"github.com/wb-go/wbf/dbpg"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+)
+
+const (
+	// pqUniqueViolation is the postgres error code of unique constraint violation
+	pqUniqueViolation = "23505"
+	// pqForeignKeyViolation is the postgres error code of foreign key constraint violation
+	pqForeignKeyViolation = "23503"
+)
+
+// TemplatePostgres implements ports.TemplateStorageRepository
+//
+// Postgres implementation with dbpg.DB
+type TemplatePostgres struct {
+	db       *dbpg.DB
+	strategy retry.Strategy
+}
+
+// NewTemplatePostgres creates a new TemplatePostgres
+func NewTemplatePostgres(db *dbpg.DB, retryStrategy retry.Strategy) *TemplatePostgres {
+	return &TemplatePostgres{db: db, strategy: retryStrategy}
+}
+
+// CreateTemplate is the Create method of this DB CRUD
+//
+// uuid is generated by caller, err ErrTemplateNameTaken if name isn't unique
+func (r *TemplatePostgres) CreateTemplate(ctx context.Context, template *models.Template) error {
+	query := `
+        INSERT INTO delayed_notifier.delayed_notifier.notification_templates (id, name, title, message)
+        VALUES ($1, $2, $3, $4)`
+
+	_, err := r.db.ExecWithRetry(ctx, r.strategy, query, template.ID.String(), template.Name.String(), template.Content.Title.String(), template.Content.Message.String())
+	if err != nil {
+		if isPqError(err, pqUniqueViolation) {
+			return internalerrors.ErrTemplateNameTaken
+		}
+		return err
+	}
+
+	return nil
+}
+
+// UpdateTemplate replaces name, title and message of existing template
+//
+// err ErrTemplateNotFound or ErrTemplateNameTaken
+func (r *TemplatePostgres) UpdateTemplate(ctx context.Context, template *models.Template) error {
+	query := `
+        UPDATE delayed_notifier.delayed_notifier.notification_templates
+        SET name = $1, title = $2, message = $3, updated_at = now()
+        WHERE id = $4`
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, template.Name.String(), template.Content.Title.String(), template.Content.Message.String(), template.ID.String())
+	if err != nil {
+		if isPqError(err, pqUniqueViolation) {
+			return internalerrors.ErrTemplateNameTaken
+		}
+		return err
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return internalerrors.ErrTemplateNotFound
+	}
+	return nil
+}
+
+// GetTemplate retrieves an object by ID, err ErrTemplateNotFound on not found
+func (r *TemplatePostgres) GetTemplate(ctx context.Context, id types.UUID) (*models.Template, error) {
+	query := `SELECT id, name, title, message FROM delayed_notifier.delayed_notifier.notification_templates WHERE id = $1`
+
+	row, err := r.db.QueryRowWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		return nil, fmt.Errorf("error select template by id in postgres: %w", err)
+	}
+
+	var template *models.Template
+	template, err = scanTemplate(row)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, internalerrors.ErrTemplateNotFound
+		}
+		return nil, err
+	}
+
+	return template, nil
+}
+
+// ListTemplates returns all templates ordered by name
+func (r *TemplatePostgres) ListTemplates(ctx context.Context) ([]*models.Template, error) {
+	query := `SELECT id, name, title, message FROM delayed_notifier.delayed_notifier.notification_templates ORDER BY name`
+
+	rows, err := r.db.QueryWithRetry(ctx, r.strategy, query)
+	if err != nil {
+		return nil, fmt.Errorf("error listing templates in postgres: %w", err)
+	}
+
+	defer func(rows *sql.Rows) {
+		if closeErr := rows.Close(); closeErr != nil {
+			zlog.Logger.Error().Err(closeErr).Msg("couldn't close postgres rows when listing templates")
+		}
+	}(rows)
+
+	templates := make([]*models.Template, 0)
+
+	for rows.Next() {
+		var template *models.Template
+		template, err = scanTemplate(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning row in templates list: %w", err)
+		}
+		templates = append(templates, template)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating rows in templates list: %w", err)
+	}
+
+	return templates, nil
+}
+
+// DeleteTemplate deletes a row by ID
+//
+// err ErrTemplateNotFound, ErrTemplateInUse if notifications refer to it
+func (r *TemplatePostgres) DeleteTemplate(ctx context.Context, id types.UUID) error {
+	query := `DELETE FROM delayed_notifier.delayed_notifier.notification_templates WHERE id = $1`
+
+	res, err := r.db.ExecWithRetry(ctx, r.strategy, query, id.String())
+	if err != nil {
+		if isPqError(err, pqForeignKeyViolation) {
+			return internalerrors.ErrTemplateInUse
+		}
+		return err
+	}
+
+	var rowsAffected int64
+	rowsAffected, err = res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("couldn't get number of rows affected: %v", err)
+	}
+
+	if rowsAffected == 0 {
+		return internalerrors.ErrTemplateNotFound
+	}
+	return nil
+}
+
+// scanTemplate reads 1 row of “id, name, title, message“ into a model
+func scanTemplate(row rowScanner) (*models.Template, error) {
+	var idString, name, title, message string
+
+	if err := row.Scan(&idString, &name, &title, &message); err != nil {
+		return nil, err
+	}
+
+	id, err := types.NewUUID(idString)
+	if err != nil {
+		return nil, fmt.Errorf("invalid uuid in postgres: %w", err)
+	}
+
+	return &models.Template{
+		ID:   &id,
+		Name: types.NewAnyText(name),
+		Content: models.NotificationContent{
+			Title:   types.NewAnyText(title),
+			Message: types.NewAnyText(message),
+		},
+	}, nil
+}
+
+// isPqError tells if err is a postgres error with given code
+func isPqError(err error, code pq.ErrorCode) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == code
+}
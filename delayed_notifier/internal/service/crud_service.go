@@ -2,36 +2,67 @@ package service
 
 import (
 	"context"
+	stderrors "errors"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"github.com/wb-go/wbf/zlog"
-	"golang.org/x/sync/errgroup"
 )
 
+// ErrInvalidPatch occurs when patch can't be applied to the notification (e.g. send_to is invalid for its channel)
+var ErrInvalidPatch = stderrors.New("invalid patch")
+
 // SignalFunc is a function that's
 type SignalFunc func(ctx context.Context, notification *models.Notification) error
 
+// Signals combines signals into 1 that calls all of them in order and joins their errors
+func Signals(signals ...SignalFunc) SignalFunc {
+	return func(ctx context.Context, notification *models.Notification) error {
+		errs := make([]error, 0, len(signals))
+		for _, signal := range signals {
+			errs = append(errs, signal(ctx, notification))
+		}
+		return stderrors.Join(errs...)
+	}
+}
+
 // NotificationCRUDService is the service for storing, caching, receiving, updating/deleting notifications
 type NotificationCRUDService struct {
 	storageRepo ports.NotificationCRUDStorageRepository
 	cacheRepo   ports.NotificationCRUDCacheRepository
 
+	// templateRepo is used to check that notification's template can be rendered
+	templateRepo ports.TemplateStorageRepository
+
 	// funcOnCreate is called after CreateNotification
 	//
-	// for example: SenderService.QuickSend
+	// for example: SenderService.Schedule
 	funcOnCreate SignalFunc
+
+	// funcOnUpdate is called after UpdateNotification
+	//
+	// for example: SenderService.Schedule
+	funcOnUpdate SignalFunc
+
+	// funcOnCancel is called after CancelNotification and after DeleteNotification of a scheduled notification
+	//
+	// for example: Signals(SenderService.Unschedule, SenderService.MaterialiseNext), so that cancelling an occurrence only skips it
+	funcOnCancel SignalFunc
 }
 
 // NewNotificationCRUDService creates a new NotificationCRUDService with given adapters (storage, cache)
 func NewNotificationCRUDService(
 	storageRepo ports.NotificationCRUDStorageRepository,
 	cacheRepo ports.NotificationCRUDCacheRepository,
+	templateRepo ports.TemplateStorageRepository,
 	funcOnCreate SignalFunc,
+	funcOnUpdate SignalFunc,
+	funcOnCancel SignalFunc,
 ) *NotificationCRUDService {
-	return &NotificationCRUDService{storageRepo: storageRepo, cacheRepo: cacheRepo, funcOnCreate: funcOnCreate}
+	return &NotificationCRUDService{storageRepo: storageRepo, cacheRepo: cacheRepo, templateRepo: templateRepo, funcOnCreate: funcOnCreate, funcOnUpdate: funcOnUpdate, funcOnCancel: funcOnCancel}
 }
 
 // CreateNotification saves a new notification
@@ -41,11 +72,18 @@ func NewNotificationCRUDService(
 // 1. This mutates the model
 //
 // 2. This returns the model back
+//
+// returns ErrInvalidTemplateVariables if its template can't be rendered
 func (s *NotificationCRUDService) CreateNotification(ctx context.Context, model *models.Notification) (*models.Notification, error) {
+	err := checkTemplate(ctx, s.templateRepo, model)
+	if err != nil {
+		return nil, err
+	}
+
 	id := types.GenerateUUID()
 	model.ID = &id
 
-	err := s.storageRepo.CreateNotification(ctx, model) // retry is called inside
+	err = s.storageRepo.CreateNotification(ctx, model) // retry is called inside
 	if err != nil {
 		return nil, fmt.Errorf("notification storage failed to create: %v", err)
 	}
@@ -53,15 +91,88 @@ func (s *NotificationCRUDService) CreateNotification(ctx context.Context, model
 	s.tryCacheNotificationInBackground(ctx, model)
 
 	// call signal in bg
-	if s.funcOnCreate != nil {
-		go func(model *models.Notification) {
-			funcErr := s.funcOnCreate(ctx, model)
-			if funcErr != nil {
-				zlog.Logger.Error().Err(funcErr).Msg(fmt.Sprintf("error in funcOnCreate %v", s.funcOnCreate))
+	s.callSignalInBackground(ctx, "funcOnCreate", s.funcOnCreate, model)
+
+	return model, nil
+}
+
+// CreateNotifications saves many notifications at once, e.g. a campaign
+//
+// IDs are generated in service layer, so this mutates the models. Notifications whose template can't be rendered
+// aren't saved and don't get an ID: 1 error (or nil) per model is returned.
+// The last error means that nothing is saved
+func (s *NotificationCRUDService) CreateNotifications(ctx context.Context, batch []*models.Notification) ([]error, error) {
+	itemErrs := checkTemplates(ctx, s.templateRepo, batch)
+
+	valid := make([]*models.Notification, 0, len(batch))
+	for i, model := range batch {
+		if itemErrs[i] == nil {
+			valid = append(valid, model)
+		}
+	}
+
+	ids := make([]types.UUID, len(valid))
+	for i, model := range valid {
+		ids[i] = types.GenerateUUID()
+		model.ID = &ids[i]
+	}
+
+	err := s.storageRepo.CreateNotifications(ctx, valid) // retry is called inside
+	if err != nil {
+		for _, model := range valid {
+			model.ID = nil
+		}
+		return itemErrs, fmt.Errorf("notification storage failed to create batch: %w", err)
+	}
+
+	// 1 goroutine for the whole batch, not 1 per notification
+	if s.funcOnCreate != nil && len(valid) > 0 {
+		go func() {
+			for _, model := range valid {
+				if funcErr := s.funcOnCreate(ctx, model); funcErr != nil {
+					zlog.Logger.Error().Err(funcErr).Stringer("id", model.ID).Msg("error in funcOnCreate of batch")
+				}
 			}
-		}(model)
+		}()
+	}
+
+	return itemErrs, nil
+}
+
+// UpdateNotification applies patch to a scheduled notification
+//
+// storage is checked (not cache) because the status must be fresh
+//
+// returns updated model, errors.ErrNotificationNotEditable if it's too late to edit
+func (s *NotificationCRUDService) UpdateNotification(ctx context.Context, id types.UUID, patch models.NotificationPatch) (*models.Notification, error) {
+	model, err := s.getObjectFromStorage(ctx, id) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("error getting object from storage: %w", err)
+	}
+
+	if !model.Status.IsEditable() {
+		return nil, errors.ErrNotificationNotEditable
 	}
 
+	err = patch.Apply(model)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidPatch, err)
+	}
+
+	// storage checks status once again, atomically
+	err = s.storageRepo.UpdateNotification(ctx, model) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("notification storage failed to update: %w", err)
+	}
+
+	// cache is rewritten right away: old publication_at mustn't be read after we respond
+	if cacheErr := s.cacheRepo.SaveNotification(ctx, model); cacheErr != nil {
+		zlog.Logger.Error().Err(cacheErr).Stringer("id", model.ID).Msg("error rewriting notification in cache")
+	}
+
+	// call signal in bg
+	s.callSignalInBackground(ctx, "funcOnUpdate", s.funcOnUpdate, model)
+
 	return model, nil
 }
 
@@ -82,26 +193,80 @@ func (s *NotificationCRUDService) GetNotification(ctx context.Context, id types.
 	return result, err
 }
 
-// DeleteNotification deletes notification if exists (invalidates cache, affects storage)
+// ListNotifications returns a page of notifications matching filter (storage only, cache is id-based)
+//
+// returns next page cursor, nil if this page is the last one
+func (s *NotificationCRUDService) ListNotifications(ctx context.Context, filter models.NotificationFilter, cursor *models.NotificationCursor, limit int) ([]*models.Notification, *models.NotificationCursor, error) {
+	// fetch 1 extra object to know if there's a next page
+	result, err := s.storageRepo.ListNotifications(ctx, filter, cursor, limit+1) // retry is called inside
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing objects from storage: %w", err)
+	}
+
+	if len(result) <= limit {
+		return result, nil, nil
+	}
+
+	result = result[:limit]
+	return result, models.NotificationCursorFromEntity(result[limit-1]), nil
+}
+
+// DeleteNotification removes notification from storage and cache
+//
+// a scheduled one is cancelled as well (funcOnCancel), so that it isn't published and its series goes on
 //
 // returns error on NotFound or Internal Error
 func (s *NotificationCRUDService) DeleteNotification(ctx context.Context, id types.UUID) error {
-	object, err := s.GetNotification(ctx, id)
+	model, err := s.getObjectFromStorage(ctx, id) // retry is called inside
 	if err != nil {
 		return fmt.Errorf("error checking object existence: %w", err)
 	}
 
-	// just to ensure, lol!
-	if object == nil || object.ID == nil {
-		return errors.ErrNotificationNotFound
+	err = s.storageRepo.DeleteNotification(ctx, id) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("notification storage failed to delete: %w", err)
 	}
 
-	errGroup := &errgroup.Group{}
+	if cacheErr := s.cacheRepo.DeleteNotification(ctx, id); cacheErr != nil {
+		zlog.Logger.Error().Err(cacheErr).Stringer("id", model.ID).Msg("error deleting notification from cache")
+	}
 
-	errGroup.Go(func() error { return s.storageRepo.DeleteNotification(ctx, *object.ID) })
-	errGroup.Go(func() error { return s.cacheRepo.DeleteNotification(ctx, *object.ID) })
+	if model.Status.IsEditable() {
+		// call signal in bg
+		s.callSignalInBackground(ctx, "funcOnCancel", s.funcOnCancel, model)
+	}
 
-	return errGroup.Wait()
+	return nil
+}
+
+// CancelNotification moves notification into cancelled status (it stays in storage, so its status can be read later)
+//
+// returns error on NotFound, errors.ErrInvalidStatusTransition if it's too late to cancel, or Internal Error
+func (s *NotificationCRUDService) CancelNotification(ctx context.Context, id types.UUID) error {
+	model, err := s.getObjectFromStorage(ctx, id) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("error getting object from storage: %w", err)
+	}
+
+	if !model.Status.CanTransitionTo(internaltypes.StatusCancelled) {
+		return fmt.Errorf("%w: '%s' -> '%s'", errors.ErrInvalidStatusTransition, model.Status, internaltypes.StatusCancelled)
+	}
+
+	// storage checks status once again, atomically
+	err = s.storageRepo.UpdateStatus(ctx, id, internaltypes.StatusCancelled) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("notification storage failed to cancel: %w", err)
+	}
+
+	model.Status = internaltypes.StatusCancelled
+	if cacheErr := s.cacheRepo.SaveNotification(ctx, model); cacheErr != nil {
+		zlog.Logger.Error().Err(cacheErr).Stringer("id", model.ID).Msg("error rewriting notification in cache")
+	}
+
+	// call signal in bg
+	s.callSignalInBackground(ctx, "funcOnCancel", s.funcOnCancel, model)
+
+	return nil
 }
 
 // PRIVATE METHODS
@@ -114,6 +279,19 @@ func (s *NotificationCRUDService) getObjectFromCache(ctx context.Context, id typ
 	return s.cacheRepo.GetNotification(ctx, id)
 }
 
+// callSignalInBackground launches signal (if set) in the background, logs on error
+func (s *NotificationCRUDService) callSignalInBackground(ctx context.Context, name string, signal SignalFunc, model *models.Notification) {
+	if signal == nil {
+		return
+	}
+	go func(model *models.Notification) {
+		funcErr := signal(ctx, model)
+		if funcErr != nil {
+			zlog.Logger.Error().Err(funcErr).Msg(fmt.Sprintf("error in %s %v", name, signal))
+		}
+	}(model)
+}
+
 // tryCacheNotificationInBackground launches cache SET in the background, logs on error
 func (s *NotificationCRUDService) tryCacheNotificationInBackground(ctx context.Context, model *models.Notification) {
 	go func() {
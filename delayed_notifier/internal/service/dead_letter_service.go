@@ -0,0 +1,120 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// DeadLetterService is the service for inspecting, replaying and purging notifications that failed for good
+//
+// dead letters are written by storage when SenderService runs out of publish attempts
+// or DeliveryResultService records a failed delivery
+type DeadLetterService struct {
+	storageRepo ports.DeadLetterRepository
+	cacheRepo   ports.NotificationCRUDCacheRepository
+
+	// funcOnReplay is called for every rescheduled notification
+	//
+	// for example: SenderService.Schedule
+	funcOnReplay SignalFunc
+}
+
+// NewDeadLetterService creates a new DeadLetterService
+func NewDeadLetterService(storageRepo ports.DeadLetterRepository, cacheRepo ports.NotificationCRUDCacheRepository,
+	funcOnReplay SignalFunc) *DeadLetterService {
+	return &DeadLetterService{storageRepo: storageRepo, cacheRepo: cacheRepo, funcOnReplay: funcOnReplay}
+}
+
+// ListDeadLetters returns a page of dead letters matching filter
+//
+// returns next page cursor, nil if this page is the last one
+func (s *DeadLetterService) ListDeadLetters(ctx context.Context, filter models.DeadLetterFilter, cursor *models.DeadLetterCursor, limit int) ([]*models.DeadLetter, *models.DeadLetterCursor, error) {
+	// fetch 1 extra object to know if there's a next page
+	result, err := s.storageRepo.ListDeadLetters(ctx, filter, cursor, limit+1) // retry is called inside
+	if err != nil {
+		return nil, nil, fmt.Errorf("error listing dead letters from storage: %w", err)
+	}
+
+	if len(result) <= limit {
+		return result, nil, nil
+	}
+
+	result = result[:limit]
+	return result, models.DeadLetterCursorFromEntity(result[limit-1]), nil
+}
+
+// GetDeadLetter returns dead letter by id
+func (s *DeadLetterService) GetDeadLetter(ctx context.Context, id types.UUID) (*models.DeadLetter, error) {
+	return s.storageRepo.GetDeadLetter(ctx, id)
+}
+
+// ReplayDeadLetter removes dead letter and schedules its notification again
+//
+// returns errors.ErrDeadLetterNotFound or errors.ErrInvalidStatusTransition if notification isn't failed anymore
+func (s *DeadLetterService) ReplayDeadLetter(ctx context.Context, id types.UUID) (*models.Notification, error) {
+	replayed, err := s.storageRepo.ReplayDeadLetter(ctx, id) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("dead letter storage failed to replay: %w", err)
+	}
+
+	s.afterReplay(ctx, replayed)
+	return replayed, nil
+}
+
+// ReplayDeadLetters removes dead letters matching filter and schedules their notifications again
+//
+// returns amount of rescheduled notifications
+func (s *DeadLetterService) ReplayDeadLetters(ctx context.Context, filter models.DeadLetterFilter) (int, error) {
+	replayed, err := s.storageRepo.ReplayDeadLetters(ctx, filter) // retry is called inside
+	if err != nil {
+		return 0, fmt.Errorf("dead letter storage failed to replay: %w", err)
+	}
+
+	s.afterReplay(ctx, replayed...)
+	return len(replayed), nil
+}
+
+// DeleteDeadLetter removes 1 dead letter, its notification stays failed
+func (s *DeadLetterService) DeleteDeadLetter(ctx context.Context, id types.UUID) error {
+	err := s.storageRepo.DeleteDeadLetter(ctx, id) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("dead letter storage failed to delete: %w", err)
+	}
+	return nil
+}
+
+// PurgeDeadLetters removes dead letters matching filter, their notifications stay failed
+//
+// returns amount of removed ones
+func (s *DeadLetterService) PurgeDeadLetters(ctx context.Context, filter models.DeadLetterFilter) (int64, error) {
+	purged, err := s.storageRepo.PurgeDeadLetters(ctx, filter) // retry is called inside
+	if err != nil {
+		return 0, fmt.Errorf("dead letter storage failed to purge: %w", err)
+	}
+	return purged, nil
+}
+
+// afterReplay invalidates cached failed status and calls funcOnReplay in the background, logs on error
+func (s *DeadLetterService) afterReplay(ctx context.Context, replayed ...*models.Notification) {
+	if len(replayed) == 0 {
+		return
+	}
+
+	go func() {
+		for _, model := range replayed {
+			if cacheErr := s.cacheRepo.DeleteNotification(ctx, *model.ID); cacheErr != nil {
+				zlog.Logger.Error().Err(cacheErr).Stringer("id", model.ID).Msg("error deleting notification from cache")
+			}
+			if s.funcOnReplay == nil {
+				continue
+			}
+			if funcErr := s.funcOnReplay(ctx, model); funcErr != nil {
+				zlog.Logger.Error().Err(funcErr).Stringer("id", model.ID).Msg("error in funcOnReplay")
+			}
+		}
+	}()
+}
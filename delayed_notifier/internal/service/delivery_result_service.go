@@ -0,0 +1,112 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/wb-go/wbf/retry"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// DeliveryResultService receives delivery results from workers and saves them next to notifications
+//
+//	go service.Run(ctx)
+type DeliveryResultService struct {
+	receiver    ports.DeliveryResultReceiver
+	storageRepo ports.DeliveryResultStorageRepository
+	cacheRepo   ports.NotificationCRUDCacheRepository
+
+	// raceRetryStrategy is used when result came before notification was marked as queued
+	//
+	// SenderService marks them in background, right after publishing, so worker may be faster
+	raceRetryStrategy retry.Strategy
+}
+
+// NewDeliveryResultService creates a new DeliveryResultService
+func NewDeliveryResultService(receiver ports.DeliveryResultReceiver, storageRepo ports.DeliveryResultStorageRepository,
+	cacheRepo ports.NotificationCRUDCacheRepository, raceRetryStrategy retry.Strategy) *DeliveryResultService {
+	return &DeliveryResultService{
+		receiver:          receiver,
+		storageRepo:       storageRepo,
+		cacheRepo:         cacheRepo,
+		raceRetryStrategy: raceRetryStrategy,
+	}
+}
+
+// Run is the main blocking method. It records results until ctx is done
+func (s *DeliveryResultService) Run(ctx context.Context) {
+	results := s.receiver.StartReceiving(ctx)
+	defer func() {
+		if err := s.receiver.StopReceiving(); err != nil {
+			zlog.Logger.Error().Err(err).Msg("error stopping delivery result receiver")
+		}
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case result, ok := <-results:
+			if !ok {
+				return
+			}
+			s.recordResult(ctx, result)
+		}
+	}
+}
+
+// recordResult saves 1 result, invalidates cache, logs on error
+//
+// result's message is acked once result is recorded or never can be, otherwise it's requeued
+func (s *DeliveryResultService) recordResult(ctx context.Context, result *models.DeliveryResult) {
+	// only the race is retried here, any other error is final
+	var finalErr error
+	err := retry.Do(
+		func() error {
+			finalErr = s.storageRepo.RecordDeliveryResult(ctx, result) // retry on DB errors is called inside
+			if stderrors.Is(finalErr, errors.ErrInvalidStatusTransition) {
+				return finalErr
+			}
+			return nil
+		},
+		s.raceRetryStrategy,
+	)
+	if err == nil {
+		err = finalErr
+	}
+	if err != nil {
+		// a notification that is gone or isn't queued won't accept this result ever
+		final := stderrors.Is(err, errors.ErrNotificationNotFound) || stderrors.Is(err, errors.ErrInvalidStatusTransition)
+
+		event := zlog.Logger.Error()
+		if final {
+			event = zlog.Logger.Warn()
+		}
+		event.Err(err).Stringer("id", result.ID).Stringer("status", result.Status).Msg("couldn't record delivery result")
+
+		settleResult(result, !final)
+		return
+	}
+
+	// cache holds the old status, next read must go to storage
+	if cacheErr := s.cacheRepo.DeleteNotification(ctx, result.ID); cacheErr != nil {
+		zlog.Logger.Error().Err(cacheErr).Stringer("id", result.ID).Msg("error deleting notification from cache")
+	}
+
+	settleResult(result, false)
+}
+
+// settleResult acks or requeues the message of result, if it came with one
+func settleResult(result *models.DeliveryResult, requeue bool) {
+	if result.Message == nil {
+		return
+	}
+
+	if requeue {
+		result.Message.Requeue()
+		return
+	}
+	result.Message.Ack()
+}
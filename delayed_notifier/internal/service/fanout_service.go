@@ -0,0 +1,111 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// FanOutService is the service for notifications sent to many recipients
+//
+// a parent is expanded into 1 usual notification (delivery) per recipient, they're sent and tracked individually
+type FanOutService struct {
+	parentRepo ports.NotificationParentRepository
+	cacheRepo  ports.NotificationCRUDCacheRepository
+
+	// templateRepo is used to check that deliveries' template can be rendered
+	templateRepo ports.TemplateStorageRepository
+
+	// funcOnCreate is called with every delivery after CreateParent
+	//
+	// for example: SenderService.Schedule
+	funcOnCreate SignalFunc
+}
+
+// NewFanOutService creates a new FanOutService
+func NewFanOutService(parentRepo ports.NotificationParentRepository, cacheRepo ports.NotificationCRUDCacheRepository,
+	templateRepo ports.TemplateStorageRepository, funcOnCreate SignalFunc) *FanOutService {
+	return &FanOutService{parentRepo: parentRepo, cacheRepo: cacheRepo, templateRepo: templateRepo, funcOnCreate: funcOnCreate}
+}
+
+// CreateParent saves a new fan-out notification and 1 delivery per its recipient
+//
+// IDs are generated in service layer, so this mutates the model: ID and StatusCounts are assigned
+//
+// returns ErrInvalidTemplateVariables if template can't be rendered for any recipient's channel
+func (s *FanOutService) CreateParent(ctx context.Context, parent *models.NotificationParent) (*models.NotificationParent, error) {
+	parentID := types.GenerateUUID()
+
+	deliveries := make([]*models.Notification, len(parent.Recipients))
+	checkedChannels := make(map[internaltypes.NotificationChannel]bool)
+
+	for i, recipient := range parent.Recipients {
+		id := types.GenerateUUID()
+		deliveries[i] = &models.Notification{
+			ID:            &id,
+			PublicationAt: parent.PublicationAt,
+			Channel:       recipient.Channel,
+			Content:       parent.Content,
+			Status:        internaltypes.StatusScheduled,
+			SendTo:        recipient.SendTo,
+			Template:      parent.Template,
+			ParentID:      &parentID,
+		}
+
+		// template is rendered differently for every channel, but not for every address
+		if !checkedChannels[recipient.Channel] {
+			if err := checkTemplate(ctx, s.templateRepo, deliveries[i]); err != nil {
+				return nil, err
+			}
+			checkedChannels[recipient.Channel] = true
+		}
+	}
+
+	parent.ID = &parentID
+	err := s.parentRepo.CreateParent(ctx, parent, deliveries) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("fan-out storage failed to create: %w", err)
+	}
+
+	parent.StatusCounts = map[internaltypes.NotificationStatus]int{internaltypes.StatusScheduled: len(deliveries)}
+
+	if s.funcOnCreate != nil {
+		go func() {
+			for _, delivery := range deliveries {
+				if funcErr := s.funcOnCreate(ctx, delivery); funcErr != nil {
+					zlog.Logger.Error().Err(funcErr).Stringer("id", delivery.ID).Msg("error in funcOnCreate of fan-out delivery")
+				}
+			}
+		}()
+	}
+
+	return parent, nil
+}
+
+// GetParent returns fan-out notification with statuses of its deliveries
+func (s *FanOutService) GetParent(ctx context.Context, id types.UUID) (*models.NotificationParent, error) {
+	return s.parentRepo.GetParent(ctx, id)
+}
+
+// CancelParent cancels every delivery that is still scheduled
+//
+// returns errors.ErrParentNotFound or Internal Error
+func (s *FanOutService) CancelParent(ctx context.Context, id types.UUID) error {
+	cancelled, err := s.parentRepo.CancelParent(ctx, id)
+	if err != nil {
+		return fmt.Errorf("fan-out storage failed to cancel: %w", err)
+	}
+
+	// cached deliveries have old status
+	for _, cancelledID := range cancelled {
+		if cacheErr := s.cacheRepo.DeleteNotification(ctx, *cancelledID); cacheErr != nil {
+			zlog.Logger.Error().Err(cacheErr).Stringer("id", cancelledID).Msg("error deleting notification from cache")
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,122 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	stderrors "errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// MaxIdempotencyKeyLength is the max length of Idempotency-Key
+const MaxIdempotencyKeyLength = 255
+
+var (
+	// ErrInvalidIdempotencyKey occurs when key is too long
+	ErrInvalidIdempotencyKey = fmt.Errorf("idempotency key must be 1 to %d characters long", MaxIdempotencyKeyLength)
+	// ErrIdempotencyKeyReused occurs when key is repeated with a different request
+	ErrIdempotencyKeyReused = stderrors.New("idempotency key is already used with a different request")
+	// ErrIdempotencyKeyInProgress occurs when key is repeated while the first request isn't finished yet
+	ErrIdempotencyKeyInProgress = stderrors.New("request with this idempotency key is still in progress")
+)
+
+// IdempotencyService makes requests with the same idempotency key be performed once
+//
+// the first response is saved and replayed on repeated requests until key expires
+//
+//	go service.Run(ctx) // deletes expired keys
+type IdempotencyService struct {
+	repo ports.IdempotencyRepository
+	ttl  time.Duration
+}
+
+// NewIdempotencyService creates a new IdempotencyService, keys are kept for ttl
+func NewIdempotencyService(repo ports.IdempotencyRepository, ttl time.Duration) *IdempotencyService {
+	return &IdempotencyService{repo: repo, ttl: ttl}
+}
+
+// Begin claims key for request
+//
+// returns nil if request must be performed (then call Complete or Release), saved response if it's a repeated one.
+// Errors: ErrInvalidIdempotencyKey, ErrIdempotencyKeyReused, ErrIdempotencyKeyInProgress or Internal Error
+func (s *IdempotencyService) Begin(ctx context.Context, key string, request any) (*models.IdempotentResponse, error) {
+	if len(key) == 0 || len(key) > MaxIdempotencyKeyLength {
+		return nil, ErrInvalidIdempotencyKey
+	}
+
+	hash, err := requestHash(request)
+	if err != nil {
+		return nil, err
+	}
+
+	claimed, record, err := s.repo.ClaimKey(ctx, key, hash, s.ttl) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("idempotency storage failed to claim: %w", err)
+	}
+
+	switch {
+	case claimed:
+		return nil, nil
+	case record == nil:
+		// the first request has just failed and released the key
+		return nil, ErrIdempotencyKeyInProgress
+	case record.RequestHash != hash:
+		return nil, ErrIdempotencyKeyReused
+	case record.Response == nil:
+		return nil, ErrIdempotencyKeyInProgress
+	default:
+		return record.Response, nil
+	}
+}
+
+// Complete saves response of a claimed key
+func (s *IdempotencyService) Complete(ctx context.Context, key string, response *models.IdempotentResponse) error {
+	return s.repo.SaveResponse(ctx, key, response)
+}
+
+// Release frees a claimed key after a failed request, so that it may be retried
+func (s *IdempotencyService) Release(ctx context.Context, key string) error {
+	return s.repo.ReleaseKey(ctx, key)
+}
+
+// Run is the main blocking method. It deletes expired keys every ttl until ctx is done
+func (s *IdempotencyService) Run(ctx context.Context) {
+	if s.ttl <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(s.ttl)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			deleted, err := s.repo.DeleteExpired(ctx)
+			if err != nil {
+				zlog.Logger.Error().Err(err).Msg("error deleting expired idempotency keys")
+				continue
+			}
+			zlog.Logger.Debug().Int64("deleted", deleted).Msg("expired idempotency keys deleted")
+		}
+	}
+}
+
+// requestHash returns sha256 of request marshalled into JSON
+//
+// parsed request is hashed, not raw body, so that formatting and keys order don't matter
+func requestHash(request any) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", fmt.Errorf("couldn't marshal request: %w", err)
+	}
+
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
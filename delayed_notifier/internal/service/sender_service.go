@@ -3,186 +3,563 @@ package service
 import (
 	"context"
 	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
-	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/dlq"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/timerheap"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"github.com/wb-go/wbf/zlog"
 	"golang.org/x/sync/errgroup"
+	"golang.org/x/sync/semaphore"
+	"slices"
 	"time"
 )
 
-// SenderService performs the background operations of sending notifications to workers when datetime.now() is close to their publication_at
+// SenderService performs the background operations of sending notifications to workers at their publication_at
 //
-//	  go service.Run(ctx)
-//	  ... // somewhere
-//	  if notification.PublicationAt < service.WhenNextFetch() {
-//		   service.QuickSend(ctx, notification)
-//	  }
+// notifications of the near-term window (fetchMaxDiapason) are kept in a timer heap, service wakes up exactly at
+// their time and publishes everything that's due. The window is reloaded every fetchPeriod.
+// With publishAhead, "their time" is publishAhead earlier and the broker delays them the rest of the way
+//
+//	go service.Run(ctx)
+//	... // somewhere
+//	service.Schedule(ctx, notification) // created or updated
+//	service.Unschedule(ctx, notification) // cancelled
 type SenderService struct {
 	fetchPeriod      time.Duration
 	fetchMaxDiapason time.Duration
 
+	// expireAfter is how late a notification may be sent, older ones become expired
+	//
+	// 0 = never expire
+	expireAfter time.Duration
+
+	// publishAhead is how long before publication_at notifications are published, so the broker holds them
+	// until their time. They can't be cancelled after that
+	//
+	// 0 = publish at publication_at
+	publishAhead time.Duration
+
+	// instanceID is the lease owner of fetched notifications, must be unique among running instances
+	instanceID string
+
+	// leaseDuration is how long fetched notifications belong to this instance
+	//
+	// if it dies mid-batch, another one reclaims them after that. Must be longer than sending a batch
+	leaseDuration time.Duration
+
+	// publishBackoff is the delay before failed publishes are fetched again
+	publishBackoff models.PublishBackoff
+
+	// paging bounds the amount of fetched notifications
+	paging FetchPaging
+
 	// publisherRepo publishes a notification or a batch into MQ
 	publisherRepo ports.NotificationPublisherRepository
 
-	// storageFetcherRepo fetches a batch of to-send notifications on request, service should query it in advance
-	//
-	// returns datetime for next fetch to be performed
+	// storageFetcherRepo fetches wake-ups of the near-term window and claims due notifications
 	storageFetcherRepo ports.NotificationFetcherRepository
 
-	// nextFetchIsAt is just for other services to know when will we wake up and gather notifications again
-	nextFetchIsAt time.Time
+	// seriesRepo creates next occurrences of recurring notifications after previous ones are sent
+	seriesRepo ports.NotificationSeriesRepository
+
+	// templateRepo gives template sources to attach to notifications, worker renders them
+	templateRepo ports.TemplateStorageRepository
+
+	// wakeUpListener tells about notifications created or updated by any replica, nil = only Schedule is used
+	wakeUpListener ports.NotificationWakeUpListener
+
+	// wakeUps are publication datetimes of the near-term window by notification ID
+	//
+	// a stale one (e.g. notification is sent by another instance) only wakes service up for nothing
+	wakeUps *timerheap.TimerHeap[types.UUID]
+
+	// windowEdge is the last loaded wake-up if the window didn't fit into MaxScheduled, the window is reloaded at it.
+	// It's used by Run goroutine only
+	windowEdge *types.UUID
+}
+
+// FetchPaging tells how SenderService fetches due notifications: by pages of BatchSize until there's none,
+// sending up to MaxConcurrentPages of them at a time and holding up to MaxInFlight fetched but not sent notifications
+//
+// MaxScheduled is the amount of wake-ups loaded from the near-term window at a time
+type FetchPaging struct {
+	BatchSize          int
+	MaxConcurrentPages int
+	MaxInFlight        int
+	MaxScheduled       int
+}
+
+// normalized returns paging with positive values, MaxInFlight fits at least 1 page
+func (p FetchPaging) normalized() FetchPaging {
+	p.BatchSize = max(p.BatchSize, 1)
+	p.MaxConcurrentPages = max(p.MaxConcurrentPages, 1)
+	p.MaxInFlight = max(p.MaxInFlight, p.BatchSize)
+	p.MaxScheduled = max(p.MaxScheduled, 1)
+	return p
 }
 
 // NewSenderService creates a new SenderService
-func NewSenderService(fetchPeriod time.Duration, fetchMaxDiapason time.Duration,
-	publisher ports.NotificationPublisherRepository, fetcher ports.NotificationFetcherRepository) *SenderService {
+func NewSenderService(fetchPeriod time.Duration, fetchMaxDiapason time.Duration, expireAfter time.Duration,
+	publishAhead time.Duration, instanceID string, leaseDuration time.Duration, publishBackoff models.PublishBackoff, paging FetchPaging,
+	publisher ports.NotificationPublisherRepository, fetcher ports.NotificationFetcherRepository,
+	series ports.NotificationSeriesRepository, templates ports.TemplateStorageRepository,
+	wakeUpListener ports.NotificationWakeUpListener) *SenderService {
 	return &SenderService{
 		fetchPeriod:        fetchPeriod,
 		fetchMaxDiapason:   fetchMaxDiapason,
+		expireAfter:        expireAfter,
+		publishAhead:       max(publishAhead, 0),
+		instanceID:         instanceID,
+		leaseDuration:      leaseDuration,
+		publishBackoff:     publishBackoff,
+		paging:             paging.normalized(),
 		publisherRepo:      publisher,
 		storageFetcherRepo: fetcher,
+		seriesRepo:         series,
+		templateRepo:       templates,
+		wakeUpListener:     wakeUpListener,
+		wakeUps:            timerheap.New[types.UUID](),
 	}
 }
 
-// Run is the main blocking method. It tracks
+// Run is the main blocking method. It sleeps until the earliest wake-up and publishes due notifications,
+// reloading the near-term window every fetchPeriod
+//
+// wake-ups of other replicas come from wakeUpListener
 func (s *SenderService) Run(ctx context.Context) {
 	ticker := time.NewTicker(s.fetchPeriod)
 	defer ticker.Stop()
 
+	var notices <-chan *models.WakeUp
+	if s.wakeUpListener != nil {
+		notices = s.wakeUpListener.StartListening()
+		defer func() {
+			if err := s.wakeUpListener.StopListening(); err != nil {
+				zlog.Logger.Error().Err(err).Msg("error stopping wake-up listener")
+			}
+		}()
+	}
+
+	timer := time.NewTimer(s.fetchPeriod)
+	defer timer.Stop()
+
 	s.lifeCycle(ctx)
 
-out:
 	for {
+		// re-plan: wake-ups may have been added while sending
+		wait := s.fetchPeriod
+		if next, ok := s.wakeUps.Next(); ok {
+			wait = min(wait, time.Until(next))
+		}
+		timer.Reset(max(wait, 0))
+
 		select {
 		case <-ctx.Done():
-			break out
+			return
 		case <-ticker.C:
 			s.lifeCycle(ctx)
+		case <-timer.C:
+			s.wakeUp(ctx)
+		case <-s.wakeUps.Changed():
+		case notice, ok := <-notices:
+			if !ok {
+				notices = nil
+				continue
+			}
+			s.onNotice(ctx, notice)
 		}
 	}
 }
 
+// Schedule plans publishing of object at its publication_at, it's a SignalFunc for create and update
+//
+// objects out of the near-term window are loaded by Run later, not scheduled ones are unscheduled
+func (s *SenderService) Schedule(ctx context.Context, object *models.Notification) error {
+	if object.ID == nil {
+		return nil
+	}
+	if !object.Status.CanTransitionTo(internaltypes.StatusQueued) {
+		return s.Unschedule(ctx, object)
+	}
+
+	return s.plan(ctx, *object.ID, object.PublicationAt.Value())
+}
+
+// plan sets wake-up of id at if it's in the near-term window, removes it otherwise (it could be moved out by update)
+//
+// planned ones are indexed by fetcher, so they're fetched at their wake-up by any instance
+func (s *SenderService) plan(ctx context.Context, id types.UUID, at time.Time) error {
+	if s.wakeAt(at).After(time.Now().Add(s.fetchMaxDiapason)) {
+		s.wakeUps.Remove(id)
+		return nil
+	}
+	s.wakeUps.Set(id, s.wakeAt(at))
+
+	if err := s.storageFetcherRepo.Index(ctx, []*models.WakeUp{{ID: &id, At: at}}); err != nil {
+		return fmt.Errorf("failed to index wake-up of '%s': %w", id, err)
+	}
+	return nil
+}
+
+// onNotice re-plans after a wake-up notice, the one without ID reloads the window if it's near-term
+func (s *SenderService) onNotice(ctx context.Context, notice *models.WakeUp) {
+	if notice.ID != nil {
+		if err := s.plan(ctx, *notice.ID, notice.At); err != nil {
+			zlog.Logger.Error().Err(err).Msg("error in SenderService loop")
+		}
+		return
+	}
+	if !s.wakeAt(notice.At).After(time.Now().Add(s.fetchMaxDiapason)) {
+		s.lifeCycle(ctx)
+	}
+}
+
+// wakeAt returns when a notification due at publicationAt is published
+func (s *SenderService) wakeAt(publicationAt time.Time) time.Time {
+	return publicationAt.Add(-s.publishAhead)
+}
+
+// Unschedule cancels planned publishing of object, it's a SignalFunc for cancel
+func (s *SenderService) Unschedule(_ context.Context, object *models.Notification) error {
+	if object.ID != nil {
+		s.wakeUps.Remove(*object.ID)
+	}
+	return nil
+}
+
 // QuickSend sends 1 notification
 //
 // should be called when an ASAP notification is created (it's publication datetime is too close to “now()“)
+//
+// it's claimed first, so if another instance has already fetched it, nothing is sent.
+// It's marked as queued only if publish succeeds, otherwise it's retried later
 func (s *SenderService) QuickSend(ctx context.Context, object *models.Notification) error {
-	err := s.publisherRepo.SendOne(ctx, object) // it calls retry inside!
-	go func() {
-		errMark := s.storageFetcherRepo.MarkAsSent(ctx, []*types.UUID{object.ID})
-		if errMark != nil {
-			zlog.Logger.Error().Err(errMark).Msg("failed to mark as sent")
-		}
-	}()
-	return err
+	if !object.Status.CanTransitionTo(internaltypes.StatusQueued) {
+		return fmt.Errorf("%w: '%s' -> '%s'", errors.ErrInvalidStatusTransition, object.Status, internaltypes.StatusQueued)
+	}
+
+	claimed, err := s.storageFetcherRepo.Claim(ctx, *object.ID, s.instanceID, s.leaseDuration)
+	if err != nil {
+		return fmt.Errorf("failed to claim notification: %w", err)
+	}
+	if !claimed {
+		zlog.Logger.Info().Stringer("id", object.ID).Msg("notification is claimed by another instance, skipping")
+		return nil
+	}
+
+	attachTemplateSources(ctx, s.templateRepo, []*models.Notification{object})
+
+	err = s.publisherRepo.SendOne(ctx, object) // it calls retry inside!
+	if err != nil {
+		s.returnToPending(ctx, []*models.PublishFailure{{ID: object.ID, Error: err}})
+		return err
+	}
+
+	s.markPublished(ctx, []*models.Notification{object})
+	return nil
 }
 
 // SendBatch sends given notifications as a batch
 //
 // # SendBatch is called regularly in Run
 //
+// only confirmed publishes are marked as queued, failed ones return to pending and are fetched again after backoff
+// until their attempts run out, then they're dead-lettered.
+//
 // might be rea-a-lly long call!
 func (s *SenderService) SendBatch(ctx context.Context, objects []*models.Notification) error {
+	attachTemplateSources(ctx, s.templateRepo, objects)
+
 	dlqNotifications := s.publisherRepo.SendMany(ctx, objects) // it calls retry inside!
 
-	var err error
-	errGroup := &errgroup.Group{}
-	errorsAmount := 0
+	// DLQ is closed after the last publish, so everything not in it is confirmed
+	failures := make([]*models.PublishFailure, 0)
+	failed := make(map[types.UUID]struct{})
+	for obj := range dlqNotifications.Items() {
+		zlog.Logger.Error().
+			Err(obj.Error()).
+			Stringer("id", obj.Value().ID).
+			Msg("failed to send object, it'll be retried later")
 
-	// Mark all as sent
-	// TODO: de-mark failed ones
-	go func() {
-		ids := make([]*types.UUID, len(objects))
-		for i, object := range objects {
-			ids[i] = object.ID
-		}
-		err = s.storageFetcherRepo.MarkAsSent(ctx, ids)
-		if err != nil {
-			zlog.Logger.Error().Err(err).Msg("failed to mark as sent")
+		failures = append(failures, &models.PublishFailure{ID: obj.Value().ID, Error: obj.Error()})
+		failed[*obj.Value().ID] = struct{}{}
+	}
+
+	published := make([]*models.Notification, 0, len(objects)-len(failures))
+	for _, object := range objects {
+		if _, isFailed := failed[*object.ID]; !isFailed {
+			published = append(published, object)
 		}
-	}()
+	}
 
-	// if bad, then retry each one
-	//
-	// ... each one with retries!
-	//
-	// So each one is in separate goroutine
-	for obj := range dlqNotifications.Items() {
-		errorsAmount++
+	s.markPublished(ctx, published)
+	s.returnToPending(ctx, failures)
+
+	if len(failures) > 0 {
+		return fmt.Errorf("failed to send '%d' objects, example err: %w", len(failures), failures[0].Error)
+	}
+	return nil
+}
+
+// markPublished moves confirmed publishes into queued, then materialises next occurrences of their series
+//
+// if marking fails, they're published again after the lease expires (at-least-once).
+// If materialising fails or is interrupted, the series is resumed by lifeCycle later
+func (s *SenderService) markPublished(ctx context.Context, objects []*models.Notification) {
+	if len(objects) == 0 {
+		return
+	}
 
-		errGroup.Go(func() error {
+	ids := make([]*types.UUID, len(objects))
+	for i, object := range objects {
+		ids[i] = object.ID
+	}
+	_, err := s.storageFetcherRepo.ChangeStatus(ctx, ids, internaltypes.StatusQueued)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int("amount", len(ids)).Msg("failed to mark as queued")
+	}
 
-			return func(obj *dlq.Item[*models.Notification]) error {
+	go s.materialiseNextOccurrences(ctx, objects)
+}
 
-				zlog.Logger.Error().
-					Err(obj.Error()).
-					Stringer("id", obj.Value().ID).
-					Msg("failed to send object, trying to resend...")
+// returnToPending gives failed publishes back to storage, they're fetched again after backoff
+//
+// the ones that run out of publishBackoff.MaxAttempts are failed and dead-lettered by storage instead, so they aren't lost.
+// If it fails, they're reclaimed after the lease expires
+func (s *SenderService) returnToPending(ctx context.Context, failures []*models.PublishFailure) {
+	if len(failures) == 0 {
+		return
+	}
 
-				err = s.QuickSend(ctx, obj.Value())
-				if err != nil {
-					zlog.Logger.Error().
-						Err(obj.Error()).
-						Stringer("id", obj.Value().ID).
-						Any("object", obj.Value()).
-						Msg("failed to send object!")
+	returned, err := s.storageFetcherRepo.ReturnToPending(ctx, failures, s.instanceID, s.publishBackoff)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int("amount", len(failures)).Msg("failed to return to pending")
+		return
+	}
+	zlog.Logger.Warn().Int64("amount", returned).Msg("returned failed publishes to pending")
+	if notReturned := int64(len(failures)) - returned; notReturned > 0 {
+		zlog.Logger.Error().Int64("amount", notReturned).Msg("failed publishes weren't returned: they're dead-lettered or reclaimed by another instance")
+	}
+}
 
-					return err
-				}
+// MaterialiseNext creates next occurrence of object's series, it's an example SignalFunc too
+//
+// does nothing if object isn't an occurrence or its series is over/stopped
+//
+// missed occurrences (e.g. service was down) are skipped: next one is the first after max(publication_at, now).
+// It copies object's content, so edits of an occurrence are carried forward
+func (s *SenderService) MaterialiseNext(ctx context.Context, object *models.Notification) error {
+	if object.SeriesID == nil {
+		return nil
+	}
 
-				zlog.Logger.Info().
-					Stringer("id", obj.Value().ID).
-					Msg("successfully sent object on second try!")
+	series, err := s.seriesRepo.GetSeries(ctx, *object.SeriesID)
+	if err != nil {
+		return fmt.Errorf("failed to get series '%s': %w", object.SeriesID, err)
+	}
+	if series.IsStopped() {
+		return nil
+	}
 
-				return nil
-			}(obj)
-		})
+	after := object.PublicationAt.Value()
+	if now := time.Now(); now.After(after) {
+		after = now
+	}
+
+	nextPublicationAt, ok := series.Rule.Next(after, object.Occurrence)
+	if !ok {
+		zlog.Logger.Info().Stringer("series_id", object.SeriesID).Int("occurrence", object.Occurrence).Msg("series is over")
+		return nil
+	}
+
+	id := types.GenerateUUID()
+	next := &models.Notification{
+		PublicationAt: types.NewDateTime(nextPublicationAt),
+		ID:            &id,
+		Channel:       object.Channel,
+		Content:       object.Content,
+		Status:        internaltypes.StatusScheduled,
+		SendTo:        object.SendTo,
+		SeriesID:      object.SeriesID,
+		Occurrence:    object.Occurrence + 1,
+	}
+	if object.Template != nil {
+		next.Template = &models.NotificationTemplate{ID: object.Template.ID, Variables: object.Template.Variables}
 	}
 
-	err = errGroup.Wait()
+	var created bool
+	created, err = s.seriesRepo.CreateOccurrence(ctx, next)
 	if err != nil {
-		return fmt.Errorf("failed to send '%d' objects, example err: %w", errorsAmount, err)
+		return fmt.Errorf("failed to create occurrence %d of series '%s': %w", next.Occurrence, object.SeriesID, err)
+	}
+	if !created {
+		return nil
 	}
 
-	return err
+	return s.Schedule(ctx, next)
 }
 
-// WhenNextFetch tells when will next fetch be performed
-//
-// If a new notification is created and next fetch will be after its publication_at, call QuickSend on it!
-func (s *SenderService) WhenNextFetch() time.Time {
-	return s.nextFetchIsAt // I hope there are no races
+// materialiseNextOccurrences calls MaterialiseNext on every object, logs on error
+func (s *SenderService) materialiseNextOccurrences(ctx context.Context, objects []*models.Notification) {
+	for _, object := range objects {
+		if object.SeriesID == nil {
+			continue
+		}
+		if err := s.MaterialiseNext(ctx, object); err != nil {
+			zlog.Logger.Error().Err(err).Stringer("id", object.ID).Msg("failed to materialise next occurrence")
+		}
+	}
 }
 
-// QuickSendIfNeeded is an example SignalFunc (check what it is)
+// resumeStalledSeries materialises next occurrences of series that have no scheduled one, logs on error
 //
-// You can use it!
-func (s *SenderService) QuickSendIfNeeded(ctx context.Context, object *models.Notification) error {
-	if object.PublicationAt.Value().Before(s.WhenNextFetch()) {
-		return s.QuickSend(ctx, object)
+// it's the safety net of markPublished and expireOutdated, they materialise next occurrences right away
+func (s *SenderService) resumeStalledSeries(ctx context.Context) {
+	if s.seriesRepo == nil {
+		return
 	}
-	return nil
+
+	stalled, err := s.seriesRepo.FetchStalledSeries(ctx, s.paging.BatchSize)
+	if err != nil {
+		zlog.Logger.Error().Err(fmt.Errorf("failed to fetch stalled series: %w", err)).Msg("error in SenderService loop")
+		return
+	}
+	if len(stalled) > 0 {
+		zlog.Logger.Warn().Int("amount", len(stalled)).Msg("resuming stalled series")
+	}
+
+	s.materialiseNextOccurrences(ctx, stalled)
 }
 
+// lifeCycle resumes stalled series, reloads wake-ups of the near-term window and publishes everything that's due
 func (s *SenderService) lifeCycle(ctx context.Context) {
-	// life cycle
+	s.resumeStalledSeries(ctx)
+
 	now := time.Now()
-	s.nextFetchIsAt = now.Add(s.fetchPeriod)
 
-	// step 1. Get batch
-	dateTimeUpTo := types.NewDateTime(now.Add(s.fetchMaxDiapason))
-	batch, err := s.storageFetcherRepo.Fetch(ctx, dateTimeUpTo)
+	windowUpTo := types.NewDateTime(now.Add(s.fetchMaxDiapason + s.publishAhead))
+	upcoming, err := s.storageFetcherRepo.FetchUpcoming(ctx, windowUpTo, s.paging.MaxScheduled)
 	if err != nil {
-		zlog.Logger.Error().Err(fmt.Errorf("failed to fetch batch for sending: %w", err)).Msg("error in SenderService loop")
+		zlog.Logger.Error().Err(fmt.Errorf("failed to fetch upcoming notifications: %w", err)).Msg("error in SenderService loop")
+	}
+	for _, wakeUp := range upcoming {
+		s.wakeUps.Set(*wakeUp.ID, s.wakeAt(wakeUp.At))
+	}
+	// a due edge would be reloaded over and over, the rest of the window waits for the ticker then
+	s.windowEdge = nil
+	if len(upcoming) > 0 && len(upcoming) == s.paging.MaxScheduled && s.wakeAt(upcoming[len(upcoming)-1].At).After(now) {
+		s.windowEdge = upcoming[len(upcoming)-1].ID
+	}
+	zlog.Logger.Info().Int("amount", len(upcoming)).Int("scheduled", s.wakeUps.Len()).Stringer("max_publication_at", windowUpTo).Msg("loaded upcoming")
+
+	s.wakeUp(ctx)
+}
+
+// wakeUp publishes everything that's due now (or in publishAhead), window is reloaded if its edge is reached
+func (s *SenderService) wakeUp(ctx context.Context) {
+	now := time.Now()
+	due := s.wakeUps.PopDue(now)
+	if s.windowEdge != nil && slices.Contains(due, *s.windowEdge) {
+		s.lifeCycle(ctx)
 		return
 	}
-	zlog.Logger.Info().Int("amount", len(batch)).Stringer("max_publication_at", dateTimeUpTo).Msg("fetched batch")
+	s.drain(ctx, types.NewDateTime(now.Add(s.publishAhead)))
+}
+
+// drain fetches pages of notifications due up to dateTimeUpTo until there's none and sends them
+func (s *SenderService) drain(ctx context.Context, dateTimeUpTo types.DateTime) {
+	// fetched but not yet sent notifications, memory is flat no matter how big the backlog is
+	inFlight := semaphore.NewWeighted(int64(s.paging.MaxInFlight))
+	pages := &errgroup.Group{}
+	pages.SetLimit(s.paging.MaxConcurrentPages)
+
+	fetched := 0
+	for ctx.Err() == nil {
+		// step 1. Get page when there's room for it
+		if err := inFlight.Acquire(ctx, int64(s.paging.BatchSize)); err != nil {
+			break
+		}
+		page, err := s.storageFetcherRepo.Fetch(ctx, dateTimeUpTo, s.instanceID, s.leaseDuration, s.paging.BatchSize)
+		if err != nil {
+			inFlight.Release(int64(s.paging.BatchSize))
+			zlog.Logger.Error().Err(fmt.Errorf("failed to fetch batch for sending: %w", err)).Msg("error in SenderService loop")
+			break
+		}
+		inFlight.Release(int64(s.paging.BatchSize - len(page)))
+		fetched += len(page)
+
+		if len(page) == 0 {
+			break
+		}
+
+		// step 2. Send it while next pages are fetched
+		pages.Go(func() error {
+			defer inFlight.Release(int64(len(page)))
+			s.sendPage(ctx, page)
+			return nil
+		})
+
+		// short page = everything due is drained, fetched ones are leased so next page wouldn't repeat them
+		if len(page) < s.paging.BatchSize {
+			break
+		}
+	}
 
-	// step 2. Send it
-	err = s.SendBatch(ctx, batch)
+	_ = pages.Wait()
+	if fetched > 0 {
+		zlog.Logger.Info().Int("amount", fetched).Stringer("max_publication_at", dateTimeUpTo).Msg("fetched batch")
+	}
+}
+
+// sendPage sends 1 fetched page, the ones that are too late are expired instead
+func (s *SenderService) sendPage(ctx context.Context, page []*models.Notification) {
+	// step 2.1. Don't send the ones that are too late
+	page = s.expireOutdated(ctx, page, time.Now())
+
+	// step 2.2. Send it
+	err := s.SendBatch(ctx, page)
 	if err != nil {
 		zlog.Logger.Error().Err(fmt.Errorf("failed to send batch: %w", err)).Msg("error in SenderService loop")
-		return
 	}
 }
+
+// expireOutdated moves notifications that are more than expireAfter late into expired status
+//
+// returns the rest of them
+func (s *SenderService) expireOutdated(ctx context.Context, batch []*models.Notification, now time.Time) []*models.Notification {
+	if s.expireAfter <= 0 {
+		return batch
+	}
+
+	deadline := now.Add(-s.expireAfter)
+
+	actual := make([]*models.Notification, 0, len(batch))
+	outdated := make([]*models.Notification, 0)
+	outdatedIDs := make([]*types.UUID, 0)
+	for _, object := range batch {
+		if object.PublicationAt.Value().Before(deadline) && object.Status.CanTransitionTo(internaltypes.StatusExpired) {
+			outdated = append(outdated, object)
+			outdatedIDs = append(outdatedIDs, object.ID)
+			continue
+		}
+		actual = append(actual, object)
+	}
+
+	if len(outdatedIDs) == 0 {
+		return actual
+	}
+
+	expired, err := s.storageFetcherRepo.ChangeStatus(ctx, outdatedIDs, internaltypes.StatusExpired)
+	if err != nil {
+		zlog.Logger.Error().Err(err).Int("amount", len(outdatedIDs)).Msg("failed to mark as expired")
+	} else {
+		zlog.Logger.Warn().Int64("amount", expired).Stringer("deadline", types.NewDateTime(deadline)).Msg("expired outdated notifications")
+
+		// series go on after an expired occurrence
+		s.materialiseNextOccurrences(ctx, outdated)
+	}
+
+	return actual
+}
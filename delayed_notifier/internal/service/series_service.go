@@ -0,0 +1,138 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+	"time"
+)
+
+// ErrEmptySeries occurs when series rule doesn't produce any occurrence (e.g. until is before the first one)
+var ErrEmptySeries = stderrors.New("recurrence rule has no occurrences")
+
+// SeriesService is the service for creating, reading and stopping recurring notifications
+//
+// occurrences themselves are materialised by SenderService.MaterialiseNext
+type SeriesService struct {
+	seriesRepo ports.NotificationSeriesRepository
+	cacheRepo  ports.NotificationCRUDCacheRepository
+
+	// templateRepo is used to check that occurrences' template can be rendered
+	templateRepo ports.TemplateStorageRepository
+
+	// funcOnCreate is called with first occurrence after CreateSeries
+	//
+	// for example: SenderService.Schedule
+	funcOnCreate SignalFunc
+}
+
+// NewSeriesService creates a new SeriesService
+func NewSeriesService(seriesRepo ports.NotificationSeriesRepository, cacheRepo ports.NotificationCRUDCacheRepository,
+	templateRepo ports.TemplateStorageRepository, funcOnCreate SignalFunc) *SeriesService {
+	return &SeriesService{seriesRepo: seriesRepo, cacheRepo: cacheRepo, templateRepo: templateRepo, funcOnCreate: funcOnCreate}
+}
+
+// CreateSeries saves a new series and its first occurrence, built from given notification
+//
+// IDs are generated in service layer, first occurrence's publication_at is the first one of the rule, so:
+//
+// 1. This mutates both models
+//
+// 2. This returns the first occurrence back
+//
+// returns ErrEmptySeries if rule has no occurrences, ErrInvalidTemplateVariables if template can't be rendered
+func (s *SeriesService) CreateSeries(ctx context.Context, series *models.NotificationSeries, first *models.Notification) (*models.Notification, error) {
+	publicationAt, ok := series.Rule.First()
+	if !ok {
+		return nil, ErrEmptySeries
+	}
+
+	err := checkTemplate(ctx, s.templateRepo, first)
+	if err != nil {
+		return nil, err
+	}
+
+	seriesID := types.GenerateUUID()
+	series.ID = &seriesID
+
+	id := types.GenerateUUID()
+	first.ID = &id
+	first.PublicationAt = types.NewDateTime(publicationAt)
+	first.SeriesID = &seriesID
+	first.Occurrence = 1
+
+	err = s.seriesRepo.CreateSeries(ctx, series, first) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("series storage failed to create: %w", err)
+	}
+
+	if s.funcOnCreate != nil {
+		go func() {
+			if funcErr := s.funcOnCreate(ctx, first); funcErr != nil {
+				zlog.Logger.Error().Err(funcErr).Msg("error in funcOnCreate of series")
+			}
+		}()
+	}
+
+	return first, nil
+}
+
+// GetSeries returns series with its latest occurrence
+func (s *SeriesService) GetSeries(ctx context.Context, id types.UUID) (*models.NotificationSeries, error) {
+	return s.seriesRepo.GetSeries(ctx, id)
+}
+
+// UpcomingOccurrences returns up to limit datetimes of occurrences that haven't been sent yet
+//
+// the latest occurrence is included if it's still scheduled, the rest are computed by the rule.
+// Missed ones are skipped like in SenderService.MaterialiseNext
+func (s *SeriesService) UpcomingOccurrences(series *models.NotificationSeries, limit int) []types.DateTime {
+	result := make([]types.DateTime, 0, limit)
+	if series.IsStopped() || limit <= 0 {
+		return result
+	}
+
+	after := series.Rule.Start().Add(-time.Nanosecond)
+	occurrence := 0
+
+	if last := series.Last; last != nil {
+		if last.Status == internaltypes.StatusScheduled {
+			result = append(result, last.PublicationAt)
+		}
+
+		after = last.PublicationAt.Value()
+		if now := time.Now(); now.After(after) {
+			after = now
+		}
+		occurrence = last.Occurrence
+	}
+
+	for _, next := range series.Rule.Upcoming(after, occurrence, limit-len(result)) {
+		result = append(result, types.NewDateTime(next))
+	}
+	return result
+}
+
+// StopSeries stops creating occurrences and cancels scheduled ones
+//
+// returns errors.ErrSeriesNotFound, errors.ErrSeriesStopped or Internal Error
+func (s *SeriesService) StopSeries(ctx context.Context, id types.UUID) error {
+	cancelled, err := s.seriesRepo.StopSeries(ctx, id) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("series storage failed to stop: %w", err)
+	}
+
+	// cached occurrences have old status
+	for _, cancelledID := range cancelled {
+		if cacheErr := s.cacheRepo.DeleteNotification(ctx, *cancelledID); cacheErr != nil {
+			zlog.Logger.Error().Err(cacheErr).Stringer("id", cancelledID).Msg("error deleting notification from cache")
+		}
+	}
+
+	return nil
+}
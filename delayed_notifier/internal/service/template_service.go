@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	stderrors "errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/zlog"
+)
+
+// ErrInvalidTemplateVariables occurs when notification's template can't be rendered with its variables
+var ErrInvalidTemplateVariables = stderrors.New("template can't be rendered with given variables")
+
+// TemplateService is the service for storing, receiving, updating/deleting message templates
+type TemplateService struct {
+	storageRepo ports.TemplateStorageRepository
+}
+
+// NewTemplateService creates a new TemplateService
+func NewTemplateService(storageRepo ports.TemplateStorageRepository) *TemplateService {
+	return &TemplateService{storageRepo: storageRepo}
+}
+
+// CreateTemplate saves a new template
+//
+// ID is generated in service layer, so this mutates the model and returns it back
+func (s *TemplateService) CreateTemplate(ctx context.Context, model *models.Template) (*models.Template, error) {
+	id := types.GenerateUUID()
+	model.ID = &id
+
+	err := s.storageRepo.CreateTemplate(ctx, model) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("template storage failed to create: %w", err)
+	}
+
+	return model, nil
+}
+
+// UpdateTemplate replaces template with given id
+//
+// notifications that aren't sent yet will be rendered with the new version
+func (s *TemplateService) UpdateTemplate(ctx context.Context, id types.UUID, model *models.Template) (*models.Template, error) {
+	model.ID = &id
+
+	err := s.storageRepo.UpdateTemplate(ctx, model) // retry is called inside
+	if err != nil {
+		return nil, fmt.Errorf("template storage failed to update: %w", err)
+	}
+
+	return model, nil
+}
+
+// GetTemplate returns template by id
+func (s *TemplateService) GetTemplate(ctx context.Context, id types.UUID) (*models.Template, error) {
+	return s.storageRepo.GetTemplate(ctx, id)
+}
+
+// ListTemplates returns all templates
+func (s *TemplateService) ListTemplates(ctx context.Context) ([]*models.Template, error) {
+	return s.storageRepo.ListTemplates(ctx)
+}
+
+// DeleteTemplate deletes template, it fails if notifications refer to it
+func (s *TemplateService) DeleteTemplate(ctx context.Context, id types.UUID) error {
+	err := s.storageRepo.DeleteTemplate(ctx, id) // retry is called inside
+	if err != nil {
+		return fmt.Errorf("template storage failed to delete: %w", err)
+	}
+	return nil
+}
+
+// checkTemplate makes sure notification's template exists and can be rendered with its variables
+//
+// does nothing if notification doesn't use a template
+func checkTemplate(ctx context.Context, templateRepo ports.TemplateStorageRepository, notification *models.Notification) error {
+	if notification.Template == nil {
+		return nil
+	}
+
+	template, err := templateRepo.GetTemplate(ctx, notification.Template.ID)
+	if err != nil {
+		return fmt.Errorf("error getting template: %w", err)
+	}
+
+	if _, err = template.Render(notification.Channel, notification.Template.Variables); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplateVariables, err)
+	}
+	return nil
+}
+
+// checkTemplates is checkTemplate for many notifications, every template is read once
+//
+// returns 1 error (or nil) per notification
+func checkTemplates(ctx context.Context, templateRepo ports.TemplateStorageRepository, notifications []*models.Notification) []error {
+	type readResult struct {
+		template *models.Template
+		err      error
+	}
+	templates := make(map[types.UUID]readResult)
+
+	errs := make([]error, len(notifications))
+	for i, notification := range notifications {
+		if notification.Template == nil {
+			continue
+		}
+
+		read, found := templates[notification.Template.ID]
+		if !found {
+			read.template, read.err = templateRepo.GetTemplate(ctx, notification.Template.ID)
+			templates[notification.Template.ID] = read
+		}
+
+		if read.err != nil {
+			errs[i] = fmt.Errorf("error getting template: %w", read.err)
+			continue
+		}
+		if _, err := read.template.Render(notification.Channel, notification.Template.Variables); err != nil {
+			errs[i] = fmt.Errorf("%w: %w", ErrInvalidTemplateVariables, err)
+		}
+	}
+	return errs
+}
+
+// attachTemplateSources fills Template.Source of notifications, so that worker can render them
+//
+// every template is read once per call. Notifications whose template couldn't be read are sent without it,
+// worker reports them as failed
+func attachTemplateSources(ctx context.Context, templateRepo ports.TemplateStorageRepository, notifications []*models.Notification) {
+	templates := make(map[types.UUID]*models.Template)
+
+	for _, notification := range notifications {
+		if notification.Template == nil || notification.Template.Source != nil {
+			continue
+		}
+
+		template, found := templates[notification.Template.ID]
+		if !found {
+			var err error
+			template, err = templateRepo.GetTemplate(ctx, notification.Template.ID)
+			if err != nil {
+				zlog.Logger.Error().Err(err).Stringer("id", notification.ID).Msg("couldn't get template of notification")
+			}
+			templates[notification.Template.ID] = template
+		}
+
+		notification.Template.Source = template
+	}
+}
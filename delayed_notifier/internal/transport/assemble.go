@@ -3,12 +3,35 @@ package transport
 import "github.com/wb-go/wbf/ginext"
 
 // AssembleRouter is the function you'd call in `main.go` to get THE app router
-func AssembleRouter(notifyHandler *NotifyHandler) *ginext.Engine {
+func AssembleRouter(notifyHandler *NotifyHandler, templateHandler *TemplateHandler, deadLetterHandler *DeadLetterHandler) *ginext.Engine {
 	router := ginext.New("release")
 
 	router.POST("/notify", notifyHandler.CreateNotification)
+	router.POST("/notify/batch", notifyHandler.CreateNotificationsBatch)
+	router.GET("/notify", notifyHandler.ListNotifications)
 	router.GET("/notify/:id", notifyHandler.GetNotification)
+	router.PATCH("/notify/:id", notifyHandler.UpdateNotification)
 	router.DELETE("/notify/:id", notifyHandler.DeleteNotification)
+	router.POST("/notify/:id/cancel", notifyHandler.CancelNotification)
+
+	router.GET("/notify/series/:id", notifyHandler.GetSeries)
+	router.DELETE("/notify/series/:id", notifyHandler.StopSeries)
+
+	router.GET("/notify/parents/:id", notifyHandler.GetParent)
+	router.DELETE("/notify/parents/:id", notifyHandler.CancelParent)
+
+	router.POST("/templates", templateHandler.CreateTemplate)
+	router.GET("/templates", templateHandler.ListTemplates)
+	router.GET("/templates/:id", templateHandler.GetTemplate)
+	router.PUT("/templates/:id", templateHandler.UpdateTemplate)
+	router.DELETE("/templates/:id", templateHandler.DeleteTemplate)
+
+	router.GET("/admin/dead-letters", deadLetterHandler.ListDeadLetters)
+	router.DELETE("/admin/dead-letters", deadLetterHandler.PurgeDeadLetters)
+	router.POST("/admin/dead-letters/replay", deadLetterHandler.ReplayDeadLetters)
+	router.GET("/admin/dead-letters/:id", deadLetterHandler.GetDeadLetter)
+	router.DELETE("/admin/dead-letters/:id", deadLetterHandler.DeleteDeadLetter)
+	router.POST("/admin/dead-letters/:id/replay", deadLetterHandler.ReplayDeadLetter)
 
 	return router
 }
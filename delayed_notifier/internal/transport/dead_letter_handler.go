@@ -0,0 +1,271 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// DeadLetterHandler is the HTTP routes handler for admin endpoints of dead letters, used in AssembleRouter
+//
+// Validates request and passes it to service layer
+type DeadLetterHandler struct {
+	deadLetterService *service.DeadLetterService
+}
+
+// NewDeadLetterHandler creates a new DeadLetterHandler with given service
+func NewDeadLetterHandler(deadLetterService *service.DeadLetterService) *DeadLetterHandler {
+	return &DeadLetterHandler{deadLetterService: deadLetterService}
+}
+
+// ListDeadLetters GET /admin/dead-letters
+func (h *DeadLetterHandler) ListDeadLetters(c *gin.Context) {
+	req, err := dto.BindListDeadLettersRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	filter, err := req.ToFilter()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	cursor, err := req.ToCursor()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	limit, err := req.ToLimit()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	page, nextCursor, err := h.deadLetterService.ListDeadLetters(context.Background(), filter, cursor, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't list dead letters: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ListDeadLettersResponseFromEntities(page, nextCursor))
+}
+
+// GetDeadLetter GET /admin/dead-letters/id
+func (h *DeadLetterHandler) GetDeadLetter(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	deadLetter, err := h.deadLetterService.GetDeadLetter(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrDeadLetterNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "dead letter not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't get dead letter: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.DeadLetterBodyFromEntity(deadLetter))
+}
+
+// ReplayDeadLetter POST /admin/dead-letters/id/replay
+//
+// dead letter is removed and its notification is scheduled again, it's returned
+func (h *DeadLetterHandler) ReplayDeadLetter(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	notification, err := h.deadLetterService.ReplayDeadLetter(context.Background(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, internalerrors.ErrDeadLetterNotFound):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "dead letter not found"},
+			)
+		case errors.Is(err, internalerrors.ErrInvalidStatusTransition):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "notification of dead letter isn't failed anymore"},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't replay dead letter: %s", err.Error())},
+			)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FullNotificationBodyFromEntity(notification))
+}
+
+// ReplayDeadLetters POST /admin/dead-letters/replay
+//
+// every dead letter matching query filters is replayed, no filters = all of them
+func (h *DeadLetterHandler) ReplayDeadLetters(c *gin.Context) {
+	req, err := dto.BindDeadLetterFilterRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	filter, err := req.ToFilter()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	replayed, err := h.deadLetterService.ReplayDeadLetters(context.Background(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't replay dead letters: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"replayed": replayed})
+}
+
+// DeleteDeadLetter DELETE /admin/dead-letters/id
+//
+// notification of dead letter stays failed
+func (h *DeadLetterHandler) DeleteDeadLetter(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	err = h.deadLetterService.DeleteDeadLetter(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrDeadLetterNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "dead letter not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't delete dead letter: %s", err.Error())},
+		)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// PurgeDeadLetters DELETE /admin/dead-letters
+//
+// every dead letter matching query filters is removed, no filters = all of them
+func (h *DeadLetterHandler) PurgeDeadLetters(c *gin.Context) {
+	req, err := dto.BindDeadLetterFilterRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	filter, err := req.ToFilter()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	purged, err := h.deadLetterService.PurgeDeadLetters(context.Background(), filter)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't purge dead letters: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"purged": purged})
+}
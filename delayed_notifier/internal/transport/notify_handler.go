@@ -2,6 +2,7 @@ package transport
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
@@ -9,6 +10,7 @@ import (
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
 	"github.com/gin-gonic/gin"
+	"github.com/wb-go/wbf/zlog"
 	"net/http"
 )
 
@@ -16,15 +18,37 @@ import (
 //
 // Validates request and passes it to service layer
 type NotifyHandler struct {
-	crudService *service.NotificationCRUDService
+	crudService   *service.NotificationCRUDService
+	seriesService *service.SeriesService
+	fanOutService *service.FanOutService
+
+	idempotencyService *service.IdempotencyService
 }
 
-// NewNotifyHandler creates a new NotifyHandler with given service
-func NewNotifyHandler(crudService *service.NotificationCRUDService) *NotifyHandler {
-	return &NotifyHandler{crudService: crudService}
+// IdempotencyKeyHeader is the header that makes POST /notify idempotent
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// IdempotentReplayedHeader is set to "true" in replayed responses
+const IdempotentReplayedHeader = "Idempotent-Replayed"
+
+// NewNotifyHandler creates a new NotifyHandler with given services
+func NewNotifyHandler(crudService *service.NotificationCRUDService, seriesService *service.SeriesService,
+	fanOutService *service.FanOutService, idempotencyService *service.IdempotencyService) *NotifyHandler {
+	return &NotifyHandler{
+		crudService:        crudService,
+		seriesService:      seriesService,
+		fanOutService:      fanOutService,
+		idempotencyService: idempotencyService,
+	}
 }
 
 // CreateNotification POST /notify
+//
+// if body has recurrence, a series is created and its first occurrence is returned
+//
+// if body has recipients, a fan-out notification is created and returned instead, see createParent
+//
+// with IdempotencyKeyHeader the first 201 response is saved and replayed on repeated requests
 func (h *NotifyHandler) CreateNotification(c *gin.Context) {
 	var body dto.CreateNotificationBody
 
@@ -36,6 +60,27 @@ func (h *NotifyHandler) CreateNotification(c *gin.Context) {
 		return
 	}
 
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if idempotencyKey != "" {
+		if done := h.beginIdempotent(c, idempotencyKey, body); done {
+			return
+		}
+
+		// failed request mustn't block retries
+		defer func() {
+			if c.Writer.Status() != http.StatusCreated {
+				if releaseErr := h.idempotencyService.Release(context.Background(), idempotencyKey); releaseErr != nil {
+					zlog.Logger.Error().Err(releaseErr).Str("key", idempotencyKey).Msg("couldn't release idempotency key")
+				}
+			}
+		}()
+	}
+
+	if len(body.Recipients) > 0 {
+		h.createParent(c, body)
+		return
+	}
+
 	var createModel *models.Notification
 	createModel, err = body.ToEntity()
 	if err != nil {
@@ -45,8 +90,29 @@ func (h *NotifyHandler) CreateNotification(c *gin.Context) {
 		return
 	}
 
-	_, err = h.crudService.CreateNotification(context.Background(), createModel)
+	var createSeries *models.NotificationSeries
+	createSeries, err = body.ToSeries()
 	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	if createSeries != nil {
+		_, err = h.seriesService.CreateSeries(context.Background(), createSeries, createModel)
+	} else {
+		_, err = h.crudService.CreateNotification(context.Background(), createModel)
+	}
+	if err != nil {
+		if errors.Is(err, service.ErrEmptySeries) || errors.Is(err, service.ErrInvalidTemplateVariables) ||
+			errors.Is(err, internalerrors.ErrTemplateNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+			)
+			return
+		}
+
 		c.AbortWithStatusJSON(
 			http.StatusConflict,
 			gin.H{"error": fmt.Sprintf("couldn't perform operation: %s", err.Error())},
@@ -55,7 +121,165 @@ func (h *NotifyHandler) CreateNotification(c *gin.Context) {
 	}
 
 	// createModel has been mutated: ID is now assigned!
-	c.JSON(http.StatusCreated, dto.FullNotificationBodyFromEntity(createModel))
+	h.respondCreated(c, dto.FullNotificationBodyFromEntity(createModel))
+}
+
+// CreateNotificationsBatch POST /notify/batch
+//
+// body is a JSON array or NDJSON (Content-Type: application/x-ndjson) of create bodies, results are returned per item.
+// Valid items are saved at once: 201 if every item is created, 207 if some aren't, 400 if none is
+func (h *NotifyHandler) CreateNotificationsBatch(c *gin.Context) {
+	items, err := dto.ParseCreateNotificationBatch(c.ContentType(), c.Request.Body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	results := make([]*dto.CreateNotificationBatchItemResult, len(items))
+	batch := make([]*models.Notification, 0, len(items))
+	batchIndexes := make([]int, 0, len(items))
+
+	for i, item := range items {
+		results[i] = &dto.CreateNotificationBatchItemResult{Index: i}
+
+		if item.ParseErr != nil {
+			results[i].Error = fmt.Sprintf("invalid item (parsing): %s", item.ParseErr.Error())
+			continue
+		}
+
+		createModel, validateErr := item.Body.ToBatchEntity()
+		if validateErr != nil {
+			results[i].Error = fmt.Sprintf("invalid item (validating): %s", validateErr.Error())
+			continue
+		}
+
+		batch = append(batch, createModel)
+		batchIndexes = append(batchIndexes, i)
+	}
+
+	if len(batch) > 0 {
+		itemErrs, batchErr := h.crudService.CreateNotifications(context.Background(), batch)
+		if batchErr != nil {
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't create notifications: %s", batchErr.Error())},
+			)
+			return
+		}
+
+		// batch models have been mutated: IDs are now assigned!
+		for j, createModel := range batch {
+			result := results[batchIndexes[j]]
+			if itemErrs[j] != nil {
+				result.Error = fmt.Sprintf("invalid item (validating): %s", itemErrs[j].Error())
+				continue
+			}
+			result.ID = createModel.ID.String()
+		}
+	}
+
+	response := dto.NewCreateNotificationBatchResponse(results)
+
+	status := http.StatusMultiStatus
+	switch {
+	case response.Failed == 0:
+		status = http.StatusCreated
+	case response.Created == 0:
+		status = http.StatusBadRequest
+	}
+	c.JSON(status, response)
+}
+
+// beginIdempotent claims idempotency key for CreateNotification
+//
+// returns true if response is already written: it's a replay or an error
+func (h *NotifyHandler) beginIdempotent(c *gin.Context, key string, body dto.CreateNotificationBody) bool {
+	saved, err := h.idempotencyService.Begin(context.Background(), key, body)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrInvalidIdempotencyKey):
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{"error": fmt.Sprintf("invalid header '%s': %s", IdempotencyKeyHeader, err.Error())},
+			)
+		case errors.Is(err, service.ErrIdempotencyKeyReused) || errors.Is(err, service.ErrIdempotencyKeyInProgress):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": err.Error()},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't check idempotency key: %s", err.Error())},
+			)
+		}
+		return true
+	}
+
+	if saved != nil {
+		c.Header(IdempotentReplayedHeader, "true")
+		c.Data(saved.StatusCode, "application/json; charset=utf-8", saved.Body)
+		return true
+	}
+	return false
+}
+
+// respondCreated writes 201 response of CreateNotification, it's saved if request has idempotency key
+func (h *NotifyHandler) respondCreated(c *gin.Context, response any) {
+	idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+	if idempotencyKey == "" {
+		c.JSON(http.StatusCreated, response)
+		return
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't marshal response: %s", err.Error())},
+		)
+		return
+	}
+
+	// notification is created anyway, so a failed save is only logged: the key stays "in progress" until it expires
+	saved := &models.IdempotentResponse{StatusCode: http.StatusCreated, Body: data}
+	if err = h.idempotencyService.Complete(context.Background(), idempotencyKey, saved); err != nil {
+		zlog.Logger.Error().Err(err).Str("key", idempotencyKey).Msg("couldn't save idempotent response")
+	}
+
+	c.Data(http.StatusCreated, "application/json; charset=utf-8", data)
+}
+
+// createParent is the fan-out part of CreateNotification
+func (h *NotifyHandler) createParent(c *gin.Context, body dto.CreateNotificationBody) {
+	createModel, err := body.ToParent()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	_, err = h.fanOutService.CreateParent(context.Background(), createModel)
+	if err != nil {
+		if errors.Is(err, service.ErrInvalidTemplateVariables) || errors.Is(err, internalerrors.ErrTemplateNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusConflict,
+			gin.H{"error": fmt.Sprintf("couldn't perform operation: %s", err.Error())},
+		)
+		return
+	}
+
+	// createModel has been mutated: ID and statuses are now assigned!
+	h.respondCreated(c, dto.ParentBodyFromEntity(createModel))
 }
 
 // GetNotification GET /notify/id
@@ -98,7 +322,131 @@ func (h *NotifyHandler) GetNotification(c *gin.Context) {
 	c.JSON(http.StatusOK, dto.FullNotificationBodyFromEntity(notification))
 }
 
+// ListNotifications GET /notify
+//
+// query: channel, send_to, status, parent_id, publication_at_from, publication_at_to, cursor, limit
+func (h *NotifyHandler) ListNotifications(c *gin.Context) {
+	req, err := dto.BindListNotificationsRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	filter, err := req.ToFilter()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	cursor, err := req.ToCursor()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	limit, err := req.ToLimit()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	page, nextCursor, err := h.crudService.ListNotifications(context.Background(), filter, cursor, limit)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't list notifications: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ListNotificationsResponseFromEntities(page, nextCursor))
+}
+
+// UpdateNotification PATCH /notify/id
+//
+// only scheduled notifications can be changed
+func (h *NotifyHandler) UpdateNotification(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	var body dto.UpdateNotificationBody
+	err = c.BindJSON(&body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	var patch models.NotificationPatch
+	patch, err = body.ToPatch()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	notification, err := h.crudService.UpdateNotification(context.Background(), id, patch)
+	if err != nil {
+		switch {
+		case errors.Is(err, internalerrors.ErrNotificationNotFound):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "notification not found"},
+			)
+		case errors.Is(err, internalerrors.ErrNotificationNotEditable):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "notification isn't scheduled anymore and can't be changed"},
+			)
+		case errors.Is(err, service.ErrInvalidPatch):
+			c.AbortWithStatusJSON(
+				http.StatusBadRequest,
+				gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't update notification: %s", err.Error())},
+			)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FullNotificationBodyFromEntity(notification))
+}
+
 // DeleteNotification DELETE /notify/id
+//
+// notification is removed, a scheduled one isn't sent then. Use CancelNotification to keep it with status "cancelled"
 func (h *NotifyHandler) DeleteNotification(c *gin.Context) {
 	req, err := dto.BindGetNotificationRequest(c)
 	if err != nil {
@@ -137,3 +485,244 @@ func (h *NotifyHandler) DeleteNotification(c *gin.Context) {
 
 	c.Status(http.StatusNoContent)
 }
+
+// CancelNotification POST /notify/id/cancel
+//
+// notification isn't removed, its status becomes "cancelled"
+func (h *NotifyHandler) CancelNotification(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	err = h.crudService.CancelNotification(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrNotificationNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "notification not found"},
+			)
+			return
+		}
+
+		if errors.Is(err, internalerrors.ErrInvalidStatusTransition) {
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": fmt.Sprintf("couldn't cancel notification: %s", err.Error())},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't cancel notification: %s", err.Error())},
+		)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetSeries GET /notify/series/id
+//
+// query: limit - amount of upcoming occurrences
+func (h *NotifyHandler) GetSeries(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	query, err := dto.BindGetSeriesRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	limit, err := query.ToLimit()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid query (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	series, err := h.seriesService.GetSeries(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrSeriesNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "series not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't get series: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.SeriesBodyFromEntity(series, h.seriesService.UpcomingOccurrences(series, limit)))
+}
+
+// StopSeries DELETE /notify/series/id
+//
+// no more occurrences are created, scheduled ones are cancelled
+func (h *NotifyHandler) StopSeries(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	err = h.seriesService.StopSeries(context.Background(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, internalerrors.ErrSeriesNotFound):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "series not found"},
+			)
+		case errors.Is(err, internalerrors.ErrSeriesStopped):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "series is already stopped"},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't stop series: %s", err.Error())},
+			)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetParent GET /notify/parents/id
+//
+// returns aggregate status of fan-out notification, deliveries are listed with GET /notify?parent_id=id
+func (h *NotifyHandler) GetParent(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	parent, err := h.fanOutService.GetParent(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrParentNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "fan-out notification not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't get fan-out notification: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.ParentBodyFromEntity(parent))
+}
+
+// CancelParent DELETE /notify/parents/id
+//
+// scheduled deliveries are cancelled, the rest are left as is
+func (h *NotifyHandler) CancelParent(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	err = h.fanOutService.CancelParent(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrParentNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "fan-out notification not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't cancel fan-out notification: %s", err.Error())},
+		)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,233 @@
+package transport
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"github.com/gin-gonic/gin"
+	"net/http"
+)
+
+// TemplateHandler is the HTTP routes handler for message templates, used in AssembleRouter
+//
+// Validates request and passes it to service layer
+type TemplateHandler struct {
+	templateService *service.TemplateService
+}
+
+// NewTemplateHandler creates a new TemplateHandler with given service
+func NewTemplateHandler(templateService *service.TemplateService) *TemplateHandler {
+	return &TemplateHandler{templateService: templateService}
+}
+
+// CreateTemplate POST /templates
+func (h *TemplateHandler) CreateTemplate(c *gin.Context) {
+	var body dto.TemplateBody
+
+	err := c.BindJSON(&body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	var createModel *models.Template
+	createModel, err = body.ToEntity()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	_, err = h.templateService.CreateTemplate(context.Background(), createModel)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrTemplateNameTaken) {
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "template name is already taken"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't create template: %s", err.Error())},
+		)
+		return
+	}
+
+	// createModel has been mutated: ID is now assigned!
+	c.JSON(http.StatusCreated, dto.FullTemplateBodyFromEntity(createModel))
+}
+
+// ListTemplates GET /templates
+func (h *TemplateHandler) ListTemplates(c *gin.Context) {
+	templates, err := h.templateService.ListTemplates(context.Background())
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't list templates: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FullTemplateBodiesFromEntities(templates))
+}
+
+// GetTemplate GET /templates/id
+func (h *TemplateHandler) GetTemplate(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	template, err := h.templateService.GetTemplate(context.Background(), id)
+	if err != nil {
+		if errors.Is(err, internalerrors.ErrTemplateNotFound) {
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "template not found"},
+			)
+			return
+		}
+
+		c.AbortWithStatusJSON(
+			http.StatusInternalServerError,
+			gin.H{"error": fmt.Sprintf("couldn't get template: %s", err.Error())},
+		)
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FullTemplateBodyFromEntity(template))
+}
+
+// UpdateTemplate PUT /templates/id
+//
+// notifications that aren't sent yet will be rendered with the new version
+func (h *TemplateHandler) UpdateTemplate(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	var body dto.TemplateBody
+	err = c.BindJSON(&body)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (parsing): %s", err.Error())},
+		)
+		return
+	}
+
+	var updateModel *models.Template
+	updateModel, err = body.ToEntity()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest, gin.H{"error": fmt.Sprintf("invalid body (validating): %s", err.Error())},
+		)
+		return
+	}
+
+	template, err := h.templateService.UpdateTemplate(context.Background(), id, updateModel)
+	if err != nil {
+		switch {
+		case errors.Is(err, internalerrors.ErrTemplateNotFound):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "template not found"},
+			)
+		case errors.Is(err, internalerrors.ErrTemplateNameTaken):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "template name is already taken"},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't update template: %s", err.Error())},
+			)
+		}
+		return
+	}
+
+	c.JSON(http.StatusOK, dto.FullTemplateBodyFromEntity(template))
+}
+
+// DeleteTemplate DELETE /templates/id
+//
+// templates used by notifications can't be deleted
+func (h *TemplateHandler) DeleteTemplate(c *gin.Context) {
+	req, err := dto.BindGetNotificationRequest(c)
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid ID parameter: %s", err.Error())},
+		)
+		return
+	}
+
+	id, err := req.ToUUID()
+	if err != nil {
+		c.AbortWithStatusJSON(
+			http.StatusBadRequest,
+			gin.H{"error": fmt.Sprintf("invalid UUID format: %s", err.Error())},
+		)
+		return
+	}
+
+	err = h.templateService.DeleteTemplate(context.Background(), id)
+	if err != nil {
+		switch {
+		case errors.Is(err, internalerrors.ErrTemplateNotFound):
+			c.AbortWithStatusJSON(
+				http.StatusNotFound,
+				gin.H{"error": "template not found"},
+			)
+		case errors.Is(err, internalerrors.ErrTemplateInUse):
+			c.AbortWithStatusJSON(
+				http.StatusConflict,
+				gin.H{"error": "template is used by notifications and can't be deleted"},
+			)
+		default:
+			c.AbortWithStatusJSON(
+				http.StatusInternalServerError,
+				gin.H{"error": fmt.Sprintf("couldn't delete template: %s", err.Error())},
+			)
+		}
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
@@ -0,0 +1,76 @@
+package delaybuckets
+
+import (
+	"strconv"
+	"time"
+)
+
+// Header is the message header the delay exchange routes by, its value is Layout.Key of a bucket
+const Header = "x-delay-bucket"
+
+// Layout describes wait queues that hold messages for Step, 2*Step, ..., Amount*Step
+//
+// every queue has 1 TTL for all of its messages, so they expire in the order they came and nothing waits behind
+// a longer one. A delay is rounded down to its bucket, the rest (less than Step) is waited by the consumer
+//
+//	layout := delaybuckets.Layout{Exchange: "notifications.delay", Step: time.Second, Amount: 60}
+//	bucket := layout.Of(time.Until(publicationAt))
+//	if bucket == 0 {
+//		... // publish right into the work exchange
+//	}
+//	... // publish into layout.Exchange with header Header: layout.Key(bucket)
+type Layout struct {
+	// Exchange is the headers exchange wait queues are bound to, they're named "<Exchange>.<Key>"
+	Exchange string
+	Step     time.Duration
+	Amount   int
+}
+
+// Enabled tells if there's at least 1 wait queue
+func (l Layout) Enabled() bool {
+	return l.Exchange != "" && l.Step > 0 && l.Amount > 0
+}
+
+// Max is the longest delay held by wait queues, longer ones are released earlier
+func (l Layout) Max() time.Duration {
+	if !l.Enabled() {
+		return 0
+	}
+	return l.Step * time.Duration(l.Amount)
+}
+
+// Of returns the bucket of delay: the longest TTL that doesn't exceed it, 0 = no wait
+func (l Layout) Of(delay time.Duration) int {
+	if !l.Enabled() || delay < l.Step {
+		return 0
+	}
+	return int(min(delay/l.Step, time.Duration(l.Amount)))
+}
+
+// Buckets returns all buckets in TTL order, from 1 to Amount
+func (l Layout) Buckets() []int {
+	if !l.Enabled() {
+		return nil
+	}
+
+	buckets := make([]int, l.Amount)
+	for i := range buckets {
+		buckets[i] = i + 1
+	}
+	return buckets
+}
+
+// TTL returns how long messages of bucket wait
+func (l Layout) TTL(bucket int) time.Duration {
+	return l.Step * time.Duration(bucket)
+}
+
+// Key returns the Header value of bucket: its TTL in milliseconds
+func (l Layout) Key(bucket int) string {
+	return strconv.FormatInt(l.TTL(bucket).Milliseconds(), 10)
+}
+
+// QueueName returns the name of the wait queue of bucket
+func (l Layout) QueueName(bucket int) string {
+	return l.Exchange + "." + l.Key(bucket)
+}
@@ -0,0 +1,191 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// cronSearchLimit is how far cron looks for the next occurrence, e.g. “0 0 30 2 *“ never happens
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+// cronDescriptors are the supported “@“ shortcuts
+var cronDescriptors = map[string]string{
+	"@yearly":   "0 0 1 1 *",
+	"@annually": "0 0 1 1 *",
+	"@monthly":  "0 0 1 * *",
+	"@weekly":   "0 0 * * 0",
+	"@daily":    "0 0 * * *",
+	"@midnight": "0 0 * * *",
+	"@hourly":   "0 * * * *",
+}
+
+var cronMonthNames = map[string]int{
+	"JAN": 1, "FEB": 2, "MAR": 3, "APR": 4, "MAY": 5, "JUN": 6,
+	"JUL": 7, "AUG": 8, "SEP": 9, "OCT": 10, "NOV": 11, "DEC": 12,
+}
+
+var cronWeekdayNames = map[string]int{
+	"SUN": 0, "MON": 1, "TUE": 2, "WED": 3, "THU": 4, "FRI": 5, "SAT": 6,
+}
+
+// cronSchedule is a classic 5-field cron: minute hour day-of-month month day-of-week
+//
+// every field is a set of allowed values
+type cronSchedule struct {
+	minutes  map[int]bool
+	hours    map[int]bool
+	days     map[int]bool
+	months   map[int]bool
+	weekdays map[int]bool
+
+	// like in vixie cron: if both days and weekdays are restricted, any of them matches
+	daysRestricted     bool
+	weekdaysRestricted bool
+}
+
+// parseCron parses “* * * * *“-like expression or one of cronDescriptors
+func parseCron(expression string) (*cronSchedule, error) {
+	if descriptor, found := cronDescriptors[strings.ToLower(expression)]; found {
+		expression = descriptor
+	}
+
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return nil, fmt.Errorf("%w: cron expression must have 5 fields, got %d", ErrInvalidRule, len(fields))
+	}
+
+	var err error
+	result := &cronSchedule{}
+
+	if result.minutes, err = parseCronField(fields[0], 0, 59, nil); err != nil {
+		return nil, fmt.Errorf("%w: minute: %w", ErrInvalidRule, err)
+	}
+	if result.hours, err = parseCronField(fields[1], 0, 23, nil); err != nil {
+		return nil, fmt.Errorf("%w: hour: %w", ErrInvalidRule, err)
+	}
+	if result.days, err = parseCronField(fields[2], 1, 31, nil); err != nil {
+		return nil, fmt.Errorf("%w: day of month: %w", ErrInvalidRule, err)
+	}
+	if result.months, err = parseCronField(fields[3], 1, 12, cronMonthNames); err != nil {
+		return nil, fmt.Errorf("%w: month: %w", ErrInvalidRule, err)
+	}
+	// 7 is sunday too
+	if result.weekdays, err = parseCronField(fields[4], 0, 7, cronWeekdayNames); err != nil {
+		return nil, fmt.Errorf("%w: day of week: %w", ErrInvalidRule, err)
+	}
+	if result.weekdays[7] {
+		result.weekdays[0] = true
+	}
+
+	result.daysRestricted = fields[2] != "*" && fields[2] != "?"
+	result.weekdaysRestricted = fields[4] != "*" && fields[4] != "?"
+
+	return result, nil
+}
+
+// parseCronField parses comma-separated list of “*“, “a“, “a-b“ with optional “/step“
+func parseCronField(field string, minValue, maxValue int, names map[string]int) (map[int]bool, error) {
+	result := make(map[int]bool)
+
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step <= 0 {
+				return nil, fmt.Errorf("invalid step '%s'", stepPart)
+			}
+		}
+
+		from, to := minValue, maxValue
+		switch {
+		case rangePart == "*" || rangePart == "?":
+		case strings.Contains(rangePart, "-"):
+			fromPart, toPart, _ := strings.Cut(rangePart, "-")
+			var err error
+			if from, err = parseCronValue(fromPart, names); err != nil {
+				return nil, err
+			}
+			if to, err = parseCronValue(toPart, names); err != nil {
+				return nil, err
+			}
+		default:
+			value, err := parseCronValue(rangePart, names)
+			if err != nil {
+				return nil, err
+			}
+			from = value
+			// “5/10“ means “5-max/10“
+			if !hasStep {
+				to = value
+			}
+		}
+
+		if from < minValue || to > maxValue || from > to {
+			return nil, fmt.Errorf("'%s' is out of range [%d; %d]", part, minValue, maxValue)
+		}
+
+		for value := from; value <= to; value += step {
+			result[value] = true
+		}
+	}
+
+	return result, nil
+}
+
+// parseCronValue parses a number or a name, e.g. “MON“
+func parseCronValue(value string, names map[string]int) (int, error) {
+	if named, found := names[strings.ToUpper(value)]; found {
+		return named, nil
+	}
+	result, err := strconv.Atoi(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid value '%s'", value)
+	}
+	return result, nil
+}
+
+// next returns the first matching minute strictly after given time
+func (s *cronSchedule) next(after time.Time) (time.Time, bool) {
+	location := after.Location()
+	limit := after.Add(cronSearchLimit)
+
+	t := after.Truncate(time.Minute).Add(time.Minute)
+
+	for t.Before(limit) {
+		if !s.months[int(t.Month())] {
+			t = time.Date(t.Year(), t.Month()+1, 1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !s.dayMatches(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, location)
+			continue
+		}
+		if !s.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, location)
+			continue
+		}
+		if !s.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, true
+	}
+
+	return time.Time{}, false
+}
+
+// dayMatches checks both day-of-month and day-of-week fields
+func (s *cronSchedule) dayMatches(t time.Time) bool {
+	dayOk := s.days[t.Day()]
+	weekdayOk := s.weekdays[int(t.Weekday())]
+
+	if s.daysRestricted && s.weekdaysRestricted {
+		return dayOk || weekdayOk
+	}
+	return dayOk && weekdayOk
+}
@@ -0,0 +1,237 @@
+package recurrence
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// rruleSearchLimit is how many periods RRULE looks through for the next occurrence
+const rruleSearchLimit = 10000
+
+const (
+	freqMinutely = "MINUTELY"
+	freqHourly   = "HOURLY"
+	freqDaily    = "DAILY"
+	freqWeekly   = "WEEKLY"
+	freqMonthly  = "MONTHLY"
+	freqYearly   = "YEARLY"
+)
+
+var rruleWeekdays = map[string]time.Weekday{
+	"MO": time.Monday, "TU": time.Tuesday, "WE": time.Wednesday, "TH": time.Thursday,
+	"FR": time.Friday, "SA": time.Saturday, "SU": time.Sunday,
+}
+
+// weekOrder is the order of days inside an RRULE week (WKST=MO)
+var weekOrder = []time.Weekday{time.Monday, time.Tuesday, time.Wednesday, time.Thursday, time.Friday, time.Saturday, time.Sunday}
+
+// rruleSchedule is a subset of RFC 5545 RRULE: FREQ, INTERVAL, COUNT, UNTIL, BYDAY (for DAILY and WEEKLY)
+//
+// start is DTSTART: occurrences keep its time of day
+type rruleSchedule struct {
+	freq     string
+	interval int
+	count    int
+	until    time.Time
+	weekdays map[time.Weekday]bool
+	start    time.Time
+}
+
+// isRRule tells if expression looks like an RRULE rather than cron
+func isRRule(expression string) bool {
+	upper := strings.ToUpper(expression)
+	return strings.HasPrefix(upper, "RRULE:") || strings.Contains(upper, "FREQ=")
+}
+
+// parseRRule parses “FREQ=...;INTERVAL=...“, “RRULE:“ prefix is optional
+func parseRRule(expression string, start time.Time) (*rruleSchedule, error) {
+	expression = strings.TrimPrefix(strings.ToUpper(expression), "RRULE:")
+
+	result := &rruleSchedule{interval: 1, start: start, weekdays: make(map[time.Weekday]bool)}
+
+	for _, part := range strings.Split(expression, ";") {
+		if part == "" {
+			continue
+		}
+
+		key, value, found := strings.Cut(part, "=")
+		if !found {
+			return nil, fmt.Errorf("%w: bad RRULE part '%s'", ErrInvalidRule, part)
+		}
+
+		var err error
+		switch key {
+		case "FREQ":
+			switch value {
+			case freqMinutely, freqHourly, freqDaily, freqWeekly, freqMonthly, freqYearly:
+				result.freq = value
+			default:
+				return nil, fmt.Errorf("%w: unsupported FREQ '%s'", ErrInvalidRule, value)
+			}
+		case "INTERVAL":
+			result.interval, err = strconv.Atoi(value)
+			if err != nil || result.interval <= 0 {
+				return nil, fmt.Errorf("%w: bad INTERVAL '%s'", ErrInvalidRule, value)
+			}
+		case "COUNT":
+			result.count, err = strconv.Atoi(value)
+			if err != nil || result.count <= 0 {
+				return nil, fmt.Errorf("%w: bad COUNT '%s'", ErrInvalidRule, value)
+			}
+		case "UNTIL":
+			result.until, err = parseRRuleUntil(value, start.Location())
+			if err != nil {
+				return nil, fmt.Errorf("%w: bad UNTIL '%s': %w", ErrInvalidRule, value, err)
+			}
+		case "BYDAY":
+			for _, day := range strings.Split(value, ",") {
+				weekday, ok := rruleWeekdays[day]
+				if !ok {
+					return nil, fmt.Errorf("%w: unsupported BYDAY '%s'", ErrInvalidRule, day)
+				}
+				result.weekdays[weekday] = true
+			}
+		case "WKST":
+			if value != "MO" {
+				return nil, fmt.Errorf("%w: only WKST=MO is supported", ErrInvalidRule)
+			}
+		default:
+			return nil, fmt.Errorf("%w: unsupported RRULE part '%s'", ErrInvalidRule, key)
+		}
+	}
+
+	if result.freq == "" {
+		return nil, fmt.Errorf("%w: FREQ is required", ErrInvalidRule)
+	}
+	if result.count > 0 && !result.until.IsZero() {
+		return nil, fmt.Errorf("%w: COUNT and UNTIL mustn't be used together", ErrInvalidRule)
+	}
+	if len(result.weekdays) > 0 && result.freq != freqDaily && result.freq != freqWeekly {
+		return nil, fmt.Errorf("%w: BYDAY is supported only with FREQ=DAILY or FREQ=WEEKLY", ErrInvalidRule)
+	}
+	if result.freq == freqWeekly && len(result.weekdays) == 0 {
+		result.weekdays[start.Weekday()] = true
+	}
+
+	return result, nil
+}
+
+// parseRRuleUntil parses “20251231T235959Z“, “20251231T235959“ (local) or “20251231“ (end of day)
+func parseRRuleUntil(value string, location *time.Location) (time.Time, error) {
+	if t, err := time.Parse("20060102T150405Z", value); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("20060102T150405", value, location); err == nil {
+		return t, nil
+	}
+	t, err := time.ParseInLocation("20060102", value, location)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.AddDate(0, 0, 1).Add(-time.Nanosecond), nil
+}
+
+// next returns the first occurrence strictly after given time
+func (s *rruleSchedule) next(after time.Time) (time.Time, bool) {
+	if s.freq == freqWeekly {
+		return s.nextWeekly(after)
+	}
+
+	firstPeriod := s.estimatePeriod(after)
+	for k := firstPeriod; k < firstPeriod+rruleSearchLimit; k++ {
+		candidate := s.advance(k)
+
+		// e.g. 31st of the month that doesn't have it: RFC 5545 says such occurrences are skipped
+		if (s.freq == freqMonthly || s.freq == freqYearly) && candidate.Day() != s.start.Day() {
+			continue
+		}
+		if len(s.weekdays) > 0 && !s.weekdays[candidate.Weekday()] {
+			continue
+		}
+		if candidate.After(after) {
+			return candidate, true
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// nextWeekly walks through weeks (each interval-th one) and their BYDAY days
+func (s *rruleSchedule) nextWeekly(after time.Time) (time.Time, bool) {
+	// monday of the DTSTART week, with DTSTART time of day
+	daysSinceMonday := (int(s.start.Weekday()) + 6) % 7
+	weekStart := s.start.AddDate(0, 0, -daysSinceMonday)
+
+	firstWeek := 0
+	if after.After(s.start) {
+		firstWeek = int(after.Sub(weekStart).Hours()/24/7)/s.interval - 1
+		if firstWeek < 0 {
+			firstWeek = 0
+		}
+	}
+
+	for week := firstWeek; week < firstWeek+rruleSearchLimit; week++ {
+		for offset, weekday := range weekOrder {
+			if !s.weekdays[weekday] {
+				continue
+			}
+
+			candidate := weekStart.AddDate(0, 0, week*s.interval*7+offset)
+			if candidate.Before(s.start) {
+				continue
+			}
+			if candidate.After(after) {
+				return candidate, true
+			}
+		}
+	}
+
+	return time.Time{}, false
+}
+
+// advance returns the k-th period start
+func (s *rruleSchedule) advance(k int) time.Time {
+	steps := k * s.interval
+
+	switch s.freq {
+	case freqMinutely:
+		return s.start.Add(time.Duration(steps) * time.Minute)
+	case freqHourly:
+		return s.start.Add(time.Duration(steps) * time.Hour)
+	case freqDaily:
+		return s.start.AddDate(0, 0, steps)
+	case freqMonthly:
+		return s.start.AddDate(0, steps, 0)
+	default:
+		return s.start.AddDate(steps, 0, 0)
+	}
+}
+
+// estimatePeriod returns a period index a bit before given time, so that next doesn't iterate from DTSTART
+func (s *rruleSchedule) estimatePeriod(after time.Time) int {
+	if !after.After(s.start) {
+		return 0
+	}
+
+	var periods int
+	switch s.freq {
+	case freqMinutely:
+		periods = int(after.Sub(s.start) / time.Minute)
+	case freqHourly:
+		periods = int(after.Sub(s.start) / time.Hour)
+	case freqDaily:
+		periods = int(after.Sub(s.start).Hours() / 24)
+	case freqMonthly:
+		periods = (after.Year()-s.start.Year())*12 + int(after.Month()) - int(s.start.Month())
+	default:
+		periods = after.Year() - s.start.Year()
+	}
+
+	k := periods/s.interval - 1
+	if k < 0 {
+		return 0
+	}
+	return k
+}
@@ -0,0 +1,145 @@
+package recurrence
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// ErrInvalidRule occurs when recurrence rule can't be parsed
+var ErrInvalidRule = errors.New("invalid recurrence rule")
+
+// ErrConflictingLimits occurs when “COUNT“/“UNTIL“ are given both in RRULE and next to it
+var ErrConflictingLimits = errors.New("recurrence limit is given twice")
+
+// schedule is either cron or RRULE
+type schedule interface {
+	// next returns the first occurrence strictly after given time, false if there's none
+	next(after time.Time) (time.Time, bool)
+}
+
+// Rule is a value type for a series schedule: cron expression or iCal RRULE plus its limits
+//
+// occurrences are numbered from 1, Count limits their amount, Until limits their datetime
+type Rule struct {
+	expression string
+	start      time.Time
+	until      time.Time
+	count      int
+
+	schedule schedule
+}
+
+// NewRule parses expression and creates a new Rule starting from start
+//
+// expression is either a 5-field cron expression (“0 9 * * 1-5“, “@daily“) or an RRULE (“FREQ=WEEKLY;BYDAY=MO,FR“,
+// “RRULE:“ prefix is optional). Cron expressions are evaluated in start's location
+//
+// until (zero = no end) and count (0 = no limit) may be given here or inside RRULE, but not differently in both places
+func NewRule(expression string, start time.Time, until time.Time, count int) (Rule, error) {
+	expression = strings.TrimSpace(expression)
+	if expression == "" {
+		return Rule{}, fmt.Errorf("%w: empty", ErrInvalidRule)
+	}
+	if count < 0 {
+		return Rule{}, fmt.Errorf("%w: count must be positive", ErrInvalidRule)
+	}
+
+	rule := Rule{expression: expression, start: start, until: until, count: count}
+
+	if isRRule(expression) {
+		parsed, err := parseRRule(expression, start)
+		if err != nil {
+			return Rule{}, err
+		}
+
+		if parsed.count > 0 {
+			if count > 0 && count != parsed.count {
+				return Rule{}, fmt.Errorf("%w: count", ErrConflictingLimits)
+			}
+			rule.count = parsed.count
+		}
+		if !parsed.until.IsZero() {
+			if !until.IsZero() && !until.Equal(parsed.until) {
+				return Rule{}, fmt.Errorf("%w: until", ErrConflictingLimits)
+			}
+			rule.until = parsed.until
+		}
+
+		rule.schedule = parsed
+		return rule, nil
+	}
+
+	parsed, err := parseCron(expression)
+	if err != nil {
+		return Rule{}, err
+	}
+	rule.schedule = parsed
+	return rule, nil
+}
+
+// String returns the expression rule was created from
+func (r Rule) String() string {
+	return r.expression
+}
+
+// Start returns datetime series starts at
+func (r Rule) Start() time.Time {
+	return r.start
+}
+
+// Until returns the last possible datetime of an occurrence, zero if there's no end
+func (r Rule) Until() time.Time {
+	return r.until
+}
+
+// Count returns max amount of occurrences, 0 if there's no limit
+func (r Rule) Count() int {
+	return r.count
+}
+
+// First returns datetime of the first occurrence (at or after start), false if there's none
+func (r Rule) First() (time.Time, bool) {
+	return r.Next(r.start.Add(-time.Nanosecond), 0)
+}
+
+// Next returns datetime of occurrence number “occurrence+1“: the first one strictly after given time
+//
+// false if series is over (count or until are reached)
+func (r Rule) Next(after time.Time, occurrence int) (time.Time, bool) {
+	if r.count > 0 && occurrence >= r.count {
+		return time.Time{}, false
+	}
+
+	if after.Before(r.start) {
+		after = r.start.Add(-time.Nanosecond)
+	}
+
+	// wall clock of start's zone, e.g. "0 9 * * *" is 9:00 there
+	after = after.In(r.start.Location())
+
+	next, ok := r.schedule.next(after)
+	if !ok {
+		return time.Time{}, false
+	}
+	if !r.until.IsZero() && next.After(r.until) {
+		return time.Time{}, false
+	}
+	return next, true
+}
+
+// Upcoming returns up to limit occurrences after given one (see Next)
+func (r Rule) Upcoming(after time.Time, occurrence int, limit int) []time.Time {
+	result := make([]time.Time, 0, limit)
+	for len(result) < limit {
+		next, ok := r.Next(after, occurrence)
+		if !ok {
+			break
+		}
+		result = append(result, next)
+		after = next
+		occurrence++
+	}
+	return result
+}
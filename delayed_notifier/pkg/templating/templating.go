@@ -0,0 +1,63 @@
+package templating
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	texttemplate "text/template"
+)
+
+// ErrInvalidTemplate occurs when template source can't be parsed
+var ErrInvalidTemplate = errors.New("invalid template")
+
+// ErrRenderFailed occurs when template can't be rendered with given variables, e.g. some are missing
+var ErrRenderFailed = errors.New("couldn't render template")
+
+// Kind tells which engine renders a template: plain text or HTML with escaping
+type Kind int
+
+const (
+	// KindText uses text/template
+	KindText Kind = iota
+	// KindHTML uses html/template, variables are escaped
+	KindHTML
+)
+
+// Validate checks that source can be parsed
+func Validate(source string) error {
+	if _, err := texttemplate.New("").Parse(source); err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+	}
+	return nil
+}
+
+// Render renders source with variables, every variable used must be given
+func Render(kind Kind, source string, variables map[string]any) (string, error) {
+	if variables == nil {
+		variables = map[string]any{}
+	}
+
+	var buffer bytes.Buffer
+
+	switch kind {
+	case KindHTML:
+		parsed, err := htmltemplate.New("").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		if err = parsed.Execute(&buffer, variables); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+	default:
+		parsed, err := texttemplate.New("").Option("missingkey=error").Parse(source)
+		if err != nil {
+			return "", fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		if err = parsed.Execute(&buffer, variables); err != nil {
+			return "", fmt.Errorf("%w: %w", ErrRenderFailed, err)
+		}
+	}
+
+	return buffer.String(), nil
+}
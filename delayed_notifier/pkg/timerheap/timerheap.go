@@ -0,0 +1,153 @@
+package timerheap
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// TimerHeap is a goroutine-safe min-heap of keyed deadlines
+//
+//	wakeUps := timerheap.New[string]()
+//	wakeUps.Set("a", time.Now().Add(time.Second))
+//	for {
+//		next, ok := wakeUps.Next()
+//		... // sleep until next or until <-wakeUps.Changed()
+//		for _, key := range wakeUps.PopDue(time.Now()) {
+//			...
+//		}
+//	}
+type TimerHeap[K comparable] struct {
+	mu    sync.Mutex
+	items items[K]
+	index map[K]*item[K]
+
+	// changed gets a value when the earliest deadline becomes earlier, sleepers must re-plan
+	changed chan struct{}
+}
+
+// New creates an empty TimerHeap
+func New[K comparable]() *TimerHeap[K] {
+	return &TimerHeap[K]{
+		index:   make(map[K]*item[K]),
+		changed: make(chan struct{}, 1),
+	}
+}
+
+// Set adds key with deadline at or moves existing key to at
+func (h *TimerHeap[K]) Set(key K, at time.Time) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	earliest, hadEarliest := h.next()
+
+	if existing, found := h.index[key]; found {
+		existing.at = at
+		heap.Fix(&h.items, existing.position)
+	} else {
+		newItem := &item[K]{key: key, at: at}
+		h.index[key] = newItem
+		heap.Push(&h.items, newItem)
+	}
+
+	if !hadEarliest || at.Before(earliest) {
+		h.notifyChanged()
+	}
+}
+
+// Remove deletes key, does nothing if there's no such key
+func (h *TimerHeap[K]) Remove(key K) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	existing, found := h.index[key]
+	if !found {
+		return
+	}
+	heap.Remove(&h.items, existing.position)
+	delete(h.index, key)
+}
+
+// Next returns the earliest deadline, false if heap is empty
+func (h *TimerHeap[K]) Next() (time.Time, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.next()
+}
+
+// PopDue removes and returns keys whose deadline isn't after now, earliest first
+func (h *TimerHeap[K]) PopDue(now time.Time) []K {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	due := make([]K, 0)
+	for len(h.items) > 0 && !h.items[0].at.After(now) {
+		popped := heap.Pop(&h.items).(*item[K])
+		delete(h.index, popped.key)
+		due = append(due, popped.key)
+	}
+	return due
+}
+
+// Len returns amount of keys
+func (h *TimerHeap[K]) Len() int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return len(h.items)
+}
+
+// Changed returns a channel that gets a value when the earliest deadline becomes earlier
+func (h *TimerHeap[K]) Changed() <-chan struct{} {
+	return h.changed
+}
+
+func (h *TimerHeap[K]) next() (time.Time, bool) {
+	if len(h.items) == 0 {
+		return time.Time{}, false
+	}
+	return h.items[0].at, true
+}
+
+// notifyChanged doesn't block: 1 pending value is enough for the sleeper to re-plan
+func (h *TimerHeap[K]) notifyChanged() {
+	select {
+	case h.changed <- struct{}{}:
+	default:
+	}
+}
+
+// item is 1 key with its deadline, position is its index in items
+type item[K comparable] struct {
+	key      K
+	at       time.Time
+	position int
+}
+
+// items implements heap.Interface
+type items[K comparable] []*item[K]
+
+func (it items[K]) Len() int { return len(it) }
+
+func (it items[K]) Less(i, j int) bool { return it[i].at.Before(it[j].at) }
+
+func (it items[K]) Swap(i, j int) {
+	it[i], it[j] = it[j], it[i]
+	it[i].position = i
+	it[j].position = j
+}
+
+func (it *items[K]) Push(x any) {
+	pushed := x.(*item[K])
+	pushed.position = len(*it)
+	*it = append(*it, pushed)
+}
+
+func (it *items[K]) Pop() any {
+	old := *it
+	last := old[len(old)-1]
+	old[len(old)-1] = nil
+	*it = old[:len(old)-1]
+	return last
+}
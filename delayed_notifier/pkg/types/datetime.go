@@ -1,13 +1,23 @@
 package types
 
 import (
+	"errors"
 	"fmt"
+	"strings"
 	"time"
 )
 
 const datetimeFormat = "2006-01-02 15:04:05"
 
+// naiveFormats are formats without offset, they're parsed in given zone (UTC by default)
+var naiveFormats = []string{datetimeFormat, "2006-01-02T15:04:05.999999999"}
+
+// ErrUnknownTimeZone describes an error when zone is neither an IANA name nor an offset like “+03:00“
+var ErrUnknownTimeZone = errors.New("unknown time zone")
+
 // DateTime is a value type that contains a datetime
+//
+// it keeps the zone it was created in, see Zone
 type DateTime struct {
 	val time.Time
 }
@@ -17,14 +27,109 @@ func NewDateTime(val time.Time) DateTime {
 	return DateTime{val: val}
 }
 
-// NewDateTimeFromString creates a new DateTime from string “2006-01-02 15:04:05“
+// NewDateTimeInZone creates a new DateTime from given time.Time value moved into zone (see LoadZone)
+func NewDateTimeInZone(val time.Time, zone string) (DateTime, error) {
+	location, err := LoadZone(zone)
+	if err != nil {
+		return DateTime{}, err
+	}
+	return NewDateTime(val.In(location)), nil
+}
+
+// NewDateTimeFromString creates a new DateTime from string, accepted formats:
+//
+//   - “2006-01-02 15:04:05“ - legacy one, UTC
+//   - RFC 3339 with offset: “2006-01-02T15:04:05+03:00“ or “2006-01-02T15:04:05Z“
+//   - any of above or “2006-01-02T15:04:05“ followed by IANA zone name (RFC 9557): “2006-01-02T15:04:05[Europe/Moscow]“
+//
+// the zone is kept, so String returns it back. Offset must match the zone if both are given
 func NewDateTimeFromString(val string) (DateTime, error) {
-	timeParsed, err := time.Parse(datetimeFormat, val)
+	base, zone := val, ""
+	if strings.HasSuffix(val, "]") {
+		bracket := strings.LastIndexByte(val, '[')
+		if bracket < 0 {
+			return DateTime{}, fmt.Errorf("invalid datetime format: unclosed zone in '%s'", val)
+		}
+		base, zone = val[:bracket], val[bracket+1:len(val)-1]
+	}
+
+	location, err := LoadZone(zone)
 	if err != nil {
 		return DateTime{}, fmt.Errorf("invalid datetime format: %w", err)
 	}
 
-	return NewDateTime(timeParsed), nil
+	// with offset
+	if timeParsed, parseErr := time.Parse(time.RFC3339, base); parseErr == nil {
+		if zone == "" {
+			return NewDateTime(timeParsed.In(offsetZone(timeParsed))), nil
+		}
+
+		timeInZone := timeParsed.In(location)
+		if _, offset := timeParsed.Zone(); offset != zoneOffset(timeInZone) {
+			return DateTime{}, fmt.Errorf("invalid datetime format: offset of '%s' doesn't match zone '%s'", base, zone)
+		}
+		return NewDateTime(timeInZone), nil
+	}
+
+	// without offset
+	for _, format := range naiveFormats {
+		if timeParsed, parseErr := time.ParseInLocation(format, base, location); parseErr == nil {
+			return NewDateTime(timeParsed), nil
+		}
+	}
+
+	return DateTime{}, fmt.Errorf("invalid datetime format: '%s' is neither '%s' nor RFC 3339", val, datetimeFormat)
+}
+
+// LoadZone returns location of zone: IANA name like “Europe/Moscow“, offset like “+03:00“ or "" for UTC
+func LoadZone(zone string) (*time.Location, error) {
+	if zone == "" || zone == "UTC" {
+		return time.UTC, nil
+	}
+
+	if zone[0] == '+' || zone[0] == '-' {
+		parsed, err := time.Parse("-07:00", zone)
+		if err != nil {
+			return nil, fmt.Errorf("%w: '%s'", ErrUnknownTimeZone, zone)
+		}
+		return offsetZone(parsed), nil
+	}
+
+	// "Local" depends on machine, it can't be stored
+	if zone == "Local" {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownTimeZone, zone)
+	}
+
+	location, err := time.LoadLocation(zone)
+	if err != nil {
+		return nil, fmt.Errorf("%w: '%s'", ErrUnknownTimeZone, zone)
+	}
+	return location, nil
+}
+
+// offsetZone returns UTC or a fixed zone named like “+03:00“ with t's offset
+func offsetZone(t time.Time) *time.Location {
+	offset := zoneOffset(t)
+	if offset == 0 {
+		return time.UTC
+	}
+	return time.FixedZone(formatOffset(offset), offset)
+}
+
+// zoneOffset returns t's offset from UTC in seconds
+func zoneOffset(t time.Time) int {
+	_, offset := t.Zone()
+	return offset
+}
+
+// formatOffset turns seconds into “+03:00“
+func formatOffset(offset int) string {
+	sign := '+'
+	if offset < 0 {
+		sign = '-'
+		offset = -offset
+	}
+	return fmt.Sprintf("%c%02d:%02d", sign, offset/3600, offset%3600/60)
 }
 
 // GreaterOrEqualThan returns if given date is later or equal than another one
@@ -37,7 +142,59 @@ func (d DateTime) Value() time.Time {
 	return d.val
 }
 
+// Zone returns the zone of datetime: IANA name, offset like “+03:00“ or "" for UTC
+//
+// LoadZone turns it back into location
+func (d DateTime) Zone() string {
+	name := d.val.Location().String()
+	switch {
+	case name == "UTC":
+		return ""
+	case name == "" || name == "Local":
+		if offset := zoneOffset(d.val); offset != 0 {
+			return formatOffset(offset)
+		}
+		return ""
+	default:
+		return name
+	}
+}
+
+// UTC returns the same datetime in UTC
+func (d DateTime) UTC() DateTime {
+	return NewDateTime(d.val.UTC())
+}
+
 // String returns value of types.DateTime converted to string
+//
+// UTC datetimes keep the legacy format “2006-01-02 15:04:05“, others are RFC 3339 with IANA zone name if there's one
 func (d DateTime) String() string {
-	return d.Value().Format(datetimeFormat)
+	zone := d.Zone()
+	switch {
+	case zone == "":
+		return d.val.UTC().Format(datetimeFormat)
+	case zone[0] == '+' || zone[0] == '-':
+		return d.val.Format(time.RFC3339)
+	default:
+		return d.val.Format(time.RFC3339) + "[" + zone + "]"
+	}
+}
+
+// MarshalText implements encoding.TextMarshaler, nanoseconds and zone are kept
+func (d DateTime) MarshalText() ([]byte, error) {
+	text := d.val.Format(time.RFC3339Nano)
+	if zone := d.Zone(); zone != "" && zone[0] != '+' && zone[0] != '-' {
+		text += "[" + zone + "]"
+	}
+	return []byte(text), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see MarshalText
+func (d *DateTime) UnmarshalText(text []byte) error {
+	parsed, err := NewDateTimeFromString(string(text))
+	if err != nil {
+		return err
+	}
+	*d = parsed
+	return nil
 }
@@ -37,3 +37,18 @@ func (v UUID) Value() uuid.UUID {
 func (v UUID) String() string {
 	return v.value.String()
 }
+
+// MarshalText implements encoding.TextMarshaler, so that UUID survives json
+func (v UUID) MarshalText() ([]byte, error) {
+	return []byte(v.value.String()), nil
+}
+
+// UnmarshalText implements encoding.TextUnmarshaler, see NewUUID
+func (v *UUID) UnmarshalText(text []byte) error {
+	id, err := NewUUID(string(text))
+	if err != nil {
+		return err
+	}
+	*v = id
+	return nil
+}
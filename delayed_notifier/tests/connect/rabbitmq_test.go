@@ -0,0 +1,60 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/config"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/connect"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"maps"
+	"slices"
+	"testing"
+)
+
+func TestChannelQueues(t *testing.T) {
+	testCases := []struct {
+		name            string
+		queueForChannel config.QueueSend
+		expected        map[string][]string
+	}{
+		{
+			name:            "shared queue",
+			queueForChannel: config.QueueSend{},
+			expected: map[string][]string{
+				"notifications": {internaltypes.EMAIL, internaltypes.TELEGRAM, internaltypes.CONSOLE},
+			},
+		},
+		{
+			name:            "some own queues",
+			queueForChannel: config.QueueSend{Email: "notifications.email"},
+			expected: map[string][]string{
+				"notifications.email": {internaltypes.EMAIL},
+				"notifications":       {internaltypes.TELEGRAM, internaltypes.CONSOLE},
+			},
+		},
+		{
+			name:            "own queues",
+			queueForChannel: config.QueueSend{Email: "email", Telegram: "telegram", Console: "console"},
+			expected: map[string][]string{
+				"email":    {internaltypes.EMAIL},
+				"telegram": {internaltypes.TELEGRAM},
+				"console":  {internaltypes.CONSOLE},
+			},
+		},
+		{
+			name:            "queue of 2 channels",
+			queueForChannel: config.QueueSend{Email: "slow", Telegram: "slow", Console: "console"},
+			expected: map[string][]string{
+				"slow":    {internaltypes.EMAIL, internaltypes.TELEGRAM},
+				"console": {internaltypes.CONSOLE},
+			},
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			queues := connect.ChannelQueues(config.RabbitMQConfig{QueueSend: "notifications", QueueForChannel: tc.queueForChannel})
+			if !maps.EqualFunc(queues, tc.expected, slices.Equal) {
+				t.Errorf("Expected '%v', got '%v'", tc.expected, queues)
+			}
+		})
+	}
+}
@@ -0,0 +1,53 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/delaybuckets"
+	"testing"
+	"time"
+)
+
+func TestOfRoundsDelayDown(t *testing.T) {
+	layout := delaybuckets.Layout{Exchange: "notifications.delay", Step: time.Second, Amount: 60}
+
+	testCases := []struct {
+		name     string
+		layout   delaybuckets.Layout
+		delay    time.Duration
+		expected int
+	}{
+		{name: "past", layout: layout, delay: -time.Second, expected: 0},
+		{name: "shorter than step", layout: layout, delay: time.Second - time.Nanosecond, expected: 0},
+		{name: "exact step", layout: layout, delay: time.Second, expected: 1},
+		{name: "rounded down", layout: layout, delay: 2*time.Second + 999*time.Millisecond, expected: 2},
+		{name: "exact max", layout: layout, delay: time.Minute, expected: 60},
+		{name: "longer than max", layout: layout, delay: time.Hour, expected: 60},
+		{name: "disabled", layout: delaybuckets.Layout{Step: time.Second, Amount: 60}, delay: time.Hour, expected: 0},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if bucket := tc.layout.Of(tc.delay); bucket != tc.expected {
+				t.Errorf("Expected '%d', got '%d'", tc.expected, bucket)
+			}
+		})
+	}
+}
+
+func TestQueueNamesAreUnique(t *testing.T) {
+	layout := delaybuckets.Layout{Exchange: "notifications.delay", Step: 500 * time.Millisecond, Amount: 4}
+
+	if layout.Max() != 2*time.Second {
+		t.Errorf("Expected '%s', got '%s'", 2*time.Second, layout.Max())
+	}
+
+	names := make(map[string]bool)
+	for _, bucket := range layout.Buckets() {
+		names[layout.QueueName(bucket)] = true
+	}
+	if len(names) != 4 {
+		t.Errorf("Expected '%d', got '%d'", 4, len(names))
+	}
+	if name := layout.QueueName(3); name != "notifications.delay.1500" {
+		t.Errorf("Expected '%s', got '%s'", "notifications.delay.1500", name)
+	}
+}
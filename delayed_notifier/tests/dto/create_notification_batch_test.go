@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"strings"
+	"testing"
+)
+
+func TestParseCreateNotificationBatch(t *testing.T) {
+	tests := []struct {
+		name        string
+		contentType string
+		body        string
+		expectErr   bool
+		parseErrs   []bool
+	}{
+		{
+			name:        "JSON array",
+			contentType: "application/json",
+			body:        `[{"channel":"console"},{"channel":"telegram","send_to":"1"}]`,
+			parseErrs:   []bool{false, false},
+		},
+		{
+			name:        "JSON array with invalid item",
+			contentType: "application/json; charset=utf-8",
+			body:        `[{"channel":"console"},{"channel":42}]`,
+			parseErrs:   []bool{false, true},
+		},
+		{
+			name:        "NDJSON with empty and invalid lines",
+			contentType: "application/x-ndjson",
+			body:        "{\"channel\":\"console\"}\n\n{broken\n{\"channel\":\"console\"}\n",
+			parseErrs:   []bool{false, true, false},
+		},
+		{
+			name:        "not an array",
+			contentType: "application/json",
+			body:        `{"channel":"console"}`,
+			expectErr:   true,
+		},
+		{
+			name:        "empty",
+			contentType: "application/json",
+			body:        `[]`,
+			expectErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, err := dto.ParseCreateNotificationBatch(tt.contentType, strings.NewReader(tt.body))
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got %d items", len(items))
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if len(items) != len(tt.parseErrs) {
+				t.Fatalf("Expected %d items, got %d", len(tt.parseErrs), len(items))
+			}
+			for i, item := range items {
+				if (item.ParseErr != nil) != tt.parseErrs[i] {
+					t.Errorf("Item %d: expected parse error: %v, got '%v'", i, tt.parseErrs[i], item.ParseErr)
+				}
+			}
+		})
+	}
+}
+
+func TestParseCreateNotificationBatch_TooLarge(t *testing.T) {
+	body := strings.Repeat("{}\n", dto.MaxBatchItems+1)
+
+	_, err := dto.ParseCreateNotificationBatch("application/x-ndjson", strings.NewReader(body))
+	if !errors.Is(err, dto.ErrBatchTooLarge) {
+		t.Errorf("Expected ErrBatchTooLarge, got '%v'", err)
+	}
+}
+
+func TestCreateNotificationBody_ToBatchEntity(t *testing.T) {
+	var body dto.CreateNotificationBody
+	body.PublicationAt = "2025-10-08 21:30:00"
+	body.Channel = "console"
+
+	if _, err := body.ToBatchEntity(); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	if err := json.Unmarshal([]byte(`{"recurrence":{"rule":"@daily"}}`), &body); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if _, err := body.ToBatchEntity(); err == nil {
+		t.Error("Expected error for recurrence in batch")
+	}
+}
+
+// endlessArray is the JSON array that never ends
+type endlessArray struct {
+	started bool
+}
+
+func (a *endlessArray) Read(p []byte) (int, error) {
+	if !a.started {
+		a.started = true
+		return copy(p, "["), nil
+	}
+	return copy(p, `{"channel":"console"},`), nil
+}
+
+func TestParseCreateNotificationBatch_TooLargeArray(t *testing.T) {
+	_, err := dto.ParseCreateNotificationBatch("application/json", &endlessArray{})
+	if !errors.Is(err, dto.ErrBatchTooLarge) {
+		t.Errorf("Expected ErrBatchTooLarge, got '%v'", err)
+	}
+}
@@ -0,0 +1,85 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"testing"
+)
+
+func TestCreateNotificationBody_ToParent(t *testing.T) {
+	base := func() dto.CreateNotificationBody {
+		var body dto.CreateNotificationBody
+		body.PublicationAt = "2025-10-08 21:30:00"
+		body.Content.Title = "title"
+		body.Content.Message = "message"
+		return body
+	}
+
+	tests := []struct {
+		name       string
+		modify     func(body *dto.CreateNotificationBody)
+		recipients string
+		wantErr    bool
+		wantCount  int
+	}{
+		{
+			name:       "two channels",
+			recipients: `[{"channel":"telegram","send_to":"123"},{"channel":"console","send_to":"anyone"}]`,
+			wantCount:  2,
+		},
+		{
+			name:       "no recipients",
+			recipients: `[]`,
+			wantCount:  0,
+		},
+		{
+			name:       "invalid address",
+			recipients: `[{"channel":"telegram","send_to":"not a chat id"}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "invalid channel",
+			recipients: `[{"channel":"pigeon","send_to":"123"}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "duplicate",
+			recipients: `[{"channel":"telegram","send_to":"123"},{"channel":"telegram","send_to":"123"}]`,
+			wantErr:    true,
+		},
+		{
+			name:       "with top-level channel",
+			modify:     func(body *dto.CreateNotificationBody) { body.Channel = "console" },
+			recipients: `[{"channel":"telegram","send_to":"123"}]`,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body := base()
+			if tt.modify != nil {
+				tt.modify(&body)
+			}
+			if err := json.Unmarshal([]byte(`{"recipients":`+tt.recipients+`}`), &body); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			parent, err := body.ToParent()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error: %v, got '%v'", tt.wantErr, err)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			count := 0
+			if parent != nil {
+				count = len(parent.Recipients)
+			}
+			if count != tt.wantCount {
+				t.Errorf("Expected %d recipients, got %d", tt.wantCount, count)
+			}
+		})
+	}
+}
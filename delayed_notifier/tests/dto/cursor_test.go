@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestNotificationCursor_RoundTrip(t *testing.T) {
+	id, err := types.NewUUID("123e4567-e89b-12d3-a456-426614174000")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cursor := &models.NotificationCursor{
+		PublicationAt: types.NewDateTime(time.Date(2025, time.October, 8, 21, 30, 0, 123456789, time.UTC)),
+		ID:            id,
+	}
+
+	decoded, err := dto.DecodeNotificationCursor(dto.EncodeNotificationCursor(cursor))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !decoded.PublicationAt.Value().Equal(cursor.PublicationAt.Value()) {
+		t.Errorf("Expected publication_at '%v', got '%v'", cursor.PublicationAt.Value(), decoded.PublicationAt.Value())
+	}
+
+	if decoded.ID.String() != cursor.ID.String() {
+		t.Errorf("Expected id '%s', got '%s'", cursor.ID.String(), decoded.ID.String())
+	}
+}
+
+func TestDecodeNotificationCursor_Invalid(t *testing.T) {
+	tests := []struct {
+		name  string
+		input string
+	}{
+		{name: "not base64", input: "!!!"},
+		{name: "no separator", input: "bm8tc2VwYXJhdG9y"},
+		{name: "bad datetime", input: "YmFkfDEyM2U0NTY3LWU4OWItMTJkMy1hNDU2LTQyNjYxNDE3NDAwMA"},
+		{name: "bad uuid", input: "MjAyNS0xMC0wOFQyMTozMDowMFp8YmFk"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := dto.DecodeNotificationCursor(tt.input)
+			if !errors.Is(err, dto.ErrInvalidCursor) {
+				t.Errorf("Expected ErrInvalidCursor, got '%v'", err)
+			}
+		})
+	}
+}
+
+func TestDeadLetterCursor_RoundTrip(t *testing.T) {
+	id, err := types.NewUUID("123e4567-e89b-12d3-a456-426614174000")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	cursor := &models.DeadLetterCursor{
+		FailedAt: types.NewDateTime(time.Date(2025, time.October, 8, 21, 30, 0, 123456789, time.UTC)),
+		ID:       id,
+	}
+
+	decoded, err := dto.DecodeDeadLetterCursor(dto.EncodeDeadLetterCursor(cursor))
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if !decoded.FailedAt.Value().Equal(cursor.FailedAt.Value()) {
+		t.Errorf("Expected failed_at '%v', got '%v'", cursor.FailedAt.Value(), decoded.FailedAt.Value())
+	}
+
+	if decoded.ID.String() != cursor.ID.String() {
+		t.Errorf("Expected id '%s', got '%s'", cursor.ID.String(), decoded.ID.String())
+	}
+}
+
+func TestDeadLetterFilterRequest_ToFilter(t *testing.T) {
+	filter, err := (&dto.DeadLetterFilterRequest{Channel: "email", Source: "publish"}).ToFilter()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if filter.Channel == nil || filter.Channel.String() != "email" {
+		t.Errorf("Expected channel '%s', got '%v'", "email", filter.Channel)
+	}
+	if filter.Source == nil || *filter.Source != models.DeadLetterSourcePublish {
+		t.Errorf("Expected source '%s', got '%v'", models.DeadLetterSourcePublish, filter.Source)
+	}
+	if filter.FailedAtFrom != nil || filter.FailedAtTo != nil || filter.NotificationID != nil {
+		t.Errorf("Expected no other filters, got '%+v'", filter)
+	}
+
+	if _, err = (&dto.DeadLetterFilterRequest{Source: "worker"}).ToFilter(); err == nil {
+		t.Errorf("Expected error for unknown source, got nil")
+	}
+}
@@ -0,0 +1,61 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/dto"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestWakeUpNoticeRoundTrip(t *testing.T) {
+	id := types.GenerateUUID()
+	at := time.Date(2025, 1, 1, 12, 0, 0, 123456789, time.FixedZone("MSK", 3*60*60))
+
+	tests := []struct {
+		name   string
+		wakeUp *models.WakeUp
+	}{
+		{name: "with ID", wakeUp: &models.WakeUp{ID: &id, At: at}},
+		{name: "reload without ID", wakeUp: &models.WakeUp{At: at}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := dto.WakeUpNoticeFromEntityBytes(tt.wakeUp)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			parsed, err := dto.WakeUpNoticeBytesToEntity(body)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if !parsed.At.Equal(tt.wakeUp.At) {
+				t.Errorf("Expected '%s', got '%s'", tt.wakeUp.At, parsed.At)
+			}
+			if (parsed.ID == nil) != (tt.wakeUp.ID == nil) || (parsed.ID != nil && *parsed.ID != *tt.wakeUp.ID) {
+				t.Errorf("Expected '%v', got '%v'", tt.wakeUp.ID, parsed.ID)
+			}
+		})
+	}
+}
+
+func TestParseInvalidWakeUpNotice(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+	}{
+		{name: "not JSON", body: `{broken`},
+		{name: "invalid at", body: `{"at":"tomorrow"}`},
+		{name: "invalid id", body: `{"id":"42","at":"2025-01-01T12:00:00Z"}`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := dto.WakeUpNoticeBytesToEntity([]byte(tt.body)); err == nil {
+				t.Errorf("Expected error, got nil")
+			}
+		})
+	}
+}
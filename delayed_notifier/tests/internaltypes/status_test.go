@@ -0,0 +1,102 @@
+package tests
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"testing"
+)
+
+func TestNotificationStatusFromString(t *testing.T) {
+	for _, value := range []string{"scheduled", "queued", "delivered", "failed", "cancelled", "expired"} {
+		status, err := internaltypes.NotificationStatusFromString(value)
+		if err != nil {
+			t.Errorf("Unexpected error for '%s': %v", value, err)
+		}
+		if status.String() != value {
+			t.Errorf("Expected '%s', got '%s'", value, status.String())
+		}
+	}
+
+	_, err := internaltypes.NotificationStatusFromString("sent")
+	if !errors.Is(err, internaltypes.ErrInvalidNotificationStatusValue) {
+		t.Errorf("Expected ErrInvalidNotificationStatusValue, got '%v'", err)
+	}
+}
+
+func TestNotificationStatus_CanTransitionTo(t *testing.T) {
+	tests := []struct {
+		name     string
+		from     internaltypes.NotificationStatus
+		to       internaltypes.NotificationStatus
+		expected bool
+	}{
+		{"scheduled to queued", internaltypes.StatusScheduled, internaltypes.StatusQueued, true},
+		{"scheduled to cancelled", internaltypes.StatusScheduled, internaltypes.StatusCancelled, true},
+		{"scheduled to expired", internaltypes.StatusScheduled, internaltypes.StatusExpired, true},
+		{"scheduled to delivered", internaltypes.StatusScheduled, internaltypes.StatusDelivered, false},
+		{"queued to delivered", internaltypes.StatusQueued, internaltypes.StatusDelivered, true},
+		{"queued to failed", internaltypes.StatusQueued, internaltypes.StatusFailed, true},
+		{"queued to scheduled", internaltypes.StatusQueued, internaltypes.StatusScheduled, true},
+		{"queued to cancelled", internaltypes.StatusQueued, internaltypes.StatusCancelled, false},
+		{"failed to scheduled", internaltypes.StatusFailed, internaltypes.StatusScheduled, true},
+		{"delivered to anything", internaltypes.StatusDelivered, internaltypes.StatusScheduled, false},
+		{"cancelled to anything", internaltypes.StatusCancelled, internaltypes.StatusQueued, false},
+		{"expired to anything", internaltypes.StatusExpired, internaltypes.StatusQueued, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if result := tt.from.CanTransitionTo(tt.to); result != tt.expected {
+				t.Errorf("Expected %v, got %v", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestNotificationStatus_AllowedPrevious(t *testing.T) {
+	previous := internaltypes.StatusScheduled.AllowedPrevious()
+	if len(previous) != 2 {
+		t.Fatalf("Expected 2 statuses, got %d", len(previous))
+	}
+	for _, status := range previous {
+		if !status.CanTransitionTo(internaltypes.StatusScheduled) {
+			t.Errorf("'%s' can't be moved into 'scheduled'", status)
+		}
+	}
+
+	if len(internaltypes.StatusQueued.AllowedPrevious()) != 1 {
+		t.Error("Only 'scheduled' may be moved into 'queued'")
+	}
+}
+
+func TestNotificationStatus_IsFinal(t *testing.T) {
+	for _, status := range []internaltypes.NotificationStatus{internaltypes.StatusDelivered, internaltypes.StatusCancelled, internaltypes.StatusExpired} {
+		if !status.IsFinal() {
+			t.Errorf("'%s' should be final", status)
+		}
+	}
+	for _, status := range []internaltypes.NotificationStatus{internaltypes.StatusScheduled, internaltypes.StatusQueued, internaltypes.StatusFailed} {
+		if status.IsFinal() {
+			t.Errorf("'%s' shouldn't be final", status)
+		}
+	}
+}
+
+func TestNotificationStatus_TextRoundTrip(t *testing.T) {
+	text, err := internaltypes.StatusCancelled.MarshalText()
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var status internaltypes.NotificationStatus
+	if err = status.UnmarshalText(text); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if status != internaltypes.StatusCancelled {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusCancelled.String(), status.String())
+	}
+
+	if err = status.UnmarshalText([]byte("sent")); !errors.Is(err, internaltypes.ErrInvalidNotificationStatusValue) {
+		t.Errorf("Expected ErrInvalidNotificationStatusValue, got '%v'", err)
+	}
+}
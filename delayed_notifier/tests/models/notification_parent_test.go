@@ -0,0 +1,50 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"testing"
+)
+
+func TestNotificationParent_AggregateStatus(t *testing.T) {
+	tests := []struct {
+		name   string
+		counts map[internaltypes.NotificationStatus]int
+		want   string
+	}{
+		{
+			name:   "all scheduled",
+			counts: map[internaltypes.NotificationStatus]int{internaltypes.StatusScheduled: 3},
+			want:   internaltypes.SCHEDULED,
+		},
+		{
+			name:   "all delivered, empty ones ignored",
+			counts: map[internaltypes.NotificationStatus]int{internaltypes.StatusDelivered: 3, internaltypes.StatusFailed: 0},
+			want:   internaltypes.DELIVERED,
+		},
+		{
+			name:   "some queued",
+			counts: map[internaltypes.NotificationStatus]int{internaltypes.StatusQueued: 1, internaltypes.StatusDelivered: 2},
+			want:   models.AggregateInProgress,
+		},
+		{
+			name:   "some failed",
+			counts: map[internaltypes.NotificationStatus]int{internaltypes.StatusFailed: 1, internaltypes.StatusDelivered: 2},
+			want:   models.AggregatePartiallyDelivered,
+		},
+		{
+			name:   "none delivered",
+			counts: map[internaltypes.NotificationStatus]int{internaltypes.StatusFailed: 1, internaltypes.StatusCancelled: 2},
+			want:   models.AggregateUndelivered,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			parent := &models.NotificationParent{StatusCounts: tt.counts}
+			if got := parent.AggregateStatus(); got != tt.want {
+				t.Errorf("Expected '%s', got '%s'", tt.want, got)
+			}
+		})
+	}
+}
@@ -0,0 +1,122 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+func patchedNotification(t *testing.T, template bool) *models.Notification {
+	sendTo, err := internaltypes.NewSendTo(types.NewAnyText("100"), internaltypes.ChannelTelegram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	notification := &models.Notification{
+		PublicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+		Channel:       internaltypes.ChannelTelegram,
+		Content:       models.NotificationContent{Title: "title", Message: "message"},
+		Status:        internaltypes.StatusScheduled,
+		SendTo:        sendTo,
+	}
+	if template {
+		notification.Content = models.NotificationContent{}
+		notification.Template = &models.NotificationTemplate{ID: types.GenerateUUID()}
+	}
+	return notification
+}
+
+func TestNotificationPatch_Apply(t *testing.T) {
+	newPublicationAt := types.NewDateTime(time.Date(2031, 6, 1, 8, 30, 0, 0, time.UTC))
+	newTitle := types.NewAnyText("new title")
+	newMessage := types.NewAnyText("new message")
+	newSendTo := types.NewAnyText("200")
+	invalidSendTo := types.NewAnyText("not a chat id")
+
+	tests := []struct {
+		name          string
+		template      bool
+		patch         models.NotificationPatch
+		wantErr       bool
+		publicationAt types.DateTime
+		title         string
+		message       string
+		sendTo        string
+	}{
+		{
+			name:          "empty patch",
+			patch:         models.NotificationPatch{},
+			publicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+			title:         "title",
+			message:       "message",
+			sendTo:        "100",
+		},
+		{
+			name:          "every field",
+			patch:         models.NotificationPatch{PublicationAt: &newPublicationAt, Title: &newTitle, Message: &newMessage, SendTo: &newSendTo},
+			publicationAt: newPublicationAt,
+			title:         "new title",
+			message:       "new message",
+			sendTo:        "200",
+		},
+		{
+			name:          "only message",
+			patch:         models.NotificationPatch{Message: &newMessage},
+			publicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+			title:         "title",
+			message:       "new message",
+			sendTo:        "100",
+		},
+		{
+			name:          "send_to invalid for channel",
+			patch:         models.NotificationPatch{PublicationAt: &newPublicationAt, SendTo: &invalidSendTo},
+			wantErr:       true,
+			publicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+			title:         "title",
+			message:       "message",
+			sendTo:        "100",
+		},
+		{
+			name:          "content of templated notification",
+			template:      true,
+			patch:         models.NotificationPatch{Title: &newTitle},
+			wantErr:       true,
+			publicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+			sendTo:        "100",
+		},
+		{
+			name:          "schedule of templated notification",
+			template:      true,
+			patch:         models.NotificationPatch{PublicationAt: &newPublicationAt, SendTo: &newSendTo},
+			publicationAt: newPublicationAt,
+			sendTo:        "200",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := patchedNotification(t, tt.template)
+
+			err := tt.patch.Apply(notification)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Expected error '%v', got '%v'", tt.wantErr, err)
+			}
+
+			// failed patch doesn't change anything
+			if !notification.PublicationAt.Value().Equal(tt.publicationAt.Value()) {
+				t.Errorf("Expected '%s', got '%s'", tt.publicationAt.String(), notification.PublicationAt.String())
+			}
+			if notification.Content.Title.String() != tt.title {
+				t.Errorf("Expected '%s', got '%s'", tt.title, notification.Content.Title.String())
+			}
+			if notification.Content.Message.String() != tt.message {
+				t.Errorf("Expected '%s', got '%s'", tt.message, notification.Content.Message.String())
+			}
+			if notification.SendTo.String() != tt.sendTo {
+				t.Errorf("Expected '%s', got '%s'", tt.sendTo, notification.SendTo.String())
+			}
+		})
+	}
+}
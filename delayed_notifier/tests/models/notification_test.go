@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+// cached notifications are json of the model, every field must survive it
+func TestNotification_JSONRoundTrip(t *testing.T) {
+	sendTo, err := internaltypes.NewSendTo(types.NewAnyText("100"), internaltypes.ChannelTelegram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id, seriesID, parentID := types.GenerateUUID(), types.GenerateUUID(), types.GenerateUUID()
+
+	original := &models.Notification{
+		ID:            &id,
+		PublicationAt: types.NewDateTime(time.Date(2030, 1, 1, 12, 0, 0, 0, time.UTC)),
+		Channel:       internaltypes.ChannelTelegram,
+		Content:       models.NotificationContent{Title: "title", Message: "message"},
+		Status:        internaltypes.StatusQueued,
+		SendTo:        sendTo,
+		Delivery:      &models.DeliveryInfo{Attempts: 2, LastError: "timeout"},
+		SeriesID:      &seriesID,
+		Occurrence:    3,
+		ParentID:      &parentID,
+	}
+
+	data, err := json.Marshal(original)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	var restored models.Notification
+	if err = json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if restored.ID == nil || *restored.ID != id {
+		t.Errorf("Expected '%s', got '%v'", id.String(), restored.ID)
+	}
+	if restored.Status != internaltypes.StatusQueued {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusQueued.String(), restored.Status.String())
+	}
+	if restored.Channel != internaltypes.ChannelTelegram {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.ChannelTelegram.String(), restored.Channel.String())
+	}
+	if restored.SendTo.String() != "100" {
+		t.Errorf("Expected '%s', got '%s'", "100", restored.SendTo.String())
+	}
+	if !restored.PublicationAt.Value().Equal(original.PublicationAt.Value()) {
+		t.Errorf("Expected '%s', got '%s'", original.PublicationAt.String(), restored.PublicationAt.String())
+	}
+	if restored.SeriesID == nil || *restored.SeriesID != seriesID || restored.Occurrence != 3 {
+		t.Errorf("Expected series '%s' #%d, got '%v' #%d", seriesID.String(), 3, restored.SeriesID, restored.Occurrence)
+	}
+	if restored.ParentID == nil || *restored.ParentID != parentID {
+		t.Errorf("Expected '%s', got '%v'", parentID.String(), restored.ParentID)
+	}
+	if restored.Delivery == nil || restored.Delivery.Attempts != 2 {
+		t.Errorf("Expected '%d' attempts, got '%v'", 2, restored.Delivery)
+	}
+}
+
+func TestNotification_JSONRejectsInvalidStatus(t *testing.T) {
+	var restored models.Notification
+	if err := json.Unmarshal([]byte(`{"Status":"sent"}`), &restored); err == nil {
+		t.Errorf("Expected an error")
+	}
+}
@@ -0,0 +1,231 @@
+package tests
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
+	"testing"
+	"time"
+)
+
+const layout = "2006-01-02 15:04:05"
+
+func mustParse(t *testing.T, value string) time.Time {
+	t.Helper()
+	result, err := time.Parse(layout, value)
+	if err != nil {
+		t.Fatalf("bad test datetime '%s': %v", value, err)
+	}
+	return result
+}
+
+func TestRuleUpcoming(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		start      string
+		until      string
+		count      int
+		limit      int
+		expected   []string
+	}{
+		{
+			name:       "cron every day at 9",
+			expression: "0 9 * * *",
+			start:      "2025-10-08 10:00:00",
+			limit:      3,
+			expected:   []string{"2025-10-09 09:00:00", "2025-10-10 09:00:00", "2025-10-11 09:00:00"},
+		},
+		{
+			name:       "cron start matches exactly",
+			expression: "30 9 * * *",
+			start:      "2025-10-08 09:30:00",
+			limit:      2,
+			expected:   []string{"2025-10-08 09:30:00", "2025-10-09 09:30:00"},
+		},
+		{
+			name:       "cron weekdays with names",
+			expression: "0 18 * * MON-FRI",
+			start:      "2025-10-10 19:00:00", // friday
+			limit:      2,
+			expected:   []string{"2025-10-13 18:00:00", "2025-10-14 18:00:00"},
+		},
+		{
+			name:       "cron step",
+			expression: "*/20 * * * *",
+			start:      "2025-10-08 10:05:00",
+			limit:      3,
+			expected:   []string{"2025-10-08 10:20:00", "2025-10-08 10:40:00", "2025-10-08 11:00:00"},
+		},
+		{
+			name:       "cron day of month or day of week",
+			expression: "0 0 1 * SUN",
+			start:      "2025-10-30 00:00:00", // thursday
+			limit:      3,
+			expected:   []string{"2025-11-01 00:00:00", "2025-11-02 00:00:00", "2025-11-09 00:00:00"},
+		},
+		{
+			name:       "cron descriptor with count",
+			expression: "@monthly",
+			start:      "2025-10-08 00:00:00",
+			count:      2,
+			limit:      5,
+			expected:   []string{"2025-11-01 00:00:00", "2025-12-01 00:00:00"},
+		},
+		{
+			name:       "cron with until",
+			expression: "0 12 * * *",
+			start:      "2025-10-08 00:00:00",
+			until:      "2025-10-09 12:00:00",
+			limit:      5,
+			expected:   []string{"2025-10-08 12:00:00", "2025-10-09 12:00:00"},
+		},
+		{
+			name:       "rrule daily with count",
+			expression: "FREQ=DAILY;COUNT=3",
+			start:      "2025-10-08 09:00:00",
+			limit:      5,
+			expected:   []string{"2025-10-08 09:00:00", "2025-10-09 09:00:00", "2025-10-10 09:00:00"},
+		},
+		{
+			name:       "rrule hourly interval",
+			expression: "RRULE:FREQ=HOURLY;INTERVAL=6",
+			start:      "2025-10-08 09:00:00",
+			limit:      3,
+			expected:   []string{"2025-10-08 09:00:00", "2025-10-08 15:00:00", "2025-10-08 21:00:00"},
+		},
+		{
+			name:       "rrule weekly by day",
+			expression: "FREQ=WEEKLY;BYDAY=MO,FR",
+			start:      "2025-10-08 09:00:00", // wednesday
+			limit:      3,
+			expected:   []string{"2025-10-10 09:00:00", "2025-10-13 09:00:00", "2025-10-17 09:00:00"},
+		},
+		{
+			name:       "rrule biweekly",
+			expression: "FREQ=WEEKLY;INTERVAL=2",
+			start:      "2025-10-08 09:00:00",
+			limit:      2,
+			expected:   []string{"2025-10-08 09:00:00", "2025-10-22 09:00:00"},
+		},
+		{
+			name:       "rrule monthly skips short months",
+			expression: "FREQ=MONTHLY",
+			start:      "2025-01-31 09:00:00",
+			limit:      3,
+			expected:   []string{"2025-01-31 09:00:00", "2025-03-31 09:00:00", "2025-05-31 09:00:00"},
+		},
+		{
+			name:       "rrule until date is inclusive",
+			expression: "FREQ=DAILY;UNTIL=20251009",
+			start:      "2025-10-08 09:00:00",
+			limit:      5,
+			expected:   []string{"2025-10-08 09:00:00", "2025-10-09 09:00:00"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var until time.Time
+			if tt.until != "" {
+				until = mustParse(t, tt.until)
+			}
+
+			rule, err := recurrence.NewRule(tt.expression, mustParse(t, tt.start), until, tt.count)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			result := rule.Upcoming(rule.Start().Add(-time.Nanosecond), 0, tt.limit)
+			if len(result) != len(tt.expected) {
+				t.Fatalf("Expected %d occurrences, got %d: %v", len(tt.expected), len(result), result)
+			}
+			for i, expected := range tt.expected {
+				if result[i].Format(layout) != expected {
+					t.Errorf("Expected '%s', got '%s'", expected, result[i].Format(layout))
+				}
+			}
+		})
+	}
+}
+
+func TestRuleNextAfterManyPeriods(t *testing.T) {
+	rule, err := recurrence.NewRule("FREQ=MINUTELY;INTERVAL=7", mustParse(t, "2025-01-01 00:00:00"), time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	next, ok := rule.Next(mustParse(t, "2025-06-01 00:00:00"), 100)
+	if !ok {
+		t.Fatal("Expected next occurrence")
+	}
+	// 2025-06-01 is 217440 minutes after start, 217441 is the next multiple of 7
+	expected := "2025-06-01 00:01:00"
+	if next.Format(layout) != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, next.Format(layout))
+	}
+}
+
+func TestRuleNextInStartZone(t *testing.T) {
+	moscow, err := time.LoadLocation("Europe/Moscow")
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	start := time.Date(2025, time.October, 8, 10, 0, 0, 0, moscow)
+	rule, err := recurrence.NewRule("0 9 * * *", start, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// "now" is usually UTC, but 9:00 is Moscow's wall clock
+	next, ok := rule.Next(mustParse(t, "2025-10-09 05:00:00"), 1)
+	if !ok {
+		t.Fatal("Expected next occurrence")
+	}
+
+	expected := "2025-10-09 06:00:00"
+	if next.UTC().Format(layout) != expected {
+		t.Errorf("Expected '%s', got '%s'", expected, next.UTC().Format(layout))
+	}
+	if next.Location() != moscow {
+		t.Errorf("Expected location '%s', got '%s'", moscow, next.Location())
+	}
+}
+
+func TestRuleCountIsReached(t *testing.T) {
+	rule, err := recurrence.NewRule("0 9 * * *", mustParse(t, "2025-10-08 00:00:00"), time.Time{}, 2)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if _, ok := rule.Next(mustParse(t, "2025-10-09 09:00:00"), 2); ok {
+		t.Errorf("Expected no occurrence after count is reached")
+	}
+}
+
+func TestRuleInvalid(t *testing.T) {
+	tests := []struct {
+		name       string
+		expression string
+		count      int
+		expected   error
+	}{
+		{name: "empty", expression: "", expected: recurrence.ErrInvalidRule},
+		{name: "cron 4 fields", expression: "* * * *", expected: recurrence.ErrInvalidRule},
+		{name: "cron out of range", expression: "60 * * * *", expected: recurrence.ErrInvalidRule},
+		{name: "cron bad step", expression: "*/0 * * * *", expected: recurrence.ErrInvalidRule},
+		{name: "rrule no freq", expression: "RRULE:COUNT=3", expected: recurrence.ErrInvalidRule},
+		{name: "rrule unsupported part", expression: "FREQ=MONTHLY;BYSETPOS=-1", expected: recurrence.ErrInvalidRule},
+		{name: "rrule byday with monthly", expression: "FREQ=MONTHLY;BYDAY=MO", expected: recurrence.ErrInvalidRule},
+		{name: "count given twice", expression: "FREQ=DAILY;COUNT=3", count: 5, expected: recurrence.ErrConflictingLimits},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := recurrence.NewRule(tt.expression, mustParse(t, "2025-10-08 00:00:00"), time.Time{}, tt.count)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected '%v', got '%v'", tt.expected, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,146 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+// deadLetteredNotification creates 1 due notification and exhausts its only publish attempt
+func deadLetteredNotification(t *testing.T, repo *repositories.NotificationPostgres) types.UUID {
+	ids := dueCampaign(t, repo, 1)
+	ctx := context.Background()
+
+	batch, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	failures := make([]*models.PublishFailure, 0, len(ids))
+	for _, notification := range batch {
+		if ids[*notification.ID] {
+			failures = append(failures, &models.PublishFailure{ID: notification.ID, Error: fmt.Errorf("nack")})
+		}
+	}
+	if len(failures) != 1 {
+		t.Fatalf("Expected '%d', got '%d'", 1, len(failures))
+	}
+
+	returned, err := repo.ReturnToPending(ctx, failures, "instance-a", models.PublishBackoff{Base: time.Minute, Max: time.Hour, MaxAttempts: 1})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if returned != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, returned)
+	}
+
+	id := *failures[0].ID
+	t.Cleanup(func() {
+		_, _ = repo.PurgeDeadLetters(context.Background(), models.DeadLetterFilter{NotificationID: &id})
+	})
+	return id
+}
+
+func TestReturnToPendingDeadLettersExhaustedPublishes(t *testing.T) {
+	repo := postgresRepo(t)
+	id := deadLetteredNotification(t, repo)
+	ctx := context.Background()
+
+	notification, err := repo.GetNotification(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if notification.Status != internaltypes.StatusFailed {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusFailed, notification.Status)
+	}
+
+	deadLetters, err := repo.ListDeadLetters(ctx, models.DeadLetterFilter{NotificationID: &id}, nil, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(deadLetters) != 1 {
+		t.Fatalf("Expected '%d', got '%d'", 1, len(deadLetters))
+	}
+	if deadLetters[0].Source != models.DeadLetterSourcePublish {
+		t.Errorf("Expected '%s', got '%s'", models.DeadLetterSourcePublish, deadLetters[0].Source)
+	}
+	if deadLetters[0].Attempts != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, deadLetters[0].Attempts)
+	}
+	if deadLetters[0].Error.String() != "nack" {
+		t.Errorf("Expected '%s', got '%s'", "nack", deadLetters[0].Error)
+	}
+	if len(deadLetters[0].Payload) == 0 {
+		t.Errorf("Expected payload of notification row, got nothing")
+	}
+}
+
+func TestReplayDeadLetterReschedulesNotification(t *testing.T) {
+	repo := postgresRepo(t)
+	id := deadLetteredNotification(t, repo)
+	ctx := context.Background()
+
+	deadLetters, err := repo.ListDeadLetters(ctx, models.DeadLetterFilter{NotificationID: &id}, nil, fetchAll)
+	if err != nil || len(deadLetters) != 1 {
+		t.Fatalf("Unexpected dead letters: %v, %v", deadLetters, err)
+	}
+
+	replayed, err := repo.ReplayDeadLetter(ctx, deadLetters[0].ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if replayed.Status != internaltypes.StatusScheduled {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusScheduled, replayed.Status)
+	}
+
+	// fresh attempts: it's fetchable right away
+	refetched, err := repo.Fetch(ctx, types.NewDateTime(time.Now().Add(time.Second)), "instance-b", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched := countFetched(map[types.UUID]bool{id: true}, refetched); fetched[id] != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, fetched[id])
+	}
+
+	_, err = repo.ReplayDeadLetter(ctx, deadLetters[0].ID)
+	if !errors.Is(err, internalerrors.ErrDeadLetterNotFound) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrDeadLetterNotFound, err)
+	}
+}
+
+func TestPurgeDeadLettersKeepsNotificationsFailed(t *testing.T) {
+	repo := postgresRepo(t)
+	id := deadLetteredNotification(t, repo)
+	ctx := context.Background()
+
+	purged, err := repo.PurgeDeadLetters(ctx, models.DeadLetterFilter{NotificationID: &id})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if purged != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, purged)
+	}
+
+	replayed, err := repo.ReplayDeadLetters(ctx, models.DeadLetterFilter{NotificationID: &id})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(replayed) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(replayed))
+	}
+
+	notification, err := repo.GetNotification(ctx, id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if notification.Status != internaltypes.StatusFailed {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusFailed, notification.Status)
+	}
+}
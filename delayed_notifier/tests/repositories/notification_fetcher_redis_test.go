@@ -0,0 +1,243 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/retry"
+	"os"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryClaimRepo is an in-memory ports.NotificationClaimRepository, only what NotificationFetcherRedis uses is real
+type memoryClaimRepo struct {
+	mu            sync.Mutex
+	notifications map[types.UUID]*models.Notification
+	leased        map[types.UUID]bool
+}
+
+func newMemoryClaimRepo(notifications ...*models.Notification) *memoryClaimRepo {
+	repo := &memoryClaimRepo{notifications: make(map[types.UUID]*models.Notification), leased: make(map[types.UUID]bool)}
+	for _, notification := range notifications {
+		repo.notifications[*notification.ID] = notification
+	}
+	return repo
+}
+
+func (r *memoryClaimRepo) Fetch(context.Context, types.DateTime, string, time.Duration, int) ([]*models.Notification, error) {
+	return nil, nil
+}
+
+func (r *memoryClaimRepo) FetchUpcoming(_ context.Context, until types.DateTime, limit int) ([]*models.WakeUp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wakeUps := make([]*models.WakeUp, 0)
+	for _, notification := range r.notifications {
+		if notification.Status == internaltypes.StatusScheduled && until.GreaterOrEqualThan(notification.PublicationAt) {
+			wakeUps = append(wakeUps, &models.WakeUp{ID: notification.ID, At: notification.PublicationAt.Value()})
+		}
+	}
+	return wakeUps[:min(limit, len(wakeUps))], nil
+}
+
+func (r *memoryClaimRepo) Index(context.Context, []*models.WakeUp) error {
+	return nil
+}
+
+func (r *memoryClaimRepo) Claim(context.Context, types.UUID, string, time.Duration) (bool, error) {
+	return false, nil
+}
+
+func (r *memoryClaimRepo) ReturnToPending(context.Context, []*models.PublishFailure, string, models.PublishBackoff) (int64, error) {
+	return 0, nil
+}
+
+func (r *memoryClaimRepo) ChangeStatus(_ context.Context, ids []*types.UUID, status internaltypes.NotificationStatus) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range ids {
+		r.notifications[*id].Status = status
+	}
+	return int64(len(ids)), nil
+}
+
+func (r *memoryClaimRepo) ClaimMany(_ context.Context, ids []*types.UUID, maxPublicationAt types.DateTime, _ string, _ time.Duration) ([]*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	claimed := make([]*models.Notification, 0, len(ids))
+	for _, id := range ids {
+		notification := r.notifications[*id]
+		if notification.Status != internaltypes.StatusScheduled || r.leased[*id] || !maxPublicationAt.GreaterOrEqualThan(notification.PublicationAt) {
+			continue
+		}
+		r.leased[*id] = true
+		claimed = append(claimed, notification)
+	}
+	return claimed, nil
+}
+
+func (r *memoryClaimRepo) WakeUpsOf(_ context.Context, ids []*types.UUID) ([]*models.WakeUp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	wakeUps := make([]*models.WakeUp, 0, len(ids))
+	for _, id := range ids {
+		notification := r.notifications[*id]
+		if notification.Status == internaltypes.StatusScheduled {
+			wakeUps = append(wakeUps, &models.WakeUp{ID: notification.ID, At: notification.PublicationAt.Value()})
+		}
+	}
+	return wakeUps, nil
+}
+
+func (r *memoryClaimRepo) update(id types.UUID, change func(notification *models.Notification)) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.notifications[id])
+}
+
+// redisFetcher connects to redis at DELAYED_NOTIFIER_TEST_REDIS_ADDR, test is skipped without it. Keys are unique per test
+func redisFetcher(t *testing.T, source *memoryClaimRepo) (*repositories.NotificationFetcherRedis, *redis.Client, string) {
+	addr := os.Getenv("DELAYED_NOTIFIER_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("DELAYED_NOTIFIER_TEST_REDIS_ADDR isn't set")
+	}
+
+	client := redis.New(addr, "", 0)
+	prefix := "test:" + types.GenerateUUID().String()
+	t.Cleanup(func() {
+		client.Client.Del(context.Background(), prefix+":pending", prefix+":leased")
+		_ = client.Close()
+	})
+
+	return repositories.NewNotificationFetcherRedis(client, retry.Strategy{Attempts: 1}, source, prefix), client, prefix
+}
+
+func dueCampaignAt(size int, publicationAt time.Time) []*models.Notification {
+	notifications := campaign(size)
+	for _, notification := range notifications {
+		notification.Status = internaltypes.StatusScheduled
+		notification.PublicationAt = types.NewDateTime(publicationAt)
+	}
+	return notifications
+}
+
+func TestRedisFetcherClaimsEachIDOnce(t *testing.T) {
+	notifications := dueCampaignAt(100, time.Now().Add(-time.Second))
+	source := newMemoryClaimRepo(notifications...)
+	fetcher, _, _ := redisFetcher(t, source)
+	ctx := context.Background()
+
+	if _, err := fetcher.FetchUpcoming(ctx, types.NewDateTime(time.Now()), 1000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	mu := sync.Mutex{}
+	fetched := make(map[types.UUID]int)
+	wg := sync.WaitGroup{}
+	for _, owner := range []string{"instance-a", "instance-b", "instance-c"} {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				page, err := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), owner, time.Minute, 7)
+				if err != nil {
+					t.Errorf("Unexpected error: %v", err)
+					return
+				}
+				if len(page) == 0 {
+					return
+				}
+				mu.Lock()
+				for _, notification := range page {
+					fetched[*notification.ID]++
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	wg.Wait()
+
+	for _, notification := range notifications {
+		if times := fetched[*notification.ID]; times != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, times, notification.ID)
+		}
+	}
+}
+
+func TestRedisFetcherReindexesStaleIDs(t *testing.T) {
+	moved := dueCampaignAt(1, time.Now().Add(-time.Second))[0]
+	cancelled := dueCampaignAt(1, time.Now().Add(-time.Second))[0]
+	source := newMemoryClaimRepo(moved, cancelled)
+	fetcher, client, prefix := redisFetcher(t, source)
+	ctx := context.Background()
+
+	if _, err := fetcher.FetchUpcoming(ctx, types.NewDateTime(time.Now()), 1000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// changed after indexing by another instance
+	movedAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	source.update(*moved.ID, func(notification *models.Notification) {
+		notification.PublicationAt = types.NewDateTime(movedAt)
+	})
+	source.update(*cancelled.ID, func(notification *models.Notification) {
+		notification.Status = internaltypes.StatusCancelled
+	})
+
+	page, err := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, 10)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if len(page) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(page))
+	}
+
+	pending, _ := client.Client.ZRangeWithScores(ctx, prefix+":pending", 0, -1).Result()
+	leased, _ := client.Client.ZRange(ctx, prefix+":leased", 0, -1).Result()
+	if len(pending) != 1 || pending[0].Member != moved.ID.String() || int64(pending[0].Score) != movedAt.UnixMilli() {
+		t.Errorf("Expected '%s' at '%d', got '%v'", moved.ID, movedAt.UnixMilli(), pending)
+	}
+	if len(leased) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(leased))
+	}
+}
+
+func TestRedisFetcherReconcile(t *testing.T) {
+	notifications := dueCampaignAt(3, time.Now().Add(time.Second))
+	source := newMemoryClaimRepo(notifications...)
+	fetcher, client, prefix := redisFetcher(t, source)
+	ctx := context.Background()
+
+	if _, err := fetcher.FetchUpcoming(ctx, types.NewDateTime(time.Now().Add(time.Minute)), 1000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// index is stale after a restart: 1 is cancelled, 1 is new
+	source.update(*notifications[0].ID, func(notification *models.Notification) {
+		notification.Status = internaltypes.StatusCancelled
+	})
+	created := dueCampaignAt(1, time.Now().Add(time.Second))[0]
+	source.notifications[*created.ID] = created
+
+	if err := fetcher.Reconcile(ctx, types.NewDateTime(time.Now().Add(time.Minute)), 1000); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	pending, _ := client.Client.ZRange(ctx, prefix+":pending", 0, -1).Result()
+	expected := []string{notifications[1].ID.String(), notifications[2].ID.String(), created.ID.String()}
+	slices.Sort(pending)
+	slices.Sort(expected)
+	if !slices.Equal(pending, expected) {
+		t.Errorf("Expected '%v', got '%v'", expected, pending)
+	}
+}
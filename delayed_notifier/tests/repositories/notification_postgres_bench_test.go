@@ -0,0 +1,87 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/dbpg"
+	"github.com/wb-go/wbf/retry"
+	"os"
+	"testing"
+	"time"
+)
+
+// benchmarkBatchSize is the size of 1 campaign
+const benchmarkBatchSize = 1000
+
+// postgresDSN returns DELAYED_NOTIFIER_TEST_POSTGRES_DSN of migrated DB, test is skipped without it
+func postgresDSN(b testing.TB) string {
+	dsn := os.Getenv("DELAYED_NOTIFIER_TEST_POSTGRES_DSN")
+	if dsn == "" {
+		b.Skip("DELAYED_NOTIFIER_TEST_POSTGRES_DSN isn't set")
+	}
+	return dsn
+}
+
+// postgresRepo connects to migrated DB, see postgresDSN. It doesn't notify about wake-ups
+func postgresRepo(b testing.TB) *repositories.NotificationPostgres {
+	return notifyingPostgresRepo(b, "")
+}
+
+// notifyingPostgresRepo connects to migrated DB, see postgresDSN. It notifies about wake-ups on notifyChannel
+func notifyingPostgresRepo(b testing.TB, notifyChannel string) *repositories.NotificationPostgres {
+	db, err := dbpg.New(postgresDSN(b), nil, &dbpg.Options{MaxOpenConns: 2, MaxIdleConns: 2})
+	if err != nil {
+		b.Fatalf("Unexpected error: %v", err)
+	}
+	b.Cleanup(func() {
+		_ = db.Master.Close()
+	})
+
+	return repositories.NewNotificationPostgres(db, retry.Strategy{Attempts: 1}, notifyChannel)
+}
+
+func campaign(size int) []*models.Notification {
+	publicationAt := types.NewDateTime(time.Now().Add(24 * time.Hour))
+	sendTo, _ := internaltypes.NewSendTo(types.NewAnyText(""), internaltypes.ChannelConsole)
+
+	result := make([]*models.Notification, size)
+	for i := range result {
+		id := types.GenerateUUID()
+		result[i] = &models.Notification{
+			ID:            &id,
+			PublicationAt: publicationAt,
+			Channel:       internaltypes.ChannelConsole,
+			Content:       models.NotificationContent{Title: "benchmark", Message: "benchmark"},
+			Status:        internaltypes.StatusCancelled,
+			SendTo:        sendTo,
+		}
+	}
+	return result
+}
+
+func BenchmarkCreateNotification_Loop(b *testing.B) {
+	repo := postgresRepo(b)
+	ctx := context.Background()
+
+	for b.Loop() {
+		for _, notification := range campaign(benchmarkBatchSize) {
+			if err := repo.CreateNotification(ctx, notification); err != nil {
+				b.Fatalf("Unexpected error: %v", err)
+			}
+		}
+	}
+}
+
+func BenchmarkCreateNotifications_Copy(b *testing.B) {
+	repo := postgresRepo(b)
+	ctx := context.Background()
+
+	for b.Loop() {
+		if err := repo.CreateNotifications(ctx, campaign(benchmarkBatchSize)); err != nil {
+			b.Fatalf("Unexpected error: %v", err)
+		}
+	}
+}
@@ -0,0 +1,205 @@
+package tests
+
+import (
+	"context"
+	"fmt"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fetchAll is the page size big enough for every test campaign
+const fetchAll = 10000
+
+// dueCampaign creates size scheduled notifications that are due, they're cancelled on cleanup
+func dueCampaign(t *testing.T, repo *repositories.NotificationPostgres, size int) map[types.UUID]bool {
+	notifications := campaign(size)
+	ids := make(map[types.UUID]bool, size)
+	idsList := make([]*types.UUID, size)
+	for i, notification := range notifications {
+		notification.PublicationAt = types.NewDateTime(time.Now().Add(-time.Minute))
+		notification.Status = internaltypes.StatusScheduled
+		ids[*notification.ID] = true
+		idsList[i] = notification.ID
+	}
+
+	if err := repo.CreateNotifications(context.Background(), notifications); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = repo.ChangeStatus(context.Background(), idsList, internaltypes.StatusCancelled)
+	})
+	return ids
+}
+
+// countFetched counts how many times each of ids is in batches
+func countFetched(ids map[types.UUID]bool, batches ...[]*models.Notification) map[types.UUID]int {
+	result := make(map[types.UUID]int)
+	for _, batch := range batches {
+		for _, notification := range batch {
+			if ids[*notification.ID] {
+				result[*notification.ID]++
+			}
+		}
+	}
+	return result
+}
+
+func TestFetchConcurrentInstancesGetDisjointBatches(t *testing.T) {
+	repo := postgresRepo(t)
+	ids := dueCampaign(t, repo, 200)
+
+	instances := 4
+	batches := make([][]*models.Notification, instances)
+	errs := make([]error, instances)
+
+	wg := &sync.WaitGroup{}
+	for i := range instances {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			batches[i], errs[i] = repo.Fetch(context.Background(), types.NewDateTime(time.Now()), fmt.Sprintf("instance-%d", i), time.Minute, fetchAll)
+		}()
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+	}
+
+	fetched := countFetched(ids, batches...)
+	if len(fetched) != len(ids) {
+		t.Errorf("Expected '%d', got '%d'", len(ids), len(fetched))
+	}
+	for id, times := range fetched {
+		if times != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, times, id.String())
+		}
+	}
+}
+
+func TestFetchReclaimsExpiredLeases(t *testing.T) {
+	repo := postgresRepo(t)
+	ids := dueCampaign(t, repo, 10)
+	ctx := context.Background()
+
+	// instance-a dies before marking anything, its lease is already over
+	first, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Millisecond, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched := countFetched(ids, first); len(fetched) != len(ids) {
+		t.Fatalf("Expected '%d', got '%d'", len(ids), len(fetched))
+	}
+	time.Sleep(10 * time.Millisecond)
+
+	second, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-b", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched := countFetched(ids, second); len(fetched) != len(ids) {
+		t.Errorf("Expected '%d', got '%d'", len(ids), len(fetched))
+	}
+
+	// instance-b is alive, its rows aren't given to anyone
+	third, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-c", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched := countFetched(ids, third); len(fetched) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(fetched))
+	}
+
+	for id := range ids {
+		claimed, claimErr := repo.Claim(ctx, id, "instance-c", time.Minute)
+		if claimErr != nil {
+			t.Fatalf("Unexpected error: %v", claimErr)
+		}
+		if claimed {
+			t.Errorf("Expected '%s' not to be claimed by instance-c", id.String())
+		}
+	}
+}
+
+func TestReturnToPendingWaitsForBackoff(t *testing.T) {
+	repo := postgresRepo(t)
+	ids := dueCampaign(t, repo, 5)
+	ctx := context.Background()
+
+	batch, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	failures := make([]*models.PublishFailure, 0, len(ids))
+	for _, notification := range batch {
+		if ids[*notification.ID] {
+			failures = append(failures, &models.PublishFailure{ID: notification.ID, Error: fmt.Errorf("nack")})
+		}
+	}
+
+	// other owner can't return them
+	returned, err := repo.ReturnToPending(ctx, failures, "instance-b", models.PublishBackoff{Base: time.Minute, Max: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if returned != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, returned)
+	}
+
+	returned, err = repo.ReturnToPending(ctx, failures, "instance-a", models.PublishBackoff{Base: time.Minute, Max: time.Hour})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if returned != int64(len(ids)) {
+		t.Errorf("Expected '%d', got '%d'", len(ids), returned)
+	}
+
+	refetched, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-b", time.Minute, fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if fetched := countFetched(ids, refetched); len(fetched) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(fetched))
+	}
+}
+
+func TestFetchPagesAreDisjointAndOrdered(t *testing.T) {
+	repo := postgresRepo(t)
+	ids := dueCampaign(t, repo, 7)
+	ctx := context.Background()
+
+	seen := make(map[types.UUID]int)
+	var previous time.Time
+	for {
+		page, err := repo.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, 3)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if len(page) > 3 {
+			t.Fatalf("Expected at most '%d', got '%d'", 3, len(page))
+		}
+		for _, notification := range page {
+			if notification.PublicationAt.Value().Before(previous) {
+				t.Errorf("Expected '%s' not to be before '%s'", notification.PublicationAt, types.NewDateTime(previous))
+			}
+			previous = notification.PublicationAt.Value()
+			seen[*notification.ID]++
+		}
+		if len(page) < 3 {
+			break
+		}
+	}
+
+	for id := range ids {
+		if seen[id] != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, seen[id], id.String())
+		}
+	}
+}
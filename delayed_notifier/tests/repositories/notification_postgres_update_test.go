@@ -0,0 +1,74 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+)
+
+func TestUpdateNotificationNotUpdatedReason(t *testing.T) {
+	repo := postgresRepo(t)
+
+	tests := []struct {
+		name    string
+		status  internaltypes.NotificationStatus
+		missing bool
+		wantErr error
+	}{
+		{name: "scheduled", status: internaltypes.StatusScheduled},
+		{name: "not found", status: internaltypes.StatusScheduled, missing: true, wantErr: internalerrors.ErrNotificationNotFound},
+		{name: "queued", status: internaltypes.StatusQueued, wantErr: internalerrors.ErrNotificationNotEditable},
+		{name: "delivered", status: internaltypes.StatusDelivered, wantErr: internalerrors.ErrNotificationNotEditable},
+		{name: "cancelled", status: internaltypes.StatusCancelled, wantErr: internalerrors.ErrNotificationNotEditable},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := campaign(1)[0]
+			notification.Status = tt.status
+			if err := repo.CreateNotification(context.Background(), notification); err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			t.Cleanup(func() {
+				_ = repo.DeleteNotification(context.Background(), *notification.ID)
+			})
+
+			if tt.missing {
+				id := types.GenerateUUID()
+				notification.ID = &id
+			}
+
+			notification.Content.Title = "edited"
+			err := repo.UpdateNotification(context.Background(), notification)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("Expected '%v', got '%v'", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestUpdateStatusNotUpdatedReason(t *testing.T) {
+	repo := postgresRepo(t)
+
+	notification := campaign(1)[0]
+	notification.Status = internaltypes.StatusDelivered
+	if err := repo.CreateNotification(context.Background(), notification); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		_ = repo.DeleteNotification(context.Background(), *notification.ID)
+	})
+
+	err := repo.UpdateStatus(context.Background(), *notification.ID, internaltypes.StatusCancelled)
+	if !errors.Is(err, internalerrors.ErrInvalidStatusTransition) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrInvalidStatusTransition, err)
+	}
+
+	err = repo.UpdateStatus(context.Background(), types.GenerateUUID(), internaltypes.StatusCancelled)
+	if !errors.Is(err, internalerrors.ErrNotificationNotFound) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrNotificationNotFound, err)
+	}
+}
@@ -0,0 +1,241 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	internalerrors "github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/delaybuckets"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/rabbitmq/amqp091-go"
+	"github.com/wb-go/wbf/retry"
+	"sync"
+	"testing"
+	"time"
+)
+
+// brokerEvent is what fakeConfirmChannel sends back after a publish
+type brokerEvent struct {
+	returned     *amqp091.Return
+	confirmation *amqp091.Confirmation
+}
+
+// fakeConfirmChannel is a repositories.ConfirmChannel that acks everything except given routing keys
+//
+// like amqp091, it sends returns and confirmations from 1 goroutine in order
+type fakeConfirmChannel struct {
+	mu          sync.Mutex
+	deliveryTag uint64
+	confirms    chan amqp091.Confirmation
+	returns     chan amqp091.Return
+	events      chan brokerEvent
+
+	// synchronous sends events before publish returns, so confirmations come before registration
+	synchronous bool
+
+	nacked     map[string]bool
+	unroutable map[string]bool
+	silent     map[string]bool
+
+	// published are messages in publish order
+	published []publishedMessage
+}
+
+// publishedMessage is where 1 message was published to
+type publishedMessage struct {
+	exchange string
+	bucket   any
+}
+
+func newFakeConfirmChannel(synchronous bool) *fakeConfirmChannel {
+	channel := &fakeConfirmChannel{
+		events:      make(chan brokerEvent, 100),
+		synchronous: synchronous,
+		nacked:      make(map[string]bool),
+		unroutable:  make(map[string]bool),
+		silent:      make(map[string]bool),
+	}
+	if !synchronous {
+		go func() {
+			for event := range channel.events {
+				channel.deliver(event)
+			}
+		}()
+	}
+	return channel
+}
+
+func (c *fakeConfirmChannel) deliver(event brokerEvent) {
+	if event.returned != nil {
+		c.returns <- *event.returned
+	}
+	if event.confirmation != nil {
+		c.confirms <- *event.confirmation
+	}
+}
+
+func (c *fakeConfirmChannel) PublishWithDeferredConfirmWithContext(_ context.Context, exchange, key string, mandatory, _ bool, msg amqp091.Publishing) (*amqp091.DeferredConfirmation, error) {
+	c.mu.Lock()
+	c.deliveryTag++
+	deliveryTag := c.deliveryTag
+	c.published = append(c.published, publishedMessage{exchange: exchange, bucket: msg.Headers[delaybuckets.Header]})
+	c.mu.Unlock()
+
+	event := brokerEvent{}
+	if c.unroutable[key] && mandatory {
+		event.returned = &amqp091.Return{ReplyCode: 312, ReplyText: "NO_ROUTE", Exchange: exchange, RoutingKey: key, MessageId: msg.MessageId}
+	}
+	if !c.silent[key] {
+		event.confirmation = &amqp091.Confirmation{DeliveryTag: deliveryTag, Ack: !c.nacked[key]}
+	}
+
+	if c.synchronous {
+		c.deliver(event)
+	} else {
+		c.events <- event
+	}
+	return &amqp091.DeferredConfirmation{DeliveryTag: deliveryTag}, nil
+}
+
+func (c *fakeConfirmChannel) NotifyPublish(confirm chan amqp091.Confirmation) chan amqp091.Confirmation {
+	c.confirms = confirm
+	return confirm
+}
+
+func (c *fakeConfirmChannel) NotifyReturn(returns chan amqp091.Return) chan amqp091.Return {
+	c.returns = returns
+	return returns
+}
+
+func (c *fakeConfirmChannel) close() {
+	close(c.confirms)
+	close(c.returns)
+}
+
+func notificationInChannel(channel internaltypes.NotificationChannel) *models.Notification {
+	notification := campaign(1)[0]
+	notification.Channel = channel
+	return notification
+}
+
+func newConfirmingRabbitMQ(channel *fakeConfirmChannel, confirmTimeout time.Duration) *repositories.NotificationRabbitMQ {
+	return repositories.NewNotificationRabbitMQ(channel, "notifications", delaybuckets.Layout{}, retry.Strategy{Attempts: 1}, confirmTimeout)
+}
+
+func TestSendManyPutsNackedAndReturnedIntoDLQ(t *testing.T) {
+	channel := newFakeConfirmChannel(false)
+	channel.nacked[internaltypes.EMAIL] = true
+	channel.unroutable[internaltypes.TELEGRAM] = true
+	repo := newConfirmingRabbitMQ(channel, time.Second)
+
+	acked := notificationInChannel(internaltypes.ChannelConsole)
+	nacked := notificationInChannel(internaltypes.ChannelEmail)
+	returned := notificationInChannel(internaltypes.ChannelTelegram)
+
+	failed := make(map[*models.Notification]error)
+	for item := range repo.SendMany(context.Background(), []*models.Notification{acked, nacked, returned, acked}).Items() {
+		failed[item.Value()] = item.Error()
+	}
+
+	testCases := []struct {
+		name         string
+		notification *models.Notification
+		expectedErr  error
+	}{
+		{name: "acked", notification: acked, expectedErr: nil},
+		{name: "nacked", notification: nacked, expectedErr: internalerrors.ErrPublishNacked},
+		{name: "returned", notification: returned, expectedErr: internalerrors.ErrPublishReturned},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			if err := failed[tc.notification]; !errors.Is(err, tc.expectedErr) {
+				t.Errorf("Expected '%v', got '%v'", tc.expectedErr, err)
+			}
+		})
+	}
+}
+
+func TestSendOneConfirmedBeforeRegistration(t *testing.T) {
+	channel := newFakeConfirmChannel(true)
+	channel.unroutable[internaltypes.TELEGRAM] = true
+	repo := newConfirmingRabbitMQ(channel, time.Second)
+
+	if err := repo.SendOne(context.Background(), notificationInChannel(internaltypes.ChannelConsole)); err != nil {
+		t.Errorf("Unexpected error: %v", err)
+	}
+
+	err := repo.SendOne(context.Background(), notificationInChannel(internaltypes.ChannelTelegram))
+	if !errors.Is(err, internalerrors.ErrPublishReturned) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrPublishReturned, err)
+	}
+}
+
+func TestSendOneNotConfirmed(t *testing.T) {
+	channel := newFakeConfirmChannel(false)
+	channel.silent[internaltypes.CONSOLE] = true
+	repo := newConfirmingRabbitMQ(channel, 50*time.Millisecond)
+
+	err := repo.SendOne(context.Background(), notificationInChannel(internaltypes.ChannelConsole))
+	if !errors.Is(err, internalerrors.ErrPublishNotConfirmed) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrPublishNotConfirmed, err)
+	}
+}
+
+func TestSendOneChannelClosed(t *testing.T) {
+	channel := newFakeConfirmChannel(false)
+	channel.silent[internaltypes.CONSOLE] = true
+	repo := newConfirmingRabbitMQ(channel, time.Minute)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		channel.close()
+	}()
+
+	err := repo.SendOne(context.Background(), notificationInChannel(internaltypes.ChannelConsole))
+	if !errors.Is(err, internalerrors.ErrPublishNotConfirmed) {
+		t.Errorf("Expected '%v', got '%v'", internalerrors.ErrPublishNotConfirmed, err)
+	}
+}
+
+func TestSendManyRoutesNotDueIntoWaitQueues(t *testing.T) {
+	channel := newFakeConfirmChannel(false)
+	layout := delaybuckets.Layout{Exchange: "notifications.delay", Step: time.Second, Amount: 60}
+	repo := repositories.NewNotificationRabbitMQ(channel, "notifications", layout, retry.Strategy{Attempts: 1}, time.Second)
+
+	testCases := []struct {
+		name             string
+		delay            time.Duration
+		expectedExchange string
+		expectedBucket   any
+	}{
+		{name: "due", delay: -time.Second, expectedExchange: "notifications", expectedBucket: nil},
+		{name: "shorter than step", delay: 500 * time.Millisecond, expectedExchange: "notifications", expectedBucket: nil},
+		{name: "rounded down", delay: 10*time.Second + 500*time.Millisecond, expectedExchange: "notifications.delay", expectedBucket: "10000"},
+		{name: "longer than max", delay: time.Hour, expectedExchange: "notifications.delay", expectedBucket: "60000"},
+	}
+
+	notifications := make([]*models.Notification, len(testCases))
+	for i, tc := range testCases {
+		notifications[i] = notificationInChannel(internaltypes.ChannelConsole)
+		notifications[i].PublicationAt = types.NewDateTime(time.Now().Add(tc.delay))
+	}
+	for item := range repo.SendMany(context.Background(), notifications).Items() {
+		t.Fatalf("Unexpected error: %v", item.Error())
+	}
+
+	// SendMany publishes in order
+	for i, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			published := channel.published[i]
+			if published.exchange != tc.expectedExchange {
+				t.Errorf("Expected '%s', got '%s'", tc.expectedExchange, published.exchange)
+			}
+			if published.bucket != tc.expectedBucket {
+				t.Errorf("Expected '%v', got '%v'", tc.expectedBucket, published.bucket)
+			}
+		})
+	}
+}
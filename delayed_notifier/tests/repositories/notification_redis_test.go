@@ -0,0 +1,45 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/wb-go/wbf/redis"
+	"github.com/wb-go/wbf/retry"
+	"os"
+	"testing"
+	"time"
+)
+
+func TestNotificationRedisRoundTrip(t *testing.T) {
+	addr := os.Getenv("DELAYED_NOTIFIER_TEST_REDIS_ADDR")
+	if addr == "" {
+		t.Skip("DELAYED_NOTIFIER_TEST_REDIS_ADDR isn't set")
+	}
+
+	client := redis.New(addr, "", 0)
+	t.Cleanup(func() { _ = client.Close() })
+	cache := repositories.NewNotificationRedis(client, retry.Strategy{Attempts: 1}, time.Minute)
+
+	notification := campaign(1)[0]
+	notification.Status = internaltypes.StatusDelivered
+	if err := cache.SaveNotification(context.Background(), notification); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() { _ = cache.DeleteNotification(context.Background(), *notification.ID) })
+
+	cached, err := cache.GetNotification(context.Background(), *notification.ID)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	if cached.ID == nil || *cached.ID != *notification.ID {
+		t.Errorf("Expected '%s', got '%v'", notification.ID.String(), cached.ID)
+	}
+	if cached.Status != internaltypes.StatusDelivered {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusDelivered.String(), cached.Status.String())
+	}
+	if cached.Channel != notification.Channel {
+		t.Errorf("Expected '%s', got '%s'", notification.Channel.String(), cached.Channel.String())
+	}
+}
@@ -0,0 +1,101 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+// sentSeries creates series of count occurrences, its first occurrence is already queued. Series is stopped on cleanup
+func sentSeries(t *testing.T, repo *repositories.NotificationPostgres, count int) *models.Notification {
+	ctx := context.Background()
+
+	rule, err := recurrence.NewRule("FREQ=MINUTELY", time.Now().Add(-time.Hour), time.Time{}, count)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	id := types.GenerateUUID()
+	series := &models.NotificationSeries{ID: &id, Rule: rule}
+
+	first := campaign(1)[0]
+	first.Status = internaltypes.StatusScheduled
+	first.SeriesID = &id
+	first.Occurrence = 1
+
+	if err = repo.CreateSeries(ctx, series, first); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	t.Cleanup(func() {
+		_, _ = repo.StopSeries(context.Background(), id)
+	})
+
+	if _, err = repo.ChangeStatus(ctx, []*types.UUID{first.ID}, internaltypes.StatusQueued); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	return first
+}
+
+// isStalled tells if latest occurrence with given id is returned by FetchStalledSeries
+func isStalled(t *testing.T, repo *repositories.NotificationPostgres, id types.UUID) bool {
+	stalled, err := repo.FetchStalledSeries(context.Background(), fetchAll)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	for _, occurrence := range stalled {
+		if *occurrence.ID == id {
+			return true
+		}
+	}
+	return false
+}
+
+func TestFetchStalledSeries(t *testing.T) {
+	repo := postgresRepo(t)
+	ctx := context.Background()
+
+	t.Run("no next occurrence", func(t *testing.T) {
+		first := sentSeries(t, repo, 0)
+		if !isStalled(t, repo, *first.ID) {
+			t.Errorf("Expected '%s' to be stalled", first.ID)
+		}
+	})
+
+	t.Run("next occurrence is scheduled", func(t *testing.T) {
+		first := sentSeries(t, repo, 0)
+
+		nextID := types.GenerateUUID()
+		next := *first
+		next.ID = &nextID
+		next.Status = internaltypes.StatusScheduled
+		next.Occurrence = 2
+		if created, err := repo.CreateOccurrence(ctx, &next); err != nil || !created {
+			t.Fatalf("Unexpected error: %v (created '%v')", err, created)
+		}
+
+		if isStalled(t, repo, *first.ID) {
+			t.Errorf("Expected '%s' not to be stalled", first.ID)
+		}
+	})
+
+	t.Run("series is over", func(t *testing.T) {
+		first := sentSeries(t, repo, 1)
+		if isStalled(t, repo, *first.ID) {
+			t.Errorf("Expected '%s' not to be stalled", first.ID)
+		}
+	})
+
+	t.Run("series is stopped", func(t *testing.T) {
+		first := sentSeries(t, repo, 0)
+		if _, err := repo.StopSeries(ctx, *first.SeriesID); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if isStalled(t, repo, *first.ID) {
+			t.Errorf("Expected '%s' not to be stalled", first.ID)
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package tests
+
+import (
+	"context"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/repositories"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+// receiveWakeUp waits for 1 wake-up for a few seconds
+func receiveWakeUp(t *testing.T, wakeUps <-chan *models.WakeUp) *models.WakeUp {
+	t.Helper()
+
+	select {
+	case wakeUp, ok := <-wakeUps:
+		if !ok {
+			t.Fatalf("Expected wake-up, got closed channel")
+		}
+		return wakeUp
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Expected wake-up, got nothing")
+	}
+	return nil
+}
+
+func TestCreateAndUpdateNotifyListeners(t *testing.T) {
+	channel := "test_wake_ups_" + types.GenerateUUID().String()[:8]
+	repo := notifyingPostgresRepo(t, channel)
+	ctx := context.Background()
+
+	listener := repositories.NewNotificationWakeUpPostgres(postgresDSN(t), channel, time.Second, time.Second)
+	wakeUps := listener.StartListening()
+	t.Cleanup(func() {
+		_ = listener.StopListening()
+	})
+
+	// listening starts in background, wait for it
+	time.Sleep(500 * time.Millisecond)
+
+	batch := campaign(3)
+	for i, notification := range batch {
+		notification.Status = internaltypes.StatusScheduled
+		notification.PublicationAt = types.NewDateTime(time.Now().Add(time.Duration(i+1) * time.Minute))
+	}
+	single := batch[0]
+
+	// step 1. Single insert is announced as is
+	if err := repo.CreateNotification(ctx, single); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wakeUp := receiveWakeUp(t, wakeUps)
+	if wakeUp.ID == nil || *wakeUp.ID != *single.ID {
+		t.Errorf("Expected '%s', got '%v'", single.ID, wakeUp.ID)
+	}
+	if !wakeUp.At.Equal(single.PublicationAt.Value()) {
+		t.Errorf("Expected '%s', got '%s'", single.PublicationAt.Value(), wakeUp.At)
+	}
+
+	// step 2. Update is announced with new datetime
+	single.PublicationAt = types.NewDateTime(time.Now().Add(time.Second))
+	if err := repo.UpdateNotification(ctx, single); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wakeUp = receiveWakeUp(t, wakeUps)
+	if !wakeUp.At.Equal(single.PublicationAt.Value()) {
+		t.Errorf("Expected '%s', got '%s'", single.PublicationAt.Value(), wakeUp.At)
+	}
+
+	// step 3. Batch is announced once, without ID
+	if err := repo.CreateNotifications(ctx, batch[1:]); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	wakeUp = receiveWakeUp(t, wakeUps)
+	if wakeUp.ID != nil {
+		t.Errorf("Expected no ID, got '%s'", wakeUp.ID)
+	}
+	if !wakeUp.At.Equal(batch[1].PublicationAt.Value()) {
+		t.Errorf("Expected '%s', got '%s'", batch[1].PublicationAt.Value(), wakeUp.At)
+	}
+
+	// cleanup
+	for _, notification := range batch {
+		_ = repo.DeleteNotification(ctx, *notification.ID)
+	}
+}
@@ -0,0 +1,259 @@
+package tests
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/retry"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryResultReceiver is a ports.DeliveryResultReceiver that hands over given results and closes the channel
+type memoryResultReceiver struct {
+	results []*models.DeliveryResult
+	// keepOpen leaves the channel open until ctx is done
+	keepOpen bool
+
+	mu      sync.Mutex
+	stopped bool
+}
+
+func (r *memoryResultReceiver) StartReceiving(ctx context.Context) <-chan *models.DeliveryResult {
+	objects := make(chan *models.DeliveryResult, len(r.results))
+	for _, result := range r.results {
+		objects <- result
+	}
+	if !r.keepOpen {
+		close(objects)
+		return objects
+	}
+
+	go func() {
+		<-ctx.Done()
+		close(objects)
+	}()
+	return objects
+}
+
+func (r *memoryResultReceiver) StopReceiving() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.stopped = true
+	return nil
+}
+
+func (r *memoryResultReceiver) isStopped() bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.stopped
+}
+
+// memoryResultMessage is a models.ResultMessage that counts how it was settled
+type memoryResultMessage struct {
+	mu       sync.Mutex
+	acked    int
+	requeued int
+}
+
+func (m *memoryResultMessage) Ack() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.acked++
+}
+
+func (m *memoryResultMessage) Requeue() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.requeued++
+}
+
+func (m *memoryResultMessage) settled() (acked, requeued int) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.acked, m.requeued
+}
+
+// memoryResultStorage is a ports.DeliveryResultStorageRepository that returns errs one by one, then nil
+type memoryResultStorage struct {
+	errs []error
+	// waitDone makes every call wait until ctx is done and return its error
+	waitDone bool
+
+	mu    sync.Mutex
+	calls int
+}
+
+func (r *memoryResultStorage) RecordDeliveryResult(ctx context.Context, _ *models.DeliveryResult) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.calls++
+	if r.waitDone {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	if r.calls <= len(r.errs) {
+		return r.errs[r.calls-1]
+	}
+	return nil
+}
+
+// memoryResultCache is a ports.NotificationCRUDCacheRepository that only remembers what was deleted
+type memoryResultCache struct {
+	mu      sync.Mutex
+	deleted []types.UUID
+}
+
+func (r *memoryResultCache) SaveNotification(_ context.Context, _ *models.Notification) error {
+	return nil
+}
+
+func (r *memoryResultCache) GetNotification(_ context.Context, _ types.UUID) (*models.Notification, error) {
+	return nil, errors.ErrNotificationNotFound
+}
+
+func (r *memoryResultCache) DeleteNotification(_ context.Context, id types.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.deleted = append(r.deleted, id)
+	return nil
+}
+
+func deliveredResult() *models.DeliveryResult {
+	return &models.DeliveryResult{
+		ID:        types.GenerateUUID(),
+		Channel:   internaltypes.ChannelTelegram,
+		Status:    internaltypes.StatusDelivered,
+		Attempt:   1,
+		Timestamp: types.NewDateTime(time.Now()),
+		Message:   &memoryResultMessage{},
+	}
+}
+
+func TestDeliveryResultService_RecordResult(t *testing.T) {
+	transition := errors.ErrInvalidStatusTransition
+
+	tests := []struct {
+		name                string
+		errs                []error
+		expectedCalls       int
+		expectedInvalidated bool
+		expectedRequeued    bool
+	}{
+		{name: "recorded", expectedCalls: 1, expectedInvalidated: true},
+		{name: "race resolved on retry", errs: []error{transition, transition}, expectedCalls: 3, expectedInvalidated: true},
+		{name: "race never resolved", errs: []error{transition, transition, transition}, expectedCalls: 3},
+		{name: "not found isn't retried", errs: []error{errors.ErrNotificationNotFound}, expectedCalls: 1},
+		{name: "storage error is requeued", errs: []error{stderrors.New("connection refused")}, expectedCalls: 1, expectedRequeued: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result := deliveredResult()
+			receiver := &memoryResultReceiver{results: []*models.DeliveryResult{result}}
+			storage := &memoryResultStorage{errs: tt.errs}
+			cache := &memoryResultCache{}
+
+			resultService := service.NewDeliveryResultService(receiver, storage, cache,
+				retry.Strategy{Attempts: 3, Delay: time.Millisecond, Backoff: 1})
+			resultService.Run(context.Background())
+
+			if storage.calls != tt.expectedCalls {
+				t.Errorf("Expected '%d', got '%d'", tt.expectedCalls, storage.calls)
+			}
+
+			// cache holds the old status only if the new one was saved
+			invalidated := len(cache.deleted) == 1 && cache.deleted[0] == result.ID
+			if invalidated != tt.expectedInvalidated {
+				t.Errorf("Expected '%v', got '%v'", tt.expectedInvalidated, invalidated)
+			}
+
+			// message is settled exactly once, requeued only if result may still be recorded
+			expectedAcked, expectedRequeued := 1, 0
+			if tt.expectedRequeued {
+				expectedAcked, expectedRequeued = 0, 1
+			}
+			acked, requeued := result.Message.(*memoryResultMessage).settled()
+			if acked != expectedAcked {
+				t.Errorf("Expected '%d', got '%d'", expectedAcked, acked)
+			}
+			if requeued != expectedRequeued {
+				t.Errorf("Expected '%d', got '%d'", expectedRequeued, requeued)
+			}
+
+			if !receiver.isStopped() {
+				t.Errorf("Expected receiver to be stopped")
+			}
+		})
+	}
+}
+
+func TestDeliveryResultService_RequeuesResultOnShutdown(t *testing.T) {
+	result := deliveredResult()
+	receiver := &memoryResultReceiver{results: []*models.DeliveryResult{result}, keepOpen: true}
+	storage := &memoryResultStorage{waitDone: true}
+	resultService := service.NewDeliveryResultService(receiver, storage, &memoryResultCache{},
+		retry.Strategy{Attempts: 1, Delay: time.Millisecond, Backoff: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resultService.Run(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Run to return after ctx is done")
+	}
+
+	acked, requeued := result.Message.(*memoryResultMessage).settled()
+	if acked != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, acked)
+	}
+	if requeued != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, requeued)
+	}
+}
+
+func TestDeliveryResultService_StopsOnContextDone(t *testing.T) {
+	receiver := &memoryResultReceiver{results: []*models.DeliveryResult{deliveredResult()}, keepOpen: true}
+	storage := &memoryResultStorage{}
+	resultService := service.NewDeliveryResultService(receiver, storage, &memoryResultCache{},
+		retry.Strategy{Attempts: 1, Delay: time.Millisecond, Backoff: 1})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		resultService.Run(ctx)
+	}()
+
+	time.Sleep(50 * time.Millisecond)
+	cancel()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatalf("Expected Run to return after ctx is done")
+	}
+
+	storage.mu.Lock()
+	defer storage.mu.Unlock()
+	if storage.calls != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, storage.calls)
+	}
+	if !receiver.isStopped() {
+		t.Errorf("Expected receiver to be stopped")
+	}
+}
@@ -0,0 +1,120 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryIdempotencyRepo is an in-memory ports.IdempotencyRepository
+type memoryIdempotencyRepo struct {
+	mu      sync.Mutex
+	records map[string]*models.IdempotencyRecord
+}
+
+func newMemoryIdempotencyRepo() *memoryIdempotencyRepo {
+	return &memoryIdempotencyRepo{records: make(map[string]*models.IdempotencyRecord)}
+}
+
+func (r *memoryIdempotencyRepo) ClaimKey(_ context.Context, key string, requestHash string, _ time.Duration) (bool, *models.IdempotencyRecord, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, found := r.records[key]; found {
+		return false, record, nil
+	}
+	r.records[key] = &models.IdempotencyRecord{Key: key, RequestHash: requestHash}
+	return true, nil, nil
+}
+
+func (r *memoryIdempotencyRepo) SaveResponse(_ context.Context, key string, response *models.IdempotentResponse) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.records[key].Response = response
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) ReleaseKey(_ context.Context, key string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if record, found := r.records[key]; found && record.Response == nil {
+		delete(r.records, key)
+	}
+	return nil
+}
+
+func (r *memoryIdempotencyRepo) DeleteExpired(_ context.Context) (int64, error) {
+	return 0, nil
+}
+
+type request struct {
+	Title string `json:"title"`
+}
+
+func TestIdempotencyService_Replay(t *testing.T) {
+	ctx := context.Background()
+	idempotency := service.NewIdempotencyService(newMemoryIdempotencyRepo(), time.Hour)
+
+	saved, err := idempotency.Begin(ctx, "key", request{Title: "a"})
+	if err != nil || saved != nil {
+		t.Fatalf("Expected the first request to be performed, got '%v', '%v'", saved, err)
+	}
+
+	// repeated before the first one is finished
+	_, err = idempotency.Begin(ctx, "key", request{Title: "a"})
+	if !errors.Is(err, service.ErrIdempotencyKeyInProgress) {
+		t.Errorf("Expected ErrIdempotencyKeyInProgress, got '%v'", err)
+	}
+
+	response := &models.IdempotentResponse{StatusCode: 201, Body: []byte(`{"id":"1"}`)}
+	if err = idempotency.Complete(ctx, "key", response); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	saved, err = idempotency.Begin(ctx, "key", request{Title: "a"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if saved == nil || saved.StatusCode != 201 || string(saved.Body) != `{"id":"1"}` {
+		t.Errorf("Expected saved response, got '%v'", saved)
+	}
+
+	_, err = idempotency.Begin(ctx, "key", request{Title: "b"})
+	if !errors.Is(err, service.ErrIdempotencyKeyReused) {
+		t.Errorf("Expected ErrIdempotencyKeyReused, got '%v'", err)
+	}
+}
+
+func TestIdempotencyService_Release(t *testing.T) {
+	ctx := context.Background()
+	idempotency := service.NewIdempotencyService(newMemoryIdempotencyRepo(), time.Hour)
+
+	if _, err := idempotency.Begin(ctx, "key", request{Title: "a"}); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if err := idempotency.Release(ctx, "key"); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	// failed request may be retried, even with another body
+	saved, err := idempotency.Begin(ctx, "key", request{Title: "b"})
+	if err != nil || saved != nil {
+		t.Errorf("Expected the retry to be performed, got '%v', '%v'", saved, err)
+	}
+}
+
+func TestIdempotencyService_InvalidKey(t *testing.T) {
+	idempotency := service.NewIdempotencyService(newMemoryIdempotencyRepo(), time.Hour)
+
+	_, err := idempotency.Begin(context.Background(), strings.Repeat("k", service.MaxIdempotencyKeyLength+1), request{})
+	if !errors.Is(err, service.ErrInvalidIdempotencyKey) {
+		t.Errorf("Expected ErrInvalidIdempotencyKey, got '%v'", err)
+	}
+}
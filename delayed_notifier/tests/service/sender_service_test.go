@@ -0,0 +1,861 @@
+package tests
+
+import (
+	"context"
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/ports"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/dlq"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/recurrence"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryLease is a lease of memoryFetcherRepo row
+type memoryLease struct {
+	owner     string
+	expiresAt time.Time
+}
+
+// memoryFetcherRepo is an in-memory ports.NotificationFetcherRepository with leases like in postgres
+type memoryFetcherRepo struct {
+	mu            sync.Mutex
+	notifications map[types.UUID]*models.Notification
+	leases        map[types.UUID]memoryLease
+	attempts      map[types.UUID]int
+	nextAttemptAt map[types.UUID]time.Time
+
+	// deadLettered are ids whose publish attempts are exhausted
+	deadLettered []types.UUID
+
+	// inFlight is the amount of fetched notifications that are neither marked nor returned yet
+	inFlight    int
+	maxInFlight int
+}
+
+func newMemoryFetcherRepo(notifications ...*models.Notification) *memoryFetcherRepo {
+	repo := &memoryFetcherRepo{
+		notifications: make(map[types.UUID]*models.Notification),
+		leases:        make(map[types.UUID]memoryLease),
+		attempts:      make(map[types.UUID]int),
+		nextAttemptAt: make(map[types.UUID]time.Time),
+	}
+	for _, notification := range notifications {
+		repo.notifications[*notification.ID] = notification
+	}
+	return repo
+}
+
+func (r *memoryFetcherRepo) claimable(id types.UUID, owner string, now time.Time) bool {
+	if r.nextAttemptAt[id].After(now) {
+		return false
+	}
+	lease, found := r.leases[id]
+	return !found || !lease.expiresAt.After(now) || lease.owner == owner
+}
+
+func (r *memoryFetcherRepo) Fetch(_ context.Context, maxPublicationAt types.DateTime, owner string, leaseFor time.Duration, limit int) ([]*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	due := make([]*models.Notification, 0)
+	for id, notification := range r.notifications {
+		lease, leased := r.leases[id]
+		if notification.Status != internaltypes.StatusScheduled || !maxPublicationAt.GreaterOrEqualThan(notification.PublicationAt) ||
+			(leased && lease.expiresAt.After(now)) || r.nextAttemptAt[id].After(now) {
+			continue
+		}
+		due = append(due, notification)
+	}
+	slices.SortFunc(due, func(a, b *models.Notification) int {
+		return a.PublicationAt.Value().Compare(b.PublicationAt.Value())
+	})
+
+	result := make([]*models.Notification, 0, limit)
+	for _, notification := range due[:min(limit, len(due))] {
+		r.leases[*notification.ID] = memoryLease{owner: owner, expiresAt: now.Add(leaseFor)}
+		copied := *notification
+		result = append(result, &copied)
+	}
+
+	r.inFlight += len(result)
+	r.maxInFlight = max(r.maxInFlight, r.inFlight)
+	return result, nil
+}
+
+func (r *memoryFetcherRepo) FetchUpcoming(_ context.Context, until types.DateTime, limit int) ([]*models.WakeUp, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	upcoming := make([]*models.WakeUp, 0)
+	for id, notification := range r.notifications {
+		dueAt := slices.MaxFunc([]time.Time{notification.PublicationAt.Value(), r.nextAttemptAt[id], r.leases[id].expiresAt}, time.Time.Compare)
+		if notification.Status != internaltypes.StatusScheduled || dueAt.After(until.Value()) {
+			continue
+		}
+		wakeUpID := id
+		upcoming = append(upcoming, &models.WakeUp{ID: &wakeUpID, At: dueAt})
+	}
+	slices.SortFunc(upcoming, func(a, b *models.WakeUp) int {
+		return a.At.Compare(b.At)
+	})
+	return upcoming[:min(limit, len(upcoming))], nil
+}
+
+func (r *memoryFetcherRepo) Index(_ context.Context, _ []*models.WakeUp) error {
+	return nil
+}
+
+func (r *memoryFetcherRepo) Claim(_ context.Context, id types.UUID, owner string, leaseFor time.Duration) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	now := time.Now()
+	notification, found := r.notifications[id]
+	if !found || notification.Status != internaltypes.StatusScheduled || !r.claimable(id, owner, now) {
+		return false, nil
+	}
+	r.leases[id] = memoryLease{owner: owner, expiresAt: now.Add(leaseFor)}
+	return true, nil
+}
+
+func (r *memoryFetcherRepo) ReturnToPending(_ context.Context, failures []*models.PublishFailure, owner string, backoff models.PublishBackoff) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var returned int64
+	for _, failure := range failures {
+		if r.leases[*failure.ID].owner != owner {
+			continue
+		}
+		delete(r.leases, *failure.ID)
+		r.inFlight--
+		r.nextAttemptAt[*failure.ID] = time.Now().Add(min(backoff.Base<<r.attempts[*failure.ID], backoff.Max))
+		r.attempts[*failure.ID]++
+		if backoff.MaxAttempts > 0 && r.attempts[*failure.ID] >= backoff.MaxAttempts {
+			r.notifications[*failure.ID].Status = internaltypes.StatusFailed
+			r.deadLettered = append(r.deadLettered, *failure.ID)
+			continue
+		}
+		returned++
+	}
+	return returned, nil
+}
+
+func (r *memoryFetcherRepo) ChangeStatus(_ context.Context, ids []*types.UUID, status internaltypes.NotificationStatus) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var changed int64
+	for _, id := range ids {
+		notification, found := r.notifications[*id]
+		if !found || !notification.Status.CanTransitionTo(status) {
+			continue
+		}
+		notification.Status = status
+		if _, leased := r.leases[*id]; leased {
+			delete(r.leases, *id)
+			r.inFlight--
+		}
+		changed++
+	}
+	return changed, nil
+}
+
+// update changes stored notification like CRUD service does and returns its copy
+func (r *memoryFetcherRepo) update(id types.UUID, change func(notification *models.Notification)) *models.Notification {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	change(r.notifications[id])
+	copied := *r.notifications[id]
+	return &copied
+}
+
+func (r *memoryFetcherRepo) add(notification *models.Notification) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications[*notification.ID] = notification
+}
+
+func (r *memoryFetcherRepo) lease(id types.UUID) memoryLease {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.leases[id]
+}
+
+func (r *memoryFetcherRepo) status(id types.UUID) internaltypes.NotificationStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.notifications[id].Status
+}
+
+func (r *memoryFetcherRepo) publishAttempts(id types.UUID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.attempts[id]
+}
+
+var errBrokerRejected = errors.New("broker rejected")
+
+// memoryPublisherRepo is a ports.NotificationPublisherRepository that counts published notifications
+//
+// notifications from rejected aren't published
+type memoryPublisherRepo struct {
+	mu          sync.Mutex
+	published   map[types.UUID]int
+	publishedAt map[types.UUID]time.Time
+	rejected    map[types.UUID]bool
+}
+
+func newMemoryPublisherRepo(rejected ...*models.Notification) *memoryPublisherRepo {
+	repo := &memoryPublisherRepo{
+		published:   make(map[types.UUID]int),
+		publishedAt: make(map[types.UUID]time.Time),
+		rejected:    make(map[types.UUID]bool),
+	}
+	for _, notification := range rejected {
+		repo.rejected[*notification.ID] = true
+	}
+	return repo
+}
+
+func (r *memoryPublisherRepo) SendOne(_ context.Context, notification *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.rejected[*notification.ID] {
+		return errBrokerRejected
+	}
+	r.published[*notification.ID]++
+	r.publishedAt[*notification.ID] = time.Now()
+	return nil
+}
+
+func (r *memoryPublisherRepo) SendMany(ctx context.Context, notifications []*models.Notification) *dlq.DLQ[*models.Notification] {
+	result := dlq.NewDLQ[*models.Notification](len(notifications))
+	for _, notification := range notifications {
+		if err := r.SendOne(ctx, notification); err != nil {
+			result.Put(notification, err)
+		}
+	}
+	result.Close()
+	return result
+}
+
+func (r *memoryPublisherRepo) timesPublished(id types.UUID) int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.published[id]
+}
+
+// lateness is how much later than its publication_at notification was published, negative if earlier
+func (r *memoryPublisherRepo) lateness(notification *models.Notification) time.Duration {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.publishedAt[*notification.ID].Sub(notification.PublicationAt.Value())
+}
+
+func scheduledNotification(publicationAt time.Time) *models.Notification {
+	id := types.GenerateUUID()
+	return &models.Notification{
+		ID:            &id,
+		PublicationAt: types.NewDateTime(publicationAt),
+		Channel:       internaltypes.ChannelConsole,
+		Status:        internaltypes.StatusScheduled,
+	}
+}
+
+func newLeasingSenderService(instanceID string, publisher *memoryPublisherRepo, fetcher *memoryFetcherRepo) *service.SenderService {
+	return newPagingSenderService(instanceID, publisher, fetcher, service.FetchPaging{BatchSize: 1000, MaxConcurrentPages: 1, MaxInFlight: 1000, MaxScheduled: 1000})
+}
+
+func newPagingSenderService(instanceID string, publisher *memoryPublisherRepo, fetcher *memoryFetcherRepo, paging service.FetchPaging) *service.SenderService {
+	return newListeningSenderService(instanceID, publisher, fetcher, paging, nil)
+}
+
+func newListeningSenderService(instanceID string, publisher *memoryPublisherRepo, fetcher *memoryFetcherRepo, paging service.FetchPaging,
+	listener ports.NotificationWakeUpListener) *service.SenderService {
+	return newAheadSenderService(instanceID, publisher, fetcher, paging, listener, 0)
+}
+
+func newAheadSenderService(instanceID string, publisher *memoryPublisherRepo, fetcher *memoryFetcherRepo, paging service.FetchPaging,
+	listener ports.NotificationWakeUpListener, publishAhead time.Duration) *service.SenderService {
+	return service.NewSenderService(time.Hour, time.Minute, 0, publishAhead, instanceID, time.Minute,
+		models.PublishBackoff{Base: time.Minute, Max: time.Hour}, paging, publisher, fetcher, nil, nil, listener)
+}
+
+// memoryWakeUpListener is a ports.NotificationWakeUpListener, wake-ups are sent into it by test
+type memoryWakeUpListener struct {
+	wakeUps chan *models.WakeUp
+	stopped chan struct{}
+}
+
+func newMemoryWakeUpListener() *memoryWakeUpListener {
+	return &memoryWakeUpListener{wakeUps: make(chan *models.WakeUp), stopped: make(chan struct{})}
+}
+
+func (l *memoryWakeUpListener) StartListening() <-chan *models.WakeUp {
+	return l.wakeUps
+}
+
+func (l *memoryWakeUpListener) StopListening() error {
+	close(l.stopped)
+	return nil
+}
+
+// notify sends wake-up like another replica would, gives up when service is stopped
+func (l *memoryWakeUpListener) notify(wakeUp *models.WakeUp) {
+	select {
+	case l.wakeUps <- wakeUp:
+	case <-l.stopped:
+	}
+}
+
+// runUntil runs services until done is true or 5 seconds pass
+func runUntil(t *testing.T, done func() bool, services ...*service.SenderService) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	wg := &sync.WaitGroup{}
+	for _, senderService := range services {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			senderService.Run(ctx)
+		}()
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !done() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	wg.Wait()
+}
+
+// allPublished tells if every notification is published at least once
+func allPublished(publisher *memoryPublisherRepo, notifications []*models.Notification) func() bool {
+	return func() bool {
+		for _, notification := range notifications {
+			if publisher.timesPublished(*notification.ID) == 0 {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+func TestQuickSendSkipsNotificationLeasedByAnotherInstance(t *testing.T) {
+	notification := scheduledNotification(time.Now())
+	fetcher := newMemoryFetcherRepo(notification)
+	publisher := newMemoryPublisherRepo()
+
+	claimed, _ := fetcher.Claim(context.Background(), *notification.ID, "instance-b", time.Minute)
+	if !claimed {
+		t.Fatalf("Expected notification to be claimed by instance-b")
+	}
+
+	err := newLeasingSenderService("instance-a", publisher, fetcher).QuickSend(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if times := publisher.timesPublished(*notification.ID); times != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, times)
+	}
+	if owner := fetcher.lease(*notification.ID).owner; owner != "instance-b" {
+		t.Errorf("Expected '%s', got '%s'", "instance-b", owner)
+	}
+}
+
+func TestQuickSendClaimsExpiredLease(t *testing.T) {
+	notification := scheduledNotification(time.Now())
+	fetcher := newMemoryFetcherRepo(notification)
+	publisher := newMemoryPublisherRepo()
+
+	// instance-b died right after claiming
+	_, _ = fetcher.Claim(context.Background(), *notification.ID, "instance-b", -time.Second)
+
+	err := newLeasingSenderService("instance-a", publisher, fetcher).QuickSend(context.Background(), notification)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if times := publisher.timesPublished(*notification.ID); times != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, times)
+	}
+}
+
+func TestInstancesPublishEachNotificationOnce(t *testing.T) {
+	notifications := make([]*models.Notification, 100)
+	for i := range notifications {
+		notifications[i] = scheduledNotification(time.Now().Add(-time.Second))
+	}
+	fetcher := newMemoryFetcherRepo(notifications...)
+	publisher := newMemoryPublisherRepo()
+
+	runUntil(t, allPublished(publisher, notifications),
+		newLeasingSenderService("instance-a", publisher, fetcher),
+		newLeasingSenderService("instance-b", publisher, fetcher),
+		newLeasingSenderService("instance-c", publisher, fetcher))
+
+	for _, notification := range notifications {
+		if times := publisher.timesPublished(*notification.ID); times != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, times, notification.ID)
+		}
+	}
+}
+
+func TestSendBatchMarksOnlyConfirmedPublishes(t *testing.T) {
+	confirmed := scheduledNotification(time.Now())
+	rejected := scheduledNotification(time.Now())
+	fetcher := newMemoryFetcherRepo(confirmed, rejected)
+	publisher := newMemoryPublisherRepo(rejected)
+	ctx := context.Background()
+
+	batch, _ := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, 10)
+
+	err := newLeasingSenderService("instance-a", publisher, fetcher).SendBatch(ctx, batch)
+	if !errors.Is(err, errBrokerRejected) {
+		t.Errorf("Expected '%v', got '%v'", errBrokerRejected, err)
+	}
+
+	if status := fetcher.status(*confirmed.ID); status != internaltypes.StatusQueued {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusQueued, status)
+	}
+	if status := fetcher.status(*rejected.ID); status != internaltypes.StatusScheduled {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusScheduled, status)
+	}
+	if attempts := fetcher.publishAttempts(*rejected.ID); attempts != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, attempts)
+	}
+
+	// lease is released, but backoff isn't over yet
+	if owner := fetcher.lease(*rejected.ID).owner; owner != "" {
+		t.Errorf("Expected '%s', got '%s'", "", owner)
+	}
+	refetched, _ := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), "instance-b", time.Minute, 10)
+	if len(refetched) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(refetched))
+	}
+}
+
+func TestQuickSendReturnsFailedPublishToPending(t *testing.T) {
+	notification := scheduledNotification(time.Now())
+	fetcher := newMemoryFetcherRepo(notification)
+	publisher := newMemoryPublisherRepo(notification)
+
+	err := newLeasingSenderService("instance-a", publisher, fetcher).QuickSend(context.Background(), notification)
+	if !errors.Is(err, errBrokerRejected) {
+		t.Errorf("Expected '%v', got '%v'", errBrokerRejected, err)
+	}
+	if status := fetcher.status(*notification.ID); status != internaltypes.StatusScheduled {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusScheduled, status)
+	}
+	if attempts := fetcher.publishAttempts(*notification.ID); attempts != 1 {
+		t.Errorf("Expected '%d', got '%d'", 1, attempts)
+	}
+}
+
+func TestSendBatchDeadLettersExhaustedPublishes(t *testing.T) {
+	rejected := scheduledNotification(time.Now())
+	fetcher := newMemoryFetcherRepo(rejected)
+	publisher := newMemoryPublisherRepo(rejected)
+	ctx := context.Background()
+
+	senderService := service.NewSenderService(time.Hour, time.Minute, 0, 0, "instance-a", time.Minute,
+		models.PublishBackoff{Base: 0, Max: 0, MaxAttempts: 2},
+		service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 1, MaxInFlight: 10, MaxScheduled: 10},
+		publisher, fetcher, nil, nil, nil)
+
+	for range 2 {
+		batch, _ := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, 10)
+		if len(batch) != 1 {
+			t.Fatalf("Expected '%d', got '%d'", 1, len(batch))
+		}
+		if err := senderService.SendBatch(ctx, batch); !errors.Is(err, errBrokerRejected) {
+			t.Errorf("Expected '%v', got '%v'", errBrokerRejected, err)
+		}
+	}
+
+	if status := fetcher.status(*rejected.ID); status != internaltypes.StatusFailed {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusFailed, status)
+	}
+	fetcher.mu.Lock()
+	deadLettered := slices.Clone(fetcher.deadLettered)
+	fetcher.mu.Unlock()
+	if !slices.Equal(deadLettered, []types.UUID{*rejected.ID}) {
+		t.Errorf("Expected '%v', got '%v'", []types.UUID{*rejected.ID}, deadLettered)
+	}
+
+	refetched, _ := fetcher.Fetch(ctx, types.NewDateTime(time.Now()), "instance-a", time.Minute, 10)
+	if len(refetched) != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, len(refetched))
+	}
+}
+
+func TestRunDrainsBacklogWithBoundedInFlight(t *testing.T) {
+	notifications := make([]*models.Notification, 1000)
+	for i := range notifications {
+		notifications[i] = scheduledNotification(time.Now().Add(-time.Duration(i) * time.Second))
+	}
+	fetcher := newMemoryFetcherRepo(notifications...)
+	publisher := newMemoryPublisherRepo(notifications[:10]...)
+
+	paging := service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 3, MaxInFlight: 25, MaxScheduled: 10}
+	runUntil(t, allPublished(publisher, notifications[10:]), newPagingSenderService("instance-a", publisher, fetcher, paging))
+
+	for _, notification := range notifications[10:] {
+		if times := publisher.timesPublished(*notification.ID); times != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, times, notification.ID)
+		}
+	}
+
+	// MaxInFlight isn't a multiple of BatchSize, so only 2 pages fit
+	fetcher.mu.Lock()
+	defer fetcher.mu.Unlock()
+	if fetcher.maxInFlight > paging.MaxInFlight {
+		t.Errorf("Expected at most '%d', got '%d'", paging.MaxInFlight, fetcher.maxInFlight)
+	}
+	if fetcher.inFlight != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, fetcher.inFlight)
+	}
+}
+
+// maxAllowedLateness is how late a notification may be published, fetchPeriod in these tests is an hour
+const maxAllowedLateness = 100 * time.Millisecond
+
+// assertPublishedOnTime checks that notifications are published not earlier than their time and not too late
+func assertPublishedOnTime(t *testing.T, publisher *memoryPublisherRepo, notifications []*models.Notification) {
+	t.Helper()
+
+	maxLateness := time.Duration(0)
+	for _, notification := range notifications {
+		if times := publisher.timesPublished(*notification.ID); times != 1 {
+			t.Errorf("Expected '%d', got '%d' for '%s'", 1, times, notification.ID)
+			continue
+		}
+		lateness := publisher.lateness(notification)
+		if lateness < 0 {
+			t.Errorf("Expected no earlier than '%s', got '%s' earlier", notification.PublicationAt, -lateness)
+		}
+		if lateness > maxAllowedLateness {
+			t.Errorf("Expected at most '%s' late, got '%s'", maxAllowedLateness, lateness)
+		}
+		maxLateness = max(maxLateness, lateness)
+	}
+	t.Logf("max lateness: %s", maxLateness)
+}
+
+func TestRunPublishesLoadedWindowOnTime(t *testing.T) {
+	start := time.Now()
+	notifications := make([]*models.Notification, 10)
+	for i := range notifications {
+		notifications[i] = scheduledNotification(start.Add(time.Duration(50*(i+1)) * time.Millisecond))
+	}
+	fetcher := newMemoryFetcherRepo(notifications...)
+	publisher := newMemoryPublisherRepo()
+
+	runUntil(t, allPublished(publisher, notifications), newLeasingSenderService("instance-a", publisher, fetcher))
+
+	assertPublishedOnTime(t, publisher, notifications)
+}
+
+func TestRunReloadsWindowThatDidNotFit(t *testing.T) {
+	start := time.Now()
+	notifications := make([]*models.Notification, 10)
+	for i := range notifications {
+		notifications[i] = scheduledNotification(start.Add(time.Duration(50*(i+1)) * time.Millisecond))
+	}
+	fetcher := newMemoryFetcherRepo(notifications...)
+	publisher := newMemoryPublisherRepo()
+
+	paging := service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 1, MaxInFlight: 10, MaxScheduled: 3}
+	runUntil(t, allPublished(publisher, notifications), newPagingSenderService("instance-a", publisher, fetcher, paging))
+
+	assertPublishedOnTime(t, publisher, notifications)
+}
+
+func TestScheduleWakesRunningService(t *testing.T) {
+	fetcher := newMemoryFetcherRepo()
+	publisher := newMemoryPublisherRepo()
+	senderService := newLeasingSenderService("instance-a", publisher, fetcher)
+
+	// created after the window is loaded
+	created := scheduledNotification(time.Now().Add(200 * time.Millisecond))
+	// moved into the window by update
+	updated := scheduledNotification(time.Now().Add(time.Hour))
+	fetcher.add(created)
+	fetcher.add(updated)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		_ = senderService.Schedule(context.Background(), created)
+
+		updated = fetcher.update(*updated.ID, func(notification *models.Notification) {
+			notification.PublicationAt = types.NewDateTime(time.Now().Add(100 * time.Millisecond))
+		})
+		_ = senderService.Schedule(context.Background(), updated)
+	}()
+
+	runUntil(t, func() bool {
+		return publisher.timesPublished(*created.ID) > 0 && publisher.timesPublished(*updated.ID) > 0
+	}, senderService)
+
+	assertPublishedOnTime(t, publisher, []*models.Notification{created, fetcher.update(*updated.ID, func(*models.Notification) {})})
+}
+
+func TestUnscheduledNotificationIsNotPublished(t *testing.T) {
+	cancelled := scheduledNotification(time.Now().Add(100 * time.Millisecond))
+	kept := scheduledNotification(time.Now().Add(200 * time.Millisecond))
+	fetcher := newMemoryFetcherRepo(cancelled, kept)
+	publisher := newMemoryPublisherRepo()
+	senderService := newLeasingSenderService("instance-a", publisher, fetcher)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		cancelled = fetcher.update(*cancelled.ID, func(notification *models.Notification) {
+			notification.Status = internaltypes.StatusCancelled
+		})
+		_ = senderService.Unschedule(context.Background(), cancelled)
+	}()
+
+	runUntil(t, allPublished(publisher, []*models.Notification{kept}), senderService)
+
+	if times := publisher.timesPublished(*cancelled.ID); times != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, times)
+	}
+	assertPublishedOnTime(t, publisher, []*models.Notification{kept})
+}
+
+func TestWakeUpNoticesOfOtherReplicasArePublishedOnTime(t *testing.T) {
+	fetcher := newMemoryFetcherRepo()
+	publisher := newMemoryPublisherRepo()
+	listener := newMemoryWakeUpListener()
+	paging := service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 1, MaxInFlight: 10, MaxScheduled: 10}
+	senderService := newListeningSenderService("instance-a", publisher, fetcher, paging, listener)
+
+	// created by another replica after the window is loaded: 1 is announced with ID, a batch without it
+	single := scheduledNotification(time.Now().Add(200 * time.Millisecond))
+	batch := []*models.Notification{
+		scheduledNotification(time.Now().Add(300 * time.Millisecond)),
+		scheduledNotification(time.Now().Add(400 * time.Millisecond)),
+	}
+	// announced, but then moved out of the window
+	movedOut := scheduledNotification(time.Now().Add(300 * time.Millisecond))
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+
+		fetcher.add(single)
+		listener.notify(&models.WakeUp{ID: single.ID, At: single.PublicationAt.Value()})
+
+		fetcher.add(movedOut)
+		listener.notify(&models.WakeUp{ID: movedOut.ID, At: movedOut.PublicationAt.Value()})
+		movedOut = fetcher.update(*movedOut.ID, func(notification *models.Notification) {
+			notification.PublicationAt = types.NewDateTime(time.Now().Add(time.Hour))
+		})
+		listener.notify(&models.WakeUp{ID: movedOut.ID, At: movedOut.PublicationAt.Value()})
+
+		for _, notification := range batch {
+			fetcher.add(notification)
+		}
+		listener.notify(&models.WakeUp{At: batch[0].PublicationAt.Value()})
+	}()
+
+	runUntil(t, allPublished(publisher, append([]*models.Notification{single}, batch...)), senderService)
+
+	assertPublishedOnTime(t, publisher, append([]*models.Notification{single}, batch...))
+	if times := publisher.timesPublished(*movedOut.ID); times != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, times)
+	}
+}
+
+func TestRunPublishesAheadForBrokerDelay(t *testing.T) {
+	const publishAhead = time.Second
+
+	start := time.Now()
+	loaded := scheduledNotification(start.Add(publishAhead + 100*time.Millisecond))
+	scheduled := scheduledNotification(start.Add(publishAhead + 200*time.Millisecond))
+	// out of window + publishAhead, it's not published at all
+	later := scheduledNotification(start.Add(time.Minute + 2*publishAhead))
+	fetcher := newMemoryFetcherRepo(loaded, later)
+	publisher := newMemoryPublisherRepo()
+	paging := service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 1, MaxInFlight: 10, MaxScheduled: 10}
+	senderService := newAheadSenderService("instance-a", publisher, fetcher, paging, nil, publishAhead)
+
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		fetcher.add(scheduled)
+		_ = senderService.Schedule(context.Background(), scheduled)
+	}()
+
+	runUntil(t, allPublished(publisher, []*models.Notification{loaded, scheduled}), senderService)
+
+	for _, notification := range []*models.Notification{loaded, scheduled} {
+		// published publishAhead earlier, broker waits the rest
+		lateness := publisher.lateness(notification) + publishAhead
+		if lateness < 0 || lateness > maxAllowedLateness {
+			t.Errorf("Expected '%s' earlier at most '%s' late, got '%s'", publishAhead, maxAllowedLateness, lateness)
+		}
+	}
+	if times := publisher.timesPublished(*later.ID); times != 0 {
+		t.Errorf("Expected '%d', got '%d'", 0, times)
+	}
+}
+
+// memorySeriesRepo is an in-memory ports.NotificationSeriesRepository
+type memorySeriesRepo struct {
+	mu          sync.Mutex
+	series      map[types.UUID]*models.NotificationSeries
+	occurrences []*models.Notification
+}
+
+func newMemorySeriesRepo() *memorySeriesRepo {
+	return &memorySeriesRepo{series: make(map[types.UUID]*models.NotificationSeries)}
+}
+
+// addSeries saves series of rule with the latest occurrence 1 in given status
+func (r *memorySeriesRepo) addSeries(t *testing.T, rule string, status internaltypes.NotificationStatus, stopped bool) types.UUID {
+	start := time.Now().Add(-time.Hour).Truncate(time.Minute)
+	validRule, err := recurrence.NewRule(rule, start, time.Time{}, 0)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id := types.GenerateUUID()
+	series := &models.NotificationSeries{ID: &id, Rule: validRule}
+	if stopped {
+		stoppedAt := types.NewDateTime(time.Now())
+		series.StoppedAt = &stoppedAt
+	}
+
+	first := scheduledNotification(start)
+	first.Status = status
+	first.SeriesID = &id
+	first.Occurrence = 1
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[id] = series
+	r.occurrences = append(r.occurrences, first)
+	return id
+}
+
+func (r *memorySeriesRepo) latest(id types.UUID) *models.Notification {
+	var latest *models.Notification
+	for _, occurrence := range r.occurrences {
+		if *occurrence.SeriesID == id && (latest == nil || occurrence.Occurrence > latest.Occurrence) {
+			latest = occurrence
+		}
+	}
+	return latest
+}
+
+func (r *memorySeriesRepo) CreateSeries(_ context.Context, series *models.NotificationSeries, first *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.series[*series.ID] = series
+	r.occurrences = append(r.occurrences, first)
+	return nil
+}
+
+func (r *memorySeriesRepo) GetSeries(_ context.Context, id types.UUID) (*models.NotificationSeries, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	series := *r.series[id]
+	series.Last = r.latest(id)
+	return &series, nil
+}
+
+func (r *memorySeriesRepo) StopSeries(_ context.Context, id types.UUID) ([]*types.UUID, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stoppedAt := types.NewDateTime(time.Now())
+	r.series[id].StoppedAt = &stoppedAt
+	return []*types.UUID{}, nil
+}
+
+func (r *memorySeriesRepo) CreateOccurrence(_ context.Context, occurrence *models.Notification) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.series[*occurrence.SeriesID].IsStopped() || r.latest(*occurrence.SeriesID).Occurrence >= occurrence.Occurrence {
+		return false, nil
+	}
+	r.occurrences = append(r.occurrences, occurrence)
+	return true, nil
+}
+
+func (r *memorySeriesRepo) FetchStalledSeries(_ context.Context, limit int) ([]*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	stalled := make([]*models.Notification, 0)
+	for id, series := range r.series {
+		if latest := r.latest(id); !series.IsStopped() && latest.Status != internaltypes.StatusScheduled {
+			copied := *latest
+			stalled = append(stalled, &copied)
+		}
+	}
+	return stalled[:min(limit, len(stalled))], nil
+}
+
+// occurrencesOf returns occurrence numbers of series
+func (r *memorySeriesRepo) occurrencesOf(id types.UUID) []int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	result := make([]int, 0)
+	for _, occurrence := range r.occurrences {
+		if *occurrence.SeriesID == id {
+			result = append(result, occurrence.Occurrence)
+		}
+	}
+	return result
+}
+
+func TestRunResumesStalledSeries(t *testing.T) {
+	seriesRepo := newMemorySeriesRepo()
+	// next occurrence of sent one wasn't created, e.g. service was down right after marking it as queued
+	stalled := seriesRepo.addSeries(t, "FREQ=MINUTELY", internaltypes.StatusQueued, false)
+	waiting := seriesRepo.addSeries(t, "FREQ=MINUTELY", internaltypes.StatusScheduled, false)
+	stopped := seriesRepo.addSeries(t, "FREQ=MINUTELY", internaltypes.StatusQueued, true)
+
+	senderService := service.NewSenderService(time.Hour, time.Minute, 0, 0, "instance-a", time.Minute,
+		models.PublishBackoff{Base: time.Minute, Max: time.Hour},
+		service.FetchPaging{BatchSize: 10, MaxConcurrentPages: 1, MaxInFlight: 10, MaxScheduled: 10},
+		newMemoryPublisherRepo(), newMemoryFetcherRepo(), seriesRepo, nil, nil)
+
+	runUntil(t, func() bool {
+		return len(seriesRepo.occurrencesOf(stalled)) == 2
+	}, senderService)
+
+	tests := []struct {
+		name     string
+		id       types.UUID
+		expected []int
+	}{
+		{name: "stalled", id: stalled, expected: []int{1, 2}},
+		{name: "waiting", id: waiting, expected: []int{1}},
+		{name: "stopped", id: stopped, expected: []int{1}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if occurrences := seriesRepo.occurrencesOf(tt.id); !slices.Equal(occurrences, tt.expected) {
+				t.Errorf("Expected '%v', got '%v'", tt.expected, occurrences)
+			}
+		})
+	}
+
+	// missed occurrences are skipped, next one is after now
+	seriesRepo.mu.Lock()
+	next := seriesRepo.latest(stalled)
+	seriesRepo.mu.Unlock()
+	if !next.PublicationAt.Value().After(time.Now().Add(-time.Second)) {
+		t.Errorf("Expected '%s' to be in the future", next.PublicationAt)
+	}
+	if next.Status != internaltypes.StatusScheduled {
+		t.Errorf("Expected '%s', got '%s'", internaltypes.StatusScheduled, next.Status)
+	}
+}
@@ -0,0 +1,105 @@
+package tests
+
+import (
+	"errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/templating"
+	"testing"
+)
+
+func TestRender(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      templating.Kind
+		source    string
+		variables map[string]any
+		expected  string
+	}{
+		{
+			name:      "text",
+			kind:      templating.KindText,
+			source:    "Hello, {{.name}}!",
+			variables: map[string]any{"name": "<b>Bob</b>"},
+			expected:  "Hello, <b>Bob</b>!",
+		},
+		{
+			name:      "html escapes variables",
+			kind:      templating.KindHTML,
+			source:    "<p>Hello, {{.name}}!</p>",
+			variables: map[string]any{"name": "<b>Bob</b>"},
+			expected:  "<p>Hello, &lt;b&gt;Bob&lt;/b&gt;!</p>",
+		},
+		{
+			name:      "numbers and conditions",
+			kind:      templating.KindText,
+			source:    "{{if .urgent}}URGENT: {{end}}{{.count}} new messages",
+			variables: map[string]any{"urgent": true, "count": 3},
+			expected:  "URGENT: 3 new messages",
+		},
+		{
+			name:     "no variables",
+			kind:     templating.KindText,
+			source:   "Static text",
+			expected: "Static text",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := templating.Render(tt.kind, tt.source, tt.variables)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if result != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result)
+			}
+		})
+	}
+}
+
+func TestRenderErrors(t *testing.T) {
+	tests := []struct {
+		name      string
+		kind      templating.Kind
+		source    string
+		variables map[string]any
+		expected  error
+	}{
+		{
+			name:      "missing variable in text",
+			kind:      templating.KindText,
+			source:    "Hello, {{.name}}!",
+			variables: map[string]any{"other": "x"},
+			expected:  templating.ErrRenderFailed,
+		},
+		{
+			name:     "missing variable in html",
+			kind:     templating.KindHTML,
+			source:   "Hello, {{.name}}!",
+			expected: templating.ErrRenderFailed,
+		},
+		{
+			name:     "unclosed action",
+			kind:     templating.KindText,
+			source:   "Hello, {{.name",
+			expected: templating.ErrInvalidTemplate,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := templating.Render(tt.kind, tt.source, tt.variables)
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected '%v', got '%v'", tt.expected, err)
+			}
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	if err := templating.Validate("Hi {{.name}}"); err != nil {
+		t.Errorf("Expected no error, got '%v'", err)
+	}
+	if err := templating.Validate("Hi {{end}}"); !errors.Is(err, templating.ErrInvalidTemplate) {
+		t.Errorf("Expected '%v', got '%v'", templating.ErrInvalidTemplate, err)
+	}
+}
@@ -0,0 +1,116 @@
+package tests
+
+import (
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/timerheap"
+	"slices"
+	"testing"
+	"time"
+)
+
+var base = time.Date(2025, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func TestPopDueReturnsEarliestFirst(t *testing.T) {
+	testCases := []struct {
+		name     string
+		set      map[string]time.Duration
+		removed  []string
+		now      time.Duration
+		expected []string
+		left     int
+	}{
+		{
+			name:     "empty",
+			set:      map[string]time.Duration{},
+			now:      time.Hour,
+			expected: []string{},
+		},
+		{
+			name:     "all due",
+			set:      map[string]time.Duration{"c": 3 * time.Second, "a": time.Second, "b": 2 * time.Second},
+			now:      3 * time.Second,
+			expected: []string{"a", "b", "c"},
+		},
+		{
+			name:     "some due",
+			set:      map[string]time.Duration{"c": 3 * time.Second, "a": time.Second, "b": 2 * time.Second},
+			now:      2*time.Second - time.Nanosecond,
+			expected: []string{"a"},
+			left:     2,
+		},
+		{
+			name:     "removed aren't due",
+			set:      map[string]time.Duration{"c": 3 * time.Second, "a": time.Second, "b": 2 * time.Second},
+			removed:  []string{"a", "missing"},
+			now:      2 * time.Second,
+			expected: []string{"b"},
+			left:     1,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wakeUps := timerheap.New[string]()
+			for key, after := range tc.set {
+				wakeUps.Set(key, base.Add(after))
+			}
+			for _, key := range tc.removed {
+				wakeUps.Remove(key)
+			}
+
+			due := wakeUps.PopDue(base.Add(tc.now))
+			if !slices.Equal(due, tc.expected) {
+				t.Errorf("Expected '%v', got '%v'", tc.expected, due)
+			}
+			if wakeUps.Len() != tc.left {
+				t.Errorf("Expected '%d', got '%d'", tc.left, wakeUps.Len())
+			}
+		})
+	}
+}
+
+func TestSetMovesExistingKey(t *testing.T) {
+	wakeUps := timerheap.New[string]()
+	wakeUps.Set("a", base.Add(time.Second))
+	wakeUps.Set("b", base.Add(2*time.Second))
+	wakeUps.Set("a", base.Add(3*time.Second))
+
+	if wakeUps.Len() != 2 {
+		t.Errorf("Expected '%d', got '%d'", 2, wakeUps.Len())
+	}
+	next, ok := wakeUps.Next()
+	if !ok || !next.Equal(base.Add(2*time.Second)) {
+		t.Errorf("Expected '%s', got '%s'", base.Add(2*time.Second), next)
+	}
+}
+
+func TestChangedOnlyWhenEarliestBecomesEarlier(t *testing.T) {
+	wakeUps := timerheap.New[string]()
+
+	testCases := []struct {
+		name     string
+		key      string
+		after    time.Duration
+		expected bool
+	}{
+		{name: "first", key: "a", after: 2 * time.Second, expected: true},
+		{name: "later", key: "b", after: 3 * time.Second, expected: false},
+		{name: "earlier", key: "c", after: time.Second, expected: true},
+		{name: "moved earlier", key: "b", after: time.Millisecond, expected: true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			wakeUps.Set(tc.key, base.Add(tc.after))
+
+			changed := false
+			select {
+			case <-wakeUps.Changed():
+				changed = true
+			default:
+			}
+			if changed != tc.expected {
+				t.Errorf("Expected '%t', got '%t'", tc.expected, changed)
+			}
+		})
+	}
+}
@@ -0,0 +1,376 @@
+package tests
+
+import (
+	"context"
+	stderrors "errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/errors"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/internaltypes"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/models"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/service"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/internal/transport"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"github.com/wb-go/wbf/ginext"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// memoryNotificationStorage is an in-memory ports.NotificationCRUDStorageRepository
+//
+// like postgres, it updates only rows in expected status, statusOnUpdate (if set) simulates a concurrent change
+type memoryNotificationStorage struct {
+	mu            sync.Mutex
+	notifications map[types.UUID]models.Notification
+
+	statusOnUpdate *internaltypes.NotificationStatus
+}
+
+func newMemoryNotificationStorage(notifications ...*models.Notification) *memoryNotificationStorage {
+	storage := &memoryNotificationStorage{notifications: make(map[types.UUID]models.Notification)}
+	for _, notification := range notifications {
+		storage.notifications[*notification.ID] = *notification
+	}
+	return storage
+}
+
+func (r *memoryNotificationStorage) CreateNotification(_ context.Context, notification *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications[*notification.ID] = *notification
+	return nil
+}
+
+func (r *memoryNotificationStorage) CreateNotifications(ctx context.Context, notifications []*models.Notification) error {
+	for _, notification := range notifications {
+		_ = r.CreateNotification(ctx, notification)
+	}
+	return nil
+}
+
+func (r *memoryNotificationStorage) UpdateNotification(_ context.Context, newData *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, found := r.notifications[*newData.ID]
+	if !found {
+		return errors.ErrNotificationNotFound
+	}
+	if r.statusOnUpdate != nil {
+		current.Status = *r.statusOnUpdate
+		r.notifications[*newData.ID] = current
+	}
+	if !current.Status.IsEditable() {
+		return errors.ErrNotificationNotEditable
+	}
+	r.notifications[*newData.ID] = *newData
+	return nil
+}
+
+func (r *memoryNotificationStorage) UpdateStatus(_ context.Context, id types.UUID, status internaltypes.NotificationStatus) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, found := r.notifications[id]
+	if !found {
+		return errors.ErrNotificationNotFound
+	}
+	if !current.Status.CanTransitionTo(status) {
+		return errors.ErrInvalidStatusTransition
+	}
+	current.Status = status
+	r.notifications[id] = current
+	return nil
+}
+
+func (r *memoryNotificationStorage) DeleteNotification(_ context.Context, id types.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, found := r.notifications[id]; !found {
+		return errors.ErrNotificationNotFound
+	}
+	delete(r.notifications, id)
+	return nil
+}
+
+func (r *memoryNotificationStorage) GetNotification(_ context.Context, id types.UUID) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	notification, found := r.notifications[id]
+	if !found {
+		return nil, errors.ErrNotificationNotFound
+	}
+	return &notification, nil
+}
+
+func (r *memoryNotificationStorage) ListNotifications(_ context.Context, _ models.NotificationFilter, _ *models.NotificationCursor, _ int) ([]*models.Notification, error) {
+	return nil, nil
+}
+
+// memoryNotificationCache is an in-memory ports.NotificationCRUDCacheRepository
+type memoryNotificationCache struct {
+	mu            sync.Mutex
+	notifications map[types.UUID]models.Notification
+}
+
+func newMemoryNotificationCache() *memoryNotificationCache {
+	return &memoryNotificationCache{notifications: make(map[types.UUID]models.Notification)}
+}
+
+func (r *memoryNotificationCache) SaveNotification(_ context.Context, notification *models.Notification) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.notifications[*notification.ID] = *notification
+	return nil
+}
+
+func (r *memoryNotificationCache) GetNotification(_ context.Context, id types.UUID) (*models.Notification, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	notification, found := r.notifications[id]
+	if !found {
+		return nil, errors.ErrNotificationNotFound
+	}
+	return &notification, nil
+}
+
+func (r *memoryNotificationCache) DeleteNotification(_ context.Context, id types.UUID) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.notifications, id)
+	return nil
+}
+
+// telegramNotification is a notification in status that's due tomorrow
+func telegramNotification(t *testing.T, status internaltypes.NotificationStatus) *models.Notification {
+	sendTo, err := internaltypes.NewSendTo(types.NewAnyText("100"), internaltypes.ChannelTelegram)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+
+	id := types.GenerateUUID()
+	return &models.Notification{
+		ID:            &id,
+		PublicationAt: types.NewDateTime(time.Now().Add(24 * time.Hour)),
+		Channel:       internaltypes.ChannelTelegram,
+		Content:       models.NotificationContent{Title: "title", Message: "message"},
+		Status:        status,
+		SendTo:        sendTo,
+	}
+}
+
+// notifyRouter assembles the router with NotifyHandler over storage, other handlers aren't used
+func notifyRouter(storage *memoryNotificationStorage, cache *memoryNotificationCache) *ginext.Engine {
+	return notifyRouterWithCancelSignal(storage, cache, nil)
+}
+
+// notifyRouterWithCancelSignal is notifyRouter that calls onCancel after cancelling
+func notifyRouterWithCancelSignal(storage *memoryNotificationStorage, cache *memoryNotificationCache, onCancel service.SignalFunc) *ginext.Engine {
+	crudService := service.NewNotificationCRUDService(storage, cache, nil, nil, nil, onCancel)
+	return transport.AssembleRouter(transport.NewNotifyHandler(crudService, nil, nil, nil), nil, nil)
+}
+
+func serve(router *ginext.Engine, method, path, body string) *httptest.ResponseRecorder {
+	recorder := httptest.NewRecorder()
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	request.Header.Set("Content-Type", "application/json")
+	router.ServeHTTP(recorder, request)
+	return recorder
+}
+
+func TestUpdateNotification_Responses(t *testing.T) {
+	queued := internaltypes.StatusQueued
+
+	tests := []struct {
+		name           string
+		status         internaltypes.NotificationStatus
+		statusOnUpdate *internaltypes.NotificationStatus
+		missing        bool
+		body           string
+		expectedCode   int
+		expectedTitle  string
+	}{
+		{
+			name:          "scheduled",
+			status:        internaltypes.StatusScheduled,
+			body:          `{"content":{"title":"new title"}}`,
+			expectedCode:  http.StatusOK,
+			expectedTitle: "new title",
+		},
+		{
+			name:          "not found",
+			status:        internaltypes.StatusScheduled,
+			missing:       true,
+			body:          `{"content":{"title":"new title"}}`,
+			expectedCode:  http.StatusNotFound,
+			expectedTitle: "title",
+		},
+		{
+			name:          "already queued",
+			status:        internaltypes.StatusQueued,
+			body:          `{"content":{"title":"new title"}}`,
+			expectedCode:  http.StatusConflict,
+			expectedTitle: "title",
+		},
+		{
+			name:          "already delivered",
+			status:        internaltypes.StatusDelivered,
+			body:          `{"content":{"title":"new title"}}`,
+			expectedCode:  http.StatusConflict,
+			expectedTitle: "title",
+		},
+		{
+			name:           "queued while being edited",
+			status:         internaltypes.StatusScheduled,
+			statusOnUpdate: &queued,
+			body:           `{"content":{"title":"new title"}}`,
+			expectedCode:   http.StatusConflict,
+			expectedTitle:  "title",
+		},
+		{
+			name:          "send_to invalid for channel",
+			status:        internaltypes.StatusScheduled,
+			body:          `{"send_to":"not a chat id"}`,
+			expectedCode:  http.StatusBadRequest,
+			expectedTitle: "title",
+		},
+		{
+			name:          "invalid publication_at",
+			status:        internaltypes.StatusScheduled,
+			body:          `{"publication_at":"tomorrow"}`,
+			expectedCode:  http.StatusBadRequest,
+			expectedTitle: "title",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := telegramNotification(t, tt.status)
+
+			storage := newMemoryNotificationStorage(notification)
+			storage.statusOnUpdate = tt.statusOnUpdate
+			path := "/notify/" + notification.ID.String()
+			if tt.missing {
+				path = "/notify/" + types.GenerateUUID().String()
+			}
+
+			response := serve(notifyRouter(storage, newMemoryNotificationCache()), http.MethodPatch, path, tt.body)
+			if response.Code != tt.expectedCode {
+				t.Fatalf("Expected '%d', got '%d': %s", tt.expectedCode, response.Code, response.Body.String())
+			}
+
+			stored, err := storage.GetNotification(context.Background(), *notification.ID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stored.Content.Title.String() != tt.expectedTitle {
+				t.Errorf("Expected '%s', got '%s'", tt.expectedTitle, stored.Content.Title.String())
+			}
+		})
+	}
+}
+
+func TestDeleteNotification_RemovesIt(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         internaltypes.NotificationStatus
+		missing        bool
+		expectedCode   int
+		expectedCancel bool
+	}{
+		{name: "scheduled", status: internaltypes.StatusScheduled, expectedCode: http.StatusNoContent, expectedCancel: true},
+		{name: "delivered", status: internaltypes.StatusDelivered, expectedCode: http.StatusNoContent},
+		{name: "not found", status: internaltypes.StatusScheduled, missing: true, expectedCode: http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := telegramNotification(t, tt.status)
+			storage := newMemoryNotificationStorage(notification)
+			cache := newMemoryNotificationCache()
+			_ = cache.SaveNotification(context.Background(), notification)
+
+			cancelled := make(chan *models.Notification, 1)
+			onCancel := func(_ context.Context, notification *models.Notification) error {
+				cancelled <- notification
+				return nil
+			}
+
+			path := "/notify/" + notification.ID.String()
+			if tt.missing {
+				path = "/notify/" + types.GenerateUUID().String()
+			}
+
+			response := serve(notifyRouterWithCancelSignal(storage, cache, onCancel), http.MethodDelete, path, "")
+			if response.Code != tt.expectedCode {
+				t.Fatalf("Expected '%d', got '%d': %s", tt.expectedCode, response.Code, response.Body.String())
+			}
+			if tt.missing {
+				return
+			}
+
+			if _, err := storage.GetNotification(context.Background(), *notification.ID); !stderrors.Is(err, errors.ErrNotificationNotFound) {
+				t.Errorf("Expected row to be deleted, got '%v'", err)
+			}
+			if _, err := cache.GetNotification(context.Background(), *notification.ID); err == nil {
+				t.Errorf("Expected cache entry to be deleted")
+			}
+
+			// scheduled one mustn't be published anymore
+			select {
+			case <-cancelled:
+				if !tt.expectedCancel {
+					t.Errorf("Expected no cancel signal")
+				}
+			case <-time.After(100 * time.Millisecond):
+				if tt.expectedCancel {
+					t.Errorf("Expected cancel signal")
+				}
+			}
+		})
+	}
+}
+
+func TestCancelNotification_KeepsIt(t *testing.T) {
+	tests := []struct {
+		name           string
+		status         internaltypes.NotificationStatus
+		missing        bool
+		expectedCode   int
+		expectedStatus internaltypes.NotificationStatus
+	}{
+		{name: "scheduled", status: internaltypes.StatusScheduled, expectedCode: http.StatusNoContent, expectedStatus: internaltypes.StatusCancelled},
+		{name: "delivered", status: internaltypes.StatusDelivered, expectedCode: http.StatusConflict, expectedStatus: internaltypes.StatusDelivered},
+		{name: "not found", status: internaltypes.StatusScheduled, missing: true, expectedCode: http.StatusNotFound, expectedStatus: internaltypes.StatusScheduled},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			notification := telegramNotification(t, tt.status)
+			storage := newMemoryNotificationStorage(notification)
+
+			path := "/notify/" + notification.ID.String() + "/cancel"
+			if tt.missing {
+				path = "/notify/" + types.GenerateUUID().String() + "/cancel"
+			}
+
+			response := serve(notifyRouter(storage, newMemoryNotificationCache()), http.MethodPost, path, "")
+			if response.Code != tt.expectedCode {
+				t.Fatalf("Expected '%d', got '%d': %s", tt.expectedCode, response.Code, response.Body.String())
+			}
+
+			stored, err := storage.GetNotification(context.Background(), *notification.ID)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if stored.Status != tt.expectedStatus {
+				t.Errorf("Expected '%s', got '%s'", tt.expectedStatus.String(), stored.Status.String())
+			}
+		})
+	}
+}
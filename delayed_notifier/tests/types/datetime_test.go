@@ -0,0 +1,164 @@
+package tests
+
+import (
+	"encoding/json"
+	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
+	"testing"
+	"time"
+)
+
+func TestNewDateTimeFromString(t *testing.T) {
+	tests := []struct {
+		name      string
+		input     string
+		expected  string
+		zone      string
+		utc       time.Time
+		expectErr bool
+	}{
+		{
+			name:     "legacy format is UTC",
+			input:    "2025-10-08 21:30:00",
+			expected: "2025-10-08 21:30:00",
+			zone:     "",
+			utc:      time.Date(2025, time.October, 8, 21, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "RFC 3339 with Z",
+			input:    "2025-10-08T21:30:00Z",
+			expected: "2025-10-08 21:30:00",
+			zone:     "",
+			utc:      time.Date(2025, time.October, 8, 21, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "RFC 3339 with offset",
+			input:    "2025-10-08T21:30:00+03:00",
+			expected: "2025-10-08T21:30:00+03:00",
+			zone:     "+03:00",
+			utc:      time.Date(2025, time.October, 8, 18, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "negative offset",
+			input:    "2025-10-08T21:30:00-05:30",
+			expected: "2025-10-08T21:30:00-05:30",
+			zone:     "-05:30",
+			utc:      time.Date(2025, time.October, 9, 3, 0, 0, 0, time.UTC),
+		},
+		{
+			name:     "naive with IANA zone",
+			input:    "2025-10-08T21:30:00[Europe/Moscow]",
+			expected: "2025-10-08T21:30:00+03:00[Europe/Moscow]",
+			zone:     "Europe/Moscow",
+			utc:      time.Date(2025, time.October, 8, 18, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "legacy with IANA zone",
+			input:    "2025-10-08 21:30:00[Europe/Moscow]",
+			expected: "2025-10-08T21:30:00+03:00[Europe/Moscow]",
+			zone:     "Europe/Moscow",
+			utc:      time.Date(2025, time.October, 8, 18, 30, 0, 0, time.UTC),
+		},
+		{
+			name:     "offset and matching IANA zone",
+			input:    "2025-10-08T21:30:00+03:00[Europe/Moscow]",
+			expected: "2025-10-08T21:30:00+03:00[Europe/Moscow]",
+			zone:     "Europe/Moscow",
+			utc:      time.Date(2025, time.October, 8, 18, 30, 0, 0, time.UTC),
+		},
+		{
+			name:      "offset doesn't match IANA zone",
+			input:     "2025-10-08T21:30:00+01:00[Europe/Moscow]",
+			expectErr: true,
+		},
+		{
+			name:      "unknown zone",
+			input:     "2025-10-08T21:30:00[Mars/Olympus]",
+			expectErr: true,
+		},
+		{
+			name:      "local zone",
+			input:     "2025-10-08T21:30:00[Local]",
+			expectErr: true,
+		},
+		{
+			name:      "unclosed zone",
+			input:     "2025-10-08T21:30:00Europe/Moscow]",
+			expectErr: true,
+		},
+		{
+			name:      "garbage",
+			input:     "tomorrow",
+			expectErr: true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			result, err := types.NewDateTimeFromString(tt.input)
+			if tt.expectErr {
+				if err == nil {
+					t.Errorf("Expected error, got '%s'", result.String())
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+
+			if result.String() != tt.expected {
+				t.Errorf("Expected '%s', got '%s'", tt.expected, result.String())
+			}
+			if result.Zone() != tt.zone {
+				t.Errorf("Expected zone '%s', got '%s'", tt.zone, result.Zone())
+			}
+			if !result.Value().Equal(tt.utc) {
+				t.Errorf("Expected '%v', got '%v'", tt.utc, result.Value().UTC())
+			}
+		})
+	}
+}
+
+func TestNewDateTimeInZone(t *testing.T) {
+	// as read from a TIMESTAMP WITH TIME ZONE column
+	stored := time.Date(2025, time.October, 8, 18, 30, 0, 0, time.UTC)
+
+	for _, zone := range []string{"", "+03:00", "Europe/Moscow"} {
+		result, err := types.NewDateTimeInZone(stored, zone)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		if result.Zone() != zone {
+			t.Errorf("Expected zone '%s', got '%s'", zone, result.Zone())
+		}
+		if !result.Value().Equal(stored) {
+			t.Errorf("Expected '%v', got '%v'", stored, result.Value())
+		}
+	}
+
+	if _, err := types.NewDateTimeInZone(stored, "Mars/Olympus"); err == nil {
+		t.Error("Expected error for unknown zone")
+	}
+}
+
+func TestDateTime_JSONRoundTrip(t *testing.T) {
+	for _, input := range []string{"2025-10-08 21:30:00", "2025-10-08T21:30:00+03:00", "2025-10-08T21:30:00[Europe/Moscow]"} {
+		original, err := types.NewDateTimeFromString(input)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		data, err := json.Marshal(original)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		var decoded types.DateTime
+		if err = json.Unmarshal(data, &decoded); err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+
+		if decoded.String() != original.String() || !decoded.Value().Equal(original.Value()) {
+			t.Errorf("Expected '%s', got '%s'", original.String(), decoded.String())
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package tests
 
 import (
+	"encoding/json"
 	"github.com/chempik1234/L3.1-wb-tech-school/delayed_notifier/pkg/types"
 	"github.com/google/uuid"
 	"testing"
@@ -155,3 +156,27 @@ func TestUUID_Equality(t *testing.T) {
 		t.Error("UUID values should be equal for same input")
 	}
 }
+
+func TestUUIDJSONRoundTrip(t *testing.T) {
+	id := types.GenerateUUID()
+
+	data, err := json.Marshal(&id)
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if string(data) != `"`+id.String()+`"` {
+		t.Errorf("Expected '%s', got '%s'", `"`+id.String()+`"`, string(data))
+	}
+
+	var restored types.UUID
+	if err = json.Unmarshal(data, &restored); err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if restored != id {
+		t.Errorf("Expected '%s', got '%s'", id.String(), restored.String())
+	}
+
+	if err = json.Unmarshal([]byte(`"not-a-uuid"`), &restored); err == nil {
+		t.Errorf("Expected an error")
+	}
+}